@@ -0,0 +1,108 @@
+package dap
+
+import (
+	"fmt"
+	"path/filepath"
+	"sapelkinav/javadap/jdwp/debugger"
+)
+
+func (s *Session) onSetBreakpoints(req *Request) (interface{}, error) {
+	a := SetBreakpointsArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.connection(); err != nil {
+		return nil, err
+	}
+	reqs := make([]debugger.SourceBreakpoint, len(a.Lines))
+	for i, l := range a.Lines {
+		reqs[i] = debugger.SourceBreakpoint{Line: s.toJavaLine(l)}
+	}
+	if a.Breakpoints != nil {
+		reqs = make([]debugger.SourceBreakpoint, len(a.Breakpoints))
+		for i, bp := range a.Breakpoints {
+			reqs[i] = debugger.SourceBreakpoint{
+				Line:         s.toJavaLine(bp.Line),
+				Condition:    bp.Condition,
+				HitCondition: bp.HitCondition,
+				LogMessage:   bp.LogMessage,
+			}
+		}
+	}
+
+	bps, err := s.breakpoints.Set(s.ctx, a.Source.Path, reqs)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Breakpoint, len(bps))
+	for i, bp := range bps {
+		out[i] = s.breakpoint(bp)
+	}
+	return SetBreakpointsResponseBody{Breakpoints: out}, nil
+}
+
+// breakpoint converts the debugger breakpoint to its DAP representation.
+func (s *Session) breakpoint(bp debugger.Breakpoint) Breakpoint {
+	return Breakpoint{
+		ID:       bp.ID,
+		Verified: bp.Verified,
+		Message:  bp.Message,
+		Source:   &Source{Name: filepath.Base(bp.Source), Path: bp.Source},
+		Line:     s.fromJavaLine(bp.Line),
+	}
+}
+
+// forwardBreakpoints sends stopped events for breakpoint hits, output events
+// for logpoints, and breakpoint events for deferred breakpoints that become
+// verified.
+func (s *Session) forwardBreakpoints(b *debugger.Breakpoints) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case hit := <-b.Hits():
+			s.stopStepping()
+			description := ""
+			if hit.ConditionError != nil {
+				description = fmt.Sprintf("Failed to evaluate condition '%v': %v",
+					hit.Breakpoint.Condition, hit.ConditionError)
+				s.event("output", OutputEventBody{Category: "console", Output: description + "\n"})
+			}
+			s.event("stopped", StoppedEventBody{
+				Reason:            "breakpoint",
+				Description:       description,
+				ThreadID:          int(hit.Thread),
+				AllThreadsStopped: true,
+				HitBreakpointIDs:  []int{hit.Breakpoint.ID},
+			})
+		case l := <-b.Logs():
+			s.event("output", OutputEventBody{
+				Category: "console",
+				Output:   l.Message + "\n",
+				Source:   &Source{Name: filepath.Base(l.Breakpoint.Source), Path: l.Breakpoint.Source},
+				Line:     s.fromJavaLine(l.Breakpoint.Line),
+			})
+		case bp := <-b.Changed():
+			s.event("breakpoint", BreakpointEventBody{
+				Reason:     "changed",
+				Breakpoint: s.breakpoint(bp),
+			})
+		}
+	}
+}
+
+// toJavaLine converts a client line number to a 1-based Java line number.
+func (s *Session) toJavaLine(line int) int {
+	if s.client.LinesStartAt1 != nil && !*s.client.LinesStartAt1 {
+		return line + 1
+	}
+	return line
+}
+
+// fromJavaLine converts a 1-based Java line number to a client line number.
+func (s *Session) fromJavaLine(line int) int {
+	if s.client.LinesStartAt1 != nil && !*s.client.LinesStartAt1 {
+		return line - 1
+	}
+	return line
+}
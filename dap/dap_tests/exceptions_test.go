@@ -0,0 +1,42 @@
+package dap_tests_test
+
+import (
+	"sapelkinav/javadap/dap"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestExceptionInfoAfterContinue(t *testing.T) {
+	c := serve(t)
+	vm := fakevm.New()
+	throwable := vm.AddClass("java.lang.Throwable", vm.Class("java.lang.Object"))
+	main := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	thread := vm.AddThread("main")
+	vm.Push(thread, main.AddMethod("run", "()V", jdwpclient.ModPublic, 10), 10)
+
+	c.request("initialize", dap.InitializeRequestArguments{AdapterID: "java"})
+	c.attach(vm)
+	args := dap.SetExceptionBreakpointsArguments{Filters: []string{"uncaught"}}
+	if res, _ := c.request("setExceptionBreakpoints", args); !res.Success {
+		t.Fatalf("setExceptionBreakpoints failed: %v", res.Message)
+	}
+	if _, err := vm.Throw(thread, vm.NewObject(throwable), nil); err != nil {
+		t.Fatalf("Throw failed: %v", err)
+	}
+	if ev := c.next(); ev.Event != "stopped" {
+		t.Fatalf("Got %+v after the exception, want the stopped event", ev)
+	}
+	info := dap.ExceptionInfoArguments{ThreadID: int(thread.ID)}
+	if res, _ := c.request("exceptionInfo", info); !res.Success {
+		t.Fatalf("exceptionInfo failed: %v", res.Message)
+	}
+
+	// The thread is no longer stopped at the exception once resumed.
+	if res, _ := c.request("continue", dap.ContinueArguments{ThreadID: int(thread.ID)}); !res.Success {
+		t.Fatalf("continue failed: %v", res.Message)
+	}
+	if res, _ := c.request("exceptionInfo", info); res.Success {
+		t.Errorf("exceptionInfo after continue returned %+v, want an error", res)
+	}
+}
@@ -0,0 +1,189 @@
+package dap_tests_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sapelkinav/javadap/dap"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"testing"
+	"time"
+)
+
+// message is any message sent by the adapter.
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client is a DAP client of a session served over pipes.
+type client struct {
+	t        *testing.T
+	w        io.Writer
+	seq      int
+	messages chan message
+	served   chan error // Receives the result of Serve.
+}
+
+// serve starts a session served by dap.Serve, returning its client.
+func serve(t *testing.T) *client {
+	ctx, cancel := context.WithCancel(context.Background())
+	requests, requestsW := io.Pipe()
+	messagesR, messagesW := io.Pipe()
+	c := &client{t: t, w: requestsW, messages: make(chan message, 64), served: make(chan error, 1)}
+	go func() {
+		c.served <- dap.Serve(ctx, requests, messagesW)
+		messagesW.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		r := bufio.NewReader(messagesR)
+		for {
+			data, err := dap.ReadMessage(r)
+			if err != nil {
+				return
+			}
+			msg := message{}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Errorf("Adapter sent invalid JSON %q: %v", data, err)
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		requestsW.Close()
+		messagesR.Close()
+	})
+	return c
+}
+
+// request sends the request and returns its response. The events sent
+// before the response are returned too.
+func (c *client) request(command string, arguments interface{}) (message, []message) {
+	c.seq++
+	req := dap.Request{ProtocolMessage: dap.ProtocolMessage{Seq: c.seq, Type: "request"}, Command: command}
+	if arguments != nil {
+		data, err := json.Marshal(arguments)
+		if err != nil {
+			c.t.Fatalf("Couldn't encode the arguments of %v: %v", command, err)
+		}
+		req.Arguments = data
+	}
+	if err := dap.WriteMessage(c.w, req); err != nil {
+		c.t.Fatalf("Couldn't send %v: %v", command, err)
+	}
+	events := []message{}
+	for {
+		msg := c.next()
+		if msg.Type == "response" && msg.RequestSeq == c.seq {
+			if msg.Command != command {
+				c.t.Errorf("Response to %v has command %v", command, msg.Command)
+			}
+			return msg, events
+		}
+		events = append(events, msg)
+	}
+}
+
+// next returns the next message sent by the adapter.
+func (c *client) next() message {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("Adapter closed the stream")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("Timed out waiting for a message from the adapter")
+	}
+	return message{}
+}
+
+// attach attaches the session to the VM, served on a local port.
+func (c *client) attach(vm *fakevm.VM) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		c.t.Fatalf("Listen failed: %v", err)
+	}
+	c.t.Cleanup(func() { listener.Close() })
+	go func() {
+		socket, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		vm.Serve(socket)
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+	res, _ := c.request("attach", dap.AttachRequestArguments{HostName: "localhost", Port: port})
+	if !res.Success {
+		c.t.Fatalf("attach failed: %v", res.Message)
+	}
+	if ev := c.next(); ev.Event != "initialized" {
+		c.t.Fatalf("Got %+v after attach, want the initialized event", ev)
+	}
+}
+
+func TestServe(t *testing.T) {
+	c := serve(t)
+	vm := fakevm.New()
+	vm.AddThread("main")
+
+	res, _ := c.request("initialize", dap.InitializeRequestArguments{AdapterID: "java"})
+	capabilities := dap.Capabilities{}
+	if err := json.Unmarshal(res.Body, &capabilities); !res.Success || err != nil {
+		t.Fatalf("initialize returned %+v, %v", res, err)
+	}
+	if !capabilities.SupportsConfigurationDoneRequest {
+		t.Errorf("initialize returned %+v, want configurationDone support", capabilities)
+	}
+	if res.Seq != 1 {
+		t.Errorf("First response has seq %v, want 1", res.Seq)
+	}
+
+	res, _ = c.request("frobnicate", nil)
+	if res.Success || res.Message != "Unsupported command 'frobnicate'" {
+		t.Errorf("Unknown command returned %+v, want an error response", res)
+	}
+	if res, _ = c.request("threads", nil); res.Success {
+		t.Errorf("threads before attaching returned %+v, want an error response", res)
+	}
+
+	c.attach(vm)
+	res, _ = c.request("threads", nil)
+	threads := dap.ThreadsResponseBody{}
+	if err := json.Unmarshal(res.Body, &threads); !res.Success || err != nil || len(threads.Threads) != 1 || threads.Threads[0].Name != "main" {
+		t.Errorf("threads returned %+v, want the main thread", res)
+	}
+
+	// The VM closes the connection once disposed, which may send the
+	// terminated event before the response.
+	terminate := false
+	res, events := c.request("disconnect", dap.DisconnectArguments{TerminateDebuggee: &terminate})
+	if !res.Success {
+		t.Fatalf("disconnect failed: %v", res.Message)
+	}
+	if len(events) == 0 {
+		events = append(events, c.next())
+	}
+	if events[0].Event != "terminated" {
+		t.Errorf("Got %+v after disconnect, want the terminated event", events[0])
+	}
+	select {
+	case err := <-c.served:
+		if err != nil {
+			t.Errorf("Serve returned %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve did not return after disconnect")
+	}
+}
@@ -0,0 +1,74 @@
+package dap_tests_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sapelkinav/javadap/dap"
+	"strings"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	buf := bytes.Buffer{}
+	msgs := []dap.Request{
+		{ProtocolMessage: dap.ProtocolMessage{Seq: 1, Type: "request"}, Command: "initialize"},
+		{ProtocolMessage: dap.ProtocolMessage{Seq: 2, Type: "request"}, Command: "threads", Arguments: json.RawMessage(`{"x":"é"}`)},
+	}
+	for _, msg := range msgs {
+		if err := dap.WriteMessage(&buf, msg); err != nil {
+			t.Fatalf("WriteMessage failed: %v", err)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "Content-Length: ") {
+		t.Errorf("WriteMessage wrote %q, want a Content-Length header", buf.String())
+	}
+	r := bufio.NewReader(&buf)
+	for _, want := range msgs {
+		data, err := dap.ReadMessage(r)
+		if err != nil {
+			t.Fatalf("ReadMessage failed: %v", err)
+		}
+		got := dap.Request{}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("ReadMessage returned invalid JSON %q: %v", data, err)
+		}
+		if got.Seq != want.Seq || got.Command != want.Command || string(got.Arguments) != string(want.Arguments) {
+			t.Errorf("ReadMessage returned %+v, want %+v", got, want)
+		}
+	}
+	if _, err := dap.ReadMessage(r); err != io.EOF {
+		t.Errorf("ReadMessage at the end of the stream returned %v, want EOF", err)
+	}
+}
+
+func TestReadMessageHeaders(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		input string
+		body  string // Expected body, if the message is valid.
+	}{
+		{"other headers", "Content-Type: application/json\r\ncontent-length: 2\r\n\r\n{}", "{}"},
+		{"bare newlines", "Content-Length: 2\n\n{}", "{}"},
+		{"missing content length", "Content-Type: application/json\r\n\r\n{}", ""},
+		{"invalid content length", "Content-Length: two\r\n\r\n{}", ""},
+		{"malformed header", "Content-Length 2\r\n\r\n{}", ""},
+		{"truncated body", "Content-Length: 10\r\n\r\n{}", ""},
+		{"negative content length", "Content-Length: -2\r\n\r\n{}", ""},
+		{"oversized content length", "Content-Length: 99999999999\r\n\r\n{}", ""},
+	} {
+		data, err := dap.ReadMessage(bufio.NewReader(strings.NewReader(test.input)))
+		switch {
+		case test.body != "" && (err != nil || string(data) != test.body):
+			t.Errorf("%v: ReadMessage returned %q, %v, want %q", test.name, data, err, test.body)
+		case test.body == "" && err == nil:
+			t.Errorf("%v: ReadMessage returned %q, want an error", test.name, data)
+		}
+	}
+	_, err := dap.ReadMessage(bufio.NewReader(strings.NewReader("Content-Length: 10\r\n\r\n{}")))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadMessage of a truncated body returned %v, want ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,90 @@
+package dap_tests_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"sapelkinav/javadap/dap"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestDataBreakpointInfoOfVariable(t *testing.T) {
+	c := serve(t)
+	vm := fakevm.New()
+	base := vm.AddClass("com.example.Base", vm.Class("java.lang.Object"))
+	base.AddField("retries", "I", jdwpclient.ModProtected)
+	order := vm.AddClass("com.example.Order", base)
+	order.AddField("status", "I", jdwpclient.ModPrivate)
+	order.AddField("COUNT", "I", jdwpclient.ModStatic)
+	run := order.AddMethod("run", "()V", jdwpclient.ModPublic, 10)
+	thread := vm.AddThread("main")
+	this := vm.NewObject(order)
+	vm.Push(thread, run, 10).This = this
+
+	c.request("initialize", dap.InitializeRequestArguments{AdapterID: "java"})
+	c.attach(vm)
+	if res, _ := c.request("pause", dap.PauseArguments{ThreadID: int(thread.ID)}); !res.Success {
+		t.Fatalf("pause failed: %v", res.Message)
+	}
+	res, _ := c.request("stackTrace", dap.StackTraceArguments{ThreadID: int(thread.ID)})
+	trace := dap.StackTraceResponseBody{}
+	if err := json.Unmarshal(res.Body, &trace); !res.Success || err != nil || len(trace.StackFrames) != 1 {
+		t.Fatalf("stackTrace returned %+v, %v, want one frame", res, err)
+	}
+	res, _ = c.request("scopes", dap.ScopesArguments{FrameID: trace.StackFrames[0].ID})
+	scopes := dap.ScopesResponseBody{}
+	if err := json.Unmarshal(res.Body, &scopes); !res.Success || err != nil {
+		t.Fatalf("scopes returned %+v, %v", res, err)
+	}
+	refs := map[string]int{}
+	for _, scope := range scopes.Scopes {
+		refs[scope.Name] = scope.VariablesReference
+	}
+
+	instance := fmt.Sprintf("@%d", this.ID)
+	for _, test := range []struct {
+		scope, name string
+		id          string // Expected data ID, or empty for none.
+	}{
+		{"This", "status", "com.example.Order#status" + instance},
+		{"This", "retries", "com.example.Base#retries" + instance},
+		{"Static", "COUNT", "com.example.Order#COUNT"},
+		{"This", "missing", ""},
+		{"Locals", "status", ""},
+	} {
+		args := dap.DataBreakpointInfoArguments{VariablesReference: refs[test.scope], Name: test.name}
+		res, _ := c.request("dataBreakpointInfo", args)
+		info := dap.DataBreakpointInfoResponseBody{}
+		if err := json.Unmarshal(res.Body, &info); !res.Success || err != nil {
+			t.Fatalf("dataBreakpointInfo of %v %v returned %+v, %v", test.scope, test.name, res, err)
+		}
+		switch {
+		case test.id == "" && info.DataID != nil:
+			t.Errorf("dataBreakpointInfo of %v %v returned data ID %v, want none", test.scope, test.name, *info.DataID)
+		case test.id != "" && (info.DataID == nil || *info.DataID != test.id):
+			t.Errorf("dataBreakpointInfo of %v %v returned %+v, want data ID %v", test.scope, test.name, info, test.id)
+		}
+	}
+
+	// The data ID of an instance field sets a watchpoint on the object.
+	id := "com.example.Order#status" + instance
+	res, _ = c.request("setDataBreakpoints", dap.SetDataBreakpointsArguments{Breakpoints: []dap.DataBreakpoint{{DataID: id}}})
+	set := dap.SetDataBreakpointsResponseBody{}
+	if err := json.Unmarshal(res.Body, &set); !res.Success || err != nil || len(set.Breakpoints) != 1 || !set.Breakpoints[0].Verified {
+		t.Errorf("setDataBreakpoints of %v returned %+v, %v, want a verified breakpoint", id, res, err)
+	}
+	modifiers := []jdwpclient.EventModifier{}
+	for _, req := range vm.Requests(jdwpclient.FieldModification) {
+		modifiers = append(modifiers, req.Modifiers...)
+	}
+	found := false
+	for _, m := range modifiers {
+		if m == jdwpclient.InstanceOnlyEventModifier(this.ID) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("FieldModification requests have modifiers %+v, want InstanceOnly %v", modifiers, this.ID)
+	}
+}
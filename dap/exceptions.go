@@ -0,0 +1,158 @@
+package dap
+
+import (
+	"fmt"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+)
+
+// exceptionFilters are the exception filters offered to the client. The
+// condition of a filter is a comma separated list of exception classes.
+var exceptionFilters = []ExceptionBreakpointsFilter{
+	{
+		Filter:               "caught",
+		Label:                "Caught Exceptions",
+		SupportsCondition:    true,
+		ConditionDescription: "Comma separated exception classes, e.g. java.io.IOException",
+	},
+	{
+		Filter:               "uncaught",
+		Label:                "Uncaught Exceptions",
+		Default:              true,
+		SupportsCondition:    true,
+		ConditionDescription: "Comma separated exception classes, e.g. java.io.IOException",
+	},
+}
+
+func (s *Session) onSetExceptionBreakpoints(req *Request) (interface{}, error) {
+	a := SetExceptionBreakpointsArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.connection(); err != nil {
+		return nil, err
+	}
+	options := a.FilterOptions
+	for _, f := range a.Filters {
+		options = append(options, ExceptionFilterOptions{FilterID: f})
+	}
+
+	bps := []debugger.ExceptionBreakpoint{}
+	for _, o := range options {
+		bp := debugger.ExceptionBreakpoint{}
+		switch o.FilterID {
+		case "caught":
+			bp.Caught = true
+		case "uncaught":
+			bp.Uncaught = true
+		default:
+			return nil, fmt.Errorf("Unknown exception filter '%v'", o.FilterID)
+		}
+		if strings.TrimSpace(o.Condition) == "" {
+			bps = append(bps, bp)
+			continue
+		}
+		for _, class := range strings.Split(o.Condition, ",") {
+			bp.Class = strings.TrimSpace(class)
+			bps = append(bps, bp)
+		}
+	}
+
+	bps, err := s.exceptions.Set(s.ctx, bps)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Breakpoint, len(bps))
+	for i, bp := range bps {
+		out[i] = exceptionBreakpoint(bp)
+	}
+	return SetExceptionBreakpointsResponseBody{Breakpoints: out}, nil
+}
+
+func (s *Session) onExceptionInfo(req *Request) (interface{}, error) {
+	a := ExceptionInfoArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	s.exceptionLock.Lock()
+	hit, ok := s.lastException[jdwpclient.ThreadID(a.ThreadID)]
+	s.exceptionLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Thread %v is not stopped at an exception", a.ThreadID)
+	}
+
+	d := hit.Details
+	breakMode := "always"
+	if d.CatchLocation == nil {
+		breakMode = "unhandled"
+	}
+	typeName := d.Type
+	if i := strings.LastIndexByte(typeName, '.'); i >= 0 {
+		typeName = typeName[i+1:]
+	}
+	trace := make([]string, len(d.StackTrace))
+	for i, element := range d.StackTrace {
+		trace[i] = "\tat " + element
+	}
+	return ExceptionInfoResponseBody{
+		ExceptionID: d.Type,
+		Description: d.Message,
+		BreakMode:   breakMode,
+		Details: &ExceptionDetails{
+			Message:      d.Message,
+			TypeName:     typeName,
+			FullTypeName: d.Type,
+			StackTrace:   strings.Join(trace, "\n"),
+		},
+	}, nil
+}
+
+// forgetExceptions forgets the exceptions that the thread, or all threads if
+// thread is 0, stopped at, once they are resumed.
+func (s *Session) forgetExceptions(thread jdwpclient.ThreadID) {
+	s.exceptionLock.Lock()
+	defer s.exceptionLock.Unlock()
+	if thread == 0 {
+		s.lastException = nil
+		return
+	}
+	delete(s.lastException, thread)
+}
+
+// exceptionBreakpoint converts the debugger exception breakpoint to its DAP
+// representation.
+func exceptionBreakpoint(bp debugger.ExceptionBreakpoint) Breakpoint {
+	return Breakpoint{ID: bp.ID, Verified: bp.Verified, Message: bp.Message}
+}
+
+// forwardExceptions sends stopped events for exception breakpoint hits, and
+// breakpoint events for deferred exception breakpoints that become verified.
+func (s *Session) forwardExceptions(e *debugger.Exceptions) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case hit := <-e.Hits():
+			s.stopStepping()
+			s.exceptionLock.Lock()
+			if s.lastException == nil {
+				s.lastException = map[jdwpclient.ThreadID]debugger.ExceptionHit{}
+			}
+			s.lastException[hit.Thread] = hit
+			s.exceptionLock.Unlock()
+			s.event("stopped", StoppedEventBody{
+				Reason:            "exception",
+				Description:       hit.Details.Type,
+				ThreadID:          int(hit.Thread),
+				AllThreadsStopped: true,
+				HitBreakpointIDs:  []int{hit.Breakpoint.ID},
+			})
+		case bp := <-e.Changed():
+			s.event("breakpoint", BreakpointEventBody{
+				Reason:     "changed",
+				Breakpoint: exceptionBreakpoint(bp),
+			})
+		}
+	}
+}
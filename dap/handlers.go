@@ -0,0 +1,322 @@
+package dap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdbg/variables"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sapelkinav/javadap/launcher"
+	"time"
+)
+
+const dialAttempts = 10
+
+func (s *Session) onInitialize(req *Request) (interface{}, error) {
+	if err := args(req, &s.client); err != nil {
+		return nil, err
+	}
+	return Capabilities{
+		SupportsConfigurationDoneRequest:  true,
+		SupportsSteppingGranularity:       true,
+		SupportsExceptionInfoRequest:      true,
+		SupportsExceptionFilterOptions:    true,
+		SupportsDataBreakpoints:           true,
+		SupportsConditionalBreakpoints:    true,
+		SupportsHitConditionalBreakpoints: true,
+		SupportsLogPoints:                 true,
+		SupportsSetVariable:               true,
+		ExceptionBreakpointFilters:        exceptionFilters,
+	}, nil
+}
+
+func (s *Session) onLaunch(req *Request) (interface{}, error) {
+	a := LaunchRequestArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	config := launcher.Config{
+		Java:       a.JavaExec,
+		Jar:        a.Jar,
+		MainClass:  a.MainClass,
+		ClassPath:  a.ClassPaths,
+		Module:     a.Module,
+		ModulePath: a.ModulePaths,
+		VMArgs:     a.VMArgs,
+		Args:       a.Args,
+		Env:        a.Env,
+		Cwd:        a.Cwd,
+		Port:       a.Port,
+		Suspend:    a.Suspend == nil || *a.Suspend,
+	}
+	if a.Listen {
+		return nil, s.launchListening(config)
+	}
+	l := launcher.New(config)
+	output := l.Output()
+	if err := l.Start(); err != nil {
+		return nil, err
+	}
+	s.launcher = l
+	go s.forwardOutput(output)
+
+	socket, err := l.Connect(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := jdwpclient.Open(s.ctx, socket)
+	if err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("Failed to open JDWP connection: %w", err)
+	}
+	if err := s.open(conn); err != nil {
+		return nil, err
+	}
+	s.after(func() { s.event("initialized", nil) })
+	return nil, nil
+}
+
+// launchListening launches the program with a JDWP agent that connects to the
+// adapter, and waits for it to connect until the program exits.
+func (s *Session) launchListening(config launcher.Config) error {
+	listener, err := jdwpclient.Listen("localhost:0")
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	config.DebuggerAddress = listener.Addr()
+	l := launcher.New(config)
+	output := l.Output()
+	if err := l.Start(); err != nil {
+		return err
+	}
+	s.launcher = l
+	go s.forwardOutput(output)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.Exited():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	conn, err := listener.Accept(ctx, 0)
+	if err != nil {
+		return err
+	}
+	if err := s.open(conn); err != nil {
+		return err
+	}
+	s.after(func() { s.event("initialized", nil) })
+	return nil
+}
+
+// forwardOutput sends the output of the launched program to the client, until
+// the program exits.
+func (s *Session) forwardOutput(output <-chan launcher.Line) {
+	for l := range output {
+		s.event("output", OutputEventBody{Category: l.Stream.String(), Output: l.Text + "\n"})
+	}
+}
+
+func (s *Session) onAttach(req *Request) (interface{}, error) {
+	a := AttachRequestArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if a.HostName == "" {
+		a.HostName = "localhost"
+	}
+	if a.Port == 0 {
+		return nil, fmt.Errorf("Attach requires a 'port'")
+	}
+	timeout := time.Duration(a.Timeout) * time.Millisecond
+	if err := s.connect(a.HostName, a.Port, timeout); err != nil {
+		return nil, err
+	}
+	s.after(func() { s.event("initialized", nil) })
+	return nil, nil
+}
+
+// connect dials the JDWP agent at host:port and opens the connection.
+func (s *Session) connect(host string, port int, timeout time.Duration) error {
+	if s.conn != nil {
+		return fmt.Errorf("Session is already connected to a VM")
+	}
+	addr := net.JoinHostPort(host, fmt.Sprint(port))
+
+	var conn *jdwpclient.Connection
+	var err error
+	for i := 0; i < dialAttempts; i++ {
+		if conn, err = jdwpclient.Attach(s.ctx, addr, timeout); err == nil {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if conn == nil {
+		return err
+	}
+	return s.open(conn)
+}
+
+// open starts serving the events of the JDWP connection.
+func (s *Session) open(conn *jdwpclient.Connection) error {
+	if s.conn != nil {
+		conn.Close()
+		return fmt.Errorf("Session is already connected to a VM")
+	}
+	s.conn = conn
+	s.events = debugger.NewDispatcher(s.ctx, conn)
+	s.events.Unhandled(s.onUnhandledEvent)
+	// DAP breakpoint IDs are shared by all kinds of breakpoints.
+	ids := debugger.NewIDs()
+	s.breakpoints = debugger.NewBreakpoints(s.events, ids)
+	s.stepper = debugger.NewStepper(s.events, debugger.DefaultStepExcludes...)
+	s.exceptions = debugger.NewExceptions(s.events, ids)
+	s.variables = variables.NewStore(conn)
+	go s.forwardBreakpoints(s.breakpoints)
+	s.watchpoints = debugger.NewWatchpoints(s.events, ids)
+	go s.forwardExceptions(s.exceptions)
+	go s.forwardWatchpoints(s.watchpoints)
+	go func() {
+		// The VM may go away without a VMDeath event, such as when the
+		// socket is dropped.
+		select {
+		case <-conn.Closed():
+			s.terminated()
+		case <-s.ctx.Done():
+		}
+	}()
+	return nil
+}
+
+func (s *Session) onConfigurationDone(req *Request) (interface{}, error) {
+	conn, err := s.connection()
+	if err != nil {
+		return nil, err
+	}
+	// The VM is started suspended, so that the client can set up its
+	// configuration before any code runs.
+	return nil, conn.ResumeAll(s.ctx)
+}
+
+func (s *Session) onThreads(req *Request) (interface{}, error) {
+	conn, err := s.connection()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := conn.GetAllThreads(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	threads := make([]Thread, 0, len(ids))
+	for _, id := range ids {
+		name, err := conn.GetThreadName(s.ctx, id)
+		if err != nil {
+			// The thread may have died since GetAllThreads.
+			continue
+		}
+		threads = append(threads, Thread{ID: int(id), Name: name})
+	}
+	return ThreadsResponseBody{Threads: threads}, nil
+}
+
+func (s *Session) onContinue(req *Request) (interface{}, error) {
+	a := ContinueArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	conn, err := s.connection()
+	if err != nil {
+		return nil, err
+	}
+	s.stopStepping()
+	s.variables.Reset()
+	if a.SingleThread && a.ThreadID != 0 {
+		s.forgetExceptions(jdwpclient.ThreadID(a.ThreadID))
+		if err := conn.Resume(s.ctx, jdwpclient.ThreadID(a.ThreadID)); err != nil {
+			return nil, err
+		}
+		return ContinueResponseBody{AllThreadsContinued: false}, nil
+	}
+	s.forgetExceptions(0)
+	if err := conn.ResumeAll(s.ctx); err != nil {
+		return nil, err
+	}
+	return ContinueResponseBody{AllThreadsContinued: true}, nil
+}
+
+func (s *Session) onPause(req *Request) (interface{}, error) {
+	a := PauseArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	conn, err := s.connection()
+	if err != nil {
+		return nil, err
+	}
+	s.stopStepping()
+	if err := conn.SuspendAll(s.ctx); err != nil {
+		return nil, err
+	}
+	s.after(func() {
+		s.event("stopped", StoppedEventBody{
+			Reason:            "pause",
+			ThreadID:          a.ThreadID,
+			AllThreadsStopped: true,
+		})
+	})
+	return nil, nil
+}
+
+func (s *Session) onDisconnect(req *Request) (interface{}, error) {
+	a := DisconnectArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	// Launched VMs are terminated by default, attached VMs are left running.
+	terminate := s.launcher != nil
+	if a.TerminateDebuggee != nil {
+		terminate = *a.TerminateDebuggee
+	}
+	if s.conn != nil {
+		var err error
+		if terminate {
+			err = s.conn.Exit(s.ctx, 0)
+		} else {
+			err = s.conn.Dispose(s.ctx)
+		}
+		if err != nil {
+			log.Warn().Err(err).Bool("terminate", terminate).Msg("Couldn't release the VM")
+		}
+	}
+	s.done = true
+	s.after(s.terminated)
+	return nil, nil
+}
+
+// onUnhandledEvent handles the events that are not raised by a request, such
+// as the VMDeath event.
+func (s *Session) onUnhandledEvent(ctx context.Context, event jdwpclient.Event) {
+	switch event.(type) {
+	case *jdwpclient.EventVMDeath:
+		s.terminated()
+	}
+}
+
+// terminated sends the terminated event to the client, once per session.
+func (s *Session) terminated() {
+	s.terminatedOnce.Do(func() { s.event("terminated", TerminatedEventBody{}) })
+}
+
+// connection returns the JDWP connection, or an error if the session has not
+// yet launched or attached to a VM.
+func (s *Session) connection() (*jdwpclient.Connection, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("Not connected to a VM")
+	}
+	return s.conn, nil
+}
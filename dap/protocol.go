@@ -0,0 +1,358 @@
+package dap
+
+import "encoding/json"
+
+// ProtocolMessage is the base of all messages sent between the client and
+// the debug adapter.
+type ProtocolMessage struct {
+	Seq  int    `json:"seq"`
+	Type string `json:"type"` // "request", "response" or "event"
+}
+
+// Request is a client or debug adapter initiated request.
+type Request struct {
+	ProtocolMessage
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Response is the reply to a Request.
+type Response struct {
+	ProtocolMessage
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+// Event is a debug adapter initiated event.
+type Event struct {
+	ProtocolMessage
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// Capabilities describes the optional features supported by the adapter.
+type Capabilities struct {
+	SupportsConfigurationDoneRequest  bool `json:"supportsConfigurationDoneRequest,omitempty"`
+	SupportsTerminateRequest          bool `json:"supportsTerminateRequest,omitempty"`
+	SupportsSteppingGranularity       bool `json:"supportsSteppingGranularity,omitempty"`
+	SupportsExceptionInfoRequest      bool `json:"supportsExceptionInfoRequest,omitempty"`
+	SupportsExceptionFilterOptions    bool `json:"supportsExceptionFilterOptions,omitempty"`
+	SupportsDataBreakpoints           bool `json:"supportsDataBreakpoints,omitempty"`
+	SupportsConditionalBreakpoints    bool `json:"supportsConditionalBreakpoints,omitempty"`
+	SupportsHitConditionalBreakpoints bool `json:"supportsHitConditionalBreakpoints,omitempty"`
+	SupportsLogPoints                 bool `json:"supportsLogPoints,omitempty"`
+	SupportsSetVariable               bool `json:"supportsSetVariable,omitempty"`
+
+	ExceptionBreakpointFilters []ExceptionBreakpointsFilter `json:"exceptionBreakpointFilters,omitempty"`
+}
+
+// InitializeRequestArguments holds the arguments of the initialize request.
+type InitializeRequestArguments struct {
+	ClientID        string `json:"clientID,omitempty"`
+	ClientName      string `json:"clientName,omitempty"`
+	AdapterID       string `json:"adapterID"`
+	LinesStartAt1   *bool  `json:"linesStartAt1,omitempty"`
+	ColumnsStartAt1 *bool  `json:"columnsStartAt1,omitempty"`
+	PathFormat      string `json:"pathFormat,omitempty"`
+}
+
+// LaunchRequestArguments holds the arguments of the launch request.
+// Exactly one of Jar, MainClass and Module selects the program to run.
+type LaunchRequestArguments struct {
+	NoDebug     bool              `json:"noDebug,omitempty"`
+	Jar         string            `json:"jar,omitempty"`         // Path to the jar to run.
+	MainClass   string            `json:"mainClass,omitempty"`   // Main class to run from the classPaths.
+	ClassPaths  []string          `json:"classPaths,omitempty"`  // Entries of the classpath.
+	Module      string            `json:"module,omitempty"`      // Module to run, as "module" or "module/class".
+	ModulePaths []string          `json:"modulePaths,omitempty"` // Entries of the module path.
+	VMArgs      []string          `json:"vmArgs,omitempty"`      // JVM options.
+	Args        []string          `json:"args,omitempty"`        // Program arguments.
+	Env         map[string]string `json:"env,omitempty"`         // Added to the environment of the adapter.
+	Cwd         string            `json:"cwd,omitempty"`         // Working directory of the program.
+	JavaExec    string            `json:"javaExec,omitempty"`    // Path to the java executable.
+	Port        int               `json:"port,omitempty"`        // JDWP port, chosen by the agent by default.
+	Suspend     *bool             `json:"suspend,omitempty"`     // Suspend the VM until attached, defaults to true.
+	Listen      bool              `json:"listen,omitempty"`      // Listen for the VM to connect (server=n) instead of attaching to it.
+}
+
+// AttachRequestArguments holds the arguments of the attach request.
+type AttachRequestArguments struct {
+	HostName string `json:"hostName,omitempty"` // Defaults to localhost.
+	Port     int    `json:"port"`
+	Timeout  int    `json:"timeout,omitempty"` // Handshake timeout in milliseconds.
+}
+
+// DisconnectArguments holds the arguments of the disconnect request.
+type DisconnectArguments struct {
+	Restart           bool  `json:"restart,omitempty"`
+	TerminateDebuggee *bool `json:"terminateDebuggee,omitempty"`
+}
+
+// ContinueArguments holds the arguments of the continue request.
+type ContinueArguments struct {
+	ThreadID     int  `json:"threadId"`
+	SingleThread bool `json:"singleThread,omitempty"`
+}
+
+// ContinueResponseBody is the body of the continue response.
+type ContinueResponseBody struct {
+	AllThreadsContinued bool `json:"allThreadsContinued"`
+}
+
+// PauseArguments holds the arguments of the pause request.
+type PauseArguments struct {
+	ThreadID int `json:"threadId"`
+}
+
+// StepArguments holds the arguments of the next, stepIn and stepOut requests.
+type StepArguments struct {
+	ThreadID     int    `json:"threadId"`
+	SingleThread bool   `json:"singleThread,omitempty"`
+	Granularity  string `json:"granularity,omitempty"` // "statement", "line" or "instruction"
+}
+
+// Thread describes a single thread of the debuggee.
+type Thread struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// ThreadsResponseBody is the body of the threads response.
+type ThreadsResponseBody struct {
+	Threads []Thread `json:"threads"`
+}
+
+// StoppedEventBody is the body of the stopped event.
+type StoppedEventBody struct {
+	Reason            string `json:"reason"`
+	Description       string `json:"description,omitempty"`
+	ThreadID          int    `json:"threadId,omitempty"`
+	AllThreadsStopped bool   `json:"allThreadsStopped,omitempty"`
+	HitBreakpointIDs  []int  `json:"hitBreakpointIds,omitempty"`
+}
+
+// ThreadEventBody is the body of the thread event.
+type ThreadEventBody struct {
+	Reason   string `json:"reason"` // "started" or "exited"
+	ThreadID int    `json:"threadId"`
+}
+
+// TerminatedEventBody is the body of the terminated event.
+type TerminatedEventBody struct {
+	Restart bool `json:"restart,omitempty"`
+}
+
+// Source describes a source file.
+type Source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// SourceBreakpoint describes a breakpoint requested by the client.
+type SourceBreakpoint struct {
+	Line         int    `json:"line"`
+	Column       int    `json:"column,omitempty"`
+	Condition    string `json:"condition,omitempty"`
+	HitCondition string `json:"hitCondition,omitempty"`
+	LogMessage   string `json:"logMessage,omitempty"`
+}
+
+// SetBreakpointsArguments holds the arguments of the setBreakpoints request.
+type SetBreakpointsArguments struct {
+	Source      Source             `json:"source"`
+	Breakpoints []SourceBreakpoint `json:"breakpoints,omitempty"`
+	Lines       []int              `json:"lines,omitempty"` // Deprecated.
+}
+
+// Breakpoint describes the state of a breakpoint set by the adapter.
+type Breakpoint struct {
+	ID       int     `json:"id,omitempty"`
+	Verified bool    `json:"verified"`
+	Message  string  `json:"message,omitempty"`
+	Source   *Source `json:"source,omitempty"`
+	Line     int     `json:"line,omitempty"`
+}
+
+// SetBreakpointsResponseBody is the body of the setBreakpoints response.
+type SetBreakpointsResponseBody struct {
+	Breakpoints []Breakpoint `json:"breakpoints"`
+}
+
+// BreakpointEventBody is the body of the breakpoint event.
+type BreakpointEventBody struct {
+	Reason     string     `json:"reason"` // "changed", "new" or "removed"
+	Breakpoint Breakpoint `json:"breakpoint"`
+}
+
+// ExceptionBreakpointsFilter describes an exception filter that the client
+// can enable in the setExceptionBreakpoints request.
+type ExceptionBreakpointsFilter struct {
+	Filter               string `json:"filter"`
+	Label                string `json:"label"`
+	Description          string `json:"description,omitempty"`
+	Default              bool   `json:"default,omitempty"`
+	SupportsCondition    bool   `json:"supportsCondition,omitempty"`
+	ConditionDescription string `json:"conditionDescription,omitempty"`
+}
+
+// ExceptionFilterOptions enables an exception filter with a condition.
+type ExceptionFilterOptions struct {
+	FilterID  string `json:"filterId"`
+	Condition string `json:"condition,omitempty"`
+}
+
+// SetExceptionBreakpointsArguments holds the arguments of the
+// setExceptionBreakpoints request.
+type SetExceptionBreakpointsArguments struct {
+	Filters       []string                 `json:"filters"`
+	FilterOptions []ExceptionFilterOptions `json:"filterOptions,omitempty"`
+}
+
+// SetExceptionBreakpointsResponseBody is the body of the
+// setExceptionBreakpoints response.
+type SetExceptionBreakpointsResponseBody struct {
+	Breakpoints []Breakpoint `json:"breakpoints,omitempty"`
+}
+
+// ExceptionInfoArguments holds the arguments of the exceptionInfo request.
+type ExceptionInfoArguments struct {
+	ThreadID int `json:"threadId"`
+}
+
+// ExceptionInfoResponseBody is the body of the exceptionInfo response.
+type ExceptionInfoResponseBody struct {
+	ExceptionID string            `json:"exceptionId"`
+	Description string            `json:"description,omitempty"`
+	BreakMode   string            `json:"breakMode"` // "never", "always", "unhandled" or "userUnhandled"
+	Details     *ExceptionDetails `json:"details,omitempty"`
+}
+
+// ExceptionDetails describes an exception in the exceptionInfo response.
+type ExceptionDetails struct {
+	Message      string `json:"message,omitempty"`
+	TypeName     string `json:"typeName,omitempty"`
+	FullTypeName string `json:"fullTypeName,omitempty"`
+	StackTrace   string `json:"stackTrace,omitempty"`
+}
+
+// DataBreakpointInfoArguments holds the arguments of the dataBreakpointInfo
+// request.
+type DataBreakpointInfoArguments struct {
+	VariablesReference int    `json:"variablesReference,omitempty"`
+	Name               string `json:"name"`
+	FrameID            int    `json:"frameId,omitempty"`
+}
+
+// DataBreakpointInfoResponseBody is the body of the dataBreakpointInfo
+// response. A nil DataID means that no data breakpoint can be set.
+type DataBreakpointInfoResponseBody struct {
+	DataID      *string  `json:"dataId"`
+	Description string   `json:"description"`
+	AccessTypes []string `json:"accessTypes,omitempty"` // "read", "write" or "readWrite"
+}
+
+// DataBreakpoint describes a data breakpoint requested by the client.
+type DataBreakpoint struct {
+	DataID     string `json:"dataId"`
+	AccessType string `json:"accessType,omitempty"` // Defaults to "write".
+}
+
+// SetDataBreakpointsArguments holds the arguments of the setDataBreakpoints
+// request.
+type SetDataBreakpointsArguments struct {
+	Breakpoints []DataBreakpoint `json:"breakpoints"`
+}
+
+// SetDataBreakpointsResponseBody is the body of the setDataBreakpoints
+// response.
+type SetDataBreakpointsResponseBody struct {
+	Breakpoints []Breakpoint `json:"breakpoints"`
+}
+
+// OutputEventBody is the body of the output event.
+type OutputEventBody struct {
+	Category string  `json:"category,omitempty"` // "console", "stdout", "stderr" or "telemetry"
+	Output   string  `json:"output"`
+	Source   *Source `json:"source,omitempty"`
+	Line     int     `json:"line,omitempty"`
+}
+
+// StackTraceArguments holds the arguments of the stackTrace request.
+type StackTraceArguments struct {
+	ThreadID   int `json:"threadId"`
+	StartFrame int `json:"startFrame,omitempty"`
+	Levels     int `json:"levels,omitempty"` // Zero for all the frames.
+}
+
+// StackFrame describes a stack frame of a thread.
+type StackFrame struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Source *Source `json:"source,omitempty"`
+	Line   int     `json:"line"`
+	Column int     `json:"column"`
+}
+
+// StackTraceResponseBody is the body of the stackTrace response.
+type StackTraceResponseBody struct {
+	StackFrames []StackFrame `json:"stackFrames"`
+	TotalFrames int          `json:"totalFrames,omitempty"`
+}
+
+// ScopesArguments holds the arguments of the scopes request.
+type ScopesArguments struct {
+	FrameID int `json:"frameId"`
+}
+
+// Scope is a named group of variables of a stack frame.
+type Scope struct {
+	Name               string `json:"name"`
+	PresentationHint   string `json:"presentationHint,omitempty"` // "arguments", "locals" or "registers"
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+// ScopesResponseBody is the body of the scopes response.
+type ScopesResponseBody struct {
+	Scopes []Scope `json:"scopes"`
+}
+
+// VariablesArguments holds the arguments of the variables request.
+type VariablesArguments struct {
+	VariablesReference int    `json:"variablesReference"`
+	Filter             string `json:"filter,omitempty"` // "indexed" or "named"
+	Start              int    `json:"start,omitempty"`
+	Count              int    `json:"count,omitempty"`
+}
+
+// Variable is a named value shown in the variables view.
+type Variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+	IndexedVariables   int    `json:"indexedVariables,omitempty"`
+}
+
+// VariablesResponseBody is the body of the variables response.
+type VariablesResponseBody struct {
+	Variables []Variable `json:"variables"`
+}
+
+// SetVariableArguments holds the arguments of the setVariable request.
+type SetVariableArguments struct {
+	VariablesReference int    `json:"variablesReference"`
+	Name               string `json:"name"`
+	Value              string `json:"value"` // A Java expression.
+}
+
+// SetVariableResponseBody is the body of the setVariable response.
+type SetVariableResponseBody struct {
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference,omitempty"`
+	IndexedVariables   int    `json:"indexedVariables,omitempty"`
+}
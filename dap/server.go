@@ -0,0 +1,239 @@
+// Package dap implements a Debug Adapter Protocol server that drives a Java
+// virtual machine through a JDWP connection.
+//
+// Messages are framed with a Content-Length header, and can be served over
+// stdio or a TCP socket.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdbg/variables"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sapelkinav/javadap/launcher"
+	"sapelkinav/javadap/utils"
+	"sync"
+)
+
+var log, _ = utils.GetComponentLogger("dap", "server")
+
+// handler is the function signature of a request handler. The returned body
+// is sent as the body of a successful response.
+type handler func(s *Session, req *Request) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":              (*Session).onInitialize,
+	"launch":                  (*Session).onLaunch,
+	"attach":                  (*Session).onAttach,
+	"configurationDone":       (*Session).onConfigurationDone,
+	"threads":                 (*Session).onThreads,
+	"continue":                (*Session).onContinue,
+	"pause":                   (*Session).onPause,
+	"disconnect":              (*Session).onDisconnect,
+	"setBreakpoints":          (*Session).onSetBreakpoints,
+	"setExceptionBreakpoints": (*Session).onSetExceptionBreakpoints,
+	"exceptionInfo":           (*Session).onExceptionInfo,
+	"dataBreakpointInfo":      (*Session).onDataBreakpointInfo,
+	"setDataBreakpoints":      (*Session).onSetDataBreakpoints,
+	"next":                    (*Session).onNext,
+	"stepIn":                  (*Session).onStepIn,
+	"stepOut":                 (*Session).onStepOut,
+	"stackTrace":              (*Session).onStackTrace,
+	"scopes":                  (*Session).onScopes,
+	"variables":               (*Session).onVariables,
+	"setVariable":             (*Session).onSetVariable,
+}
+
+// Session is a single debug session between a client and a VM.
+type Session struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	in     *bufio.Reader
+
+	out     io.Writer
+	outLock sync.Mutex
+	seq     int
+
+	client      InitializeRequestArguments
+	conn        *jdwpclient.Connection
+	launcher    *launcher.JavaLauncher
+	events      *debugger.Dispatcher
+	breakpoints *debugger.Breakpoints
+	stepper     *debugger.Stepper
+	exceptions  *debugger.Exceptions
+	watchpoints *debugger.Watchpoints
+	variables   *variables.Store
+
+	exceptionLock sync.Mutex
+	lastException map[jdwpclient.ThreadID]debugger.ExceptionHit // By thread, for exceptionInfo.
+
+	stepLock   sync.Mutex
+	cancelStep context.CancelFunc // Cancels the step in progress, if any.
+
+	// afterResponse holds the functions to call once the response to the
+	// request currently being handled has been sent.
+	afterResponse  []func()
+	done           bool
+	terminatedOnce sync.Once
+}
+
+// Serve runs a single debug session, reading requests from r and writing
+// responses and events to w. Serve returns once the client disconnects, the
+// stream is closed or ctx is cancelled.
+func Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := &Session{
+		ctx:    ctx,
+		cancel: cancel,
+		in:     bufio.NewReader(r),
+		out:    w,
+	}
+	defer s.close()
+	return s.run()
+}
+
+// ListenAndServe accepts client connections on the TCP address addr, serving
+// a debug session for each. ListenAndServe returns when ctx is cancelled.
+func ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	log.Info().Str("address", listener.Addr().String()).Msg("Listening for DAP clients")
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := Serve(ctx, conn, conn); err != nil {
+				log.Warn().Err(err).Msg("DAP session failed")
+			}
+		}()
+	}
+}
+
+func (s *Session) run() error {
+	for !s.done {
+		data, err := ReadMessage(s.in)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		case s.ctx.Err() != nil:
+			return nil
+		}
+		req := &Request{}
+		if err := json.Unmarshal(data, req); err != nil {
+			log.Warn().Err(err).Msg("Couldn't decode DAP message")
+			continue
+		}
+		if req.Type != "request" {
+			log.Warn().Str("type", req.Type).Msg("Ignoring non-request message")
+			continue
+		}
+		s.handle(req)
+	}
+	return nil
+}
+
+// handle dispatches req to its handler and sends the response.
+func (s *Session) handle(req *Request) {
+	h, ok := handlers[req.Command]
+	if !ok {
+		s.respond(req, nil, fmt.Errorf("Unsupported command '%v'", req.Command))
+		return
+	}
+	body, err := h(s, req)
+	if err != nil {
+		log.Warn().Err(err).Str("command", req.Command).Msg("Request failed")
+	}
+	s.respond(req, body, err)
+
+	after := s.afterResponse
+	s.afterResponse = nil
+	for _, f := range after {
+		f()
+	}
+}
+
+// after schedules f to be called once the response to the current request has
+// been sent.
+func (s *Session) after(f func()) {
+	s.afterResponse = append(s.afterResponse, f)
+}
+
+func (s *Session) respond(req *Request, body interface{}, err error) {
+	res := &Response{
+		ProtocolMessage: ProtocolMessage{Type: "response"},
+		RequestSeq:      req.Seq,
+		Success:         err == nil,
+		Command:         req.Command,
+		Body:            body,
+	}
+	if err != nil {
+		res.Message = err.Error()
+		res.Body = nil
+	}
+	s.send(res, &res.ProtocolMessage)
+}
+
+// event sends the named event to the client.
+func (s *Session) event(name string, body interface{}) {
+	ev := &Event{
+		ProtocolMessage: ProtocolMessage{Type: "event"},
+		Event:           name,
+		Body:            body,
+	}
+	s.send(ev, &ev.ProtocolMessage)
+}
+
+// send stamps msg with the next sequence number and writes it to the client.
+// send is safe to call from any goroutine.
+func (s *Session) send(msg interface{}, header *ProtocolMessage) {
+	s.outLock.Lock()
+	defer s.outLock.Unlock()
+	s.seq++
+	header.Seq = s.seq
+	if err := WriteMessage(s.out, msg); err != nil {
+		log.Warn().Err(err).Msg("Couldn't send DAP message")
+	}
+}
+
+// close releases the VM connection and stops any launched process.
+func (s *Session) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	if s.launcher != nil {
+		s.launcher.Stop()
+		s.launcher = nil
+	}
+	s.conn = nil
+}
+
+// args decodes the request arguments into out.
+func args(req *Request, out interface{}) error {
+	if len(req.Arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Arguments, out); err != nil {
+		return fmt.Errorf("Invalid arguments for '%v': %w", req.Command, err)
+	}
+	return nil
+}
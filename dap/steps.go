@@ -0,0 +1,77 @@
+package dap
+
+import (
+	"context"
+	"errors"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+)
+
+func (s *Session) onNext(req *Request) (interface{}, error) {
+	return s.startStep(req, jdwpclient.StepOver)
+}
+
+func (s *Session) onStepIn(req *Request) (interface{}, error) {
+	return s.startStep(req, jdwpclient.StepInto)
+}
+
+func (s *Session) onStepOut(req *Request) (interface{}, error) {
+	return s.startStep(req, jdwpclient.StepOut)
+}
+
+// startStep starts stepping the requested thread once the response is sent.
+// A stopped event is sent when the step completes.
+func (s *Session) startStep(req *Request, depth jdwpclient.StepDepth) (interface{}, error) {
+	a := StepArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.connection(); err != nil {
+		return nil, err
+	}
+	size := jdwpclient.StepLine
+	if a.Granularity == "instruction" {
+		size = jdwpclient.StepMin
+	}
+	thread := jdwpclient.ThreadID(a.ThreadID)
+
+	s.stopStepping()
+	s.variables.Reset()
+	s.forgetExceptions(thread)
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.stepLock.Lock()
+	s.cancelStep = cancel
+	s.stepLock.Unlock()
+	s.after(func() { go s.step(ctx, thread, size, depth) })
+	return nil, nil
+}
+
+// step steps the thread, sending a stopped event when the step completes, or
+// a thread event if the thread dies while stepping.
+func (s *Session) step(ctx context.Context, thread jdwpclient.ThreadID, size jdwpclient.StepSize, depth jdwpclient.StepDepth) {
+	_, err := s.stepper.Step(ctx, thread, size, depth)
+	switch {
+	case err == nil:
+		s.event("stopped", StoppedEventBody{
+			Reason:            "step",
+			ThreadID:          int(thread),
+			AllThreadsStopped: true,
+		})
+	case errors.Is(err, debugger.ErrThreadDied):
+		s.event("thread", ThreadEventBody{Reason: "exited", ThreadID: int(thread)})
+	case ctx.Err() != nil:
+		// The step was interrupted by another stop or resume.
+	default:
+		log.Warn().Err(err).Int("thread", int(thread)).Msg("Step failed")
+	}
+}
+
+// stopStepping cancels the step in progress, if any.
+func (s *Session) stopStepping() {
+	s.stepLock.Lock()
+	defer s.stepLock.Unlock()
+	if s.cancelStep != nil {
+		s.cancelStep()
+		s.cancelStep = nil
+	}
+}
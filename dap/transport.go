@@ -0,0 +1,68 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const contentLengthHeader = "Content-Length"
+
+// MaxMessageSize is the largest message body that ReadMessage accepts.
+const MaxMessageSize = 64 << 20
+
+// ReadMessage reads a single Content-Length framed message from r, returning
+// the message body.
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break // End of the header block.
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("Malformed header line '%v'", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), contentLengthHeader) {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("Invalid %v '%v': %w", contentLengthHeader, value, err)
+			}
+			if length < 0 {
+				return nil, fmt.Errorf("Invalid %v '%v'", contentLengthHeader, value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("Message is missing the %v header", contentLengthHeader)
+	}
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("%v %v exceeds the maximum of %v bytes", contentLengthHeader, length, MaxMessageSize)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteMessage encodes msg as JSON and writes it to w with a Content-Length
+// header.
+func WriteMessage(w io.Writer, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%v: %d\r\n\r\n", contentLengthHeader, len(data)); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,116 @@
+package dap
+
+import (
+	"path/filepath"
+	"sapelkinav/javadap/jdwp/jdbg/variables"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+)
+
+func (s *Session) onStackTrace(req *Request) (interface{}, error) {
+	a := StackTraceArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.connection(); err != nil {
+		return nil, err
+	}
+	frames, total, err := s.variables.StackTrace(s.ctx, jdwpclient.ThreadID(a.ThreadID), a.StartFrame, a.Levels)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]StackFrame, len(frames))
+	for i, f := range frames {
+		out[i] = StackFrame{ID: f.Reference, Name: f.Name(), Source: s.source(f.Class)}
+		if f.Line > 0 {
+			out[i].Line = s.fromJavaLine(f.Line)
+		}
+	}
+	return StackTraceResponseBody{StackFrames: out, TotalFrames: total}, nil
+}
+
+// source returns the source file that declares the class. The file only has
+// a path if it has breakpoints.
+func (s *Session) source(class string) *Source {
+	name := class[strings.LastIndexByte(class, '.')+1:]
+	if i := strings.IndexByte(name, '$'); i >= 0 {
+		name = name[:i]
+	}
+	path := s.breakpoints.Source(class)
+	if path != "" {
+		name = filepath.Base(path)
+	} else {
+		name += ".java"
+	}
+	return &Source{Name: name, Path: path}
+}
+
+func (s *Session) onScopes(req *Request) (interface{}, error) {
+	a := ScopesArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.connection(); err != nil {
+		return nil, err
+	}
+	scopes, err := s.variables.Scopes(s.ctx, a.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Scope, len(scopes))
+	for i, scope := range scopes {
+		out[i] = Scope{Name: scope.Name, VariablesReference: scope.Reference}
+		switch scope.Name {
+		case variables.ScopeArguments:
+			out[i].PresentationHint = "arguments"
+		case variables.ScopeLocals:
+			out[i].PresentationHint = "locals"
+		}
+	}
+	return ScopesResponseBody{Scopes: out}, nil
+}
+
+func (s *Session) onVariables(req *Request) (interface{}, error) {
+	a := VariablesArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.connection(); err != nil {
+		return nil, err
+	}
+	vars, err := s.variables.Variables(s.ctx, a.VariablesReference, a.Start, a.Count)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Variable, len(vars))
+	for i, v := range vars {
+		out[i] = Variable{
+			Name:               v.Name,
+			Value:              v.Value,
+			Type:               v.Type,
+			VariablesReference: v.Reference,
+			IndexedVariables:   v.Indexed,
+		}
+	}
+	return VariablesResponseBody{Variables: out}, nil
+}
+
+func (s *Session) onSetVariable(req *Request) (interface{}, error) {
+	a := SetVariableArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.connection(); err != nil {
+		return nil, err
+	}
+	v, err := s.variables.SetVariable(s.ctx, a.VariablesReference, a.Name, a.Value)
+	if err != nil {
+		return nil, err
+	}
+	return SetVariableResponseBody{
+		Value:              v.Value,
+		Type:               v.Type,
+		VariablesReference: v.Reference,
+		IndexedVariables:   v.Indexed,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package dap
+
+import (
+	"fmt"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strconv"
+	"strings"
+)
+
+// Data breakpoints are identified by a data ID of the form "class#field", or
+// "class#field@object" for a watchpoint on a single object.
+
+func (s *Session) onDataBreakpointInfo(req *Request) (interface{}, error) {
+	a := DataBreakpointInfoArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	access := []string{"read", "write", "readWrite"}
+	if a.VariablesReference != 0 {
+		// The name is a field of the object or scope with the reference.
+		if _, err := s.connection(); err != nil {
+			return nil, err
+		}
+		class, instance, err := s.variables.Field(s.ctx, a.VariablesReference, a.Name)
+		if err != nil {
+			return DataBreakpointInfoResponseBody{Description: err.Error()}, nil
+		}
+		id, description := class+"#"+a.Name, class+"."+a.Name
+		if instance != 0 {
+			id += fmt.Sprintf("@%d", instance)
+			description += fmt.Sprintf(" of object %d", instance)
+		}
+		return DataBreakpointInfoResponseBody{DataID: &id, Description: description, AccessTypes: access}, nil
+	}
+	// Without a variables reference, the name is a fully qualified field
+	// name, such as "com.example.Order.status".
+	i := strings.LastIndexByte(a.Name, '.')
+	if i < 0 {
+		return DataBreakpointInfoResponseBody{
+			Description: fmt.Sprintf("'%v' is not a fully qualified field name", a.Name),
+		}, nil
+	}
+	id := a.Name[:i] + "#" + a.Name[i+1:]
+	return DataBreakpointInfoResponseBody{
+		DataID:      &id,
+		Description: a.Name,
+		AccessTypes: access,
+	}, nil
+}
+
+func (s *Session) onSetDataBreakpoints(req *Request) (interface{}, error) {
+	a := SetDataBreakpointsArguments{}
+	if err := args(req, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.connection(); err != nil {
+		return nil, err
+	}
+	wps := make([]debugger.Watchpoint, len(a.Breakpoints))
+	for i, bp := range a.Breakpoints {
+		wp, err := parseDataID(bp.DataID)
+		if err != nil {
+			return nil, err
+		}
+		switch bp.AccessType {
+		case "", "write":
+			wp.Modification = true
+		case "read":
+			wp.Access = true
+		case "readWrite":
+			wp.Access, wp.Modification = true, true
+		default:
+			return nil, fmt.Errorf("Unknown access type '%v'", bp.AccessType)
+		}
+		wps[i] = wp
+	}
+
+	wps, err := s.watchpoints.Set(s.ctx, wps)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Breakpoint, len(wps))
+	for i, wp := range wps {
+		out[i] = dataBreakpoint(wp)
+	}
+	return SetDataBreakpointsResponseBody{Breakpoints: out}, nil
+}
+
+// parseDataID returns the watchpoint identified by the data ID.
+func parseDataID(id string) (debugger.Watchpoint, error) {
+	wp := debugger.Watchpoint{}
+	if i := strings.LastIndexByte(id, '@'); i >= 0 {
+		object, err := strconv.ParseUint(id[i+1:], 10, 64)
+		if err != nil {
+			return wp, fmt.Errorf("Invalid data breakpoint '%v': %w", id, err)
+		}
+		wp.Instance, id = jdwpclient.ObjectID(object), id[:i]
+	}
+	i := strings.IndexByte(id, '#')
+	if i <= 0 || i == len(id)-1 {
+		return wp, fmt.Errorf("Invalid data breakpoint '%v'", id)
+	}
+	wp.Class, wp.Field = id[:i], id[i+1:]
+	return wp, nil
+}
+
+// dataBreakpoint converts the watchpoint to its DAP representation.
+func dataBreakpoint(wp debugger.Watchpoint) Breakpoint {
+	return Breakpoint{ID: wp.ID, Verified: wp.Verified, Message: wp.Message}
+}
+
+// forwardWatchpoints sends stopped events for watchpoint hits, and breakpoint
+// events for deferred watchpoints that become verified.
+func (s *Session) forwardWatchpoints(w *debugger.Watchpoints) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case hit := <-w.Hits():
+			s.stopStepping()
+			description := fmt.Sprintf("%v.%v accessed", hit.Watchpoint.Class, hit.Watchpoint.Field)
+			if hit.Modification {
+				description = fmt.Sprintf("%v.%v changed from %v to %v",
+					hit.Watchpoint.Class, hit.Watchpoint.Field, hit.OldValue, hit.NewValue)
+			}
+			s.event("stopped", StoppedEventBody{
+				Reason:            "data breakpoint",
+				Description:       description,
+				ThreadID:          int(hit.Thread),
+				AllThreadsStopped: true,
+				HitBreakpointIDs:  []int{hit.Watchpoint.ID},
+			})
+		case wp := <-w.Changed():
+			s.event("breakpoint", BreakpointEventBody{
+				Reason:     "changed",
+				Breakpoint: dataBreakpoint(wp),
+			})
+		}
+	}
+}
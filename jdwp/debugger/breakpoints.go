@@ -0,0 +1,419 @@
+// Package debugger implements the user-facing debugger features, such as
+// line breakpoints, on top of a JDWP connection.
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sapelkinav/javadap/utils"
+	"strings"
+	"sync"
+)
+
+var log, _ = utils.GetComponentLogger("jdwp", "debugger")
+
+// Breakpoint is a line breakpoint in a Java source file.
+type Breakpoint struct {
+	ID        int
+	Source    string // Path of the source file.
+	Line      int
+	Verified  bool   // True once the breakpoint is set in a loaded class.
+	Message   string // Explains why the breakpoint is not verified.
+	Locations []jdwpclient.Location
+
+	// Condition is a boolean Java expression that must be true for the
+	// breakpoint to be hit. An empty condition is always true.
+	Condition string
+	// HitCondition is an expression over the number of times the breakpoint
+	// is hit, such as ">= 5" or "% 10 == 0". See ParseHitCondition.
+	HitCondition string
+	// LogMessage makes the breakpoint a logpoint, which logs the message
+	// instead of stopping. Java expressions in braces, such as "{order.id}",
+	// are replaced with their values.
+	LogMessage string
+	// HitCount is the number of times the condition held when the
+	// breakpoint was reached.
+	HitCount int
+
+	class    string // Fully qualified name of the top-level class.
+	requests []*jdwpclient.EventRequest
+	hit      HitCondition
+	invalid  bool // True if the breakpoint is never set, such as for an invalid hit condition.
+}
+
+// SourceBreakpoint is a breakpoint requested at a line of a source file.
+type SourceBreakpoint struct {
+	Line         int
+	Condition    string
+	HitCondition string
+	LogMessage   string
+}
+
+// Hit describes a thread stopping at a breakpoint.
+type Hit struct {
+	Breakpoint Breakpoint
+	Thread     jdwpclient.ThreadID
+	Location   jdwpclient.Location
+	// ConditionError is the error evaluating the breakpoint's condition. The
+	// thread stops when the condition cannot be evaluated.
+	ConditionError error
+}
+
+// Log is a message logged by a logpoint.
+type Log struct {
+	Breakpoint Breakpoint
+	Thread     jdwpclient.ThreadID
+	Location   jdwpclient.Location
+	Message    string
+}
+
+// IDs allocates the IDs of the breakpoints of a debug session. Managers of
+// different kinds of breakpoints that share IDs never reuse each other's IDs.
+type IDs struct {
+	mutex sync.Mutex
+	last  int
+}
+
+// NewIDs returns a new ID allocator, whose first ID is 1.
+func NewIDs() *IDs { return &IDs{} }
+
+// Next returns a new ID.
+func (i *IDs) Next() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.last++
+	return i.last
+}
+
+// Breakpoints manages the line breakpoints of a debug session.
+// Breakpoints in classes that are not yet loaded are deferred until the class
+// is prepared.
+type Breakpoints struct {
+	conn    *jdwpclient.Connection
+	events  *Dispatcher
+	hits    chan Hit
+	logs    chan Log
+	changed chan Breakpoint
+
+	ids       *IDs
+	mutex     sync.Mutex
+	bySource  map[string][]*Breakpoint
+	byRequest map[jdwpclient.EventRequestID]*Breakpoint
+	deferred  *deferrals
+	evaluator Evaluator
+}
+
+// NewBreakpoints returns a new breakpoint manager using the events
+// dispatcher, which evaluates conditions and log messages as Java expressions.
+// The IDs of the breakpoints are allocated from ids.
+func NewBreakpoints(events *Dispatcher, ids *IDs) *Breakpoints {
+	b := &Breakpoints{
+		conn:      events.Connection(),
+		events:    events,
+		hits:      make(chan Hit, 16),
+		logs:      make(chan Log, 64),
+		changed:   make(chan Breakpoint, 16),
+		ids:       ids,
+		bySource:  map[string][]*Breakpoint{},
+		byRequest: map[jdwpclient.EventRequestID]*Breakpoint{},
+		evaluator: (*jdbg.JDbg).Evaluate,
+	}
+	b.deferred = newDeferrals(events, &b.mutex, true, b.onClassPrepare)
+	return b
+}
+
+// Hits returns the channel that receives a Hit each time a thread stops at a
+// breakpoint. All threads are suspended when a breakpoint is hit.
+func (b *Breakpoints) Hits() <-chan Hit { return b.hits }
+
+// Logs returns the channel that receives the messages of logpoints. Threads
+// are resumed once a logpoint's message is evaluated.
+func (b *Breakpoints) Logs() <-chan Log { return b.logs }
+
+// Changed returns the channel that receives deferred breakpoints as they
+// become verified. Changes are dropped while the channel is full.
+func (b *Breakpoints) Changed() <-chan Breakpoint { return b.changed }
+
+// SetEvaluator sets the evaluator of the conditions and of the expressions in
+// the log messages of the breakpoints. Without an evaluator, conditions fail
+// to evaluate, which stops at the breakpoint.
+func (b *Breakpoints) SetEvaluator(e Evaluator) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.evaluator = e
+}
+
+// Source returns the path of a source file with breakpoints that declares
+// the class, or an empty string if there is no such file.
+func (b *Breakpoints) Source(class string) string {
+	if i := strings.IndexByte(class, '$'); i >= 0 {
+		class = class[:i] // Nested classes are declared by the top-level class.
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for source, bps := range b.bySource {
+		if bps[0].class == class {
+			return source
+		}
+	}
+	return ""
+}
+
+// Set replaces all the breakpoints in the source file with the requested
+// breakpoints, returning the new breakpoints in the same order as reqs.
+// Breakpoints with invalid hit conditions are not set, and are returned
+// unverified with the error as their message. Conditions and log messages are
+// not parsed until the breakpoint is reached. If Set fails, the previous
+// breakpoints in the source file are kept.
+func (b *Breakpoints) Set(ctx context.Context, source string, reqs []SourceBreakpoint) ([]Breakpoint, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	class := classNameForSource(source)
+	var types []jdwpclient.ClassInfo
+	if len(reqs) > 0 {
+		var err error
+		if types, err = b.deferred.prepare(ctx, class); err != nil {
+			b.unwatchUnused(ctx)
+			return nil, err
+		}
+	}
+
+	bps := make([]*Breakpoint, len(reqs))
+	out := make([]Breakpoint, len(reqs))
+	for i, req := range reqs {
+		line := req.Line
+		bp := &Breakpoint{
+			ID:           b.ids.Next(),
+			Source:       source,
+			Line:         line,
+			Condition:    req.Condition,
+			HitCondition: req.HitCondition,
+			LogMessage:   req.LogMessage,
+			class:        class,
+		}
+		bps[i] = bp
+		hit, err := ParseHitCondition(req.HitCondition)
+		if err != nil {
+			bp.Message, bp.invalid = err.Error(), true
+			out[i] = *bp
+			continue
+		}
+		bp.hit = hit
+		for _, ty := range types {
+			if err := b.resolve(ctx, bp, ty); err != nil {
+				// Keep the previous breakpoints of the source.
+				for _, bp := range bps[:i+1] {
+					b.clear(ctx, bp)
+				}
+				b.unwatchUnused(ctx)
+				return nil, err
+			}
+		}
+		switch {
+		case bp.Verified:
+		case len(types) == 0:
+			bp.Message = fmt.Sprintf("Class %v is not loaded yet", class)
+		default:
+			bp.Message = fmt.Sprintf("No executable code at line %d", line)
+		}
+		out[i] = *bp
+	}
+
+	for _, bp := range b.bySource[source] {
+		b.clear(ctx, bp)
+	}
+	delete(b.bySource, source)
+	if len(bps) > 0 {
+		b.bySource[source] = bps
+	}
+	b.unwatchUnused(ctx)
+	return out, nil
+}
+
+// unwatchUnused stops watching for the preparation of classes without
+// breakpoints.
+func (b *Breakpoints) unwatchUnused(ctx context.Context) {
+	used := map[string]bool{}
+	for _, bps := range b.bySource {
+		for _, bp := range bps {
+			used[bp.class] = true
+		}
+	}
+	b.deferred.unwatchUnused(ctx, used)
+}
+
+// resolve sets the breakpoint in the loaded type ty, if ty has code at the
+// breakpoint's line.
+func (b *Breakpoints) resolve(ctx context.Context, bp *Breakpoint, ty jdwpclient.ClassInfo) error {
+	for _, l := range bp.Locations {
+		if l.Class == ty.ClassID() {
+			return nil // Already set in this type.
+		}
+	}
+	locations, err := lineLocations(ctx, b.conn, ty, bp.Line)
+	if err != nil {
+		return err
+	}
+	for _, l := range locations {
+		req, err := b.events.Set(ctx, jdwpclient.Breakpoint, jdwpclient.SuspendAll, b.onBreakpoint,
+			jdwpclient.LocationOnlyEventModifier(l))
+		if err != nil {
+			return err
+		}
+		bp.requests = append(bp.requests, req)
+		bp.Locations = append(bp.Locations, l)
+		b.byRequest[req.ID] = bp
+	}
+	if len(bp.Locations) > 0 {
+		bp.Verified, bp.Message = true, ""
+	}
+	return nil
+}
+
+// clear removes all the event requests for the breakpoint.
+func (b *Breakpoints) clear(ctx context.Context, bp *Breakpoint) {
+	for _, req := range bp.requests {
+		if err := b.events.Clear(ctx, req); err != nil {
+			log.Warn().Err(err).Int("breakpoint", bp.ID).Msg("Couldn't clear breakpoint request")
+		}
+		delete(b.byRequest, req.ID)
+	}
+	bp.requests, bp.Locations, bp.Verified = nil, nil, false
+}
+
+// onClassPrepare sets the deferred breakpoints of the top-level class in the
+// prepared type of the class or of one of its nested classes.
+func (b *Breakpoints) onClassPrepare(ctx context.Context, class string, ty jdwpclient.ClassInfo) {
+	for _, bps := range b.bySource {
+		for _, bp := range bps {
+			if bp.class != class || bp.invalid {
+				continue
+			}
+			wasVerified := bp.Verified
+			if err := b.resolve(ctx, bp, ty); err != nil {
+				log.Warn().Err(err).Int("breakpoint", bp.ID).Msg("Couldn't set deferred breakpoint")
+				continue
+			}
+			if bp.Verified && !wasVerified {
+				// The mutex is held on the dispatcher's goroutine, so a
+				// full channel must not block.
+				select {
+				case b.changed <- *bp:
+				default:
+					log.Warn().Int("breakpoint", bp.ID).Msg("Dropped change of verified breakpoint")
+				}
+			}
+		}
+	}
+}
+
+func (b *Breakpoints) onBreakpoint(ctx context.Context, event jdwpclient.Event) {
+	e := event.(*jdwpclient.EventBreakpoint)
+	b.mutex.Lock()
+	bp, ok := b.byRequest[e.Request]
+	var hit Hit
+	if ok {
+		hit = Hit{Breakpoint: *bp, Thread: e.Thread, Location: e.Location}
+	}
+	b.mutex.Unlock()
+	if !ok {
+		// The breakpoint was cleared after the event was raised.
+		b.resume(ctx, event, "stale breakpoint")
+		return
+	}
+	if hit.Breakpoint.Condition == "" && hit.Breakpoint.hit == nil && hit.Breakpoint.LogMessage == "" {
+		hit.Breakpoint.HitCount = b.count(bp)
+		b.hits <- hit
+		return
+	}
+	// Conditions and log messages may invoke methods in the VM, which may
+	// raise events that need the dispatcher.
+	b.events.Defer(event)
+	go b.evaluate(ctx, event, bp, hit)
+}
+
+// evaluate evaluates the condition, hit condition and log message of the
+// breakpoint for the hit, either stopping at the breakpoint or resuming after
+// the event.
+func (b *Breakpoints) evaluate(ctx context.Context, event jdwpclient.Event, bp *Breakpoint, hit Hit) {
+	b.mutex.Lock()
+	evaluate := b.evaluator
+	b.mutex.Unlock()
+	if hit.Breakpoint.Condition != "" {
+		ok, err := evaluateCondition(ctx, b.conn, hit.Thread, evaluate, hit.Breakpoint.Condition)
+		if err != nil {
+			hit.ConditionError = err
+			b.events.Stop(event)
+			b.hits <- hit
+			return
+		}
+		if !ok {
+			b.resume(ctx, event, "false breakpoint condition")
+			return
+		}
+	}
+	hit.Breakpoint.HitCount = b.count(bp)
+	if hit.Breakpoint.hit != nil && !hit.Breakpoint.hit(hit.Breakpoint.HitCount) {
+		b.resume(ctx, event, "unmet hit condition")
+		return
+	}
+	if hit.Breakpoint.LogMessage == "" {
+		b.events.Stop(event)
+		b.hits <- hit
+		return
+	}
+	message, err := evaluateLogMessage(ctx, b.conn, hit.Thread, evaluate, hit.Breakpoint.LogMessage)
+	if err != nil {
+		message = fmt.Sprintf("%v (%v)", message, err)
+	}
+	b.logs <- Log{Breakpoint: hit.Breakpoint, Thread: hit.Thread, Location: hit.Location, Message: message}
+	b.resume(ctx, event, "logpoint")
+}
+
+// count increments and returns the hit count of the breakpoint.
+func (b *Breakpoints) count(bp *Breakpoint) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	bp.HitCount++
+	return bp.HitCount
+}
+
+// resume resumes after a breakpoint event that does not stop, unless another
+// event raised with it stops.
+func (b *Breakpoints) resume(ctx context.Context, event jdwpclient.Event, reason string) {
+	if err := b.events.Resume(ctx, event); err != nil {
+		log.Warn().Err(err).Msgf("Couldn't resume after %v", reason)
+	}
+}
+
+// lineLocations returns the locations of the code for the source line in the
+// type's methods.
+func lineLocations(ctx context.Context, conn *jdwpclient.Connection, ty jdwpclient.ClassInfo, line int) ([]jdwpclient.Location, error) {
+	methods, err := conn.GetMethods(ctx, ty.TypeID)
+	if err != nil {
+		return nil, err
+	}
+	out := []jdwpclient.Location{}
+	for _, m := range methods {
+		table, err := conn.LineTable(ctx, ty.TypeID, m.ID)
+		switch err {
+		case nil:
+		case jdwpclient.ErrAbsentInformation, jdwpclient.ErrNativeMethod:
+			continue
+		default:
+			return nil, err
+		}
+		if index, ok := table.Lookup(line); ok {
+			out = append(out, jdwpclient.Location{
+				Type:     ty.Kind,
+				Class:    ty.ClassID(),
+				Method:   m.ID,
+				Location: index,
+			})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,153 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strconv"
+	"strings"
+)
+
+// Evaluator evaluates a Java expression in the top frame of the thread that j
+// is bound to. It fails j if the expression cannot be evaluated.
+type Evaluator func(j *jdbg.JDbg, expression string) jdbg.Value
+
+// HitCondition reports whether a breakpoint stops on its nth hit.
+type HitCondition func(n int) bool
+
+// ParseHitCondition parses a hit condition, which compares the number of
+// times a breakpoint is hit with a number:
+//
+//	5       stops on the 5th hit
+//	== 5    stops on the 5th hit
+//	>= 5    stops on the 5th hit and every hit after it
+//	> 5     stops on every hit after the 5th
+//	< 5     stops on the first 4 hits
+//	<= 5    stops on the first 5 hits
+//	!= 5    stops on every hit except the 5th
+//	% 10    stops on every 10th hit
+//	% 10 == 3  stops on the 3rd, 13th, 23rd... hits
+//
+// An empty hit condition returns a nil HitCondition, which always stops.
+func ParseHitCondition(s string) (HitCondition, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	op := ""
+	for _, o := range []string{"==", "!=", ">=", "<=", ">", "<", "%"} {
+		if strings.HasPrefix(s, o) {
+			op, s = o, strings.TrimSpace(s[len(o):])
+			break
+		}
+	}
+	rest := ""
+	if op == "%" {
+		if i := strings.Index(s, "=="); i >= 0 {
+			s, rest = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+2:])
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hit condition '%v': expected a number", s)
+	}
+	switch op {
+	case "", "==":
+		return func(hits int) bool { return hits == n }, nil
+	case "!=":
+		return func(hits int) bool { return hits != n }, nil
+	case ">=":
+		return func(hits int) bool { return hits >= n }, nil
+	case "<=":
+		return func(hits int) bool { return hits <= n }, nil
+	case ">":
+		return func(hits int) bool { return hits > n }, nil
+	case "<":
+		return func(hits int) bool { return hits < n }, nil
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("Invalid hit condition: modulus %d must be positive", n)
+	}
+	remainder := 0
+	if rest != "" {
+		if remainder, err = strconv.Atoi(rest); err != nil {
+			return nil, fmt.Errorf("Invalid hit condition '%v': expected a number", rest)
+		}
+	}
+	return func(hits int) bool { return hits%n == remainder }, nil
+}
+
+// evaluateCondition evaluates the boolean Java expression in the top frame of
+// the thread, which must be suspended by an event.
+func evaluateCondition(
+	ctx context.Context,
+	conn *jdwpclient.Connection,
+	thread jdwpclient.ThreadID,
+	evaluate Evaluator,
+	condition string) (bool, error) {
+
+	if evaluate == nil {
+		return false, fmt.Errorf("Cannot evaluate '%v' without an expression evaluator", condition)
+	}
+	result := false
+	err := jdbg.Do(ctx, conn, thread, func(j *jdbg.JDbg) error {
+		v := evaluate(j, condition)
+		b, ok := v.Get().(bool)
+		if !ok {
+			return fmt.Errorf("Condition '%v' is %v, not boolean", condition, v.Type())
+		}
+		result = b
+		return nil
+	})
+	return result, err
+}
+
+// evaluateLogMessage replaces the Java expressions in braces in the message
+// with their values, evaluated in the top frame of the thread, which must be
+// suspended by an event. Expressions that fail to evaluate are replaced with
+// their error, which is also returned.
+func evaluateLogMessage(
+	ctx context.Context,
+	conn *jdwpclient.Connection,
+	thread jdwpclient.ThreadID,
+	evaluate Evaluator,
+	message string) (string, error) {
+
+	out := strings.Builder{}
+	var firstErr error
+	err := jdbg.Do(ctx, conn, thread, func(j *jdbg.JDbg) error {
+		for s := message; s != ""; {
+			start := strings.IndexByte(s, '{')
+			end := strings.IndexByte(s[start+1:], '}') + start + 1
+			if start < 0 || end <= start {
+				out.WriteString(s)
+				break
+			}
+			out.WriteString(s[:start])
+			expression := s[start+1 : end]
+			s = s[end+1:]
+
+			var text string
+			err := jdbg.Try(func() error {
+				if evaluate == nil {
+					return fmt.Errorf("Cannot evaluate '%v' without an expression evaluator", expression)
+				}
+				text = j.ToString(evaluate(j, expression))
+				return nil
+			})
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				text = fmt.Sprintf("<%v>", err)
+			}
+			out.WriteString(text)
+		}
+		return nil
+	})
+	if err == nil {
+		err = firstErr
+	}
+	return out.String(), err
+}
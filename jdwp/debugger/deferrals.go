@@ -0,0 +1,124 @@
+package debugger
+
+import (
+	"context"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+	"sync"
+)
+
+// deferrals defers the event requests of a manager on classes that are not
+// loaded yet until the classes are prepared. It holds the ClassPrepare
+// requests of each watched class, and shares the mutex of the manager, which
+// must be held when calling its methods.
+type deferrals struct {
+	conn   *jdwpclient.Connection
+	events *Dispatcher
+	mutex  *sync.Mutex
+	nested bool // Whether the nested classes of the watched classes are watched too.
+	// prepared is called with the mutex held each time a type of a watched
+	// class, or of one of its watched nested classes, is prepared.
+	prepared func(ctx context.Context, class string, ty jdwpclient.ClassInfo)
+	watches  map[string][]*jdwpclient.EventRequest // ClassPrepare requests by class
+}
+
+func newDeferrals(
+	events *Dispatcher,
+	mutex *sync.Mutex,
+	nested bool,
+	prepared func(ctx context.Context, class string, ty jdwpclient.ClassInfo)) *deferrals {
+
+	return &deferrals{
+		conn:     events.Connection(),
+		events:   events,
+		mutex:    mutex,
+		nested:   nested,
+		prepared: prepared,
+		watches:  map[string][]*jdwpclient.EventRequest{},
+	}
+}
+
+// prepare watches the class, unless it is already watched, and returns the
+// loaded types of the class, and of its nested classes if they are watched,
+// that are prepared.
+func (d *deferrals) prepare(ctx context.Context, class string) ([]jdwpclient.ClassInfo, error) {
+	if _, ok := d.watches[class]; !ok {
+		patterns := []string{class}
+		if d.nested {
+			patterns = append(patterns, class+"$*")
+		}
+		reqs := []*jdwpclient.EventRequest{}
+		for _, pattern := range patterns {
+			req, err := d.events.Set(ctx, jdwpclient.ClassPrepare, jdwpclient.SuspendEventThread, d.onClassPrepare,
+				jdwpclient.ClassMatchEventModifier(pattern))
+			if err != nil {
+				return nil, err
+			}
+			reqs = append(reqs, req)
+		}
+		d.watches[class] = reqs
+	}
+
+	var classes []jdwpclient.ClassInfo
+	var err error
+	if d.nested {
+		classes, err = d.conn.GetAllClasses(ctx)
+	} else {
+		classes, err = d.conn.GetClassesBySignature(ctx, classSignature(class))
+	}
+	if err != nil {
+		return nil, err
+	}
+	sig := classSignature(class)
+	nested := strings.TrimSuffix(sig, ";") + "$"
+	out := []jdwpclient.ClassInfo{}
+	for _, c := range classes {
+		if c.Status&jdwpclient.StatusPrepared == 0 {
+			continue
+		}
+		if c.Signature == sig || d.nested && strings.HasPrefix(c.Signature, nested) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// unwatchUnused clears the ClassPrepare requests of the classes that are not
+// used.
+func (d *deferrals) unwatchUnused(ctx context.Context, used map[string]bool) {
+	for class, reqs := range d.watches {
+		if used[class] {
+			continue
+		}
+		for _, req := range reqs {
+			if err := d.events.Clear(ctx, req); err != nil {
+				log.Warn().Err(err).Str("class", class).Msg("Couldn't clear class prepare request")
+			}
+		}
+		delete(d.watches, class)
+	}
+}
+
+func (d *deferrals) onClassPrepare(ctx context.Context, event jdwpclient.Event) {
+	e := event.(*jdwpclient.EventClassPrepare)
+	defer func() {
+		if err := d.events.Resume(ctx, event); err != nil {
+			log.Warn().Err(err).Msg("Couldn't resume thread after class prepare")
+		}
+	}()
+
+	ty := jdwpclient.ClassInfo{
+		Kind:      e.ClassKind,
+		TypeID:    e.ClassType,
+		Signature: e.Signature,
+		Status:    e.Status,
+	}
+	class := classNameForSignature(e.Signature)
+	if i := strings.IndexByte(class, '$'); d.nested && i >= 0 {
+		class = class[:i]
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.prepared(ctx, class, ty)
+}
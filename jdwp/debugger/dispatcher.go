@@ -0,0 +1,227 @@
+package debugger
+
+import (
+	"context"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sync"
+)
+
+// EventHandler is the function called for each event raised by a request.
+// Handlers are called one at a time on the dispatcher's goroutine, with the
+// dispatcher's context. The threads suspended by the event stay suspended
+// unless the handler calls Dispatcher.Resume, or Dispatcher.Defer to decide
+// once it returns.
+type EventHandler func(context.Context, jdwpclient.Event)
+
+// Dispatcher consumes the event stream of a connection, multiplexing the
+// events to the handlers of the requests that raised them.
+type Dispatcher struct {
+	conn      *jdwpclient.Connection
+	mutex     sync.Mutex
+	handlers  map[jdwpclient.EventRequestID]EventHandler
+	unhandled []EventHandler
+	pending   map[jdwpclient.Event]*pendingEvent // Events not yet resumed or stopped.
+}
+
+// eventSet tracks whether to resume the threads suspended by an event set.
+type eventSet struct {
+	policy    jdwpclient.SuspendPolicy
+	thread    jdwpclient.ThreadID // Thread suspended by a SuspendEventThread set.
+	undecided int                 // Number of events not yet resumed or stopped.
+	stop      bool                // Whether one of the events stopped.
+}
+
+// pendingEvent is an event whose handler has not yet resumed or stopped.
+type pendingEvent struct {
+	set      *eventSet
+	deferred bool // Whether the handler decides once it returns.
+}
+
+// NewDispatcher returns a dispatcher for the events of conn. The dispatcher
+// runs until ctx is cancelled or the connection's event stream is closed.
+// There must only be one dispatcher per connection.
+func NewDispatcher(ctx context.Context, conn *jdwpclient.Connection) *Dispatcher {
+	d := &Dispatcher{
+		conn:     conn,
+		handlers: map[jdwpclient.EventRequestID]EventHandler{},
+		pending:  map[jdwpclient.Event]*pendingEvent{},
+	}
+	go d.run(ctx)
+	return d
+}
+
+// Connection returns the JDWP connection.
+func (d *Dispatcher) Connection() *jdwpclient.Connection { return d.conn }
+
+// Set sets a new event request, calling handler for each event it raises.
+func (d *Dispatcher) Set(
+	ctx context.Context,
+	kind jdwpclient.EventKind,
+	suspendPolicy jdwpclient.SuspendPolicy,
+	handler EventHandler,
+	modifiers ...jdwpclient.EventModifier) (*jdwpclient.EventRequest, error) {
+
+	// Holding the lock prevents the dispatch of an event raised by the new
+	// request before its handler is registered.
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	req, err := d.conn.SetEventRequest(ctx, kind, suspendPolicy, modifiers...)
+	if err != nil {
+		return nil, err
+	}
+	d.handlers[req.ID] = handler
+	return req, nil
+}
+
+// Clear clears the event request and unregisters its handler.
+func (d *Dispatcher) Clear(ctx context.Context, req *jdwpclient.EventRequest) error {
+	d.mutex.Lock()
+	delete(d.handlers, req.ID)
+	d.mutex.Unlock()
+	return d.conn.ClearEventRequest(ctx, req)
+}
+
+// Unhandled registers handler to be called for each event that has no
+// registered handler, such as the automatically generated VMDeath event.
+func (d *Dispatcher) Unhandled(handler EventHandler) {
+	d.mutex.Lock()
+	d.unhandled = append(d.unhandled, handler)
+	d.mutex.Unlock()
+}
+
+// Defer lets the handler of the event resume or stop after it returns, with
+// a later call to Resume or Stop.
+func (d *Dispatcher) Defer(event jdwpclient.Event) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if p, ok := d.pending[event]; ok {
+		p.deferred = true
+	}
+}
+
+// Resume resumes the threads suspended by the event, once all the other events
+// raised with it in the same composite event are resumed too. If any of them
+// stops, the threads stay suspended.
+func (d *Dispatcher) Resume(ctx context.Context, event jdwpclient.Event) error {
+	return d.decide(ctx, event, false)
+}
+
+// Stop keeps the threads suspended by the event suspended. Handlers only need
+// to call Stop after deferring their decision with Defer.
+func (d *Dispatcher) Stop(event jdwpclient.Event) {
+	d.decide(context.Background(), event, true)
+}
+
+// decide resumes or stops after the event, resuming the threads suspended by
+// its set once all the events of the set are resumed.
+func (d *Dispatcher) decide(ctx context.Context, event jdwpclient.Event, stop bool) error {
+	d.mutex.Lock()
+	p, ok := d.pending[event]
+	delete(d.pending, event)
+	resume := false
+	if ok {
+		p.set.undecided--
+		p.set.stop = p.set.stop || stop
+		resume = p.set.undecided == 0 && !p.set.stop
+	}
+	d.mutex.Unlock()
+	if !resume {
+		return nil
+	}
+	switch {
+	case p.set.policy == jdwpclient.SuspendAll:
+		return d.conn.ResumeAll(ctx)
+	case p.set.policy == jdwpclient.SuspendEventThread && p.set.thread != 0:
+		return d.conn.Resume(ctx, p.set.thread)
+	}
+	return nil
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	sets := d.conn.Events()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case set, ok := <-sets:
+			if !ok {
+				return
+			}
+			d.dispatchSet(ctx, set)
+		}
+	}
+}
+
+// dispatchSet dispatches the events of the set. Events whose handlers return
+// without resuming or deferring stop.
+func (d *Dispatcher) dispatchSet(ctx context.Context, set jdwpclient.EventSet) {
+	s := &eventSet{policy: set.Policy, undecided: len(set.Events)}
+	d.mutex.Lock()
+	for _, event := range set.Events {
+		if thread := eventThread(event); thread != 0 {
+			s.thread = thread
+		}
+		d.pending[event] = &pendingEvent{set: s}
+	}
+	d.mutex.Unlock()
+
+	for _, event := range set.Events {
+		d.dispatch(ctx, event)
+		d.mutex.Lock()
+		p, ok := d.pending[event]
+		stop := ok && !p.deferred
+		d.mutex.Unlock()
+		if stop {
+			d.Stop(event)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event jdwpclient.Event) {
+	d.mutex.Lock()
+	handler, ok := d.handlers[event.RequestID()]
+	unhandled := d.unhandled
+	d.mutex.Unlock()
+
+	if ok {
+		handler(ctx, event)
+		return
+	}
+	if len(unhandled) == 0 {
+		log.Debug().Int("request", int(event.RequestID())).Str("kind", event.Kind().String()).
+			Msg("No handler for event")
+	}
+	for _, h := range unhandled {
+		h(ctx, event)
+	}
+}
+
+// eventThread returns the thread that raised the event, or 0 if the event is
+// not raised by a thread.
+func eventThread(event jdwpclient.Event) jdwpclient.ThreadID {
+	switch e := event.(type) {
+	case *jdwpclient.EventVMStart:
+		return e.Thread
+	case *jdwpclient.EventSingleStep:
+		return e.Thread
+	case *jdwpclient.EventBreakpoint:
+		return e.Thread
+	case *jdwpclient.EventMethodEntry:
+		return e.Thread
+	case *jdwpclient.EventMethodExit:
+		return e.Thread
+	case *jdwpclient.EventException:
+		return e.Thread
+	case *jdwpclient.EventThreadStart:
+		return e.Thread
+	case *jdwpclient.EventThreadDeath:
+		return e.Thread
+	case *jdwpclient.EventClassPrepare:
+		return e.Thread
+	case *jdwpclient.EventFieldAccess:
+		return e.Thread
+	case *jdwpclient.EventFieldModification:
+		return e.Thread
+	}
+	return 0
+}
@@ -0,0 +1,239 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sync"
+)
+
+// ExceptionBreakpoint stops threads that throw exceptions. Exception
+// breakpoints on a class also stop on exceptions of its subclasses.
+type ExceptionBreakpoint struct {
+	ID       int
+	Class    string // Fully qualified name of the exception class, or empty for all exceptions.
+	Caught   bool   // Stop on exceptions that will be caught.
+	Uncaught bool   // Stop on exceptions that will not be caught.
+	Verified bool   // True once the breakpoint is set for a loaded class.
+	Message  string // Explains why the breakpoint is not verified.
+
+	requests []*jdwpclient.EventRequest
+}
+
+// ExceptionDetails describes a thrown exception.
+type ExceptionDetails struct {
+	Exception     jdwpclient.ObjectID
+	Type          string               // Fully qualified class name of the exception.
+	Message       string               // Result of getMessage(), empty if null.
+	StackTrace    []string             // Elements of getStackTrace(), innermost first.
+	Location      jdwpclient.Location  // Where the exception was thrown.
+	CatchLocation *jdwpclient.Location // Where the exception will be caught, nil if uncaught.
+}
+
+// ExceptionHit describes a thread stopping at an exception breakpoint.
+type ExceptionHit struct {
+	Breakpoint ExceptionBreakpoint
+	Thread     jdwpclient.ThreadID
+	Details    ExceptionDetails
+}
+
+// Exceptions manages the exception breakpoints of a debug session.
+// Breakpoints on exception classes that are not yet loaded are deferred until
+// the class is prepared.
+type Exceptions struct {
+	conn    *jdwpclient.Connection
+	events  *Dispatcher
+	hits    chan ExceptionHit
+	changed chan ExceptionBreakpoint
+
+	ids       *IDs
+	mutex     sync.Mutex
+	bps       []*ExceptionBreakpoint
+	byRequest map[jdwpclient.EventRequestID]*ExceptionBreakpoint
+	deferred  *deferrals
+}
+
+// NewExceptions returns a new exception breakpoint manager using the events
+// dispatcher, which allocates the IDs of the breakpoints from ids.
+func NewExceptions(events *Dispatcher, ids *IDs) *Exceptions {
+	e := &Exceptions{
+		conn:      events.Connection(),
+		events:    events,
+		hits:      make(chan ExceptionHit, 16),
+		changed:   make(chan ExceptionBreakpoint, 16),
+		ids:       ids,
+		byRequest: map[jdwpclient.EventRequestID]*ExceptionBreakpoint{},
+	}
+	e.deferred = newDeferrals(events, &e.mutex, false, e.onClassPrepare)
+	return e
+}
+
+// Hits returns the channel that receives an ExceptionHit each time a thread
+// stops at an exception breakpoint. All threads are suspended when an
+// exception breakpoint is hit.
+func (e *Exceptions) Hits() <-chan ExceptionHit { return e.hits }
+
+// Changed returns the channel that receives deferred exception breakpoints as
+// they become verified. Changes are dropped while the channel is full.
+func (e *Exceptions) Changed() <-chan ExceptionBreakpoint { return e.changed }
+
+// Set replaces all the exception breakpoints with bps, returning the new
+// breakpoints in the same order. The ID, Verified and Message fields of bps
+// are ignored.
+func (e *Exceptions) Set(ctx context.Context, bps []ExceptionBreakpoint) ([]ExceptionBreakpoint, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, bp := range e.bps {
+		e.clear(ctx, bp)
+	}
+	e.bps = nil
+
+	out := make([]ExceptionBreakpoint, len(bps))
+	for i, req := range bps {
+		bp := &ExceptionBreakpoint{ID: e.ids.Next(), Class: req.Class, Caught: req.Caught, Uncaught: req.Uncaught}
+		e.bps = append(e.bps, bp)
+		if err := e.resolve(ctx, bp); err != nil {
+			return nil, err
+		}
+		out[i] = *bp
+	}
+	used := map[string]bool{}
+	for _, bp := range e.bps {
+		used[bp.Class] = true
+	}
+	e.deferred.unwatchUnused(ctx, used)
+	return out, nil
+}
+
+// resolve sets the exception requests for the breakpoint in all the loaded
+// types of its class, deferring the breakpoint if the class is not loaded.
+func (e *Exceptions) resolve(ctx context.Context, bp *ExceptionBreakpoint) error {
+	if bp.Class == "" {
+		bp.Verified = true
+		return e.set(ctx, bp, 0)
+	}
+	types, err := e.deferred.prepare(ctx, bp.Class)
+	if err != nil {
+		return err
+	}
+	for _, ty := range types {
+		if err := e.set(ctx, bp, ty.TypeID); err != nil {
+			return err
+		}
+		bp.Verified = true
+	}
+	if !bp.Verified {
+		bp.Message = fmt.Sprintf("Class %v is not loaded yet", bp.Class)
+	}
+	return nil
+}
+
+// set sets an exception request for the breakpoint on exceptions of the type,
+// or all exceptions if ty is 0.
+func (e *Exceptions) set(ctx context.Context, bp *ExceptionBreakpoint, ty jdwpclient.ReferenceTypeID) error {
+	req, err := e.events.Set(ctx, jdwpclient.Exception, jdwpclient.SuspendAll, e.onException,
+		jdwpclient.ExceptionOnlyEventModifier{ExceptionOrNull: ty, Caught: bp.Caught, Uncaught: bp.Uncaught})
+	if err != nil {
+		return err
+	}
+	bp.requests = append(bp.requests, req)
+	e.byRequest[req.ID] = bp
+	return nil
+}
+
+// clear removes all the event requests for the breakpoint.
+func (e *Exceptions) clear(ctx context.Context, bp *ExceptionBreakpoint) {
+	for _, req := range bp.requests {
+		if err := e.events.Clear(ctx, req); err != nil {
+			log.Warn().Err(err).Int("breakpoint", bp.ID).Msg("Couldn't clear exception request")
+		}
+		delete(e.byRequest, req.ID)
+	}
+	bp.requests, bp.Verified = nil, false
+}
+
+// onClassPrepare sets the deferred exception breakpoints on the class in the
+// prepared type.
+func (e *Exceptions) onClassPrepare(ctx context.Context, class string, ty jdwpclient.ClassInfo) {
+	for _, bp := range e.bps {
+		if bp.Class != class {
+			continue
+		}
+		wasVerified := bp.Verified
+		if err := e.set(ctx, bp, ty.TypeID); err != nil {
+			log.Warn().Err(err).Int("breakpoint", bp.ID).Msg("Couldn't set deferred exception breakpoint")
+			continue
+		}
+		bp.Verified, bp.Message = true, ""
+		if !wasVerified {
+			// Don't stall the dispatcher if nothing reads the changes.
+			select {
+			case e.changed <- *bp:
+			default:
+				log.Warn().Int("breakpoint", bp.ID).Msg("Dropped change of verified exception breakpoint")
+			}
+		}
+	}
+}
+
+func (e *Exceptions) onException(ctx context.Context, event jdwpclient.Event) {
+	ev := event.(*jdwpclient.EventException)
+	e.mutex.Lock()
+	bp, ok := e.byRequest[ev.Request]
+	var hit ExceptionHit
+	if ok {
+		hit = ExceptionHit{Breakpoint: *bp, Thread: ev.Thread}
+	}
+	e.mutex.Unlock()
+	if !ok {
+		// The breakpoint was cleared after the event was raised.
+		if err := e.events.Resume(ctx, event); err != nil {
+			log.Warn().Err(err).Msg("Couldn't resume after stale exception breakpoint")
+		}
+		return
+	}
+
+	// Describing the exception invokes methods in the VM, which may raise
+	// events that need the dispatcher.
+	go func() {
+		details, err := DescribeException(ctx, e.conn, ev)
+		if err != nil {
+			log.Warn().Err(err).Int("breakpoint", hit.Breakpoint.ID).Msg("Couldn't describe exception")
+		}
+		hit.Details = details
+		e.hits <- hit
+	}()
+}
+
+// DescribeException returns the details of the exception of the event. The
+// exception's methods are invoked on the event's thread, which must be
+// suspended by the event. If the methods fail, the partial details are
+// returned with the error.
+func DescribeException(ctx context.Context, conn *jdwpclient.Connection, ev *jdwpclient.EventException) (ExceptionDetails, error) {
+	details := ExceptionDetails{
+		Exception: ev.Exception.Object,
+		Location:  ev.Location,
+	}
+	if ev.CatchLocation.Method != 0 {
+		catch := ev.CatchLocation
+		details.CatchLocation = &catch
+	}
+	err := jdbg.Do(ctx, conn, ev.Thread, func(j *jdbg.JDbg) error {
+		exception := j.Object(ev.Exception.Object)
+		details.Type = exception.Type().String()
+		if message := exception.Call("getMessage"); !message.IsNull() {
+			details.Message = fmt.Sprint(message.Get())
+		}
+		trace := exception.Call("getStackTrace")
+		if trace.IsNull() {
+			return nil
+		}
+		for _, element := range trace.ArrayValues(0, trace.ArrayLength()) {
+			details.StackTrace = append(details.StackTrace, fmt.Sprint(element.Call("toString").Get()))
+		}
+		return nil
+	})
+	return details, err
+}
@@ -0,0 +1,33 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+)
+
+// RestartFrame runs the method of frame again on the suspended thread. The
+// frames up to and including frame are popped, and the thread steps into the
+// method, stopping at its first instruction. The side effects of the popped
+// frames are not undone. The thread is suspended at the returned location
+// when RestartFrame returns.
+func RestartFrame(
+	ctx context.Context,
+	events *Dispatcher,
+	thread jdwpclient.ThreadID,
+	frame jdwpclient.FrameInfo) (jdwpclient.Location, error) {
+
+	conn := events.Connection()
+	if err := conn.PopFrames(ctx, thread, frame.Frame); err != nil {
+		return jdwpclient.Location{}, fmt.Errorf("Failed to pop frames: %w", err)
+	}
+	location, err := step(ctx, events, thread, jdwpclient.StepMin, jdwpclient.StepInto, jdwpclient.SuspendEventThread)
+	if err != nil {
+		return jdwpclient.Location{}, err
+	}
+	if location.Method != frame.Location.Method {
+		log.Warn().Uint64("method", uint64(location.Method)).
+			Msg("Restarted frame stopped in a different method")
+	}
+	return location, nil
+}
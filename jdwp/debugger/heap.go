@@ -0,0 +1,177 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sort"
+)
+
+// ClassCount is the number of reachable instances of a class, as reported by
+// ClassHistogram.
+type ClassCount struct {
+	Type      jdwpclient.ReferenceTypeID
+	Name      string // Fully qualified name, or the signature of an array type.
+	Instances int64
+}
+
+// ClassHistogram returns the number of reachable instances of each loaded
+// class, ordered by decreasing count, then by name. Classes without instances
+// are left out.
+//
+// The VM must be able to report instance information.
+func ClassHistogram(ctx context.Context, conn *jdwpclient.Connection) ([]ClassCount, error) {
+	if err := conn.Capabilities().Require(jdwpclient.InstanceInfo); err != nil {
+		return nil, err
+	}
+	classes, err := conn.GetAllClasses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the loaded classes: %w", err)
+	}
+	types := make([]jdwpclient.ReferenceTypeID, len(classes))
+	for i, c := range classes {
+		types[i] = c.TypeID
+	}
+	counts, err := conn.GetInstanceCounts(ctx, types...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the instance counts: %w", err)
+	}
+	histogram := []ClassCount{}
+	for i, c := range classes {
+		if i < len(counts) && counts[i] > 0 {
+			histogram = append(histogram, ClassCount{Type: c.TypeID, Name: classNameForSignature(c.Signature), Instances: counts[i]})
+		}
+	}
+	sort.Slice(histogram, func(i, j int) bool {
+		a, b := histogram[i], histogram[j]
+		if a.Instances != b.Instances {
+			return a.Instances > b.Instances
+		}
+		return a.Name < b.Name
+	})
+	return histogram, nil
+}
+
+// RootKind is the kind of root that keeps an object alive.
+type RootKind int
+
+const (
+	// NoRoot means that no thread or static root was found: the object is
+	// held by roots that are not objects, such as local variables and JNI
+	// references, or by a chain longer than the search allowed.
+	NoRoot RootKind = iota
+	// ThreadRoot is a java.lang.Thread object.
+	ThreadRoot
+	// StaticRoot is a class whose static fields hold a reference.
+	StaticRoot
+)
+
+func (k RootKind) String() string {
+	switch k {
+	case ThreadRoot:
+		return "thread"
+	case StaticRoot:
+		return "static"
+	}
+	return "none"
+}
+
+// RetentionPath is a chain of references that keeps an object alive, as found
+// by WhyAlive.
+type RetentionPath struct {
+	Root RootKind
+	// Name is the name of the root thread, or of the class holding the static
+	// reference.
+	Name string
+	// Objects holds the chain from the root to the object: each object holds
+	// a reference to the next one. For a StaticRoot the first object is the
+	// class object. Without root, Objects only holds the object.
+	Objects []jdwpclient.TaggedObjectID
+}
+
+// DefaultRetentionSearch is the number of objects WhyAlive visits before
+// giving up, when no limit is given.
+const DefaultRetentionSearch = 10000
+
+// WhyAlive suspends the VM and follows the objects referring to obj, breadth
+// first, until it finds a thread or a class holding it. The returned path is
+// a shortest chain from such a root. At most limit objects are visited, or
+// DefaultRetentionSearch if limit is zero. The VM is resumed before WhyAlive
+// returns.
+//
+// The VM must be able to report instance information.
+func WhyAlive(ctx context.Context, conn *jdwpclient.Connection, obj jdwpclient.ObjectID, limit int) (RetentionPath, error) {
+	if err := conn.Capabilities().Require(jdwpclient.InstanceInfo); err != nil {
+		return RetentionPath{}, err
+	}
+	if limit <= 0 {
+		limit = DefaultRetentionSearch
+	}
+	if err := conn.SuspendAll(ctx); err != nil {
+		return RetentionPath{}, fmt.Errorf("Failed to suspend the VM: %w", err)
+	}
+	defer func() {
+		if err := conn.ResumeAll(context.WithoutCancel(ctx)); err != nil {
+			log.Warn().Err(err).Msg("Failed to resume the VM after walking referrers")
+		}
+	}()
+
+	// towards maps each visited object to the object it refers to, on the
+	// way to obj.
+	towards := map[jdwpclient.ObjectID]jdwpclient.ObjectID{obj: 0}
+	tags := map[jdwpclient.ObjectID]jdwpclient.Tag{obj: jdwpclient.TagObject}
+	queue := []jdwpclient.ObjectID{obj}
+	for visited := 0; len(queue) > 0 && visited < limit; visited++ {
+		id := queue[0]
+		queue = queue[1:]
+		referrers, err := conn.GetReferringObjects(ctx, id, 0)
+		if err != nil {
+			return RetentionPath{}, fmt.Errorf("Failed to get the objects referring to %v: %w", id, err)
+		}
+		for _, r := range referrers {
+			if _, seen := towards[r.Object]; seen {
+				continue
+			}
+			towards[r.Object], tags[r.Object] = id, r.Type
+			switch r.Type {
+			case jdwpclient.TagThread, jdwpclient.TagClassObject:
+				return retentionPath(ctx, conn, r, towards, tags)
+			}
+			queue = append(queue, r.Object)
+		}
+	}
+	return RetentionPath{Root: NoRoot, Objects: []jdwpclient.TaggedObjectID{{Type: jdwpclient.TagObject, Object: obj}}}, nil
+}
+
+// retentionPath returns the path from the root to the object WhyAlive started
+// from.
+func retentionPath(
+	ctx context.Context,
+	conn *jdwpclient.Connection,
+	root jdwpclient.TaggedObjectID,
+	towards map[jdwpclient.ObjectID]jdwpclient.ObjectID,
+	tags map[jdwpclient.ObjectID]jdwpclient.Tag) (RetentionPath, error) {
+
+	path := RetentionPath{}
+	for id := root.Object; id != 0; id = towards[id] {
+		path.Objects = append(path.Objects, jdwpclient.TaggedObjectID{Type: tags[id], Object: id})
+	}
+	if root.Type == jdwpclient.TagThread {
+		name, err := conn.GetThreadName(ctx, jdwpclient.ThreadID(root.Object))
+		if err != nil {
+			return RetentionPath{}, fmt.Errorf("Failed to get the name of the root thread: %w", err)
+		}
+		path.Root, path.Name = ThreadRoot, name
+		return path, nil
+	}
+	ty, err := conn.ReflectedType(ctx, jdwpclient.ClassObjectID(root.Object))
+	if err != nil {
+		return RetentionPath{}, fmt.Errorf("Failed to get the class of the root: %w", err)
+	}
+	sig, err := conn.GetTypeSignature(ctx, ty)
+	if err != nil {
+		return RetentionPath{}, fmt.Errorf("Failed to get the signature of the root class: %w", err)
+	}
+	path.Root, path.Name = StaticRoot, classNameForSignature(sig)
+	return path, nil
+}
@@ -0,0 +1,267 @@
+package debugger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Redefinition describes the outcome of replacing the code of loaded classes.
+type Redefinition struct {
+	Classes  []jdwpclient.ClassInfo // The redefined loaded types.
+	Skipped  []string               // Signatures of the classes that are not loaded.
+	Obsolete []ObsoleteMethod       // Methods replaced while suspended threads ran them.
+}
+
+// ObsoleteMethod is a method that was replaced by a non-equivalent method
+// while suspended threads were running it. Their frames keep running the old
+// code, which the VM identifies with a new method ID, until they return.
+type ObsoleteMethod struct {
+	Class jdwpclient.ClassInfo
+	// Method is the declaration of the method, whose ID now identifies the
+	// new code. Only its ID is known if the frames could not be matched to
+	// the frames before the redefinition.
+	Method   jdwpclient.Method
+	Obsolete jdwpclient.MethodID   // The identifier of the old code.
+	Threads  []jdwpclient.ThreadID // The suspended threads running the old code.
+}
+
+func (m ObsoleteMethod) String() string {
+	return fmt.Sprintf("%v.%v%v", m.Class.Signature, m.Method.Name, m.Method.Signature)
+}
+
+// RedefineClasses replaces the code of the loaded classes with the class files
+// in classes, keyed by class signature. Classes that are not loaded are
+// skipped, as they will load the new class files when they are first used.
+// All the loaded types of a class, such as the same class loaded by different
+// class loaders, are redefined.
+//
+// The obsolete methods are found from the frames of the suspended threads:
+// the VM keeps the method IDs for the new code, so only the frames running the
+// old code refer to obsolete methods.
+func RedefineClasses(ctx context.Context, conn *jdwpclient.Connection, classes map[string][]byte) (Redefinition, error) {
+	if err := conn.Capabilities().Require(jdwpclient.RedefineClasses); err != nil {
+		return Redefinition{}, err
+	}
+	signatures := make([]string, 0, len(classes))
+	for sig := range classes {
+		signatures = append(signatures, sig)
+	}
+	sort.Strings(signatures)
+
+	out := Redefinition{}
+	defs := []jdwpclient.ClassDefinition{}
+	methods := map[jdwpclient.ReferenceTypeID]jdwpclient.Methods{}
+	for _, sig := range signatures {
+		types, err := conn.GetClassesBySignature(ctx, sig)
+		if err != nil {
+			return Redefinition{}, err
+		}
+		if len(types) == 0 {
+			out.Skipped = append(out.Skipped, sig)
+			continue
+		}
+		for _, ty := range types {
+			// Keep the declarations to name the obsolete methods.
+			if methods[ty.TypeID], err = conn.GetMethods(ctx, ty.TypeID); err != nil {
+				return Redefinition{}, err
+			}
+			defs = append(defs, jdwpclient.ClassDefinition{Type: ty.TypeID, Bytes: classes[sig]})
+			out.Classes = append(out.Classes, ty)
+		}
+	}
+	if len(defs) == 0 {
+		return out, nil
+	}
+	before, _, err := suspendedFrames(ctx, conn)
+	if err != nil {
+		return Redefinition{}, err
+	}
+	if err := conn.RedefineClasses(ctx, defs); err != nil {
+		return Redefinition{}, fmt.Errorf("Failed to redefine %v: %w", strings.Join(signatures, ", "), err)
+	}
+
+	after, threads, err := suspendedFrames(ctx, conn)
+	if err != nil {
+		return out, err
+	}
+	redefined := map[jdwpclient.ReferenceTypeID]jdwpclient.ClassInfo{}
+	for _, ty := range out.Classes {
+		redefined[ty.TypeID] = ty
+	}
+	obsolete := map[jdwpclient.MethodID]int{} // Index in out.Obsolete, or -1.
+	for _, thread := range threads {
+		for depth, f := range after[thread] {
+			ty, ok := redefined[jdwpclient.ReferenceTypeID(f.Location.Class)]
+			if !ok {
+				continue
+			}
+			i, seen := obsolete[f.Location.Method]
+			if !seen {
+				isObsolete, err := conn.IsObsolete(ctx, ty.TypeID, f.Location.Method)
+				if err != nil {
+					return out, err
+				}
+				i = -1
+				if isObsolete {
+					m := ObsoleteMethod{Class: ty, Method: jdwpclient.Method{ID: f.Location.Method}, Obsolete: f.Location.Method}
+					if old := before[thread]; depth < len(old) && old[depth].Location.Class == f.Location.Class {
+						for _, decl := range methods[ty.TypeID] {
+							if decl.ID == old[depth].Location.Method {
+								m.Method = decl
+							}
+						}
+					}
+					i = len(out.Obsolete)
+					out.Obsolete = append(out.Obsolete, m)
+				}
+				obsolete[f.Location.Method] = i
+			}
+			if i >= 0 && !containsThread(out.Obsolete[i].Threads, thread) {
+				out.Obsolete[i].Threads = append(out.Obsolete[i].Threads, thread)
+			}
+		}
+	}
+	return out, nil
+}
+
+// suspendedFrames returns the frames of the suspended threads, and the
+// threads in the order of the VM.
+func suspendedFrames(ctx context.Context, conn *jdwpclient.Connection) (map[jdwpclient.ThreadID][]jdwpclient.FrameInfo, []jdwpclient.ThreadID, error) {
+	ids, err := conn.GetAllThreads(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to get the threads: %w", err)
+	}
+	frames := map[jdwpclient.ThreadID][]jdwpclient.FrameInfo{}
+	threads := []jdwpclient.ThreadID{}
+	for _, id := range ids {
+		count, err := conn.GetSuspendCount(ctx, id)
+		if err == nil && count > 0 {
+			frames[id], err = conn.GetFrames(ctx, id, 0, -1)
+		}
+		switch {
+		case errors.Is(err, jdwpclient.ErrInvalidThread), errors.Is(err, jdwpclient.ErrThreadNotSuspended):
+			continue // The thread terminated or was resumed.
+		case err != nil:
+			return nil, nil, fmt.Errorf("Failed to get the frames of thread %v: %w", id, err)
+		case count > 0:
+			threads = append(threads, id)
+		}
+	}
+	return frames, threads, nil
+}
+
+func containsThread(threads []jdwpclient.ThreadID, thread jdwpclient.ThreadID) bool {
+	for _, t := range threads {
+		if t == thread {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassWatcher watches directories of compiled classes, such as a build's
+// output directory, and redefines the loaded classes whose class files
+// change.
+type ClassWatcher struct {
+	conn  *jdwpclient.Connection
+	dirs  []string
+	files map[string]classFile // By path.
+}
+
+// classFile is the state of a class file when it was last scanned.
+type classFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewClassWatcher returns a watcher of the class directories. Class files
+// that already exist are only redefined once they change.
+func NewClassWatcher(conn *jdwpclient.Connection, dirs ...string) (*ClassWatcher, error) {
+	w := &ClassWatcher{conn: conn, dirs: dirs}
+	if _, err := w.Changed(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Changed returns the class files that were created or modified since the
+// last scan, keyed by class signature.
+func (w *ClassWatcher) Changed() (map[string][]byte, error) {
+	first := w.files == nil
+	files := map[string]classFile{}
+	changed := map[string][]byte{}
+	for _, dir := range w.dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == dir && os.IsNotExist(err) {
+					return filepath.SkipDir // The build has not created it yet.
+				}
+				return err
+			}
+			if d.IsDir() || filepath.Ext(path) != ".class" {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			file := classFile{modTime: info.ModTime(), size: info.Size()}
+			files[path] = file
+			if old, ok := w.files[path]; first || (ok && old == file) {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			bytes, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			sig := "L" + filepath.ToSlash(strings.TrimSuffix(rel, ".class")) + ";"
+			changed[sig] = bytes
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan class directory %v: %w", dir, err)
+		}
+	}
+	w.files = files
+	return changed, nil
+}
+
+// Poll redefines the loaded classes whose class files changed since the last
+// scan.
+func (w *ClassWatcher) Poll(ctx context.Context) (Redefinition, error) {
+	changed, err := w.Changed()
+	if err != nil || len(changed) == 0 {
+		return Redefinition{}, err
+	}
+	return RedefineClasses(ctx, w.conn, changed)
+}
+
+// Run polls the class directories at the interval until ctx is done, calling
+// f with the outcome of each poll that found changed classes.
+func (w *ClassWatcher) Run(ctx context.Context, interval time.Duration, f func(Redefinition, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		res, err := w.Poll(ctx)
+		if err != nil || len(res.Classes) > 0 || len(res.Skipped) > 0 {
+			f(res, err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package debugger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sort"
+)
+
+// LockAnalysis is the state of the monitors of the VM, as captured by
+// AnalyzeLocks.
+type LockAnalysis struct {
+	// Contended holds the monitors that threads are blocked on, ordered by
+	// object ID.
+	Contended []ContendedMonitor
+	// Deadlocks holds the cycles of threads blocked on each other.
+	Deadlocks []Deadlock
+}
+
+// ContendedMonitor is a monitor that threads are blocked on entering.
+type ContendedMonitor struct {
+	Monitor    jdwpclient.ObjectID
+	Owner      jdwpclient.ThreadID // The thread owning the monitor, or zero.
+	EntryCount int                 // The number of entries by the owner, or zero if unknown.
+	Blocked    []jdwpclient.ThreadID
+}
+
+// Deadlock is a cycle of threads, each blocked on entering a monitor owned by
+// the next thread of the cycle.
+type Deadlock []BlockedThread
+
+// BlockedThread is a thread of a deadlock.
+type BlockedThread struct {
+	Thread  jdwpclient.ThreadID
+	Name    string
+	Monitor jdwpclient.ObjectID // The monitor the thread is blocked on.
+	Owner   jdwpclient.ThreadID // The thread owning Monitor.
+	// Depth is the index of the frame of Owner that entered Monitor, from the
+	// top of its stack, or -1 if unknown. Acquired is the location of that
+	// frame.
+	Depth    int
+	Acquired jdwpclient.Location
+}
+
+// lockThread is the monitor state of a thread.
+type lockThread struct {
+	name    string
+	blocked jdwpclient.ObjectID // The monitor the thread is blocked on, if any.
+	owned   []jdwpclient.OwnedMonitor
+}
+
+// AnalyzeLocks suspends the VM, builds the graph of the threads waiting for
+// monitors owned by other threads, and reports the contended monitors and the
+// deadlocks. The VM is resumed before AnalyzeLocks returns.
+//
+// The VM must be able to report the owned and contended monitors of threads.
+// The depths at which monitors were entered and the entry counts are only
+// reported if the VM can get them.
+func AnalyzeLocks(ctx context.Context, conn *jdwpclient.Connection) (LockAnalysis, error) {
+	capabilities := conn.Capabilities()
+	for _, f := range []jdwpclient.Feature{jdwpclient.OwnedMonitorInfo, jdwpclient.CurrentContendedMonitor} {
+		if err := capabilities.Require(f); err != nil {
+			return LockAnalysis{}, err
+		}
+	}
+	if err := conn.SuspendAll(ctx); err != nil {
+		return LockAnalysis{}, fmt.Errorf("Failed to suspend the VM: %w", err)
+	}
+	defer func() {
+		if err := conn.ResumeAll(context.WithoutCancel(ctx)); err != nil {
+			log.Warn().Err(err).Msg("Failed to resume the VM after analyzing locks")
+		}
+	}()
+
+	ids, err := conn.GetAllThreads(ctx)
+	if err != nil {
+		return LockAnalysis{}, fmt.Errorf("Failed to get the threads: %w", err)
+	}
+	threads := map[jdwpclient.ThreadID]*lockThread{}
+	owners := map[jdwpclient.ObjectID]jdwpclient.ThreadID{}
+	for _, id := range ids {
+		t, err := getLockThread(ctx, conn, id)
+		if errors.Is(err, jdwpclient.ErrInvalidThread) {
+			continue // The thread terminated.
+		}
+		if err != nil {
+			return LockAnalysis{}, err
+		}
+		threads[id] = t
+		for _, m := range t.owned {
+			owners[m.Monitor.Object] = id
+		}
+	}
+
+	analysis := LockAnalysis{}
+	contended := map[jdwpclient.ObjectID]*ContendedMonitor{}
+	for _, id := range ids {
+		t := threads[id]
+		if t == nil || t.blocked == 0 {
+			continue
+		}
+		c := contended[t.blocked]
+		if c == nil {
+			c = &ContendedMonitor{Monitor: t.blocked, Owner: owners[t.blocked]}
+			contended[t.blocked] = c
+		}
+		c.Blocked = append(c.Blocked, id)
+	}
+	for _, c := range contended {
+		if capabilities.Supports(jdwpclient.MonitorInfo) {
+			usage, err := conn.GetMonitorInfo(ctx, c.Monitor)
+			if err != nil {
+				return LockAnalysis{}, fmt.Errorf("Failed to get the monitor info of %v: %w", c.Monitor, err)
+			}
+			c.EntryCount = usage.EntryCount
+		}
+		analysis.Contended = append(analysis.Contended, *c)
+	}
+	sort.Slice(analysis.Contended, func(i, j int) bool {
+		return analysis.Contended[i].Monitor < analysis.Contended[j].Monitor
+	})
+
+	for _, cycle := range findCycles(ids, threads, owners) {
+		deadlock := make(Deadlock, len(cycle))
+		for i, id := range cycle {
+			t := threads[id]
+			b := BlockedThread{Thread: id, Name: t.name, Monitor: t.blocked, Owner: owners[t.blocked]}
+			if b.Depth, b.Acquired, err = acquired(ctx, conn, b.Owner, threads[b.Owner], b.Monitor); err != nil {
+				return LockAnalysis{}, err
+			}
+			deadlock[i] = b
+		}
+		analysis.Deadlocks = append(analysis.Deadlocks, deadlock)
+	}
+	return analysis, nil
+}
+
+// getLockThread returns the monitors owned and contended by the suspended
+// thread.
+func getLockThread(ctx context.Context, conn *jdwpclient.Connection, id jdwpclient.ThreadID) (*lockThread, error) {
+	name, err := conn.GetThreadName(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	t := &lockThread{name: name}
+	status, _, err := conn.GetThreadStatus(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status == jdwpclient.ThreadMonitor {
+		// Threads in Object.wait also report a contended monitor, but they
+		// are not blocked by its owner.
+		monitor, err := conn.GetCurrentContendedMonitor(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get the contended monitor of %v: %w", name, err)
+		}
+		t.blocked = monitor.Object
+	}
+	t.owned, err = conn.GetOwnedMonitorsStackDepth(ctx, id)
+	if errors.Is(err, jdwpclient.ErrUnsupported) {
+		var monitors []jdwpclient.TaggedObjectID
+		monitors, err = conn.GetOwnedMonitors(ctx, id)
+		for _, m := range monitors {
+			t.owned = append(t.owned, jdwpclient.OwnedMonitor{Monitor: m, StackDepth: -1})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the owned monitors of %v: %w", name, err)
+	}
+	return t, nil
+}
+
+// findCycles returns the cycles of the graph where each blocked thread points
+// to the owner of its monitor. Each cycle starts with its first thread in ids.
+func findCycles(
+	ids []jdwpclient.ThreadID,
+	threads map[jdwpclient.ThreadID]*lockThread,
+	owners map[jdwpclient.ObjectID]jdwpclient.ThreadID) [][]jdwpclient.ThreadID {
+
+	next := func(id jdwpclient.ThreadID) (jdwpclient.ThreadID, bool) {
+		t := threads[id]
+		if t == nil || t.blocked == 0 {
+			return 0, false
+		}
+		owner, ok := owners[t.blocked]
+		return owner, ok && owner != id
+	}
+	// Each thread has at most one successor, so every walk ends in at most
+	// one cycle. done holds the threads of the walks already taken.
+	done := map[jdwpclient.ThreadID]bool{}
+	cycles := [][]jdwpclient.ThreadID{}
+	for _, start := range ids {
+		walk := map[jdwpclient.ThreadID]int{}
+		path := []jdwpclient.ThreadID{}
+		id, ok := start, true
+		for ok && !done[id] {
+			if i, seen := walk[id]; seen {
+				cycles = append(cycles, rotateCycle(path[i:], ids))
+				break
+			}
+			walk[id] = len(path)
+			path = append(path, id)
+			id, ok = next(id)
+		}
+		for _, id := range path {
+			done[id] = true
+		}
+	}
+	return cycles
+}
+
+// rotateCycle rotates the cycle to start with its thread that comes first in
+// ids.
+func rotateCycle(cycle, ids []jdwpclient.ThreadID) []jdwpclient.ThreadID {
+	order := map[jdwpclient.ThreadID]int{}
+	for i, id := range ids {
+		order[id] = i
+	}
+	first := 0
+	for i, id := range cycle {
+		if order[id] < order[cycle[first]] {
+			first = i
+		}
+	}
+	return append(append([]jdwpclient.ThreadID{}, cycle[first:]...), cycle[:first]...)
+}
+
+// acquired returns the depth and location of the frame of the owner that
+// entered the monitor, or -1 if it is unknown.
+func acquired(
+	ctx context.Context,
+	conn *jdwpclient.Connection,
+	owner jdwpclient.ThreadID,
+	t *lockThread,
+	monitor jdwpclient.ObjectID) (int, jdwpclient.Location, error) {
+
+	// A re-entered monitor is listed once per entry: the deepest entry
+	// acquired it.
+	depth := -1
+	for _, m := range t.owned {
+		if m.Monitor.Object == monitor && m.StackDepth > depth {
+			depth = m.StackDepth
+		}
+	}
+	if depth < 0 {
+		return -1, jdwpclient.Location{}, nil
+	}
+	frames, err := conn.GetFrames(ctx, owner, depth, 1)
+	if err != nil {
+		return 0, jdwpclient.Location{}, fmt.Errorf("Failed to get the frame of %v that entered %v: %w", t.name, monitor, err)
+	}
+	if len(frames) == 0 {
+		return -1, jdwpclient.Location{}, nil
+	}
+	return depth, frames[0].Location, nil
+}
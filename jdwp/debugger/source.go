@@ -0,0 +1,79 @@
+package debugger
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// classNameForSource returns the fully qualified name of the top-level class
+// declared by the Java source file at path. The package is read from the
+// file's package declaration. If the file cannot be read, the class is assumed
+// to be in the default package.
+func classNameForSource(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if pkg := sourcePackage(path); pkg != "" {
+		return pkg + "." + name
+	}
+	return name
+}
+
+// sourcePackage returns the package declared by the Java source file at path,
+// or an empty string if there is none.
+func sourcePackage(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	inComment := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inComment {
+			end := strings.Index(line, "*/")
+			if end < 0 {
+				continue
+			}
+			inComment = false
+			line = strings.TrimSpace(line[end+2:])
+		}
+		if strings.HasPrefix(line, "/*") {
+			if end := strings.Index(line, "*/"); end >= 0 {
+				line = strings.TrimSpace(line[end+2:])
+			} else {
+				inComment = true
+				continue
+			}
+		}
+		switch {
+		case line == "", strings.HasPrefix(line, "//"), strings.HasPrefix(line, "@"):
+			continue
+		case strings.HasPrefix(line, "package "):
+			pkg := strings.TrimPrefix(line, "package ")
+			if end := strings.IndexByte(pkg, ';'); end >= 0 {
+				pkg = pkg[:end]
+			}
+			return strings.TrimSpace(pkg)
+		default:
+			// The package declaration must precede everything else.
+			return ""
+		}
+	}
+	return ""
+}
+
+// classSignature returns the JNI signature of the class with the given
+// fully qualified name. For example "java.lang.String" returns
+// "Ljava/lang/String;".
+func classSignature(name string) string {
+	return "L" + strings.Replace(name, ".", "/", -1) + ";"
+}
+
+// classNameForSignature returns the fully qualified name of the class with
+// the given JNI signature. It is the inverse of classSignature.
+func classNameForSignature(sig string) string {
+	return strings.Replace(strings.TrimSuffix(strings.TrimPrefix(sig, "L"), ";"), "/", ".", -1)
+}
@@ -0,0 +1,153 @@
+package debugger
+
+import (
+	"context"
+	"errors"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+)
+
+// DefaultStepExcludes are the class patterns of the runtime's classes, which
+// steps do not stop in.
+var DefaultStepExcludes = []string{"java.*", "javax.*", "jdk.internal.*", "sun.*", "com.sun.*"}
+
+// ErrThreadDied is returned when stepping a thread that terminates before the
+// step completes.
+var ErrThreadDied = errors.New("Thread terminated while stepping")
+
+// Stepper single-steps the threads of a debug session.
+type Stepper struct {
+	events   *Dispatcher
+	excludes []string
+}
+
+// NewStepper returns a stepper using the events dispatcher. Steps do not stop
+// in classes that match any of the exclude patterns, which are in the format
+// of jdwpclient.ClassExcludeEventModifier.
+func NewStepper(events *Dispatcher, excludes ...string) *Stepper {
+	return &Stepper{events: events, excludes: excludes}
+}
+
+// Step resumes all threads until the thread completes a step of the given
+// size and depth, returning the location where the step stopped. All threads
+// are suspended when the step completes. If the thread terminates before
+// completing the step, Step returns ErrThreadDied and the other threads keep
+// running.
+func (s *Stepper) Step(
+	ctx context.Context,
+	thread jdwpclient.ThreadID,
+	size jdwpclient.StepSize,
+	depth jdwpclient.StepDepth) (jdwpclient.Location, error) {
+
+	modifiers := []jdwpclient.EventModifier{}
+	for _, pattern := range s.excludes {
+		modifiers = append(modifiers, jdwpclient.ClassExcludeEventModifier(pattern))
+	}
+	return step(ctx, s.events, thread, size, depth, jdwpclient.SuspendAll, modifiers...)
+}
+
+// StepInto steps to the next line, stepping into any method calls.
+func (s *Stepper) StepInto(ctx context.Context, thread jdwpclient.ThreadID) (jdwpclient.Location, error) {
+	return s.Step(ctx, thread, jdwpclient.StepLine, jdwpclient.StepInto)
+}
+
+// StepOver steps to the next line, stepping over any method calls.
+func (s *Stepper) StepOver(ctx context.Context, thread jdwpclient.ThreadID) (jdwpclient.Location, error) {
+	return s.Step(ctx, thread, jdwpclient.StepLine, jdwpclient.StepOver)
+}
+
+// StepOut steps out of the method of the thread's top frame.
+func (s *Stepper) StepOut(ctx context.Context, thread jdwpclient.ThreadID) (jdwpclient.Location, error) {
+	return s.Step(ctx, thread, jdwpclient.StepLine, jdwpclient.StepOut)
+}
+
+// step sets a step request for the thread and resumes the VM until the step
+// completes. The step request suspends threads with the suspend policy, and
+// only the thread is resumed unless the policy is SuspendAll.
+func step(
+	ctx context.Context,
+	events *Dispatcher,
+	thread jdwpclient.ThreadID,
+	size jdwpclient.StepSize,
+	depth jdwpclient.StepDepth,
+	suspendPolicy jdwpclient.SuspendPolicy,
+	modifiers ...jdwpclient.EventModifier) (jdwpclient.Location, error) {
+
+	conn := events.Connection()
+	// Resuming all threads does not fail for a dead thread, so the step would
+	// never complete.
+	status, _, err := conn.GetThreadStatus(ctx, thread)
+	switch {
+	case err == jdwpclient.ErrInvalidThread, err == nil && status == jdwpclient.ThreadZombie:
+		return jdwpclient.Location{}, ErrThreadDied
+	case err != nil:
+		return jdwpclient.Location{}, err
+	}
+
+	stepped := make(chan jdwpclient.Location, 1)
+	died := make(chan struct{}, 1)
+	onStep := func(ctx context.Context, event jdwpclient.Event) {
+		select {
+		case stepped <- event.(*jdwpclient.EventSingleStep).Location:
+		default:
+		}
+	}
+	onDeath := func(ctx context.Context, event jdwpclient.Event) {
+		select {
+		case died <- struct{}{}:
+		default:
+		}
+	}
+
+	death, err := events.Set(ctx, jdwpclient.ThreadDeath, jdwpclient.SuspendNone, onDeath,
+		jdwpclient.ThreadOnlyEventModifier(thread))
+	if err != nil {
+		return jdwpclient.Location{}, err
+	}
+	modifiers = append([]jdwpclient.EventModifier{
+		jdwpclient.StepEventModifier{Thread: thread, Size: size, Depth: depth},
+		jdwpclient.CountEventModifier(1),
+	}, modifiers...)
+	req, err := events.Set(ctx, jdwpclient.SingleStep, suspendPolicy, onStep, modifiers...)
+	if err != nil {
+		clearRequests(ctx, events, death)
+		if err == jdwpclient.ErrInvalidThread {
+			return jdwpclient.Location{}, ErrThreadDied
+		}
+		return jdwpclient.Location{}, err
+	}
+	// There can only be one step request per thread, so the request must be
+	// cleared even if the step does not complete.
+	defer clearRequests(ctx, events, req, death)
+
+	if suspendPolicy == jdwpclient.SuspendAll {
+		err = conn.ResumeAll(ctx)
+	} else {
+		err = conn.Resume(ctx, thread)
+	}
+	if err == jdwpclient.ErrInvalidThread {
+		return jdwpclient.Location{}, ErrThreadDied
+	}
+	if err != nil {
+		return jdwpclient.Location{}, err
+	}
+
+	select {
+	case l := <-stepped:
+		return l, nil
+	case <-died:
+		return jdwpclient.Location{}, ErrThreadDied
+	case <-conn.Closed():
+		return jdwpclient.Location{}, jdwpclient.ErrDisconnected
+	case <-ctx.Done():
+		return jdwpclient.Location{}, ctx.Err()
+	}
+}
+
+// clearRequests clears the requests, logging any failure.
+func clearRequests(ctx context.Context, events *Dispatcher, reqs ...*jdwpclient.EventRequest) {
+	for _, req := range reqs {
+		if err := events.Clear(context.WithoutCancel(ctx), req); err != nil {
+			log.Warn().Err(err).Str("kind", req.Kind.String()).Msg("Couldn't clear request")
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package debugger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+	"time"
+)
+
+// ThreadDump is the state of the threads of the VM, as captured by
+// DumpThreads.
+type ThreadDump struct {
+	Time    time.Time      `json:"time"`
+	VM      string         `json:"vm"` // Name and version of the VM.
+	Threads []DumpedThread `json:"threads"`
+}
+
+// DumpedThread is a thread of a ThreadDump.
+type DumpedThread struct {
+	ID     jdwpclient.ThreadID     `json:"id"`
+	Name   string                  `json:"name"`
+	Group  string                  `json:"group"` // Path of the thread group, such as "system/main".
+	Status jdwpclient.ThreadStatus `json:"-"`
+	State  string                  `json:"state"` // As java.lang.Thread.State, such as "RUNNABLE".
+	// SuspendCount is the number of suspensions of the thread before the
+	// dump.
+	SuspendCount int `json:"suspendCount"`
+	// WaitingFor is the monitor the thread is blocked on or waits on, if the
+	// VM can report it.
+	WaitingFor *DumpedMonitor `json:"waitingFor,omitempty"`
+	Frames     []DumpedFrame  `json:"frames"`
+}
+
+// DumpedFrame is a stack frame of a DumpedThread.
+type DumpedFrame struct {
+	Class  string          `json:"class"`
+	Method string          `json:"method"`
+	Source string          `json:"source,omitempty"` // Source file name, if known.
+	Line   int             `json:"line"`             // Source line, or -1 if unknown.
+	Native bool            `json:"native,omitempty"`
+	Locked []DumpedMonitor `json:"locked,omitempty"` // Monitors entered by the frame.
+}
+
+// DumpedMonitor is an object whose monitor is held or waited for.
+type DumpedMonitor struct {
+	Object jdwpclient.ObjectID `json:"object"`
+	Class  string              `json:"class"`
+}
+
+// threadStates maps the thread statuses to java.lang.Thread.State and to the
+// description of the jstack thread header.
+var threadStates = map[jdwpclient.ThreadStatus][2]string{
+	jdwpclient.ThreadZombie:   {"TERMINATED", "terminated"},
+	jdwpclient.ThreadRunning:  {"RUNNABLE", "runnable"},
+	jdwpclient.ThreadSleeping: {"TIMED_WAITING (sleeping)", "sleeping"},
+	jdwpclient.ThreadMonitor:  {"BLOCKED (on object monitor)", "waiting for monitor entry"},
+	jdwpclient.ThreadWait:     {"WAITING (on object monitor)", "in Object.wait()"},
+}
+
+// DumpThreads suspends every thread of the VM and collects its stack, with the
+// class, method and source line of each frame. The monitors held and waited
+// for are included if the VM can report them. Only the threads suspended by
+// DumpThreads are resumed before it returns.
+func DumpThreads(ctx context.Context, conn *jdwpclient.Connection) (ThreadDump, error) {
+	version, err := conn.GetVersion(ctx)
+	if err != nil {
+		return ThreadDump{}, fmt.Errorf("Failed to get the VM version: %w", err)
+	}
+	dump := ThreadDump{Time: time.Now(), VM: fmt.Sprintf("%v (%v)", version.Name, version.Version)}
+
+	ids, err := conn.GetAllThreads(ctx)
+	if err != nil {
+		return ThreadDump{}, fmt.Errorf("Failed to get the threads: %w", err)
+	}
+	suspended := map[jdwpclient.ThreadID]bool{}
+	defer func() {
+		for id := range suspended {
+			if err := conn.Resume(context.WithoutCancel(ctx), id); err != nil && err != jdwpclient.ErrInvalidThread {
+				log.Warn().Err(err).Uint64("thread", uint64(id)).Msg("Failed to resume thread after the dump")
+			}
+		}
+	}()
+	for _, id := range ids {
+		switch err := conn.Suspend(ctx, id); err {
+		case nil:
+			suspended[id] = true
+		case jdwpclient.ErrInvalidThread:
+			// The thread terminated.
+		default:
+			return ThreadDump{}, fmt.Errorf("Failed to suspend thread %v: %w", id, err)
+		}
+	}
+
+	threads, err := ThreadSnapshot(ctx, conn)
+	if err != nil {
+		return ThreadDump{}, err
+	}
+	r := dumpResolver{
+		ctx:     ctx,
+		conn:    conn,
+		classes: map[jdwpclient.ReferenceTypeID]*dumpClass{},
+	}
+	for _, info := range threads {
+		if !suspended[info.ID] {
+			continue // Started after the suspension.
+		}
+		t, err := r.thread(info)
+		if err == jdwpclient.ErrInvalidThread {
+			continue
+		}
+		if err != nil {
+			return ThreadDump{}, err
+		}
+		dump.Threads = append(dump.Threads, t)
+	}
+	return dump, nil
+}
+
+// dumpResolver resolves the frames of a thread dump, caching the classes and
+// line tables.
+type dumpResolver struct {
+	ctx     context.Context
+	conn    *jdwpclient.Connection
+	classes map[jdwpclient.ReferenceTypeID]*dumpClass
+}
+
+// dumpClass is the information of a class used by thread dumps. Method IDs
+// are only unique within their class, so the line tables are cached per
+// class.
+type dumpClass struct {
+	name    string
+	source  string
+	methods map[jdwpclient.MethodID]jdwpclient.Method
+	lines   map[jdwpclient.MethodID]jdwpclient.LineTable
+}
+
+// thread returns the dump of the suspended thread.
+func (r *dumpResolver) thread(info ThreadInfo) (DumpedThread, error) {
+	t := DumpedThread{
+		ID:           info.ID,
+		Name:         info.Name,
+		Group:        info.GroupPath(),
+		Status:       info.Status,
+		State:        threadStates[info.Status][0],
+		SuspendCount: info.SuspendCount - 1,
+		Frames:       []DumpedFrame{},
+	}
+	if info.Status == jdwpclient.ThreadZombie {
+		return t, nil
+	}
+	frames, err := r.conn.GetFrames(r.ctx, info.ID, 0, -1)
+	if err != nil {
+		return DumpedThread{}, err
+	}
+	for _, f := range frames {
+		frame, err := r.frame(f.Location)
+		if err != nil {
+			return DumpedThread{}, err
+		}
+		t.Frames = append(t.Frames, frame)
+	}
+	if err := r.monitors(&t); err != nil {
+		return DumpedThread{}, err
+	}
+	return t, nil
+}
+
+// frame returns the dump of the frame at the location.
+func (r *dumpResolver) frame(location jdwpclient.Location) (DumpedFrame, error) {
+	class, err := r.class(jdwpclient.ReferenceTypeID(location.Class))
+	if err != nil {
+		return DumpedFrame{}, err
+	}
+	f := DumpedFrame{Class: class.name, Method: "<unknown>", Source: class.source, Line: -1}
+	method, ok := class.methods[location.Method]
+	if !ok {
+		return f, nil
+	}
+	f.Method = method.Name
+	if method.ModBits&jdwpclient.ModNative != 0 {
+		f.Native = true
+		return f, nil
+	}
+	table, ok := class.lines[location.Method]
+	if !ok {
+		table, err = r.conn.LineTable(r.ctx, jdwpclient.ReferenceTypeID(location.Class), location.Method)
+		switch err {
+		case nil, jdwpclient.ErrAbsentInformation, jdwpclient.ErrNativeMethod:
+		default:
+			return DumpedFrame{}, fmt.Errorf("Failed to get the line table of %v.%v: %w", class.name, method.Name, err)
+		}
+		class.lines[location.Method] = table
+	}
+	f.Line = table.LineOf(location.Location)
+	return f, nil
+}
+
+// class returns the name, source file and methods of the class.
+func (r *dumpResolver) class(id jdwpclient.ReferenceTypeID) (*dumpClass, error) {
+	if c, ok := r.classes[id]; ok {
+		return c, nil
+	}
+	metadata, err := r.conn.GetTypeMetadata(r.ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the metadata of class %v: %w", id, err)
+	}
+	c := &dumpClass{
+		name:    classNameForSignature(metadata.Signature),
+		source:  metadata.SourceFile,
+		methods: map[jdwpclient.MethodID]jdwpclient.Method{},
+		lines:   map[jdwpclient.MethodID]jdwpclient.LineTable{},
+	}
+	methods, err := r.conn.GetMethods(r.ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the methods of %v: %w", c.name, err)
+	}
+	for _, m := range methods {
+		c.methods[m.ID] = m
+	}
+	r.classes[id] = c
+	return c, nil
+}
+
+// monitors adds the monitors held and waited for by the thread, if the VM can
+// report them.
+func (r *dumpResolver) monitors(t *DumpedThread) error {
+	if t.Status == jdwpclient.ThreadMonitor || t.Status == jdwpclient.ThreadWait {
+		monitor, err := r.conn.GetCurrentContendedMonitor(r.ctx, t.ID)
+		switch {
+		case errors.Is(err, jdwpclient.ErrUnsupported):
+		case err != nil:
+			return fmt.Errorf("Failed to get the contended monitor of %v: %w", t.Name, err)
+		case monitor.Object != 0:
+			m, err := r.monitor(monitor.Object)
+			if err != nil {
+				return err
+			}
+			t.WaitingFor = &m
+		}
+	}
+	owned, err := r.conn.GetOwnedMonitorsStackDepth(r.ctx, t.ID)
+	if errors.Is(err, jdwpclient.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to get the owned monitors of %v: %w", t.Name, err)
+	}
+	for _, o := range owned {
+		if o.StackDepth < 0 || o.StackDepth >= len(t.Frames) {
+			continue
+		}
+		m, err := r.monitor(o.Monitor.Object)
+		if err != nil {
+			return err
+		}
+		f := &t.Frames[o.StackDepth]
+		f.Locked = append(f.Locked, m)
+	}
+	return nil
+}
+
+// monitor returns the object with the name of its class.
+func (r *dumpResolver) monitor(object jdwpclient.ObjectID) (DumpedMonitor, error) {
+	ty, err := r.conn.GetObjectType(r.ctx, object)
+	if err != nil {
+		return DumpedMonitor{}, fmt.Errorf("Failed to get the type of monitor %v: %w", object, err)
+	}
+	sig, err := r.conn.GetTypeSignature(r.ctx, ty.Type)
+	if err != nil {
+		return DumpedMonitor{}, fmt.Errorf("Failed to get the signature of class %v: %w", ty.Type, err)
+	}
+	return DumpedMonitor{Object: object, Class: classNameForSignature(sig)}, nil
+}
+
+// WriteText writes the dump in the text format of jstack.
+func (d ThreadDump) WriteText(w io.Writer) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%v\nFull thread dump %v:\n", d.Time.Format("2006-01-02 15:04:05"), d.VM)
+	for _, t := range d.Threads {
+		state := threadStates[t.Status]
+		fmt.Fprintf(b, "\n\"%v\" #%d group=\"%v\" %v\n", t.Name, uint64(t.ID), t.Group, state[1])
+		fmt.Fprintf(b, "   java.lang.Thread.State: %v\n", state[0])
+		for i, f := range t.Frames {
+			fmt.Fprintf(b, "\tat %v.%v(%v)\n", f.Class, f.Method, f.location())
+			if i == 0 && t.WaitingFor != nil {
+				verb := "waiting on"
+				if t.Status == jdwpclient.ThreadMonitor {
+					verb = "waiting to lock"
+				}
+				fmt.Fprintf(b, "\t- %v %v\n", verb, t.WaitingFor)
+			}
+			for _, m := range f.Locked {
+				fmt.Fprintf(b, "\t- locked %v\n", m)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the dump as indented JSON.
+func (d ThreadDump) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(d)
+}
+
+// location returns the source location of the frame as printed by jstack,
+// such as "Main.java:10".
+func (f DumpedFrame) location() string {
+	switch {
+	case f.Native:
+		return "Native Method"
+	case f.Source == "":
+		return "Unknown Source"
+	case f.Line < 0:
+		return f.Source
+	}
+	return fmt.Sprintf("%v:%d", f.Source, f.Line)
+}
+
+// String returns the monitor as printed by jstack, such as
+// "<0x000000000000002a> (a java.lang.Object)".
+func (m DumpedMonitor) String() string {
+	return fmt.Sprintf("<0x%016x> (a %v)", uint64(m.Object), m.Class)
+}
@@ -0,0 +1,117 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+)
+
+// ThreadInfo describes a thread, as captured by ThreadSnapshot.
+type ThreadInfo struct {
+	ID           jdwpclient.ThreadID
+	Name         string
+	Status       jdwpclient.ThreadStatus
+	SuspendCount int
+	// Groups holds the names of the thread groups containing the thread,
+	// from the top level group down to the thread's own group.
+	Groups []string
+	// FrameCount is the number of frames on the thread's stack, or -1 if the
+	// thread is not suspended.
+	FrameCount int
+}
+
+// GroupPath returns the names of the thread groups joined by "/", such as
+// "system/main".
+func (t ThreadInfo) GroupPath() string { return strings.Join(t.Groups, "/") }
+
+// IsSystem returns true if the thread is a thread of the JVM rather than of
+// the program: a thread of the "system" group or of its subgroups other than
+// "main", such as the reference handler and the finalizer.
+func (t ThreadInfo) IsSystem() bool {
+	return len(t.Groups) > 0 && t.Groups[0] == "system" && (len(t.Groups) == 1 || t.Groups[1] != "main")
+}
+
+// ThreadSnapshot walks the thread group tree of the VM, and returns the
+// threads in the order of the walk. Threads and groups that terminate during
+// the walk are left out.
+func ThreadSnapshot(ctx context.Context, conn *jdwpclient.Connection) ([]ThreadInfo, error) {
+	groups, err := conn.GetTopLevelThreadGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the top level thread groups: %w", err)
+	}
+	s := snapshot{ctx: ctx, conn: conn}
+	for _, g := range groups {
+		if err := s.walk(g, nil); err != nil {
+			return nil, err
+		}
+	}
+	return s.threads, nil
+}
+
+// snapshot holds the state of ThreadSnapshot.
+type snapshot struct {
+	ctx     context.Context
+	conn    *jdwpclient.Connection
+	threads []ThreadInfo
+}
+
+// walk adds the threads of the group and of its subgroups. path holds the
+// names of the parents of the group.
+func (s *snapshot) walk(group jdwpclient.ThreadGroupID, path []string) error {
+	name, err := s.conn.GetThreadGroupName(s.ctx, group)
+	if err != nil {
+		return s.skip(err, "thread group name")
+	}
+	children, err := s.conn.GetThreadGroupChildren(s.ctx, group)
+	if err != nil {
+		return s.skip(err, "thread group children")
+	}
+	path = append(path[:len(path):len(path)], name)
+	for _, thread := range children.Threads {
+		if err := s.add(thread, path); err != nil {
+			return err
+		}
+	}
+	for _, child := range children.Groups {
+		if err := s.walk(child, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds the thread of the group path.
+func (s *snapshot) add(thread jdwpclient.ThreadID, path []string) error {
+	info := ThreadInfo{ID: thread, Groups: path, FrameCount: -1}
+	var err error
+	if info.Name, err = s.conn.GetThreadName(s.ctx, thread); err != nil {
+		return s.skip(err, "thread name")
+	}
+	if info.Status, _, err = s.conn.GetThreadStatus(s.ctx, thread); err != nil {
+		return s.skip(err, "thread status")
+	}
+	if info.Status == jdwpclient.ThreadZombie {
+		return nil
+	}
+	if info.SuspendCount, err = s.conn.GetSuspendCount(s.ctx, thread); err != nil {
+		return s.skip(err, "suspend count")
+	}
+	if info.SuspendCount > 0 {
+		if info.FrameCount, err = s.conn.GetFrameCount(s.ctx, thread); err != nil {
+			return s.skip(err, "frame count")
+		}
+	}
+	s.threads = append(s.threads, info)
+	return nil
+}
+
+// skip returns nil if err reports that a thread or group terminated, and
+// otherwise an error for failing to get what.
+func (s *snapshot) skip(err error, what string) error {
+	switch err {
+	case jdwpclient.ErrInvalidThread, jdwpclient.ErrInvalidThreadGroup, jdwpclient.ErrInvalidObject:
+		return nil
+	}
+	return fmt.Errorf("Failed to get the %v: %w", what, err)
+}
@@ -0,0 +1,265 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sync"
+)
+
+// Watchpoint stops threads that access or modify a field.
+type Watchpoint struct {
+	ID           int
+	Class        string              // Fully qualified name of the class declaring or inheriting the field.
+	Field        string              // Name of the field.
+	Instance     jdwpclient.ObjectID // Object to watch the field of, or 0 for all objects.
+	Access       bool                // Stop when the field is read.
+	Modification bool                // Stop when the field is written.
+	Verified     bool                // True once the watchpoint is set for a loaded class.
+	Message      string              // Explains why the watchpoint is not verified.
+
+	requests []*jdwpclient.EventRequest
+}
+
+// WatchpointHit describes a thread stopping at a watchpoint.
+type WatchpointHit struct {
+	Watchpoint   Watchpoint
+	Thread       jdwpclient.ThreadID
+	Location     jdwpclient.Location // Location of the access or modification.
+	Object       jdwpclient.ObjectID // Object holding the field, 0 for a static field.
+	Modification bool                // True for a modification, false for an access.
+	OldValue     jdwpclient.Value    // Value of the field before the modification, or the value read.
+	NewValue     jdwpclient.Value    // Value being assigned by a modification.
+}
+
+// Watchpoints manages the field watchpoints of a debug session. Watchpoints
+// on classes that are not yet loaded are deferred until the class is
+// prepared.
+type Watchpoints struct {
+	conn    *jdwpclient.Connection
+	events  *Dispatcher
+	hits    chan WatchpointHit
+	changed chan Watchpoint
+
+	ids       *IDs
+	mutex     sync.Mutex
+	wps       []*Watchpoint
+	byRequest map[jdwpclient.EventRequestID]*Watchpoint
+	deferred  *deferrals
+}
+
+// NewWatchpoints returns a new watchpoint manager using the events
+// dispatcher, which allocates the IDs of the watchpoints from ids.
+func NewWatchpoints(events *Dispatcher, ids *IDs) *Watchpoints {
+	w := &Watchpoints{
+		conn:      events.Connection(),
+		events:    events,
+		hits:      make(chan WatchpointHit, 16),
+		changed:   make(chan Watchpoint, 16),
+		ids:       ids,
+		byRequest: map[jdwpclient.EventRequestID]*Watchpoint{},
+	}
+	w.deferred = newDeferrals(events, &w.mutex, false, w.onClassPrepare)
+	return w
+}
+
+// Hits returns the channel that receives a WatchpointHit each time a thread
+// stops at a watchpoint. All threads are suspended when a watchpoint is hit.
+func (w *Watchpoints) Hits() <-chan WatchpointHit { return w.hits }
+
+// Changed returns the channel that receives deferred watchpoints as they
+// become verified. Changes are dropped while the channel is full.
+func (w *Watchpoints) Changed() <-chan Watchpoint { return w.changed }
+
+// Set replaces all the watchpoints with wps, returning the new watchpoints in
+// the same order. The ID, Verified and Message fields of wps are ignored.
+// Watchpoints on fields that the class does not have fail with an error.
+func (w *Watchpoints) Set(ctx context.Context, wps []Watchpoint) ([]Watchpoint, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, wp := range w.wps {
+		w.clear(ctx, wp)
+	}
+	w.wps = nil
+
+	out := make([]Watchpoint, len(wps))
+	for i, req := range wps {
+		if !req.Access && !req.Modification {
+			return nil, fmt.Errorf("Watchpoint on %v.%v watches neither access nor modification", req.Class, req.Field)
+		}
+		wp := &Watchpoint{
+			ID:           w.ids.Next(),
+			Class:        req.Class,
+			Field:        req.Field,
+			Instance:     req.Instance,
+			Access:       req.Access,
+			Modification: req.Modification,
+		}
+		w.wps = append(w.wps, wp)
+		if err := w.resolve(ctx, wp); err != nil {
+			return nil, err
+		}
+		out[i] = *wp
+	}
+	used := map[string]bool{}
+	for _, wp := range w.wps {
+		used[wp.Class] = true
+	}
+	w.deferred.unwatchUnused(ctx, used)
+	return out, nil
+}
+
+// resolve sets the watchpoint's requests in all the loaded types of its
+// class, deferring the watchpoint if the class is not loaded.
+func (w *Watchpoints) resolve(ctx context.Context, wp *Watchpoint) error {
+	types, err := w.deferred.prepare(ctx, wp.Class)
+	if err != nil {
+		return err
+	}
+	for _, ty := range types {
+		if err := w.set(ctx, wp, ty.TypeID); err != nil {
+			return err
+		}
+		wp.Verified = true
+	}
+	if !wp.Verified {
+		wp.Message = fmt.Sprintf("Class %v is not loaded yet", wp.Class)
+	}
+	return nil
+}
+
+// set sets the watchpoint's requests on its field as found in the type.
+func (w *Watchpoints) set(ctx context.Context, wp *Watchpoint, ty jdwpclient.ReferenceTypeID) error {
+	declaring, field, err := findField(ctx, w.conn, ty, wp.Field)
+	if err != nil {
+		return err
+	}
+	modifiers := []jdwpclient.EventModifier{jdwpclient.FieldOnlyEventModifier{Type: declaring, Field: field.ID}}
+	if wp.Instance != 0 {
+		modifiers = append(modifiers, jdwpclient.InstanceOnlyEventModifier(wp.Instance))
+	}
+	kinds := []jdwpclient.EventKind{}
+	if wp.Access {
+		kinds = append(kinds, jdwpclient.FieldAccess)
+	}
+	if wp.Modification {
+		kinds = append(kinds, jdwpclient.FieldModification)
+	}
+	for _, kind := range kinds {
+		req, err := w.events.Set(ctx, kind, jdwpclient.SuspendAll, w.onField, modifiers...)
+		if err != nil {
+			return err
+		}
+		wp.requests = append(wp.requests, req)
+		w.byRequest[req.ID] = wp
+	}
+	return nil
+}
+
+// findField returns the field with the name in the type or its superclasses,
+// along with the type declaring the field.
+func findField(
+	ctx context.Context,
+	conn *jdwpclient.Connection,
+	ty jdwpclient.ReferenceTypeID,
+	name string) (jdwpclient.ReferenceTypeID, jdwpclient.Field, error) {
+
+	for class := ty; class != 0; {
+		fields, err := conn.GetFields(ctx, class)
+		if err != nil {
+			return 0, jdwpclient.Field{}, err
+		}
+		if f := fields.FindByName(name); f != nil {
+			return class, *f, nil
+		}
+		super, err := conn.GetSuperClass(ctx, jdwpclient.ClassID(class))
+		if err != nil {
+			break // Interfaces have no superclass.
+		}
+		class = jdwpclient.ReferenceTypeID(super)
+	}
+	sig, _ := conn.GetTypeSignature(ctx, ty)
+	return 0, jdwpclient.Field{}, fmt.Errorf("Class %v has no field '%v'", classNameForSignature(sig), name)
+}
+
+// clear removes all the event requests for the watchpoint.
+func (w *Watchpoints) clear(ctx context.Context, wp *Watchpoint) {
+	for _, req := range wp.requests {
+		if err := w.events.Clear(ctx, req); err != nil {
+			log.Warn().Err(err).Int("watchpoint", wp.ID).Msg("Couldn't clear watchpoint request")
+		}
+		delete(w.byRequest, req.ID)
+	}
+	wp.requests, wp.Verified = nil, false
+}
+
+// onClassPrepare sets the deferred watchpoints on the class in the prepared
+// type.
+func (w *Watchpoints) onClassPrepare(ctx context.Context, class string, ty jdwpclient.ClassInfo) {
+	for _, wp := range w.wps {
+		if wp.Class != class {
+			continue
+		}
+		wasVerified := wp.Verified
+		if err := w.set(ctx, wp, ty.TypeID); err != nil {
+			wp.Message = err.Error()
+			log.Warn().Err(err).Int("watchpoint", wp.ID).Msg("Couldn't set deferred watchpoint")
+			continue
+		}
+		wp.Verified, wp.Message = true, ""
+		if !wasVerified {
+			// Blocking here would stall the dispatcher with the mutex held.
+			select {
+			case w.changed <- *wp:
+			default:
+				log.Warn().Int("watchpoint", wp.ID).Msg("Dropped change of verified watchpoint")
+			}
+		}
+	}
+}
+
+func (w *Watchpoints) onField(ctx context.Context, event jdwpclient.Event) {
+	var hit WatchpointHit
+	var declaring jdwpclient.ReferenceTypeID
+	var field jdwpclient.FieldID
+	switch ev := event.(type) {
+	case *jdwpclient.EventFieldAccess:
+		hit = WatchpointHit{Thread: ev.Thread, Location: ev.Location, Object: ev.Object.Object}
+		declaring, field = ev.FieldType, ev.Field
+	case *jdwpclient.EventFieldModification:
+		hit = WatchpointHit{Thread: ev.Thread, Location: ev.Location, Object: ev.Object.Object,
+			Modification: true, NewValue: ev.NewValue}
+		declaring, field = ev.FieldType, ev.Field
+	}
+
+	w.mutex.Lock()
+	wp, ok := w.byRequest[event.RequestID()]
+	if ok {
+		hit.Watchpoint = *wp
+	}
+	w.mutex.Unlock()
+	if !ok {
+		// The watchpoint was cleared after the event was raised.
+		if err := w.events.Resume(ctx, event); err != nil {
+			log.Warn().Err(err).Msg("Couldn't resume after stale watchpoint")
+		}
+		return
+	}
+
+	// The field is not modified until the event has been handled, so it
+	// still holds the old value.
+	var values []jdwpclient.Value
+	var err error
+	if hit.Object != 0 {
+		values, err = w.conn.GetFieldValues(ctx, hit.Object, field)
+	} else {
+		values, err = w.conn.GetStaticFieldValues(ctx, declaring, field)
+	}
+	if err == nil && len(values) == 1 {
+		hit.OldValue = values[0]
+	} else {
+		log.Warn().Err(err).Int("watchpoint", hit.Watchpoint.ID).Msg("Couldn't read watched field")
+	}
+	w.hits <- hit
+}
@@ -0,0 +1,423 @@
+package fakevm
+
+import (
+	"bytes"
+	"sapelkinav/javadap/jdwp/data/binary"
+	"sapelkinav/javadap/jdwp/data/endian"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+)
+
+// Requests returns the event requests of the kind that are set on the VM.
+func (vm *VM) Requests(kind jdwpclient.EventKind) []*jdwpclient.EventRequest {
+	vm.Lock()
+	defer vm.Unlock()
+	out := []*jdwpclient.EventRequest{}
+	for _, r := range vm.requests {
+		if r.Kind == kind {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Emit sends a composite event holding events to the client, suspending
+// thread or all threads as required by the suspend policy.
+func (vm *VM) Emit(policy jdwpclient.SuspendPolicy, thread *Thread, events ...jdwpclient.Event) error {
+	vm.Lock()
+	switch policy {
+	case jdwpclient.SuspendAll:
+		for _, t := range vm.threads {
+			t.suspend++
+		}
+	case jdwpclient.SuspendEventThread:
+		if thread != nil {
+			thread.suspend++
+		}
+	}
+	id := uint32(vm.newID())
+	vm.Unlock()
+
+	data := bytes.Buffer{}
+	composite := struct {
+		Policy jdwpclient.SuspendPolicy
+		Events []jdwpclient.Event
+	}{policy, events}
+	if err := jdwpclient.Encode(endian.Writer(&data, endian.BigEndian), vm.sizes, composite); err != nil {
+		return err
+	}
+	return vm.write(func(w binary.Writer) {
+		w.Uint32(uint32(packetHeaderLength + data.Len()))
+		w.Uint32(id)
+		w.Uint8(0)
+		w.Uint8(64)  // Event command set
+		w.Uint8(100) // Composite command
+		w.Data(data.Bytes())
+	})
+}
+
+// Breakpoint raises a Breakpoint event on the thread for each breakpoint
+// request matching the location of the thread's top frame, returning the
+// number of events raised.
+func (vm *VM) Breakpoint(t *Thread) (int, error) {
+	vm.Lock()
+	location := t.Frames[0].Location
+	class := vm.classByID(jdwpclient.ReferenceTypeID(location.Class))
+	events, policy := []jdwpclient.Event{}, jdwpclient.SuspendNone
+	for _, r := range vm.requests {
+		if r.Kind == jdwpclient.Breakpoint && matches(r, t, class, &location) {
+			events = append(events, &jdwpclient.EventBreakpoint{Request: r.ID, Thread: t.ThreadID(), Location: location})
+			policy = maxPolicy(policy, r.SuspendPolicy)
+		}
+	}
+	vm.Unlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return len(events), vm.Emit(policy, t, events...)
+}
+
+// Throw raises an Exception event on the thread for each exception request
+// matching the exception thrown at the location of the thread's top frame,
+// returning the number of events raised. A nil catch location throws an
+// uncaught exception.
+func (vm *VM) Throw(t *Thread, exception *Object, catch *jdwpclient.Location) (int, error) {
+	vm.Lock()
+	location := t.Frames[0].Location
+	class := vm.classByID(jdwpclient.ReferenceTypeID(location.Class))
+	events, policy := []jdwpclient.Event{}, jdwpclient.SuspendNone
+	for _, r := range vm.requests {
+		if r.Kind != jdwpclient.Exception || !matches(r, t, class, &location) {
+			continue
+		}
+		if !vm.matchesException(r, exception.Class, catch != nil) {
+			continue
+		}
+		e := &jdwpclient.EventException{
+			Request:   r.ID,
+			Thread:    t.ThreadID(),
+			Location:  location,
+			Exception: jdwpclient.TaggedObjectID{Type: jdwpclient.TagObject, Object: exception.ID},
+		}
+		if catch != nil {
+			e.CatchLocation = *catch
+		}
+		events = append(events, e)
+		policy = maxPolicy(policy, r.SuspendPolicy)
+	}
+	vm.Unlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return len(events), vm.Emit(policy, t, events...)
+}
+
+// matchesException returns true if the request's exception modifiers permit an
+// exception of the class.
+func (vm *VM) matchesException(r *jdwpclient.EventRequest, class *Class, caught bool) bool {
+	for _, m := range r.Modifiers {
+		m, ok := m.(jdwpclient.ExceptionOnlyEventModifier)
+		if !ok {
+			continue
+		}
+		if caught && !m.Caught || !caught && !m.Uncaught {
+			return false
+		}
+		if m.ExceptionOrNull != 0 && !class.IsA(vm.classByID(m.ExceptionOrNull)) {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessField raises a FieldAccess event on the thread for each watchpoint
+// request matching the field, returning the number of events raised. A nil
+// object accesses a static field.
+func (vm *VM) AccessField(t *Thread, object *Object, f *Field) (int, error) {
+	vm.Lock()
+	location := t.Frames[0].Location
+	class := vm.classByID(jdwpclient.ReferenceTypeID(location.Class))
+	events, policy := []jdwpclient.Event{}, jdwpclient.SuspendNone
+	for _, r := range vm.requests {
+		if r.Kind != jdwpclient.FieldAccess || !matches(r, t, class, &location) || !matchesField(r, f, object) {
+			continue
+		}
+		events = append(events, &jdwpclient.EventFieldAccess{
+			Request:   r.ID,
+			Thread:    t.ThreadID(),
+			Location:  location,
+			FieldKind: f.Class.Kind,
+			FieldType: f.Class.ID,
+			Field:     f.ID,
+			Object:    taggedObject(object),
+		})
+		policy = maxPolicy(policy, r.SuspendPolicy)
+	}
+	vm.Unlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return len(events), vm.Emit(policy, t, events...)
+}
+
+// ModifyField raises a FieldModification event on the thread for each
+// watchpoint request matching the field, returning the number of events
+// raised. A nil object modifies a static field. As the field is modified once
+// the event is handled, the field keeps its old value and the caller is
+// responsible for assigning value.
+func (vm *VM) ModifyField(t *Thread, object *Object, f *Field, value jdwpclient.Value) (int, error) {
+	vm.Lock()
+	location := t.Frames[0].Location
+	class := vm.classByID(jdwpclient.ReferenceTypeID(location.Class))
+	events, policy := []jdwpclient.Event{}, jdwpclient.SuspendNone
+	for _, r := range vm.requests {
+		if r.Kind != jdwpclient.FieldModification || !matches(r, t, class, &location) || !matchesField(r, f, object) {
+			continue
+		}
+		events = append(events, &jdwpclient.EventFieldModification{
+			Request:   r.ID,
+			Thread:    t.ThreadID(),
+			Location:  location,
+			FieldKind: f.Class.Kind,
+			FieldType: f.Class.ID,
+			Field:     f.ID,
+			Object:    taggedObject(object),
+			NewValue:  value,
+		})
+		policy = maxPolicy(policy, r.SuspendPolicy)
+	}
+	vm.Unlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return len(events), vm.Emit(policy, t, events...)
+}
+
+// matchesField returns true if the request's field and instance modifiers
+// permit the field of the object.
+func matchesField(r *jdwpclient.EventRequest, f *Field, object *Object) bool {
+	for _, m := range r.Modifiers {
+		switch m := m.(type) {
+		case jdwpclient.FieldOnlyEventModifier:
+			if m.Field != f.ID || m.Type != f.Class.ID {
+				return false
+			}
+		case jdwpclient.InstanceOnlyEventModifier:
+			if object == nil || object.ID != jdwpclient.ObjectID(m) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// taggedObject returns the tagged ID of the object, tagged by the object's
+// class, or a null object ID if object is nil.
+func taggedObject(object *Object) jdwpclient.TaggedObjectID {
+	if object == nil {
+		return jdwpclient.TaggedObjectID{Type: jdwpclient.TagObject}
+	}
+	tag := jdwpclient.TagObject
+	switch object.Value().(type) {
+	case jdwpclient.ArrayID:
+		tag = jdwpclient.TagArray
+	case jdwpclient.StringID:
+		tag = jdwpclient.TagString
+	case jdwpclient.ThreadID:
+		tag = jdwpclient.TagThread
+	case jdwpclient.ThreadGroupID:
+		tag = jdwpclient.TagThreadGroup
+	case jdwpclient.ClassObjectID:
+		tag = jdwpclient.TagClassObject
+	}
+	return jdwpclient.TaggedObjectID{Type: tag, Object: object.ID}
+}
+
+// PrepareClass raises a ClassPrepare event on the thread for each class
+// prepare request matching the class, returning the number of events raised.
+func (vm *VM) PrepareClass(c *Class, t *Thread) (int, error) {
+	vm.Lock()
+	events, policy := []jdwpclient.Event{}, jdwpclient.SuspendNone
+	for _, r := range vm.requests {
+		if r.Kind == jdwpclient.ClassPrepare && matches(r, t, c, nil) {
+			events = append(events, &jdwpclient.EventClassPrepare{
+				Request:   r.ID,
+				Thread:    t.ThreadID(),
+				ClassKind: c.Kind,
+				ClassType: c.ID,
+				Signature: c.Signature(),
+				Status:    c.Status,
+			})
+			policy = maxPolicy(policy, r.SuspendPolicy)
+		}
+	}
+	vm.Unlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return len(events), vm.Emit(policy, t, events...)
+}
+
+// UnloadClass removes the class from the VM, raising a ClassUnload event for
+// each class unload request matching the class, returning the number of
+// events raised.
+func (vm *VM) UnloadClass(c *Class) (int, error) {
+	vm.Lock()
+	for i, other := range vm.classes {
+		if other == c {
+			vm.classes = append(vm.classes[:i:i], vm.classes[i+1:]...)
+			break
+		}
+	}
+	events, policy := []jdwpclient.Event{}, jdwpclient.SuspendNone
+	for _, r := range vm.requests {
+		if r.Kind == jdwpclient.ClassUnload && matches(r, nil, c, nil) {
+			events = append(events, &jdwpclient.EventClassUnload{Request: r.ID, Signature: c.Signature()})
+			policy = maxPolicy(policy, r.SuspendPolicy)
+		}
+	}
+	vm.Unlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return len(events), vm.Emit(policy, nil, events...)
+}
+
+// resumed completes the single steps requested on the thread, which has
+// just been resumed. It must be called with the VM locked.
+func (vm *VM) resumed(t *Thread) {
+	steps := []*jdwpclient.EventRequest{}
+	var step jdwpclient.StepEventModifier
+	for _, r := range vm.requests {
+		if r.Kind != jdwpclient.SingleStep {
+			continue
+		}
+		for _, m := range r.Modifiers {
+			if m, ok := m.(jdwpclient.StepEventModifier); ok && m.Thread == t.ThreadID() {
+				steps, step = append(steps, r), m
+			}
+		}
+	}
+	if len(steps) == 0 {
+		return
+	}
+	if vm.Step != nil {
+		vm.Step(t, step)
+	}
+	if len(t.Frames) == 0 {
+		// The thread returned from its last frame before completing the step.
+		events, policy := vm.terminate(t)
+		if len(events) > 0 {
+			go vm.emitAsync(policy, t, events)
+		}
+		return
+	}
+	location := t.Frames[0].Location
+	class := vm.classByID(jdwpclient.ReferenceTypeID(location.Class))
+	events, policy := []jdwpclient.Event{}, jdwpclient.SuspendNone
+	for _, r := range steps {
+		if matches(r, t, class, &location) {
+			events = append(events, &jdwpclient.EventSingleStep{Request: r.ID, Thread: t.ThreadID(), Location: location})
+			policy = maxPolicy(policy, r.SuspendPolicy)
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+	go vm.emitAsync(policy, t, events)
+}
+
+// emitAsync emits the events from a handler. Emit locks the VM, so the events
+// are sent once the command is handled.
+func (vm *VM) emitAsync(policy jdwpclient.SuspendPolicy, t *Thread, events []jdwpclient.Event) {
+	if err := vm.Emit(policy, t, events...); err != nil {
+		log.Debug().Err(err).Msg("Couldn't send events")
+	}
+}
+
+// Terminate ends the thread, raising a ThreadDeath event for each thread death
+// request matching the thread, returning the number of events raised.
+func (vm *VM) Terminate(t *Thread) (int, error) {
+	vm.Lock()
+	events, policy := vm.terminate(t)
+	vm.Unlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+	return len(events), vm.Emit(policy, t, events...)
+}
+
+// terminate removes the thread from the VM, returning the ThreadDeath events
+// to raise. It must be called with the VM locked.
+func (vm *VM) terminate(t *Thread) ([]jdwpclient.Event, jdwpclient.SuspendPolicy) {
+	for i, other := range vm.threads {
+		if other == t {
+			vm.threads = append(vm.threads[:i:i], vm.threads[i+1:]...)
+			break
+		}
+	}
+	t.Status, t.Frames = jdwpclient.ThreadZombie, nil
+	events, policy := []jdwpclient.Event{}, jdwpclient.SuspendNone
+	for _, r := range vm.requests {
+		if r.Kind == jdwpclient.ThreadDeath && matches(r, t, nil, nil) {
+			events = append(events, &jdwpclient.EventThreadDeath{Request: r.ID, Thread: t.ThreadID()})
+			policy = maxPolicy(policy, r.SuspendPolicy)
+		}
+	}
+	return events, policy
+}
+
+// Death sends the automatically generated VMDeath event.
+func (vm *VM) Death() error {
+	return vm.Emit(jdwpclient.SuspendNone, nil, &jdwpclient.EventVMDeath{})
+}
+
+// matches returns true if the request's modifiers permit an event on the
+// thread, in the class and at the location. The modifiers that cannot be
+// evaluated by the VM are ignored.
+func matches(r *jdwpclient.EventRequest, t *Thread, c *Class, l *jdwpclient.Location) bool {
+	for _, m := range r.Modifiers {
+		switch m := m.(type) {
+		case jdwpclient.ThreadOnlyEventModifier:
+			if t == nil || t.ThreadID() != jdwpclient.ThreadID(m) {
+				return false
+			}
+		case jdwpclient.ClassOnlyEventModifier:
+			if c == nil || c.ClassID() != jdwpclient.ClassID(m) {
+				return false
+			}
+		case jdwpclient.ClassMatchEventModifier:
+			if c == nil || !matchClass(string(m), c.Name) {
+				return false
+			}
+		case jdwpclient.ClassExcludeEventModifier:
+			if c != nil && matchClass(string(m), c.Name) {
+				return false
+			}
+		case jdwpclient.LocationOnlyEventModifier:
+			if l == nil || *l != jdwpclient.Location(m) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchClass returns true if the class name matches the pattern of a class
+// match modifier, which may start or end with a '*' wildcard.
+func matchClass(pattern, name string) bool {
+	switch {
+	case strings.HasPrefix(pattern, "*"):
+		return strings.HasSuffix(name, pattern[1:])
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(name, pattern[:len(pattern)-1])
+	}
+	return pattern == name
+}
+
+func maxPolicy(a, b jdwpclient.SuspendPolicy) jdwpclient.SuspendPolicy {
+	if a > b {
+		return a
+	}
+	return b
+}
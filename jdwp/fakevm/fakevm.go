@@ -0,0 +1,330 @@
+// Package fakevm implements an in-process Java virtual machine that speaks the
+// JDWP protocol, for testing the jdwpclient and jdbg packages without a JDK.
+//
+// The VM serves a synthetic model of classes, threads, frames and objects that
+// is built by the test. Commands that are not implemented by the model reply
+// with ErrNotImplemented, and any command can be scripted with VM.Handle.
+// Events are raised by the test with Emit, or with the helpers that raise
+// events for the matching event requests.
+package fakevm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sapelkinav/javadap/jdwp/data/binary"
+	"sapelkinav/javadap/jdwp/data/endian"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sapelkinav/javadap/utils"
+	"sync"
+)
+
+var log, _ = utils.GetComponentLogger("jdwp", "fakevm")
+
+var handshake = []byte("JDWP-Handshake")
+
+const (
+	packetHeaderLength = 11
+	packetIsReply      = 0x80
+)
+
+// Command identifies a JDWP command by its command set and command number.
+type Command struct {
+	Set uint8
+	ID  uint8
+}
+
+// Handler handles a single command, decoding the arguments from args and
+// returning the reply data. The reply data is encoded with jdwpclient.Encode,
+// and ignored if the returned error is not jdwpclient.ErrNone.
+// Handlers are called with the VM locked.
+type Handler func(args *Args) (interface{}, jdwpclient.Error)
+
+// Args holds the arguments of a command.
+type Args struct {
+	Command Command
+	r       binary.Reader
+	sizes   jdwpclient.IDSizes
+}
+
+// badArgs is the panic value used by Args.Decode.
+type badArgs struct{ err error }
+
+// Decode decodes the next argument into the value pointed to by v. If the
+// arguments cannot be decoded, the command fails with ErrIllegalArgument.
+func (a *Args) Decode(v interface{}) {
+	if err := jdwpclient.Decode(a.r, a.sizes, v); err != nil {
+		panic(badArgs{err})
+	}
+}
+
+// VM is a fake Java virtual machine. The model of the VM can be modified by
+// the test while serving, as long as the VM is locked.
+type VM struct {
+	sync.Mutex
+
+	// Version is the reply to the VirtualMachine.Version command.
+	Version jdwpclient.Version
+	// Capabilities is the reply to the VirtualMachine.CapabilitiesNew command.
+	// Capabilities is read when the client opens the connection.
+	Capabilities jdwpclient.Capabilities
+	// Step is called with the VM locked when a thread with a single step
+	// request is resumed, to move the thread to where the step completes.
+	// A nil Step completes steps at the thread's current location.
+	Step func(t *Thread, step jdwpclient.StepEventModifier)
+
+	sizes    jdwpclient.IDSizes
+	nextID   uint64
+	handlers map[Command]Handler
+
+	classes  []*Class
+	threads  []*Thread
+	groups   []*ThreadGroup
+	objects  map[jdwpclient.ObjectID]*Object
+	requests []*jdwpclient.EventRequest
+	disabled map[jdwpclient.ObjectID]int
+	exitCode *int
+
+	disposed bool
+
+	outLock sync.Mutex // Guards out and conn, and serializes writes to out
+	out     io.Writer
+	conn    io.Closer
+}
+
+// New returns a new VM holding the classes of java.lang used by jdbg.
+func New() *VM {
+	vm := &VM{
+		Version: jdwpclient.Version{
+			Description: "Fake VM",
+			JDWPMajor:   1,
+			JDWPMinor:   8,
+			Version:     "1.8.0",
+			Name:        "fakevm",
+		},
+		Capabilities: jdwpclient.Capabilities{
+			CanWatchFieldModification:     true,
+			CanWatchFieldAccess:           true,
+			CanGetOwnedMonitorInfo:        true,
+			CanGetCurrentContendedMonitor: true,
+			CanGetMonitorInfo:             true,
+			CanGetMonitorFrameInfo:        true,
+			CanRedefineClasses:            true,
+			CanPopFrames:                  true,
+			CanUseInstanceFilters:         true,
+			CanRequestVMDeathEvent:        true,
+			CanGetInstanceInfo:            true,
+			CanForceEarlyReturn:           true,
+			CanGetSourceDebugExtension:    true,
+		},
+		sizes: jdwpclient.IDSizes{
+			FieldIDSize:         8,
+			MethodIDSize:        8,
+			ObjectIDSize:        8,
+			ReferenceTypeIDSize: 8,
+			FrameIDSize:         8,
+		},
+		nextID:   1,
+		handlers: map[Command]Handler{},
+		objects:  map[jdwpclient.ObjectID]*Object{},
+		disabled: map[jdwpclient.ObjectID]int{},
+	}
+	object := vm.AddClass("java.lang.Object", nil)
+	number := vm.AddClass("java.lang.Number", object)
+	for _, name := range []string{"String", "Boolean", "Character", "Class", "Thread", "ThreadGroup"} {
+		vm.AddClass("java.lang."+name, object)
+	}
+	for _, name := range []string{"Byte", "Short", "Integer", "Long", "Float", "Double"} {
+		vm.AddClass("java.lang."+name, number)
+	}
+	// Threads are added to the main group, as the threads started by main.
+	system := vm.addThreadGroup("system", nil)
+	vm.addThreadGroup("main", system)
+	return vm
+}
+
+// Handle replaces the handler of the command cmd with h.
+func (vm *VM) Handle(cmd Command, h Handler) {
+	vm.Lock()
+	defer vm.Unlock()
+	vm.handlers[cmd] = h
+}
+
+// Open starts serving the VM over an in-memory pipe, returning the client
+// connection to the VM.
+func (vm *VM) Open(ctx context.Context) (*jdwpclient.Connection, error) {
+	client, server := net.Pipe()
+	go func() {
+		if err := vm.Serve(server); err != nil {
+			log.Debug().Err(err).Msg("Fake VM stopped serving")
+		}
+	}()
+	conn, err := jdwpclient.Open(ctx, client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Serve serves JDWP commands over conn until the connection is closed, or the
+// VM is exited or disposed.
+func (vm *VM) Serve(conn io.ReadWriteCloser) error {
+	defer conn.Close()
+
+	got := make([]byte, len(handshake))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return err
+	}
+	if !bytes.Equal(got, handshake) {
+		return fmt.Errorf("Invalid handshake %q", got)
+	}
+	if _, err := conn.Write(handshake); err != nil {
+		return err
+	}
+
+	vm.Lock()
+	vm.disposed = false
+	vm.Unlock()
+	vm.outLock.Lock()
+	vm.out, vm.conn = conn, conn
+	vm.outLock.Unlock()
+
+	r := endian.Reader(conn, endian.BigEndian)
+	for {
+		length := r.Uint32()
+		id := r.Uint32()
+		flags := r.Uint8()
+		cmd := Command{Set: r.Uint8(), ID: r.Uint8()}
+		if err := r.Error(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if length < packetHeaderLength {
+			return fmt.Errorf("Packet length too short (%d)", length)
+		}
+		data := make([]byte, length-packetHeaderLength)
+		r.Data(data)
+		if err := r.Error(); err != nil {
+			return err
+		}
+		if flags&packetIsReply != 0 {
+			continue // The VM never sends commands that need replies.
+		}
+
+		reply, errCode := vm.dispatch(cmd, data)
+		if err := vm.reply(id, reply, errCode); err != nil {
+			return err
+		}
+
+		vm.Lock()
+		done := vm.disposed || vm.exitCode != nil
+		vm.Unlock()
+		if done {
+			return nil
+		}
+	}
+}
+
+// Close closes the connection to the client, as if the VM had crashed.
+// Close can be called by handlers.
+func (vm *VM) Close() error {
+	vm.outLock.Lock()
+	defer vm.outLock.Unlock()
+	if vm.conn == nil {
+		return nil
+	}
+	return vm.conn.Close()
+}
+
+// ExitCode returns the exit code passed to VirtualMachine.Exit, and true, or
+// false if the VM has not been exited.
+func (vm *VM) ExitCode() (int, bool) {
+	vm.Lock()
+	defer vm.Unlock()
+	if vm.exitCode == nil {
+		return 0, false
+	}
+	return *vm.exitCode, true
+}
+
+// dispatch calls the handler for cmd, returning the reply data and error code.
+func (vm *VM) dispatch(cmd Command, data []byte) (reply interface{}, errCode jdwpclient.Error) {
+	vm.Lock()
+	defer vm.Unlock()
+
+	h, ok := vm.handlers[cmd]
+	if !ok {
+		if f, ok := defaultHandlers[cmd]; ok {
+			h = func(args *Args) (interface{}, jdwpclient.Error) { return f(vm, args) }
+		}
+	}
+	if h == nil {
+		log.Debug().Uint8("set", cmd.Set).Uint8("cmd", cmd.ID).Msg("Unhandled command")
+		return nil, jdwpclient.ErrNotImplemented
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			bad, ok := r.(badArgs)
+			if !ok {
+				panic(r)
+			}
+			log.Debug().Err(bad.err).Uint8("set", cmd.Set).Uint8("cmd", cmd.ID).Msg("Bad command arguments")
+			reply, errCode = nil, jdwpclient.ErrIllegalArgument
+		}
+	}()
+	args := &Args{
+		Command: cmd,
+		r:       endian.Reader(bytes.NewReader(data), endian.BigEndian),
+		sizes:   vm.sizes,
+	}
+	return h(args)
+}
+
+// reply sends the reply packet for the command id.
+func (vm *VM) reply(id uint32, reply interface{}, errCode jdwpclient.Error) error {
+	data := bytes.Buffer{}
+	if errCode == jdwpclient.ErrNone && reply != nil {
+		if err := jdwpclient.Encode(endian.Writer(&data, endian.BigEndian), vm.sizes, reply); err != nil {
+			return err
+		}
+	}
+	return vm.write(func(w binary.Writer) {
+		w.Uint32(uint32(packetHeaderLength + data.Len()))
+		w.Uint32(id)
+		w.Uint8(packetIsReply)
+		w.Uint16(uint16(errCode))
+		w.Data(data.Bytes())
+	})
+}
+
+// write calls f to write a single packet to the client.
+func (vm *VM) write(f func(w binary.Writer)) error {
+	vm.outLock.Lock()
+	defer vm.outLock.Unlock()
+	out := vm.out
+	if out == nil {
+		return fmt.Errorf("VM is not serving")
+	}
+	buf := bytes.Buffer{}
+	w := endian.Writer(&buf, endian.BigEndian)
+	f(w)
+	if err := w.Error(); err != nil {
+		return err
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// newID returns a new unique identifier for a class, method, field, object or
+// frame.
+func (vm *VM) newID() uint64 {
+	id := vm.nextID
+	vm.nextID++
+	return id
+}
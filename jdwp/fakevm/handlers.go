@@ -0,0 +1,1154 @@
+package fakevm
+
+import (
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+	"unicode"
+)
+
+type handler func(vm *VM, args *Args) (interface{}, jdwpclient.Error)
+
+// defaultHandlers are the handlers that serve the VM's model.
+var defaultHandlers = map[Command]handler{
+	{1, 1}:   (*VM).onVersion,
+	{1, 2}:   (*VM).onClassesBySignature,
+	{1, 3}:   (*VM).onAllClasses,
+	{1, 4}:   (*VM).onAllThreads,
+	{1, 5}:   (*VM).onTopLevelThreadGroups,
+	{1, 6}:   (*VM).onDispose,
+	{1, 7}:   (*VM).onIDSizes,
+	{1, 8}:   (*VM).onSuspendAll,
+	{1, 9}:   (*VM).onResumeAll,
+	{1, 10}:  (*VM).onExit,
+	{1, 11}:  (*VM).onCreateString,
+	{1, 12}:  (*VM).onCapabilities,
+	{1, 17}:  (*VM).onCapabilitiesNew,
+	{1, 18}:  (*VM).onRedefineClasses,
+	{1, 21}:  (*VM).onInstanceCounts,
+	{2, 1}:   (*VM).onSignature,
+	{2, 2}:   (*VM).onClassLoader,
+	{2, 3}:   (*VM).onModifiers,
+	{2, 4}:   (*VM).onFields,
+	{2, 5}:   (*VM).onMethods,
+	{2, 6}:   (*VM).onStaticValues,
+	{2, 7}:   (*VM).onSourceFile,
+	{2, 8}:   (*VM).onNestedTypes,
+	{2, 9}:   (*VM).onStatus,
+	{2, 10}:  (*VM).onInterfaces,
+	{2, 11}:  (*VM).onClassObject,
+	{2, 12}:  (*VM).onSourceDebugExtension,
+	{2, 16}:  (*VM).onInstances,
+	{3, 1}:   (*VM).onSuperclass,
+	{3, 2}:   (*VM).onSetStaticValues,
+	{3, 3}:   (*VM).onInvokeStatic,
+	{3, 4}:   (*VM).onNewInstance,
+	{6, 1}:   (*VM).onLineTable,
+	{6, 2}:   (*VM).onVariableTable,
+	{6, 4}:   (*VM).onIsObsolete,
+	{9, 1}:   (*VM).onReferenceType,
+	{9, 2}:   (*VM).onObjectValues,
+	{9, 3}:   (*VM).onSetObjectValues,
+	{9, 5}:   (*VM).onMonitorInfo,
+	{9, 6}:   (*VM).onInvokeMethod,
+	{9, 7}:   (*VM).onDisableCollection,
+	{9, 8}:   (*VM).onEnableCollection,
+	{9, 10}:  (*VM).onReferringObjects,
+	{10, 1}:  (*VM).onStringValue,
+	{11, 1}:  (*VM).onThreadName,
+	{11, 2}:  (*VM).onThreadSuspend,
+	{11, 3}:  (*VM).onThreadResume,
+	{11, 4}:  (*VM).onThreadStatus,
+	{11, 5}:  (*VM).onThreadGroup,
+	{11, 6}:  (*VM).onFrames,
+	{11, 7}:  (*VM).onFrameCount,
+	{11, 8}:  (*VM).onOwnedMonitors,
+	{11, 9}:  (*VM).onCurrentContendedMonitor,
+	{11, 12}: (*VM).onSuspendCount,
+	{11, 13}: (*VM).onOwnedMonitorsStackDepth,
+	{11, 14}: (*VM).onForceEarlyReturn,
+	{12, 1}:  (*VM).onThreadGroupName,
+	{12, 2}:  (*VM).onThreadGroupParent,
+	{12, 3}:  (*VM).onThreadGroupChildren,
+	{13, 1}:  (*VM).onArrayLength,
+	{13, 2}:  (*VM).onArrayValues,
+	{13, 3}:  (*VM).onSetArrayValues,
+	{15, 1}:  (*VM).onEventRequestSet,
+	{15, 2}:  (*VM).onEventRequestClear,
+	{15, 3}:  (*VM).onClearAllBreakpoints,
+	{16, 1}:  (*VM).onFrameValues,
+	{16, 2}:  (*VM).onSetFrameValues,
+	{16, 3}:  (*VM).onThisObject,
+	{16, 4}:  (*VM).onPopFrames,
+	{17, 1}:  (*VM).onReflectedType,
+}
+
+func (vm *VM) onVersion(args *Args) (interface{}, jdwpclient.Error) {
+	return vm.Version, jdwpclient.ErrNone
+}
+
+func (vm *VM) onClassesBySignature(args *Args) (interface{}, jdwpclient.Error) {
+	var sig string
+	args.Decode(&sig)
+	type class struct {
+		Kind   jdwpclient.TypeTag
+		TypeID jdwpclient.ReferenceTypeID
+		Status jdwpclient.ClassStatus
+	}
+	out := []class{}
+	for _, c := range vm.classes {
+		if c.Signature() == sig {
+			out = append(out, class{c.Kind, c.ID, c.Status})
+		}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onAllClasses(args *Args) (interface{}, jdwpclient.Error) {
+	out := make([]jdwpclient.ClassInfo, len(vm.classes))
+	for i, c := range vm.classes {
+		out[i] = jdwpclient.ClassInfo{Kind: c.Kind, TypeID: c.ID, Signature: c.Signature(), Status: c.Status}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onAllThreads(args *Args) (interface{}, jdwpclient.Error) {
+	out := []jdwpclient.ThreadID{}
+	for _, t := range vm.threads {
+		if t.Status != jdwpclient.ThreadZombie {
+			out = append(out, t.ThreadID())
+		}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onTopLevelThreadGroups(args *Args) (interface{}, jdwpclient.Error) {
+	out := []jdwpclient.ThreadGroupID{}
+	for _, g := range vm.groups {
+		if g.Parent == nil {
+			out = append(out, g.ThreadGroupID())
+		}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onDispose(args *Args) (interface{}, jdwpclient.Error) {
+	vm.requests = nil
+	for _, t := range vm.threads {
+		t.suspend = 0
+	}
+	vm.disposed = true
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onIDSizes(args *Args) (interface{}, jdwpclient.Error) {
+	return vm.sizes, jdwpclient.ErrNone
+}
+
+func (vm *VM) onSuspendAll(args *Args) (interface{}, jdwpclient.Error) {
+	for _, t := range vm.threads {
+		t.suspend++
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onResumeAll(args *Args) (interface{}, jdwpclient.Error) {
+	for _, t := range vm.threads {
+		if t.suspend > 0 {
+			t.suspend--
+			if t.suspend == 0 {
+				vm.resumed(t)
+			}
+		}
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onExit(args *Args) (interface{}, jdwpclient.Error) {
+	var code int
+	args.Decode(&code)
+	vm.exitCode = &code
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onCreateString(args *Args) (interface{}, jdwpclient.Error) {
+	var s string
+	args.Decode(&s)
+	return jdwpclient.StringID(vm.newString(s).ID), jdwpclient.ErrNone
+}
+
+func (vm *VM) onCapabilities(args *Args) (interface{}, jdwpclient.Error) {
+	c := vm.Capabilities
+	return struct {
+		CanWatchFieldModification, CanWatchFieldAccess, CanGetBytecodes, CanGetSyntheticAttribute,
+		CanGetOwnedMonitorInfo, CanGetCurrentContendedMonitor, CanGetMonitorInfo bool
+	}{
+		c.CanWatchFieldModification,
+		c.CanWatchFieldAccess,
+		c.CanGetBytecodes,
+		c.CanGetSyntheticAttribute,
+		c.CanGetOwnedMonitorInfo,
+		c.CanGetCurrentContendedMonitor,
+		c.CanGetMonitorInfo,
+	}, jdwpclient.ErrNone
+}
+
+func (vm *VM) onCapabilitiesNew(args *Args) (interface{}, jdwpclient.Error) {
+	return vm.Capabilities, jdwpclient.ErrNone
+}
+
+func (vm *VM) onRedefineClasses(args *Args) (interface{}, jdwpclient.Error) {
+	var defs []jdwpclient.ClassDefinition
+	args.Decode(&defs)
+	classes := make([]*Class, len(defs))
+	for i, def := range defs {
+		if classes[i] = vm.classByID(def.Type); classes[i] == nil {
+			return nil, jdwpclient.ErrInvalidClass
+		}
+	}
+	for i, c := range classes {
+		var changed []*Method
+		if c.Redefine != nil {
+			var err jdwpclient.Error
+			if changed, err = c.Redefine(defs[i].Bytes); err != jdwpclient.ErrNone {
+				return nil, err
+			}
+		}
+		c.Bytes = defs[i].Bytes
+		for _, m := range changed {
+			vm.obsolete(m)
+		}
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onInstanceCounts(args *Args) (interface{}, jdwpclient.Error) {
+	var ids []jdwpclient.ReferenceTypeID
+	args.Decode(&ids)
+	out := make([]int64, len(ids))
+	for i, id := range ids {
+		c := vm.classByID(id)
+		if c == nil {
+			return nil, jdwpclient.ErrInvalidClass
+		}
+		for _, o := range vm.objects {
+			if o.Class == c {
+				out[i]++
+			}
+		}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onSignature(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return c.Signature(), jdwpclient.ErrNone
+}
+
+func (vm *VM) onClassLoader(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if c.Loader == nil {
+		return jdwpclient.ClassLoaderID(0), jdwpclient.ErrNone
+	}
+	return jdwpclient.ClassLoaderID(c.Loader.ID), jdwpclient.ErrNone
+}
+
+func (vm *VM) onModifiers(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return c.ModBits, jdwpclient.ErrNone
+}
+
+func (vm *VM) onSourceFile(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if c.SourceFile == "" {
+		return nil, jdwpclient.ErrAbsentInformation
+	}
+	return c.SourceFile, jdwpclient.ErrNone
+}
+
+// onNestedTypes replies with the classes named after the class followed by
+// "$" and a member name, such as "Outer$Inner". Local and anonymous classes,
+// whose names start with a digit, are not members.
+func (vm *VM) onNestedTypes(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := []jdwpclient.ObjectType{}
+	for _, n := range vm.classes {
+		member := strings.TrimPrefix(n.Name, c.Name+"$")
+		if member == n.Name || member == "" || strings.Contains(member, "$") || unicode.IsDigit(rune(member[0])) {
+			continue
+		}
+		out = append(out, jdwpclient.ObjectType{Kind: n.Kind, Type: n.ID})
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onStatus(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return c.Status, jdwpclient.ErrNone
+}
+
+func (vm *VM) onClassObject(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return jdwpclient.ClassObjectID(vm.classObject(c).ID), jdwpclient.ErrNone
+}
+
+func (vm *VM) onSourceDebugExtension(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if c.SourceDebugExtension == "" {
+		return nil, jdwpclient.ErrAbsentInformation
+	}
+	return c.SourceDebugExtension, jdwpclient.ErrNone
+}
+
+func (vm *VM) onFields(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := make(jdwpclient.Fields, len(c.Fields))
+	for i, f := range c.Fields {
+		out[i] = jdwpclient.Field{ID: f.ID, Name: f.Name, Signature: f.Signature, ModBits: f.ModBits}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onMethods(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := make(jdwpclient.Methods, len(c.Methods))
+	for i, m := range c.Methods {
+		out[i] = jdwpclient.Method{ID: m.ID, Name: m.Name, Signature: m.Signature, ModBits: m.ModBits}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onStaticValues(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var ids []jdwpclient.FieldID
+	args.Decode(&ids)
+	out := make([]jdwpclient.Value, len(ids))
+	for i, id := range ids {
+		f := vm.field(c, id)
+		if f == nil {
+			return nil, jdwpclient.ErrInvalidFieldID
+		}
+		out[i] = f.Value
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onInterfaces(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := make([]jdwpclient.InterfaceID, len(c.Interfaces))
+	for i, iface := range c.Interfaces {
+		out[i] = jdwpclient.InterfaceID(iface.ID)
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onInstances(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var max int
+	args.Decode(&max)
+	out := []jdwpclient.TaggedObjectID{}
+	for _, o := range vm.sortedObjects() {
+		if max > 0 && len(out) == max {
+			break
+		}
+		if o.Class == c {
+			out = append(out, taggedObject(o))
+		}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onSuperclass(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if c.Super == nil {
+		return jdwpclient.ClassID(0), jdwpclient.ErrNone
+	}
+	return c.Super.ClassID(), jdwpclient.ErrNone
+}
+
+func (vm *VM) onSetStaticValues(args *Args) (interface{}, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var count int
+	args.Decode(&count)
+	for i := 0; i < count; i++ {
+		var id jdwpclient.FieldID
+		args.Decode(&id)
+		f := vm.field(c, id)
+		if f == nil {
+			return nil, jdwpclient.ErrInvalidFieldID
+		}
+		f.Value = vm.decodeUntagged(args, f.Signature)
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onInvokeStatic(args *Args) (interface{}, jdwpclient.Error) {
+	var req struct {
+		Class   jdwpclient.ClassID
+		Thread  jdwpclient.ThreadID
+		Method  jdwpclient.MethodID
+		Args    []jdwpclient.Value
+		Options jdwpclient.InvokeOptions
+	}
+	args.Decode(&req)
+	return vm.invoke(jdwpclient.ReferenceTypeID(req.Class), req.Method, req.Thread, nil, req.Args)
+}
+
+func (vm *VM) onNewInstance(args *Args) (interface{}, jdwpclient.Error) {
+	var req struct {
+		Class       jdwpclient.ClassID
+		Thread      jdwpclient.ThreadID
+		Constructor jdwpclient.MethodID
+		Args        []jdwpclient.Value
+		Options     jdwpclient.InvokeOptions
+	}
+	args.Decode(&req)
+	c := vm.classByID(jdwpclient.ReferenceTypeID(req.Class))
+	if c == nil {
+		return nil, jdwpclient.ErrInvalidClass
+	}
+	this := vm.newObject(c)
+	res, err := vm.invoke(c.ID, req.Constructor, req.Thread, this, req.Args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := jdwpclient.NewInstanceResult{Exception: res.Exception}
+	if res.Exception.Object == 0 {
+		out.Result = jdwpclient.TaggedObjectID{Type: jdwpclient.TagObject, Object: this.ID}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onLineTable(args *Args) (interface{}, jdwpclient.Error) {
+	m, err := vm.decodeMethod(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if m.ModBits&jdwpclient.ModNative != 0 {
+		return nil, jdwpclient.ErrNativeMethod
+	}
+	if len(m.Lines) == 0 {
+		return nil, jdwpclient.ErrAbsentInformation
+	}
+	out := jdwpclient.LineTable{End: uint64(len(m.Lines) - 1)}
+	for i, line := range m.Lines {
+		out.Lines = append(out.Lines, jdwpclient.LineTableEntry{CodeIndex: uint64(i), LineNumber: line})
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onVariableTable(args *Args) (interface{}, jdwpclient.Error) {
+	m, err := vm.decodeMethod(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if m.ModBits&jdwpclient.ModNative != 0 {
+		return nil, jdwpclient.ErrNativeMethod
+	}
+	if len(m.Variables.Slots) == 0 {
+		return nil, jdwpclient.ErrAbsentInformation
+	}
+	return m.Variables, jdwpclient.ErrNone
+}
+
+func (vm *VM) onIsObsolete(args *Args) (interface{}, jdwpclient.Error) {
+	m, err := vm.decodeMethod(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return m.Obsolete, jdwpclient.ErrNone
+}
+
+func (vm *VM) onReferenceType(args *Args) (interface{}, jdwpclient.Error) {
+	o, err := vm.decodeObject(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return jdwpclient.ObjectType{Kind: o.Class.Kind, Type: o.Class.ID}, jdwpclient.ErrNone
+}
+
+func (vm *VM) onObjectValues(args *Args) (interface{}, jdwpclient.Error) {
+	o, err := vm.decodeObject(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var ids []jdwpclient.FieldID
+	args.Decode(&ids)
+	out := make([]jdwpclient.Value, len(ids))
+	for i, id := range ids {
+		if vm.field(o.Class, id) == nil {
+			return nil, jdwpclient.ErrInvalidFieldID
+		}
+		out[i] = o.Fields[id]
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onSetObjectValues(args *Args) (interface{}, jdwpclient.Error) {
+	o, err := vm.decodeObject(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var count int
+	args.Decode(&count)
+	for i := 0; i < count; i++ {
+		var id jdwpclient.FieldID
+		args.Decode(&id)
+		f := vm.field(o.Class, id)
+		if f == nil {
+			return nil, jdwpclient.ErrInvalidFieldID
+		}
+		o.Fields[id] = vm.decodeUntagged(args, f.Signature)
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onInvokeMethod(args *Args) (interface{}, jdwpclient.Error) {
+	var req struct {
+		Object  jdwpclient.ObjectID
+		Thread  jdwpclient.ThreadID
+		Class   jdwpclient.ClassID
+		Method  jdwpclient.MethodID
+		Args    []jdwpclient.Value
+		Options jdwpclient.InvokeOptions
+	}
+	args.Decode(&req)
+	this, ok := vm.objects[req.Object]
+	if !ok {
+		return nil, jdwpclient.ErrInvalidObject
+	}
+	return vm.invoke(jdwpclient.ReferenceTypeID(req.Class), req.Method, req.Thread, this, req.Args)
+}
+
+func (vm *VM) onMonitorInfo(args *Args) (interface{}, jdwpclient.Error) {
+	var id jdwpclient.ObjectID
+	args.Decode(&id)
+	o, ok := vm.objects[id]
+	if !ok {
+		return nil, jdwpclient.ErrInvalidObject
+	}
+	out := jdwpclient.MonitorUsage{Waiters: []jdwpclient.ThreadID{}}
+	for _, t := range vm.threads {
+		if t.Status == jdwpclient.ThreadZombie {
+			continue
+		}
+		if t.suspend == 0 {
+			return nil, jdwpclient.ErrThreadNotSuspended
+		}
+		for _, m := range t.Owned {
+			if m.Object == o {
+				out.Owner = t.ThreadID()
+				out.EntryCount++
+			}
+		}
+		if t.Contended == o {
+			out.Waiters = append(out.Waiters, t.ThreadID())
+		}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onDisableCollection(args *Args) (interface{}, jdwpclient.Error) {
+	o, err := vm.decodeObject(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	vm.disabled[o.ID]++
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onEnableCollection(args *Args) (interface{}, jdwpclient.Error) {
+	o, err := vm.decodeObject(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if vm.disabled[o.ID]--; vm.disabled[o.ID] <= 0 {
+		delete(vm.disabled, o.ID)
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+// onReferringObjects replies with the objects whose fields or elements hold
+// the object, followed by the class objects of the classes whose static fields
+// hold it.
+func (vm *VM) onReferringObjects(args *Args) (interface{}, jdwpclient.Error) {
+	o, err := vm.decodeObject(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var max int
+	args.Decode(&max)
+	referrers := []*Object{}
+	for _, r := range vm.sortedObjects() {
+		for _, v := range r.Fields {
+			if references(v, o) {
+				referrers = append(referrers, r)
+				break
+			}
+		}
+		for _, v := range r.Elements {
+			if references(v, o) {
+				referrers = append(referrers, r)
+				break
+			}
+		}
+	}
+	for _, c := range vm.classes {
+		for _, f := range c.Fields {
+			if f.ModBits&jdwpclient.ModStatic != 0 && references(f.Value, o) {
+				referrers = append(referrers, vm.classObject(c))
+				break
+			}
+		}
+	}
+	if max > 0 && len(referrers) > max {
+		referrers = referrers[:max]
+	}
+	out := make([]jdwpclient.TaggedObjectID, len(referrers))
+	for i, r := range referrers {
+		out[i] = taggedObject(r)
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onStringValue(args *Args) (interface{}, jdwpclient.Error) {
+	o, err := vm.decodeObject(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if o.Class.Name != "java.lang.String" {
+		return nil, jdwpclient.ErrInvalidString
+	}
+	return o.String, jdwpclient.ErrNone
+}
+
+func (vm *VM) onArrayLength(args *Args) (interface{}, jdwpclient.Error) {
+	a, err := vm.decodeArray(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return len(a.Elements), jdwpclient.ErrNone
+}
+
+func (vm *VM) onArrayValues(args *Args) (interface{}, jdwpclient.Error) {
+	a, err := vm.decodeArray(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var first, length int
+	args.Decode(&first)
+	args.Decode(&length)
+	if first < 0 || length < 0 || first+length > len(a.Elements) {
+		return nil, jdwpclient.ErrInvalidLength
+	}
+	return jdwpclient.ArrayRegion{
+		Tag:    jdwpclient.Tag(a.Class.Component[0]),
+		Values: a.Elements[first : first+length],
+	}, jdwpclient.ErrNone
+}
+
+func (vm *VM) onSetArrayValues(args *Args) (interface{}, jdwpclient.Error) {
+	a, err := vm.decodeArray(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var first, count int
+	args.Decode(&first)
+	args.Decode(&count)
+	if first < 0 || count < 0 || first+count > len(a.Elements) {
+		return nil, jdwpclient.ErrInvalidLength
+	}
+	for i := 0; i < count; i++ {
+		a.Elements[first+i] = vm.decodeUntagged(args, a.Class.Component)
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onThreadName(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return t.Name, jdwpclient.ErrNone
+}
+
+func (vm *VM) onThreadSuspend(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	t.suspend++
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onThreadResume(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if t.suspend > 0 {
+		t.suspend--
+		if t.suspend == 0 {
+			vm.resumed(t)
+		}
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onThreadStatus(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := struct {
+		Thread  jdwpclient.ThreadStatus
+		Suspend jdwpclient.SuspendStatus
+	}{t.Status, jdwpclient.NotSuspended}
+	if t.suspend > 0 {
+		out.Suspend = jdwpclient.Suspended
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onThreadGroup(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if t.Group == nil {
+		return jdwpclient.ThreadGroupID(0), jdwpclient.ErrNone
+	}
+	return t.Group.ThreadGroupID(), jdwpclient.ErrNone
+}
+
+func (vm *VM) onThreadGroupName(args *Args) (interface{}, jdwpclient.Error) {
+	g, err := vm.decodeThreadGroup(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return g.Name, jdwpclient.ErrNone
+}
+
+func (vm *VM) onThreadGroupParent(args *Args) (interface{}, jdwpclient.Error) {
+	g, err := vm.decodeThreadGroup(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if g.Parent == nil {
+		return jdwpclient.ThreadGroupID(0), jdwpclient.ErrNone
+	}
+	return g.Parent.ThreadGroupID(), jdwpclient.ErrNone
+}
+
+func (vm *VM) onThreadGroupChildren(args *Args) (interface{}, jdwpclient.Error) {
+	g, err := vm.decodeThreadGroup(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := jdwpclient.ThreadGroupChildren{Threads: []jdwpclient.ThreadID{}, Groups: []jdwpclient.ThreadGroupID{}}
+	for _, t := range vm.threads {
+		if t.Group == g && t.Status != jdwpclient.ThreadZombie {
+			out.Threads = append(out.Threads, t.ThreadID())
+		}
+	}
+	for _, child := range vm.groups {
+		if child.Parent == g {
+			out.Groups = append(out.Groups, child.ThreadGroupID())
+		}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onFrames(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeSuspendedThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var start, count int
+	args.Decode(&start)
+	args.Decode(&count)
+	if count < 0 {
+		count = len(t.Frames) - start
+	}
+	if start < 0 || count < 0 || start+count > len(t.Frames) {
+		return nil, jdwpclient.ErrInvalidIndex
+	}
+	out := []jdwpclient.FrameInfo{}
+	for _, f := range t.Frames[start : start+count] {
+		out = append(out, jdwpclient.FrameInfo{Frame: f.ID, Location: f.Location})
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onFrameCount(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeSuspendedThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return len(t.Frames), jdwpclient.ErrNone
+}
+
+func (vm *VM) onOwnedMonitors(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeSuspendedThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := []jdwpclient.TaggedObjectID{}
+	seen := map[*Object]bool{}
+	for _, m := range t.Owned {
+		if !seen[m.Object] {
+			seen[m.Object] = true
+			out = append(out, jdwpclient.TaggedObjectID{Type: jdwpclient.TagObject, Object: m.Object.ID})
+		}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onCurrentContendedMonitor(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeSuspendedThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := jdwpclient.TaggedObjectID{Type: jdwpclient.TagObject}
+	if t.Contended != nil {
+		out.Object = t.Contended.ID
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onOwnedMonitorsStackDepth(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeSuspendedThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := []jdwpclient.OwnedMonitor{}
+	for _, m := range t.Owned {
+		monitor := jdwpclient.TaggedObjectID{Type: jdwpclient.TagObject, Object: m.Object.ID}
+		out = append(out, jdwpclient.OwnedMonitor{Monitor: monitor, StackDepth: m.Depth})
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onSuspendCount(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	return t.suspend, jdwpclient.ErrNone
+}
+
+func (vm *VM) onForceEarlyReturn(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeSuspendedThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var value jdwpclient.Value
+	args.Decode(&value)
+	if len(t.Frames) == 0 {
+		return nil, jdwpclient.ErrNoMoreFrames
+	}
+	t.Frames = t.Frames[1:]
+	t.Returned = value
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onEventRequestSet(args *Args) (interface{}, jdwpclient.Error) {
+	req := &jdwpclient.EventRequest{ID: jdwpclient.EventRequestID(vm.newID())}
+	args.Decode(&req.Kind)
+	args.Decode(&req.SuspendPolicy)
+	args.Decode(&req.Modifiers)
+	vm.requests = append(vm.requests, req)
+	return req.ID, jdwpclient.ErrNone
+}
+
+func (vm *VM) onEventRequestClear(args *Args) (interface{}, jdwpclient.Error) {
+	var kind jdwpclient.EventKind
+	var id jdwpclient.EventRequestID
+	args.Decode(&kind)
+	args.Decode(&id)
+	for i, r := range vm.requests {
+		if r.ID == id && r.Kind == kind {
+			vm.requests = append(vm.requests[:i], vm.requests[i+1:]...)
+			break
+		}
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onClearAllBreakpoints(args *Args) (interface{}, jdwpclient.Error) {
+	kept := []*jdwpclient.EventRequest{}
+	for _, r := range vm.requests {
+		if r.Kind != jdwpclient.Breakpoint {
+			kept = append(kept, r)
+		}
+	}
+	vm.requests = kept
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onFrameValues(args *Args) (interface{}, jdwpclient.Error) {
+	f, err := vm.decodeFrame(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var slots []jdwpclient.VariableRequest
+	args.Decode(&slots)
+	out := make([]jdwpclient.Value, len(slots))
+	for i, s := range slots {
+		v, ok := f.Locals[s.Index]
+		if !ok {
+			return nil, jdwpclient.ErrInvalidSlot
+		}
+		out[i] = v
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onSetFrameValues(args *Args) (interface{}, jdwpclient.Error) {
+	f, err := vm.decodeFrame(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var slots []jdwpclient.VariableAssignmentRequest
+	args.Decode(&slots)
+	for _, s := range slots {
+		f.Locals[s.Index] = s.Value
+	}
+	return nil, jdwpclient.ErrNone
+}
+
+func (vm *VM) onThisObject(args *Args) (interface{}, jdwpclient.Error) {
+	f, err := vm.decodeFrame(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	out := jdwpclient.TaggedObjectID{Type: jdwpclient.TagObject}
+	if f.This != nil {
+		out.Object = f.This.ID
+	}
+	return out, jdwpclient.ErrNone
+}
+
+func (vm *VM) onPopFrames(args *Args) (interface{}, jdwpclient.Error) {
+	t, err := vm.decodeSuspendedThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var id jdwpclient.FrameID
+	args.Decode(&id)
+	for i, f := range t.Frames {
+		if f.ID == id {
+			if i == len(t.Frames)-1 {
+				return nil, jdwpclient.ErrNoMoreFrames // Cannot pop the thread's last frame.
+			}
+			t.Frames = t.Frames[i+1:]
+			return nil, jdwpclient.ErrNone
+		}
+	}
+	return nil, jdwpclient.ErrInvalidFrameID
+}
+
+func (vm *VM) onReflectedType(args *Args) (interface{}, jdwpclient.Error) {
+	var id jdwpclient.ClassObjectID
+	args.Decode(&id)
+	for _, c := range vm.classes {
+		if c.object != nil && c.object.ID == id.ID() {
+			return jdwpclient.ObjectType{Kind: c.Kind, Type: c.ID}, jdwpclient.ErrNone
+		}
+	}
+	return nil, jdwpclient.ErrInvalidObject
+}
+
+// invoke calls the method of the class with the arguments.
+func (vm *VM) invoke(
+	class jdwpclient.ReferenceTypeID,
+	method jdwpclient.MethodID,
+	thread jdwpclient.ThreadID,
+	this *Object,
+	args []jdwpclient.Value) (jdwpclient.InvokeResult, jdwpclient.Error) {
+
+	t := vm.thread(thread)
+	if t == nil {
+		return jdwpclient.InvokeResult{}, jdwpclient.ErrInvalidThread
+	}
+	m := vm.method(class, method)
+	if m == nil || m.Invoke == nil {
+		return jdwpclient.InvokeResult{}, jdwpclient.ErrInvalidMethodID
+	}
+	result, exception := m.Invoke(t, this, args)
+	out := jdwpclient.InvokeResult{Result: result}
+	if exception != nil {
+		out.Exception = jdwpclient.TaggedObjectID{Type: jdwpclient.TagObject, Object: exception.ID}
+	}
+	return out, jdwpclient.ErrNone
+}
+
+// decodeUntagged decodes a value that is not prefixed with its tag, as the
+// Go type used for values of the type with the signature.
+func (vm *VM) decodeUntagged(args *Args, sig string) jdwpclient.Value {
+	switch sig[0] {
+	case 'Z':
+		return decodeAs[bool](args)
+	case 'B':
+		return decodeAs[byte](args)
+	case 'C':
+		return decodeAs[jdwpclient.Char](args)
+	case 'S':
+		return decodeAs[int16](args)
+	case 'I':
+		return decodeAs[int](args)
+	case 'J':
+		return decodeAs[int64](args)
+	case 'F':
+		return decodeAs[float32](args)
+	case 'D':
+		return decodeAs[float64](args)
+	}
+	var id jdwpclient.ObjectID
+	args.Decode(&id)
+	if o, ok := vm.objects[id]; ok {
+		return o.Value()
+	}
+	return id
+}
+
+func decodeAs[T any](args *Args) jdwpclient.Value {
+	var v T
+	args.Decode(&v)
+	return v
+}
+
+func (vm *VM) decodeClass(args *Args) (*Class, jdwpclient.Error) {
+	var id jdwpclient.ReferenceTypeID
+	args.Decode(&id)
+	c := vm.classByID(id)
+	if c == nil {
+		return nil, jdwpclient.ErrInvalidClass
+	}
+	return c, jdwpclient.ErrNone
+}
+
+func (vm *VM) decodeMethod(args *Args) (*Method, jdwpclient.Error) {
+	c, err := vm.decodeClass(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var id jdwpclient.MethodID
+	args.Decode(&id)
+	m := vm.method(c.ID, id)
+	if m == nil {
+		return nil, jdwpclient.ErrInvalidMethodID
+	}
+	return m, jdwpclient.ErrNone
+}
+
+func (vm *VM) decodeObject(args *Args) (*Object, jdwpclient.Error) {
+	var id jdwpclient.ObjectID
+	args.Decode(&id)
+	o, ok := vm.objects[id]
+	if !ok {
+		return nil, jdwpclient.ErrInvalidObject
+	}
+	return o, jdwpclient.ErrNone
+}
+
+func (vm *VM) decodeArray(args *Args) (*Object, jdwpclient.Error) {
+	o, err := vm.decodeObject(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if o.Class.Kind != jdwpclient.Array {
+		return nil, jdwpclient.ErrInvalidArray
+	}
+	return o, jdwpclient.ErrNone
+}
+
+func (vm *VM) decodeThread(args *Args) (*Thread, jdwpclient.Error) {
+	var id jdwpclient.ThreadID
+	args.Decode(&id)
+	t := vm.thread(id)
+	if t == nil {
+		return nil, jdwpclient.ErrInvalidThread
+	}
+	return t, jdwpclient.ErrNone
+}
+
+func (vm *VM) decodeThreadGroup(args *Args) (*ThreadGroup, jdwpclient.Error) {
+	var id jdwpclient.ThreadGroupID
+	args.Decode(&id)
+	for _, g := range vm.groups {
+		if g.ThreadGroupID() == id {
+			return g, jdwpclient.ErrNone
+		}
+	}
+	return nil, jdwpclient.ErrInvalidThreadGroup
+}
+
+func (vm *VM) decodeSuspendedThread(args *Args) (*Thread, jdwpclient.Error) {
+	t, err := vm.decodeThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	if t.suspend == 0 {
+		return nil, jdwpclient.ErrThreadNotSuspended
+	}
+	return t, jdwpclient.ErrNone
+}
+
+func (vm *VM) decodeFrame(args *Args) (*Frame, jdwpclient.Error) {
+	t, err := vm.decodeSuspendedThread(args)
+	if err != jdwpclient.ErrNone {
+		return nil, err
+	}
+	var id jdwpclient.FrameID
+	args.Decode(&id)
+	f := t.frame(id)
+	if f == nil {
+		return nil, jdwpclient.ErrInvalidFrameID
+	}
+	return f, jdwpclient.ErrNone
+}
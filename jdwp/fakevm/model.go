@@ -0,0 +1,525 @@
+package fakevm
+
+import (
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sort"
+	"strings"
+)
+
+// Class is a synthetic class or interface loaded by the VM.
+type Class struct {
+	ID         jdwpclient.ReferenceTypeID
+	Kind       jdwpclient.TypeTag
+	Name       string // Fully qualified name, such as "java.lang.String".
+	Status     jdwpclient.ClassStatus
+	Super      *Class
+	Interfaces []*Class
+	Fields     []*Field
+	Methods    []*Method
+	Bytes      []byte // Class file of the last redefinition.
+	Component  string // Signature of the component type of an array class.
+	SourceFile string // Name of the source file, or empty if absent.
+	ModBits    jdwpclient.ModBits
+	Loader     *Object // The class loader, or nil for the bootstrap loader.
+	// SourceDebugExtension is the SourceDebugExtension attribute of the
+	// class file, or empty if absent.
+	SourceDebugExtension string
+
+	// Redefine is called with the VM locked when the class is redefined with
+	// a new class file, before Bytes is updated. It returns the methods whose
+	// code changed in a non-equivalent way: the frames running them keep the
+	// old code, which becomes an obsolete method with a new identifier, while
+	// the method keeps its identifier for the new code. A nil Redefine accepts
+	// any class file without changing the class.
+	Redefine func(bytes []byte) (changed []*Method, err jdwpclient.Error)
+
+	vm       *VM
+	object   *Object   // The java.lang.Class instance, created on first use.
+	obsolete []*Method // The obsolete methods, not listed with Methods.
+}
+
+// Field is a field of a synthetic class.
+type Field struct {
+	ID        jdwpclient.FieldID
+	Class     *Class
+	Name      string
+	Signature string
+	ModBits   jdwpclient.ModBits
+	Value     jdwpclient.Value // Value of a static field.
+}
+
+// Method is a method of a synthetic class.
+// The method has one code index per line, so the line Lines[i] is at code
+// index i.
+type Method struct {
+	ID        jdwpclient.MethodID
+	Class     *Class
+	Name      string
+	Signature string
+	ModBits   jdwpclient.ModBits
+	Lines     []int
+	Variables jdwpclient.VariableTable
+	Obsolete  bool // The old code of a method changed by a redefinition.
+
+	// Invoke is called for invocations of the method. A nil Invoke fails the
+	// invocation with ErrInvalidMethodID.
+	Invoke func(thread *Thread, this *Object, args []jdwpclient.Value) (result jdwpclient.Value, exception *Object)
+}
+
+// Object is an instance of a synthetic class.
+type Object struct {
+	ID       jdwpclient.ObjectID
+	Class    *Class
+	Fields   map[jdwpclient.FieldID]jdwpclient.Value
+	String   string             // Value of a java.lang.String.
+	Elements []jdwpclient.Value // Elements of an array.
+}
+
+// Thread is a thread of the VM. Frames holds the call stack, with the
+// innermost frame first.
+type Thread struct {
+	*Object
+	Name   string
+	Status jdwpclient.ThreadStatus
+	Frames []*Frame
+	// Returned is the value of the last forced early return, which pops the
+	// top frame.
+	Returned jdwpclient.Value
+	Group    *ThreadGroup
+	// Owned holds the monitors entered by the thread, once per entry.
+	Owned []Monitor
+	// Contended is the object whose monitor the thread waits to enter, when
+	// its Status is ThreadMonitor, or waits on, when it is ThreadWait.
+	Contended *Object
+	suspend   int
+}
+
+// Monitor is a monitor entered by a thread.
+type Monitor struct {
+	Object *Object
+	Depth  int // Depth of the frame that entered the monitor, or -1 if unknown.
+}
+
+// ThreadGroup is a thread group of the VM. Top level groups have no Parent.
+type ThreadGroup struct {
+	*Object
+	Name   string
+	Parent *ThreadGroup
+}
+
+// Frame is a stack frame of a thread.
+type Frame struct {
+	ID       jdwpclient.FrameID
+	Location jdwpclient.Location
+	This     *Object
+	Locals   map[int]jdwpclient.Value // Values by slot.
+}
+
+// Signature returns the JNI signature of the class.
+func (c *Class) Signature() string {
+	if c.Kind == jdwpclient.Array {
+		return "[" + c.Component
+	}
+	return "L" + strings.Replace(c.Name, ".", "/", -1) + ";"
+}
+
+// IsA returns true if the class is other or a subclass of other.
+func (c *Class) IsA(other *Class) bool {
+	for ; c != nil; c = c.Super {
+		if c == other {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassID returns the identifier of the class as a ClassID.
+func (c *Class) ClassID() jdwpclient.ClassID { return jdwpclient.ClassID(c.ID) }
+
+// AddClass adds a new prepared class with the fully qualified name and super
+// class to the VM.
+func (vm *VM) AddClass(name string, super *Class) *Class {
+	return vm.addType(name, jdwpclient.Class, super)
+}
+
+// AddInterface adds a new prepared interface with the fully qualified name to
+// the VM.
+func (vm *VM) AddInterface(name string) *Class {
+	return vm.addType(name, jdwpclient.Interface, nil)
+}
+
+func (vm *VM) addType(name string, kind jdwpclient.TypeTag, super *Class) *Class {
+	vm.Lock()
+	defer vm.Unlock()
+	c := &Class{
+		ID:     jdwpclient.ReferenceTypeID(vm.newID()),
+		Kind:   kind,
+		Name:   name,
+		Status: jdwpclient.StatusVerified | jdwpclient.StatusPrepared | jdwpclient.StatusInitialized,
+		Super:  super,
+		vm:     vm,
+	}
+	c.ModBits = jdwpclient.ModPublic
+	if kind == jdwpclient.Interface {
+		c.ModBits |= jdwpclient.ModInterface | jdwpclient.ModAbstract
+	}
+	vm.classes = append(vm.classes, c)
+	return c
+}
+
+// ArrayClass returns the array class with elements of the component type
+// signature, such as "I" or "Ljava/lang/String;", adding it if it is not yet
+// loaded.
+func (vm *VM) ArrayClass(component string) *Class {
+	name := typeName(component) + "[]"
+	if c := vm.Class(name); c != nil {
+		return c
+	}
+	c := vm.addType(name, jdwpclient.Array, vm.Class("java.lang.Object"))
+	c.Component = component
+	return c
+}
+
+// typeName returns the Java name of the type with the signature.
+func typeName(sig string) string {
+	switch sig[0] {
+	case 'L':
+		return strings.Replace(strings.TrimSuffix(sig[1:], ";"), "/", ".", -1)
+	case '[':
+		return typeName(sig[1:]) + "[]"
+	}
+	names := map[byte]string{
+		'B': "byte", 'C': "char", 'D': "double", 'F': "float",
+		'I': "int", 'J': "long", 'S': "short", 'Z': "boolean", 'V': "void",
+	}
+	return names[sig[0]]
+}
+
+// Class returns the loaded class with the fully qualified name, or nil if
+// there is no such class.
+func (vm *VM) Class(name string) *Class {
+	vm.Lock()
+	defer vm.Unlock()
+	for _, c := range vm.classes {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// AddField adds a new field to the class.
+func (c *Class) AddField(name, signature string, mods jdwpclient.ModBits) *Field {
+	c.vm.Lock()
+	defer c.vm.Unlock()
+	f := &Field{
+		ID:        jdwpclient.FieldID(c.vm.newID()),
+		Class:     c,
+		Name:      name,
+		Signature: signature,
+		ModBits:   mods,
+	}
+	c.Fields = append(c.Fields, f)
+	return f
+}
+
+// AddMethod adds a new method to the class, with code at the given lines.
+// A method without lines has no line information.
+func (c *Class) AddMethod(name, signature string, mods jdwpclient.ModBits, lines ...int) *Method {
+	c.vm.Lock()
+	defer c.vm.Unlock()
+	m := &Method{
+		ID:        jdwpclient.MethodID(c.vm.newID()),
+		Class:     c,
+		Name:      name,
+		Signature: signature,
+		ModBits:   mods,
+		Lines:     lines,
+	}
+	c.Methods = append(c.Methods, m)
+	return m
+}
+
+// AddVariable adds a local variable in the slot that is live for the whole
+// method.
+func (m *Method) AddVariable(name, signature string, slot int) {
+	m.Class.vm.Lock()
+	defer m.Class.vm.Unlock()
+	m.Variables.Slots = append(m.Variables.Slots, jdwpclient.FrameVariable{
+		CodeIndex: 0,
+		Name:      name,
+		Signature: signature,
+		Length:    len(m.Lines),
+		Slot:      slot,
+	})
+}
+
+// AddArgument adds a method argument in the slot, after the arguments
+// already added.
+func (m *Method) AddArgument(name, signature string, slot int) {
+	m.AddVariable(name, signature, slot)
+	m.Class.vm.Lock()
+	defer m.Class.vm.Unlock()
+	m.Variables.ArgCount = slot + 1
+	if signature == "J" || signature == "D" {
+		m.Variables.ArgCount++
+	}
+}
+
+// Location returns the location of the first code at the line, or the start
+// of the method if the method has no code at the line.
+func (m *Method) Location(line int) jdwpclient.Location {
+	l := jdwpclient.Location{Type: m.Class.Kind, Class: m.Class.ClassID(), Method: m.ID}
+	for i, n := range m.Lines {
+		if n == line {
+			l.Location = uint64(i)
+			break
+		}
+	}
+	return l
+}
+
+// NewObject returns a new instance of the class.
+func (vm *VM) NewObject(class *Class) *Object {
+	vm.Lock()
+	defer vm.Unlock()
+	return vm.newObject(class)
+}
+
+func (vm *VM) newObject(class *Class) *Object {
+	o := &Object{
+		ID:     jdwpclient.ObjectID(vm.newID()),
+		Class:  class,
+		Fields: map[jdwpclient.FieldID]jdwpclient.Value{},
+	}
+	vm.objects[o.ID] = o
+	return o
+}
+
+// NewArray returns a new instance of the array class holding the elements.
+func (vm *VM) NewArray(class *Class, elements ...jdwpclient.Value) *Object {
+	vm.Lock()
+	defer vm.Unlock()
+	o := vm.newObject(class)
+	o.Elements = elements
+	return o
+}
+
+// NewString returns a new java.lang.String holding s.
+func (vm *VM) NewString(s string) *Object {
+	vm.Lock()
+	defer vm.Unlock()
+	return vm.newString(s)
+}
+
+func (vm *VM) newString(s string) *Object {
+	o := vm.newObject(vm.class("java.lang.String"))
+	o.String = s
+	return o
+}
+
+// Value returns the object as a value, typed by the object's class.
+func (o *Object) Value() jdwpclient.Value {
+	if o.Class.Kind == jdwpclient.Array {
+		return jdwpclient.ArrayID(o.ID)
+	}
+	switch o.Class.Name {
+	case "java.lang.String":
+		return jdwpclient.StringID(o.ID)
+	case "java.lang.Thread":
+		return jdwpclient.ThreadID(o.ID)
+	case "java.lang.ThreadGroup":
+		return jdwpclient.ThreadGroupID(o.ID)
+	case "java.lang.Class":
+		return jdwpclient.ClassObjectID(o.ID)
+	}
+	return o.ID
+}
+
+// ClassObject returns the java.lang.Class instance of the class.
+func (vm *VM) ClassObject(c *Class) *Object {
+	vm.Lock()
+	defer vm.Unlock()
+	return vm.classObject(c)
+}
+
+func (vm *VM) classObject(c *Class) *Object {
+	if c.object == nil {
+		c.object = vm.newObject(vm.class("java.lang.Class"))
+	}
+	return c.object
+}
+
+// AddThreadGroup adds a new thread group with the name to the parent group,
+// or as a top level group if parent is nil.
+func (vm *VM) AddThreadGroup(name string, parent *ThreadGroup) *ThreadGroup {
+	vm.Lock()
+	defer vm.Unlock()
+	return vm.addThreadGroup(name, parent)
+}
+
+func (vm *VM) addThreadGroup(name string, parent *ThreadGroup) *ThreadGroup {
+	g := &ThreadGroup{
+		Object: vm.newObject(vm.class("java.lang.ThreadGroup")),
+		Name:   name,
+		Parent: parent,
+	}
+	vm.groups = append(vm.groups, g)
+	return g
+}
+
+// ThreadGroup returns the thread group with the name, such as the "system"
+// and "main" groups of every VM, or nil if there is none.
+func (vm *VM) ThreadGroup(name string) *ThreadGroup {
+	vm.Lock()
+	defer vm.Unlock()
+	for _, g := range vm.groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// ThreadGroupID returns the identifier of the thread group.
+func (g *ThreadGroup) ThreadGroupID() jdwpclient.ThreadGroupID { return jdwpclient.ThreadGroupID(g.ID) }
+
+// AddThread adds a new running thread to the "main" thread group of the VM.
+func (vm *VM) AddThread(name string) *Thread {
+	vm.Lock()
+	defer vm.Unlock()
+	t := &Thread{
+		Object: vm.newObject(vm.class("java.lang.Thread")),
+		Name:   name,
+		Status: jdwpclient.ThreadRunning,
+		Group:  vm.groups[1],
+	}
+	vm.threads = append(vm.threads, t)
+	return t
+}
+
+// ThreadID returns the identifier of the thread.
+func (t *Thread) ThreadID() jdwpclient.ThreadID { return jdwpclient.ThreadID(t.ID) }
+
+// Push pushes a new frame executing the method at the line onto the thread's
+// call stack.
+func (vm *VM) Push(t *Thread, m *Method, line int) *Frame {
+	vm.Lock()
+	defer vm.Unlock()
+	f := &Frame{
+		ID:       jdwpclient.FrameID(vm.newID()),
+		Location: m.Location(line),
+		Locals:   map[int]jdwpclient.Value{},
+	}
+	t.Frames = append([]*Frame{f}, t.Frames...)
+	return f
+}
+
+// Suspended returns true if the thread is suspended.
+func (vm *VM) Suspended(t *Thread) bool {
+	vm.Lock()
+	defer vm.Unlock()
+	return t.suspend > 0
+}
+
+func (vm *VM) class(name string) *Class {
+	for _, c := range vm.classes {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (vm *VM) classByID(id jdwpclient.ReferenceTypeID) *Class {
+	for _, c := range vm.classes {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// sortedObjects returns the objects of the VM ordered by identifier.
+func (vm *VM) sortedObjects() []*Object {
+	out := make([]*Object, 0, len(vm.objects))
+	for _, o := range vm.objects {
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// references returns true if the value is a reference to the object.
+func references(v jdwpclient.Value, o *Object) bool {
+	ref, ok := v.(jdwpclient.Object)
+	return ok && ref.ID() == o.ID
+}
+
+func (vm *VM) thread(id jdwpclient.ThreadID) *Thread {
+	for _, t := range vm.threads {
+		if t.ThreadID() == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// method returns the method with the identifier in the class or its super
+// classes, including the obsolete methods.
+func (vm *VM) method(class jdwpclient.ReferenceTypeID, id jdwpclient.MethodID) *Method {
+	for c := vm.classByID(class); c != nil; c = c.Super {
+		for _, methods := range [][]*Method{c.Methods, c.obsolete} {
+			for _, m := range methods {
+				if m.ID == id {
+					return m
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// obsolete moves the frames running the method, whose code was changed by a
+// redefinition, to a new obsolete method holding the old code. It must be
+// called with the VM locked.
+func (vm *VM) obsolete(m *Method) {
+	var old *Method
+	for _, t := range vm.threads {
+		for _, f := range t.Frames {
+			if f.Location.Class != m.Class.ClassID() || f.Location.Method != m.ID {
+				continue
+			}
+			if old == nil {
+				code := *m
+				old = &code
+				old.ID = jdwpclient.MethodID(vm.newID())
+				old.Obsolete = true
+				m.Class.obsolete = append(m.Class.obsolete, old)
+			}
+			f.Location.Method = old.ID
+		}
+	}
+}
+
+// field returns the field with the identifier in the class or its super
+// classes.
+func (vm *VM) field(c *Class, id jdwpclient.FieldID) *Field {
+	for ; c != nil; c = c.Super {
+		for _, f := range c.Fields {
+			if f.ID == id {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Thread) frame(id jdwpclient.FrameID) *Frame {
+	for _, f := range t.Frames {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
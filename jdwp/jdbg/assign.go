@@ -0,0 +1,221 @@
+package jdbg
+
+import (
+	"fmt"
+	"reflect"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+)
+
+// Target is a variable that can be assigned a value: a local variable of a
+// stack frame, an instance or static field, or an array element.
+type Target struct {
+	j    *JDbg
+	name string
+	ty   Type
+	set  func(val jdwpclient.Value) error
+}
+
+// String returns the name of the target.
+func (t Target) String() string { return t.name }
+
+// Type returns the declared type of the target.
+func (t Target) Type() Type { return t.ty }
+
+// LocalTarget returns the argument or local variable with the name that is in
+// scope at the frame's location.
+func (j *JDbg) LocalTarget(frame jdwpclient.FrameInfo, name string) Target {
+	location := frame.Location
+	table, err := j.conn.VariableTable(j.ctx, jdwpclient.ReferenceTypeID(location.Class), location.Method)
+	if err != nil {
+		j.fail("VariableTable() returned: %v", err)
+	}
+	for _, slot := range table.Slots {
+		if slot.Name != name || slot.Name == "this" {
+			continue
+		}
+		if location.Location < slot.CodeIndex || location.Location >= slot.CodeIndex+uint64(slot.Length) {
+			continue // Not in scope.
+		}
+		return Target{j, name, j.Type(slot.Signature), func(val jdwpclient.Value) error {
+			assign := jdwpclient.VariableAssignmentRequest{Index: slot.Slot, Value: val}
+			return j.conn.SetValues(j.ctx, j.thread, frame.Frame, []jdwpclient.VariableAssignmentRequest{assign})
+		}}
+	}
+	j.fail("Cannot find variable '%v'", name)
+	return Target{}
+}
+
+// FieldTarget returns the field of the object with the name, declared by the
+// object's class or one of its superclasses. As in Java, the field can be
+// static.
+func (j *JDbg) FieldTarget(object Value, name string) Target {
+	if isPrimitive(object) {
+		j.fail("Cannot set field '%v' of %v", name, object.ty)
+	}
+	if object.IsNull() {
+		j.fail("NullPointerException: cannot set field '%v' of null", name)
+	}
+	c, f := findField(classOf(object.ty), name)
+	switch {
+	case f == nil:
+		j.fail("Type '%v' has no field '%v'", object.ty, name)
+	case f.ModBits&jdwpclient.ModStatic != 0:
+		return j.StaticTarget(c, name)
+	}
+	id := object.val.(jdwpclient.Object).ID()
+	return Target{j, name, j.Type(f.Signature), func(val jdwpclient.Value) error {
+		return j.conn.SetFieldValues(j.ctx, id, jdwpclient.FieldValue{Field: f.ID, Value: val})
+	}}
+}
+
+// StaticTarget returns the static field with the name, declared by the class
+// or one of its superclasses. Final static fields cannot be assigned.
+func (j *JDbg) StaticTarget(class *Class, name string) Target {
+	c, f := findField(class, name)
+	switch {
+	case f == nil || f.ModBits&jdwpclient.ModStatic == 0:
+		j.fail("Class '%v' has no static field '%v'", class, name)
+	case f.ModBits&jdwpclient.ModFinal != 0:
+		j.fail("Cannot assign a value to final static field '%v'", name)
+	}
+	return Target{j, name, j.Type(f.Signature), func(val jdwpclient.Value) error {
+		return j.conn.SetStaticFieldValues(j.ctx, c.ID(), jdwpclient.FieldValue{Field: f.ID, Value: val})
+	}}
+}
+
+// ElementTarget returns the element of the array with the index.
+func (j *JDbg) ElementTarget(array Value, index int) Target {
+	arrayTy, ok := array.ty.(*Array)
+	if !ok {
+		j.fail("Cannot index %v, which is not an array", array.ty)
+	}
+	if array.IsNull() {
+		j.fail("NullPointerException: cannot index null array")
+	}
+	if length := array.ArrayLength(); index < 0 || index >= length {
+		j.fail("ArrayIndexOutOfBoundsException: index %d out of bounds for length %d", index, length)
+	}
+	id := array.val.(jdwpclient.ArrayID)
+	return Target{j, fmt.Sprintf("[%d]", index), arrayTy.el, func(val jdwpclient.Value) error {
+		// Array elements are not tagged, so the element is sent in a slice of
+		// its Go type.
+		v := reflect.ValueOf(val)
+		values := reflect.Append(reflect.MakeSlice(reflect.SliceOf(v.Type()), 0, 1), v)
+		return j.conn.SetArrayValues(j.ctx, id, index, values.Interface())
+	}}
+}
+
+// Set assigns the value to the target, converting it as Java's assignment
+// conversion does, and returns the assigned value.
+func (t Target) Set(v Value) Value {
+	ev := &evaluator{j: t.j}
+	return ev.assign(t, v, nil)
+}
+
+// Assign parses and evaluates the Java expression in the top stack frame of
+// the thread, and assigns its value to the target. See AssignInFrame.
+func (j *JDbg) Assign(target Target, expression string) Value {
+	frames, err := j.conn.GetFrames(j.ctx, j.thread, 0, 1)
+	if err != nil {
+		j.fail("GetFrames() returned: %v", err)
+	}
+	return j.AssignInFrame(frames[0], target, expression)
+}
+
+// AssignInFrame parses and evaluates the Java expression in the given stack
+// frame of the thread, and assigns its value to the target. It returns the
+// assigned value.
+//
+// The value is converted as Java's assignment conversion does: primitives
+// are widened, or narrowed to byte, short or char if the expression is an
+// integer constant that fits, and are boxed or unboxed to match the target.
+// Values of other types must be assignable to the type of the target.
+func (j *JDbg) AssignInFrame(frame jdwpclient.FrameInfo, target Target, expression string) Value {
+	e, err := parseExpression(expression)
+	if err != nil {
+		j.fail("Failed to parse '%v': %v", expression, err)
+	}
+	ev := &evaluator{j: j, frame: frame}
+	return ev.assign(target, ev.eval(e), e)
+}
+
+// assign converts the value of the expression e to the type of the target and
+// assigns it. e is nil if the value is not the result of an expression.
+func (ev *evaluator) assign(t Target, v Value, e expr) Value {
+	v = ev.assignment(t.ty, v, e)
+	if err := t.set(v.val); err != nil {
+		ev.j.fail("Failed to set %v: %v", t, err)
+	}
+	return v
+}
+
+// assignment converts the value to the type ty as Java's assignment
+// conversion does, failing if the value cannot be assigned to ty.
+func (ev *evaluator) assignment(ty Type, v Value, e expr) Value {
+	j := ev.j
+	if s, ok := ty.(*Simple); ok {
+		v = ev.unbox(v)
+		if v.ty == s {
+			return v
+		}
+		if n, ok := numeric(v.val); ok && s != j.cache.boolTy {
+			if widens(n.tag, s.ty) || (isConstant(e) && fits(n, s.ty)) {
+				return j.primitive(n.to(s.ty))
+			}
+		}
+		j.fail("Incompatible types: %v cannot be converted to %v", v.ty, ty)
+	}
+	if isPrimitive(v) {
+		v = ev.box(v)
+	}
+	if v.IsNull() {
+		return Value{ty, v.val}
+	}
+	if !j.assignable(ty, v) {
+		j.fail("Incompatible types: %v cannot be converted to %v", v.ty, ty)
+	}
+	return v
+}
+
+// ranks orders the numeric types for widening. char only widens to int and
+// wider types.
+var ranks = map[jdwpclient.Tag]int{
+	jdwpclient.TagByte:   1,
+	jdwpclient.TagShort:  2,
+	jdwpclient.TagChar:   2,
+	jdwpclient.TagInt:    3,
+	jdwpclient.TagLong:   4,
+	jdwpclient.TagFloat:  5,
+	jdwpclient.TagDouble: 6,
+}
+
+// widens returns true if a value of the numeric type from can be widened to
+// the type to.
+func widens(from, to jdwpclient.Tag) bool {
+	return from == to || (to != jdwpclient.TagChar && ranks[from] < ranks[to])
+}
+
+// fits returns true if the integer n can be narrowed to the byte, short or
+// char type to without changing its value.
+func fits(n number, to jdwpclient.Tag) bool {
+	switch {
+	case n.isFloat() || n.tag == jdwpclient.TagLong:
+		return false
+	case to != jdwpclient.TagByte && to != jdwpclient.TagShort && to != jdwpclient.TagChar:
+		return false
+	}
+	m, _ := numeric(n.to(to))
+	return m.i == n.i
+}
+
+// isConstant returns true if the expression is a literal, or a signed
+// literal.
+func isConstant(e expr) bool {
+	switch e := e.(type) {
+	case literalExpr:
+		return true
+	case unaryExpr:
+		return (e.op == "-" || e.op == "+") && isConstant(e.x)
+	}
+	return false
+}
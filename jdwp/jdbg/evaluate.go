@@ -0,0 +1,889 @@
+package jdbg
+
+import (
+	"math"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strconv"
+	"strings"
+)
+
+// evaluator evaluates parsed expressions in a stack frame of the thread.
+type evaluator struct {
+	j     *JDbg
+	frame jdwpclient.FrameInfo
+	this  *Value // Lazily fetched 'this' object of the frame.
+	class *Class // Lazily fetched declaring class of the frame's method.
+}
+
+// Evaluate parses and evaluates the Java expression in the top stack frame of
+// the thread. See EvaluateInFrame for the supported expressions.
+func (j *JDbg) Evaluate(expression string) Value {
+	frames, err := j.conn.GetFrames(j.ctx, j.thread, 0, 1)
+	if err != nil {
+		j.fail("GetFrames() returned: %v", err)
+	}
+	return j.EvaluateInFrame(frames[0], expression)
+}
+
+// EvaluateInFrame parses and evaluates the Java expression in the given stack
+// frame of the thread.
+//
+// The expression can use literals, local variables, 'this', fields, static
+// fields and methods of classes, method calls, array indexing, the arithmetic,
+// comparison, logical and conditional operators, string concatenation, casts
+// and instanceof. Simple class names are looked up as nested classes of the
+// frame's class, in the frame's package and in java.lang.
+// Methods are invoked in the thread, which must be suspended by an event.
+func (j *JDbg) EvaluateInFrame(frame jdwpclient.FrameInfo, expression string) Value {
+	e, err := parseExpression(expression)
+	if err != nil {
+		j.fail("Failed to parse '%v': %v", expression, err)
+	}
+	ev := &evaluator{j: j, frame: frame}
+	return ev.eval(e)
+}
+
+func (ev *evaluator) eval(e expr) Value {
+	j := ev.j
+	switch e := e.(type) {
+	case literalExpr:
+		return ev.literal(e.val)
+	case thisExpr:
+		this := ev.thisObject()
+		if this.IsNull() {
+			j.fail("'this' is not available in a static method")
+		}
+		return this
+	case nameExpr, fieldExpr:
+		op := ev.operand(e)
+		switch {
+		case op.class != nil:
+			j.fail("'%v' is a class, not a value", e)
+		case op.pkg != "":
+			if _, ok := e.(nameExpr); ok {
+				j.fail("Cannot find variable '%v'", e)
+			}
+			j.fail("Cannot find symbol '%v'", e)
+		}
+		return op.val
+	case callExpr:
+		return ev.call(e)
+	case indexExpr:
+		return ev.index(e)
+	case unaryExpr:
+		return ev.unary(e)
+	case binaryExpr:
+		return ev.binary(e)
+	case castExpr:
+		return ev.cast(e)
+	case instanceOfExpr:
+		x := ev.eval(e.x)
+		if isPrimitive(x) {
+			j.fail("instanceof cannot be applied to %v", x.ty)
+		}
+		ty := ev.resolveType(e.ty)
+		return j.primitive(!x.IsNull() && x.ty.CastableTo(ty))
+	case condExpr:
+		if ev.boolean(ev.eval(e.cond), e.cond) {
+			return ev.eval(e.x)
+		}
+		return ev.eval(e.y)
+	}
+	j.fail("Unsupported expression %v", e)
+	return Value{}
+}
+
+// literal returns the value of the literal.
+func (ev *evaluator) literal(val interface{}) Value {
+	j := ev.j
+	switch val := val.(type) {
+	case nil:
+		return Value{j.cache.objTy, jdwpclient.ObjectID(0)}
+	case string:
+		return j.String(val)
+	}
+	return j.primitive(val)
+}
+
+// operand is the result of evaluating a name, which can be a value, a class
+// or a package.
+type operand struct {
+	val   Value
+	class *Class
+	pkg   string
+}
+
+// operand evaluates the simple or qualified name. As in Java, names are
+// variables before classes and classes before packages.
+func (ev *evaluator) operand(e expr) operand {
+	switch e := e.(type) {
+	case nameExpr:
+		if v, ok := ev.variable(e.name); ok {
+			return operand{val: v}
+		}
+		if c := ev.findClass(e.name); c != nil {
+			return operand{class: c}
+		}
+		return operand{pkg: e.name}
+	case fieldExpr:
+		x := ev.operand(e.x)
+		switch {
+		case x.class != nil:
+			if c, f := findField(x.class, e.name); f != nil && f.ModBits&jdwpclient.ModStatic != 0 {
+				return operand{val: ev.static(c, f)}
+			}
+			if c := ev.lookupClass(x.class.name + "$" + e.name); c != nil {
+				return operand{class: c}
+			}
+			ev.j.fail("Class '%v' has no static field '%v'", x.class, e.name)
+		case x.pkg != "":
+			name := x.pkg + "." + e.name
+			if c := ev.lookupClass(name); c != nil {
+				return operand{class: c}
+			}
+			return operand{pkg: name}
+		}
+		return operand{val: ev.field(x.val, e.name)}
+	}
+	return operand{val: ev.eval(e)}
+}
+
+// variable returns the value of the local variable, the field of 'this' or
+// the static field of the frame's class with the name.
+func (ev *evaluator) variable(name string) (Value, bool) {
+	if v, ok := ev.local(name); ok {
+		return v, true
+	}
+	if this := ev.thisObject(); !this.IsNull() {
+		if v, ok := ev.fieldOf(this, name); ok {
+			return v, true
+		}
+	}
+	if class := ev.frameClass(); class != nil {
+		if c, f := findField(class, name); f != nil && f.ModBits&jdwpclient.ModStatic != 0 {
+			return ev.static(c, f), true
+		}
+	}
+	return Value{}, false
+}
+
+// local returns the value of the local variable in scope at the frame's
+// location.
+func (ev *evaluator) local(name string) (Value, bool) {
+	j := ev.j
+	location := ev.frame.Location
+	table, err := j.conn.VariableTable(j.ctx, jdwpclient.ReferenceTypeID(location.Class), location.Method)
+	switch err {
+	case nil:
+	case jdwpclient.ErrAbsentInformation, jdwpclient.ErrNativeMethod:
+		return Value{}, false
+	default:
+		j.fail("VariableTable() returned: %v", err)
+	}
+	for _, slot := range table.Slots {
+		if slot.Name != name || slot.Name == "this" {
+			continue
+		}
+		if location.Location < slot.CodeIndex || location.Location >= slot.CodeIndex+uint64(slot.Length) {
+			continue // Not in scope.
+		}
+		req := jdwpclient.VariableRequest{Index: slot.Slot, Tag: slot.Signature[0]}
+		values, err := j.conn.GetValues(j.ctx, j.thread, ev.frame.Frame, []jdwpclient.VariableRequest{req})
+		if err != nil {
+			j.fail("GetValues() returned: %v", err)
+		}
+		return j.value(values[0]), true
+	}
+	return Value{}, false
+}
+
+// thisObject returns the 'this' object of the frame, which is null in static
+// methods.
+func (ev *evaluator) thisObject() Value {
+	if ev.this == nil {
+		j := ev.j
+		this, err := j.conn.GetThisObject(j.ctx, j.thread, ev.frame.Frame)
+		if err != nil {
+			j.fail("GetThisObject() returned: %v", err)
+		}
+		v := j.Object(this.Object)
+		ev.this = &v
+	}
+	return *ev.this
+}
+
+// frameClass returns the class that declares the frame's method.
+func (ev *evaluator) frameClass() *Class {
+	if ev.class == nil {
+		ty := ev.j.typeFromID(jdwpclient.ReferenceTypeID(ev.frame.Location.Class))
+		ev.class = classOf(ty)
+	}
+	return ev.class
+}
+
+// findClass returns the loaded class with the simple or qualified name, or nil
+// if there is no such class.
+func (ev *evaluator) findClass(name string) *Class {
+	if strings.Contains(name, ".") {
+		return ev.lookupClass(name)
+	}
+	candidates := []string{}
+	if frame := ev.frameClass(); frame != nil {
+		pkg := ""
+		if i := strings.LastIndex(frame.name, "."); i >= 0 {
+			pkg = frame.name[:i+1]
+		}
+		candidates = append(candidates, frame.name+"$"+name, pkg+name)
+	}
+	candidates = append(candidates, "java.lang."+name)
+	for _, candidate := range candidates {
+		if c := ev.lookupClass(candidate); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// lookupClass returns the loaded class with the fully qualified name, or nil
+// if there is no such class.
+func (ev *evaluator) lookupClass(name string) *Class {
+	c, err := ev.j.classFromSig("L" + strings.Replace(name, ".", "/", -1) + ";")
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// resolveType returns the type named by the type expression.
+func (ev *evaluator) resolveType(t typeExpr) Type {
+	j := ev.j
+	var ty Type
+	switch t.name {
+	case "boolean":
+		ty = j.cache.boolTy
+	case "byte":
+		ty = j.cache.byteTy
+	case "char":
+		ty = j.cache.charTy
+	case "short":
+		ty = j.cache.shortTy
+	case "int":
+		ty = j.cache.intTy
+	case "long":
+		ty = j.cache.longTy
+	case "float":
+		ty = j.cache.floatTy
+	case "double":
+		ty = j.cache.doubleTy
+	default:
+		c := ev.findClass(t.name)
+		if c == nil {
+			j.fail("Cannot find class '%v'", t.name)
+		}
+		ty = c
+	}
+	for i := 0; i < t.dims; i++ {
+		ty = j.ArrayOf(ty)
+	}
+	return ty
+}
+
+// field returns the value of the field of the object, or the length of an
+// array.
+func (ev *evaluator) field(object Value, name string) Value {
+	j := ev.j
+	if isPrimitive(object) {
+		j.fail("Cannot get field '%v' of %v", name, object.ty)
+	}
+	if object.IsNull() {
+		j.fail("NullPointerException: cannot get field '%v' of null", name)
+	}
+	if _, ok := object.ty.(*Array); ok && name == "length" {
+		return j.primitive(object.ArrayLength())
+	}
+	v, ok := ev.fieldOf(object, name)
+	if !ok {
+		j.fail("Type '%v' has no field '%v'", object.ty, name)
+	}
+	return v
+}
+
+// fieldOf returns the value of the object's field with the name, declared by
+// the object's class or one of its superclasses.
+func (ev *evaluator) fieldOf(object Value, name string) (Value, bool) {
+	c, f := findField(classOf(object.ty), name)
+	switch {
+	case f == nil:
+		return Value{}, false
+	case f.ModBits&jdwpclient.ModStatic != 0:
+		return ev.static(c, f), true
+	}
+	return c.field(object, name), true
+}
+
+// static returns the value of the static field f of the class c.
+func (ev *evaluator) static(c *Class, f *jdwpclient.Field) Value {
+	j := ev.j
+	values, err := j.conn.GetStaticFieldValues(j.ctx, c.class.TypeID, f.ID)
+	if err != nil {
+		j.fail("GetStaticFieldValues() returned: %v", err)
+	}
+	return j.value(values[0])
+}
+
+// findField returns the field with the name and the class that declares it,
+// searching the class, its interfaces and its superclasses.
+func findField(class *Class, name string) (*Class, *jdwpclient.Field) {
+	for c := class; c != nil; c = c.super {
+		if f := c.fields.FindByName(name); f != nil {
+			return c, f
+		}
+		for _, i := range c.implements {
+			if c, f := findField(i, name); f != nil {
+				return c, f
+			}
+		}
+	}
+	return nil, nil
+}
+
+// call invokes the method of the call expression, resolving overloads with
+// the types of the arguments.
+func (ev *evaluator) call(e callExpr) Value {
+	j := ev.j
+	args := make([]Value, len(e.args))
+	for i, arg := range e.args {
+		args[i] = ev.eval(arg)
+	}
+	if e.x == nil {
+		// A method of 'this', or a static method of the frame's class.
+		if this := ev.thisObject(); !this.IsNull() {
+			return ev.invoke(classOf(this.ty), this, e.name, args)
+		}
+		return ev.invoke(ev.frameClass(), nilValue, e.name, args)
+	}
+	x := ev.operand(e.x)
+	switch {
+	case x.class != nil:
+		return ev.invoke(x.class, nilValue, e.name, args)
+	case x.pkg != "":
+		j.fail("Cannot find symbol '%v'", e.x)
+	case isPrimitive(x.val):
+		j.fail("Cannot call method '%v' on %v", e.name, x.val.ty)
+	case x.val.IsNull():
+		j.fail("NullPointerException: cannot call method '%v' on null", e.name)
+	}
+	return ev.invoke(classOf(x.val.ty), x.val, e.name, args)
+}
+
+// invoke resolves and invokes the method of the class with the arguments,
+// boxing primitive arguments passed to reference parameters. object is
+// nilValue for static methods.
+func (ev *evaluator) invoke(class *Class, object Value, name string, args []Value) Value {
+	in := make([]interface{}, len(args))
+	for i, arg := range args {
+		in[i] = arg
+	}
+	m := ev.j.resolveMethod(object != nilValue, class, name, in)
+	for i, param := range m.sig.Parameters {
+		if _, ok := param.(*Simple); !ok && isPrimitive(args[i]) {
+			in[i] = ev.box(args[i])
+		}
+	}
+	return class.invoke(object, m, in)
+}
+
+// index returns the element of the array.
+func (ev *evaluator) index(e indexExpr) Value {
+	j := ev.j
+	array := ev.eval(e.x)
+	if _, ok := array.ty.(*Array); !ok {
+		j.fail("Cannot index %v, which is %v, not an array", e.x, array.ty)
+	}
+	if array.IsNull() {
+		j.fail("NullPointerException: cannot index null array %v", e.x)
+	}
+	n, ok := numeric(ev.unbox(ev.eval(e.index)).val)
+	if !ok || n.isFloat() || n.tag == jdwpclient.TagLong {
+		j.fail("Array index %v is not an int", e.index)
+	}
+	if length := array.ArrayLength(); n.i < 0 || n.i >= int64(length) {
+		j.fail("ArrayIndexOutOfBoundsException: index %d out of bounds for length %d", n.i, length)
+	}
+	return array.ArrayValues(int(n.i), 1)[0]
+}
+
+func (ev *evaluator) unary(e unaryExpr) Value {
+	j := ev.j
+	if e.op == "!" {
+		return j.primitive(!ev.boolean(ev.eval(e.x), e.x))
+	}
+	x := ev.unbox(ev.eval(e.x))
+	n, ok := numeric(x.val)
+	if !ok {
+		j.fail("Operator %v cannot be applied to %v", e.op, x.ty)
+	}
+	tag := promote(n, number{tag: jdwpclient.TagInt})
+	switch e.op {
+	case "+":
+		return j.primitive(n.to(tag))
+	case "-":
+		return j.primitive(arithmetic("-", number{tag: tag}, n))
+	}
+	j.fail("Unsupported operator %v", e.op)
+	return Value{}
+}
+
+func (ev *evaluator) binary(e binaryExpr) Value {
+	j := ev.j
+	switch e.op {
+	case "&&":
+		return j.primitive(ev.boolean(ev.eval(e.x), e.x) && ev.boolean(ev.eval(e.y), e.y))
+	case "||":
+		return j.primitive(ev.boolean(ev.eval(e.x), e.x) || ev.boolean(ev.eval(e.y), e.y))
+	}
+
+	x, y := ev.eval(e.x), ev.eval(e.y)
+	switch e.op {
+	case "==":
+		return j.primitive(ev.equal(x, y, e))
+	case "!=":
+		return j.primitive(!ev.equal(x, y, e))
+	case "+":
+		if x.ty == j.cache.stringTy || y.ty == j.cache.stringTy {
+			return j.String(j.ToString(x) + j.ToString(y))
+		}
+	}
+
+	a, aok := numeric(ev.unbox(x).val)
+	b, bok := numeric(ev.unbox(y).val)
+	if !aok || !bok {
+		j.fail("Operator %v cannot be applied to %v and %v", e.op, x.ty, y.ty)
+	}
+	switch e.op {
+	case "<", "<=", ">", ">=":
+		return j.primitive(relational(e.op, a, b))
+	case "+", "-", "*", "/", "%":
+		tag := promote(a, b)
+		if (e.op == "/" || e.op == "%") && tag != jdwpclient.TagFloat && tag != jdwpclient.TagDouble && b.i == 0 {
+			j.fail("ArithmeticException: / by zero in %v", e)
+		}
+		return j.primitive(arithmetic(e.op, a, b))
+	}
+	j.fail("Unsupported operator %v", e.op)
+	return Value{}
+}
+
+// cast converts the operand to the type of the cast. Primitives are converted
+// as in Java, and references are checked to be instances of the type.
+func (ev *evaluator) cast(e castExpr) Value {
+	j := ev.j
+	ty := ev.resolveType(e.ty)
+	x := ev.eval(e.x)
+	if s, ok := ty.(*Simple); ok {
+		x = ev.unbox(x)
+		if s == j.cache.boolTy {
+			if _, ok := x.val.(bool); !ok {
+				j.fail("Cannot cast %v to %v", x.ty, ty)
+			}
+			return x
+		}
+		n, ok := numeric(x.val)
+		if !ok {
+			j.fail("Cannot cast %v to %v", x.ty, ty)
+		}
+		return j.primitive(n.to(s.ty))
+	}
+	if isPrimitive(x) {
+		x = ev.box(x)
+	}
+	if x.IsNull() {
+		return Value{ty, x.val}
+	}
+	if !x.ty.CastableTo(ty) {
+		j.fail("ClassCastException: %v cannot be cast to %v", x.ty, ty)
+	}
+	return x
+}
+
+// equal returns true if the two values are equal, comparing primitives by
+// value and objects by identity. A boxed value compared with a primitive is
+// unboxed.
+func (ev *evaluator) equal(x, y Value, e expr) bool {
+	if isPrimitive(x) != isPrimitive(y) {
+		x, y = ev.unbox(x), ev.unbox(y)
+	}
+	if a, ok := numeric(x.val); ok {
+		b, ok := numeric(y.val)
+		if !ok {
+			ev.j.fail("Incomparable types %v and %v in %v", x.ty, y.ty, e)
+		}
+		return relational("==", a, b)
+	}
+	if a, ok := x.val.(bool); ok {
+		b, ok := y.val.(bool)
+		if !ok {
+			ev.j.fail("Incomparable types %v and %v in %v", x.ty, y.ty, e)
+		}
+		return a == b
+	}
+	a, aok := x.val.(jdwpclient.Object)
+	b, bok := y.val.(jdwpclient.Object)
+	if !aok || !bok {
+		ev.j.fail("Incomparable types %v and %v in %v", x.ty, y.ty, e)
+	}
+	return a.ID() == b.ID()
+}
+
+// boolean returns the value as a bool, unboxing Boolean objects, and failing
+// if the value is not a boolean.
+func (ev *evaluator) boolean(v Value, e expr) bool {
+	b, ok := ev.unbox(v).val.(bool)
+	if !ok {
+		ev.j.fail("%v is %v, not boolean", e, v.ty)
+	}
+	return b
+}
+
+// box returns the primitive value boxed in an object of its wrapper class.
+func (ev *evaluator) box(v Value) Value {
+	j := ev.j
+	var class *Class
+	switch v.ty {
+	case j.cache.boolTy:
+		class = j.cache.boolObjTy
+	case j.cache.byteTy:
+		class = j.cache.byteObjTy
+	case j.cache.charTy:
+		class = j.cache.charObjTy
+	case j.cache.shortTy:
+		class = j.cache.shortObjTy
+	case j.cache.intTy:
+		class = j.cache.intObjTy
+	case j.cache.longTy:
+		class = j.cache.longObjTy
+	case j.cache.floatTy:
+		class = j.cache.floatObjTy
+	case j.cache.doubleTy:
+		class = j.cache.doubleObjTy
+	default:
+		j.fail("Cannot box %v", v.ty)
+	}
+	return class.Call("valueOf", v)
+}
+
+// unbox returns the primitive value of a boxed object. Other values are
+// returned unchanged.
+func (ev *evaluator) unbox(v Value) Value {
+	j := ev.j
+	method := ""
+	switch v.ty {
+	case j.cache.boolObjTy:
+		method = "booleanValue"
+	case j.cache.byteObjTy:
+		method = "byteValue"
+	case j.cache.charObjTy:
+		method = "charValue"
+	case j.cache.shortObjTy:
+		method = "shortValue"
+	case j.cache.intObjTy:
+		method = "intValue"
+	case j.cache.longObjTy:
+		method = "longValue"
+	case j.cache.floatObjTy:
+		method = "floatValue"
+	case j.cache.doubleObjTy:
+		method = "doubleValue"
+	default:
+		return v
+	}
+	if v.IsNull() {
+		j.fail("NullPointerException: cannot unbox null %v", v.ty)
+	}
+	return v.Call(method)
+}
+
+// isPrimitive returns true if the value is of a primitive type.
+func isPrimitive(v Value) bool {
+	_, ok := v.ty.(*Simple)
+	return ok
+}
+
+// classOf returns the class of the class or array type, or nil for primitive
+// types.
+func classOf(ty Type) *Class {
+	switch ty := ty.(type) {
+	case *Class:
+		return ty
+	case *Array:
+		return ty.Class
+	}
+	return nil
+}
+
+// ToString returns the value as text, as String.valueOf() would, calling
+// toString() on objects.
+func (j *JDbg) ToString(v Value) string {
+	if v.IsNull() {
+		return "null"
+	}
+	switch val := v.Get().(type) {
+	case string:
+		return val
+	case jdwpclient.Object:
+		str := v.Call("toString")
+		if str.IsNull() {
+			return "null"
+		}
+		return str.Get().(string)
+	default:
+		text, _ := PrimitiveString(val)
+		return text
+	}
+}
+
+// PrimitiveString returns the value of a primitive type as text, as
+// String.valueOf() would, or false if the value is not of a primitive type.
+func PrimitiveString(v jdwpclient.Value) (string, bool) {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v), true
+	case jdwpclient.Char:
+		return string(rune(uint16(v))), true
+	case byte:
+		return strconv.Itoa(int(int8(v))), true
+	case int16:
+		return strconv.Itoa(int(v)), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float32:
+		return formatFloat(float64(v), 32), true
+	case float64:
+		return formatFloat(v, 64), true
+	}
+	return "", false
+}
+
+// formatFloat returns the float or double as text, as Double.toString() and
+// Float.toString() would.
+func formatFloat(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0 && math.Signbit(f):
+		return "-0.0"
+	case f == 0:
+		return "0.0"
+	}
+	if abs := math.Abs(f); abs >= 1e-3 && abs < 1e7 {
+		s := strconv.FormatFloat(f, 'f', -1, bits)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	}
+	s := strconv.FormatFloat(f, 'E', -1, bits)
+	i := strings.IndexByte(s, 'E')
+	mantissa, exponent := s[:i], s[i+1:]
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	exp, _ := strconv.Atoi(exponent)
+	return mantissa + "E" + strconv.Itoa(exp)
+}
+
+// number is a primitive numeric value, widened to int64 or float64.
+type number struct {
+	tag jdwpclient.Tag // Type of the value.
+	i   int64
+	f   float64
+}
+
+// numeric returns the value as a number, or false if the value is not of a
+// primitive numeric type.
+func numeric(v interface{}) (number, bool) {
+	switch v := v.(type) {
+	case int:
+		return number{tag: jdwpclient.TagInt, i: int64(v)}, true
+	case int64:
+		return number{tag: jdwpclient.TagLong, i: v}, true
+	case int16:
+		return number{tag: jdwpclient.TagShort, i: int64(v)}, true
+	case byte:
+		return number{tag: jdwpclient.TagByte, i: int64(int8(v))}, true
+	case jdwpclient.Char:
+		return number{tag: jdwpclient.TagChar, i: int64(uint16(v))}, true
+	case float32:
+		return number{tag: jdwpclient.TagFloat, f: float64(v)}, true
+	case float64:
+		return number{tag: jdwpclient.TagDouble, f: v}, true
+	}
+	return number{}, false
+}
+
+// isFloat returns true if the number is a float or a double.
+func (n number) isFloat() bool {
+	return n.tag == jdwpclient.TagFloat || n.tag == jdwpclient.TagDouble
+}
+
+// float returns the number as a float64.
+func (n number) float() float64 {
+	if n.isFloat() {
+		return n.f
+	}
+	return float64(n.i)
+}
+
+// long returns the number as an int64, rounding floats towards zero and
+// saturating them as Java does.
+func (n number) long() int64 {
+	switch {
+	case !n.isFloat():
+		return n.i
+	case math.IsNaN(n.f):
+		return 0
+	case n.f >= math.MaxInt64:
+		return math.MaxInt64
+	case n.f <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int64(n.f)
+}
+
+// int returns the number as an int32, rounding floats towards zero and
+// saturating them as Java does.
+func (n number) int() int32 {
+	if n.isFloat() {
+		return int32(math.Max(math.MinInt32, math.Min(math.MaxInt32, float64(n.long()))))
+	}
+	return int32(n.i)
+}
+
+// to returns the number converted to the primitive type with the tag, as the
+// Go type used for values of that type.
+func (n number) to(tag jdwpclient.Tag) interface{} {
+	switch tag {
+	case jdwpclient.TagDouble:
+		return n.float()
+	case jdwpclient.TagFloat:
+		return float32(n.float())
+	case jdwpclient.TagLong:
+		return n.long()
+	case jdwpclient.TagShort:
+		return int16(n.int())
+	case jdwpclient.TagByte:
+		return byte(int8(n.int()))
+	case jdwpclient.TagChar:
+		return jdwpclient.Char(uint16(n.int()))
+	}
+	return int(n.int())
+}
+
+// promote returns the type of the binary numeric promotion of a and b.
+func promote(a, b number) jdwpclient.Tag {
+	switch {
+	case a.tag == jdwpclient.TagDouble || b.tag == jdwpclient.TagDouble:
+		return jdwpclient.TagDouble
+	case a.tag == jdwpclient.TagFloat || b.tag == jdwpclient.TagFloat:
+		return jdwpclient.TagFloat
+	case a.tag == jdwpclient.TagLong || b.tag == jdwpclient.TagLong:
+		return jdwpclient.TagLong
+	}
+	return jdwpclient.TagInt
+}
+
+// arithmetic applies the arithmetic operator to the promoted operands.
+// Integer division by zero must be checked by the caller.
+func arithmetic(op string, a, b number) interface{} {
+	switch tag := promote(a, b); tag {
+	case jdwpclient.TagDouble, jdwpclient.TagFloat:
+		x, y := a.float(), b.float()
+		if tag == jdwpclient.TagFloat {
+			x, y = float64(float32(x)), float64(float32(y))
+		}
+		var r float64
+		switch op {
+		case "+":
+			r = x + y
+		case "-":
+			r = x - y
+		case "*":
+			r = x * y
+		case "/":
+			r = x / y
+		case "%":
+			r = math.Mod(x, y)
+		}
+		return number{tag: jdwpclient.TagDouble, f: r}.to(tag)
+	case jdwpclient.TagLong:
+		x, y := a.long(), b.long()
+		switch op {
+		case "+":
+			return x + y
+		case "-":
+			return x - y
+		case "*":
+			return x * y
+		case "/":
+			return x / y
+		default:
+			return x % y
+		}
+	default:
+		x, y := a.int(), b.int()
+		switch op {
+		case "+":
+			return int(x + y)
+		case "-":
+			return int(x - y)
+		case "*":
+			return int(x * y)
+		case "/":
+			return int(x / y)
+		default:
+			return int(x % y)
+		}
+	}
+}
+
+// relational applies the comparison operator to the promoted operands.
+func relational(op string, a, b number) bool {
+	if a.isFloat() || b.isFloat() {
+		x, y := a.float(), b.float()
+		switch op {
+		case "==":
+			return x == y
+		case "!=":
+			return x != y
+		case "<":
+			return x < y
+		case "<=":
+			return x <= y
+		case ">":
+			return x > y
+		default:
+			return x >= y
+		}
+	}
+	x, y := a.i, b.i
+	switch op {
+	case "==":
+		return x == y
+	case "!=":
+		return x != y
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	default:
+		return x >= y
+	}
+}
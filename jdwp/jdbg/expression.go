@@ -0,0 +1,638 @@
+package jdbg
+
+import (
+	"errors"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind is the kind of a token of a Java expression.
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokLong
+	tokFloat
+	tokDouble
+	tokChar
+	tokString
+	tokOp
+)
+
+// token is a single token of a Java expression.
+type token struct {
+	kind tokenKind
+	text string // Identifier, operator or literal source.
+	val  string // Unescaped value of string and char literals.
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("'%v'", t.text)
+}
+
+// operators holds the operators of the expression language, longest first so
+// that they are matched greedily.
+var operators = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"(", ")", "[", "]", ".", ",", "!", "<", ">", "+", "-", "*", "/", "%", "?", ":",
+}
+
+// tokenize splits the Java expression into tokens, ending with a tokEOF.
+func tokenize(s string) ([]token, error) {
+	out := []token{}
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '_' || c == '$' || unicode.IsLetter(c):
+			start := i
+			for i < len(s) && (s[i] == '_' || s[i] == '$' || unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i]))) {
+				i++
+			}
+			out = append(out, token{kind: tokIdent, text: s[start:i], pos: start})
+
+		case unicode.IsDigit(c) || c == '.' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1])):
+			t, err := numberToken(s, i)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, t)
+			i += len(t.text)
+
+		case c == '"' || c == '\'':
+			t, err := quoted(s, i)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, t)
+			i += len(t.text)
+
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("Unexpected character '%c' at offset %d", c, i)
+			}
+			out = append(out, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(out, token{kind: tokEOF, pos: len(s)}), nil
+}
+
+// numberToken returns the numeric literal token starting at s[start].
+func numberToken(s string, start int) (token, error) {
+	i, kind := start, tokInt
+	hex := strings.HasPrefix(s[i:], "0x") || strings.HasPrefix(s[i:], "0X")
+	binary := strings.HasPrefix(s[i:], "0b") || strings.HasPrefix(s[i:], "0B")
+	if hex || binary {
+		i += 2
+	}
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9', c == '_', hex && strings.IndexByte("abcdefABCDEF", c) >= 0:
+		case !hex && !binary && c == '.':
+			kind = tokDouble
+		case !hex && !binary && (c == 'e' || c == 'E'):
+			kind = tokDouble
+			if i+1 < len(s) && (s[i+1] == '+' || s[i+1] == '-') {
+				i++
+			}
+		default:
+			goto suffix
+		}
+		i++
+	}
+suffix:
+	if i < len(s) {
+		switch s[i] {
+		case 'l', 'L':
+			kind, i = tokLong, i+1
+		case 'f', 'F':
+			kind, i = tokFloat, i+1
+		case 'd', 'D':
+			kind, i = tokDouble, i+1
+		}
+	}
+	if i < len(s) && (s[i] == '_' || unicode.IsLetter(rune(s[i]))) {
+		return token{}, fmt.Errorf("Malformed number at offset %d", start)
+	}
+	return token{kind: kind, text: s[start:i], pos: start}, nil
+}
+
+// quoted returns the string or char literal token starting at s[start].
+func quoted(s string, start int) (token, error) {
+	quote := s[start]
+	val := strings.Builder{}
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			t := token{kind: tokString, text: s[start : i+1], val: val.String(), pos: start}
+			if quote == '\'' {
+				if len([]rune(t.val)) != 1 {
+					return token{}, fmt.Errorf("Invalid char literal at offset %d", start)
+				}
+				t.kind = tokChar
+			}
+			return t, nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				val.WriteByte('\n')
+			case 't':
+				val.WriteByte('\t')
+			case 'r':
+				val.WriteByte('\r')
+			case 'b':
+				val.WriteByte('\b')
+			case 'f':
+				val.WriteByte('\f')
+			case '0':
+				val.WriteByte(0)
+			case 'u':
+				if i+4 >= len(s) {
+					return token{}, fmt.Errorf("Invalid unicode escape at offset %d", i-1)
+				}
+				r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+				if err != nil {
+					return token{}, fmt.Errorf("Invalid unicode escape at offset %d", i-1)
+				}
+				val.WriteRune(rune(r))
+				i += 4
+			default:
+				val.WriteByte(s[i])
+			}
+		default:
+			val.WriteByte(c)
+		}
+	}
+	return token{}, fmt.Errorf("Unterminated literal at offset %d", start)
+}
+
+// expr is a node of a parsed Java expression.
+type expr interface {
+	String() string
+}
+
+type (
+	// literalExpr is a literal value: a bool, int, int64, float32, float64,
+	// jdwpclient.Char, string or nil for null.
+	literalExpr struct{ val interface{} }
+	// nameExpr is a simple name, such as a local variable or a class.
+	nameExpr struct{ name string }
+	// thisExpr is the 'this' keyword.
+	thisExpr struct{}
+	// fieldExpr selects a field of an object or a class, or a class of a
+	// package: x.name
+	fieldExpr struct {
+		x    expr
+		name string
+	}
+	// callExpr calls a method: x.name(args). x is nil for calls of methods of
+	// 'this' or of the frame's class.
+	callExpr struct {
+		x    expr
+		name string
+		args []expr
+	}
+	// indexExpr selects an element of an array: x[index]
+	indexExpr struct {
+		x, index expr
+	}
+	// unaryExpr is a prefix operator applied to an operand.
+	unaryExpr struct {
+		op string
+		x  expr
+	}
+	// binaryExpr is an infix operator applied to two operands.
+	binaryExpr struct {
+		op   string
+		x, y expr
+	}
+	// castExpr converts an operand to a type: (ty) x
+	castExpr struct {
+		ty typeExpr
+		x  expr
+	}
+	// instanceOfExpr tests the type of an operand: x instanceof ty
+	instanceOfExpr struct {
+		x  expr
+		ty typeExpr
+	}
+	// condExpr is the conditional operator: cond ? x : y
+	condExpr struct {
+		cond, x, y expr
+	}
+)
+
+// typeExpr names a type, such as "int", "String" or "java.util.List[]".
+type typeExpr struct {
+	name string // Primitive type name, or simple or qualified class name.
+	dims int    // Number of array dimensions.
+}
+
+func (e literalExpr) String() string {
+	switch v := e.val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case jdwpclient.Char:
+		return strconv.QuoteRune(rune(v))
+	}
+	return fmt.Sprint(e.val)
+}
+func (e nameExpr) String() string  { return e.name }
+func (e thisExpr) String() string  { return "this" }
+func (e fieldExpr) String() string { return fmt.Sprintf("%v.%v", e.x, e.name) }
+func (e callExpr) String() string {
+	args := make([]string, len(e.args))
+	for i, a := range e.args {
+		args[i] = a.String()
+	}
+	if e.x == nil {
+		return fmt.Sprintf("%v(%v)", e.name, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("%v.%v(%v)", e.x, e.name, strings.Join(args, ", "))
+}
+func (e indexExpr) String() string      { return fmt.Sprintf("%v[%v]", e.x, e.index) }
+func (e unaryExpr) String() string      { return fmt.Sprintf("%v%v", e.op, e.x) }
+func (e binaryExpr) String() string     { return fmt.Sprintf("(%v %v %v)", e.x, e.op, e.y) }
+func (e castExpr) String() string       { return fmt.Sprintf("(%v) %v", e.ty, e.x) }
+func (e instanceOfExpr) String() string { return fmt.Sprintf("(%v instanceof %v)", e.x, e.ty) }
+func (e condExpr) String() string       { return fmt.Sprintf("(%v ? %v : %v)", e.cond, e.x, e.y) }
+func (e typeExpr) String() string       { return e.name + strings.Repeat("[]", e.dims) }
+
+// primitiveTypes holds the names of the primitive types.
+var primitiveTypes = map[string]bool{
+	"boolean": true, "byte": true, "char": true, "short": true,
+	"int": true, "long": true, "float": true, "double": true,
+}
+
+// precedence holds the binding power of the binary operators.
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4, "instanceof": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// parser is a precedence climbing parser of Java expressions.
+type parser struct {
+	tokens []token
+	i      int
+}
+
+// parseExpression parses the Java expression.
+func parseExpression(s string) (expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("Unexpected %v at offset %d", t, t.pos)
+	}
+	return e, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.i] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// isOp returns true if the next token is the operator op.
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+// expect consumes the operator op, or returns an error if the next token is
+// not op.
+func (p *parser) expect(op string) error {
+	if !p.isOp(op) {
+		t := p.peek()
+		return fmt.Errorf("Expected '%v' but got %v at offset %d", op, t, t.pos)
+	}
+	p.next()
+	return nil
+}
+
+// expression parses a full expression, including the conditional operator.
+func (p *parser) expression() (expr, error) {
+	cond, err := p.binary(1)
+	if err != nil || !p.isOp("?") {
+		return cond, err
+	}
+	p.next()
+	x, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	y, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return condExpr{cond: cond, x: x, y: y}, nil
+}
+
+// binary parses a sequence of binary operations with operators that bind at
+// least as tightly as min.
+func (p *parser) binary(min int) (expr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if (t.kind != tokOp && t.text != "instanceof") || !ok || prec < min {
+			return x, nil
+		}
+		p.next()
+		if t.text == "instanceof" {
+			ty, err := p.typeName()
+			if err != nil {
+				return nil, err
+			}
+			x = instanceOfExpr{x: x, ty: ty}
+			continue
+		}
+		y, err := p.binary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: t.text, x: x, y: y}
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.isOp("!") || p.isOp("-") || p.isOp("+") {
+		op := p.next().text
+		var x expr
+		var err error
+		if t := p.peek(); op == "-" && (t.kind == tokInt || t.kind == tokLong) {
+			// The smallest int and long literals are only valid when negated.
+			x, err = numberLiteral(p.next(), true)
+		} else {
+			x, err = p.unary()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: op, x: x}, nil
+	}
+	if ty, ok := p.cast(); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return castExpr{ty: ty, x: x}, nil
+	}
+	return p.postfix()
+}
+
+// cast consumes and returns the parenthesized type of a cast, or returns false
+// without consuming anything if the next tokens are not a cast.
+// As in Java, a parenthesized name is a cast if it names a primitive type, or
+// if it is followed by an operand that cannot continue a binary operation.
+func (p *parser) cast() (typeExpr, bool) {
+	if !p.isOp("(") {
+		return typeExpr{}, false
+	}
+	start := p.i
+	p.next()
+	ty, err := p.typeName()
+	if err != nil || !p.isOp(")") {
+		p.i = start
+		return typeExpr{}, false
+	}
+	p.next()
+	if primitiveTypes[ty.name] {
+		return ty, true
+	}
+	switch t := p.peek(); {
+	case t.kind == tokIdent && t.text != "instanceof",
+		t.kind == tokInt, t.kind == tokLong, t.kind == tokFloat, t.kind == tokDouble,
+		t.kind == tokChar, t.kind == tokString,
+		t.kind == tokOp && (t.text == "(" || t.text == "!"):
+		return ty, true
+	}
+	p.i = start
+	return typeExpr{}, false
+}
+
+// typeName parses a primitive type or a possibly qualified class name,
+// followed by any array dimensions.
+func (p *parser) typeName() (typeExpr, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return typeExpr{}, fmt.Errorf("Expected a type but got %v at offset %d", t, t.pos)
+	}
+	ty := typeExpr{name: t.text}
+	for !primitiveTypes[ty.name] && p.isOp(".") {
+		p.next()
+		t := p.next()
+		if t.kind != tokIdent {
+			return typeExpr{}, fmt.Errorf("Expected a name after '.' but got %v at offset %d", t, t.pos)
+		}
+		ty.name += "." + t.text
+	}
+	for p.isOp("[") {
+		p.next()
+		if err := p.expect("]"); err != nil {
+			return typeExpr{}, err
+		}
+		ty.dims++
+	}
+	return ty, nil
+}
+
+// postfix parses a primary expression followed by any field selectors, method
+// calls and array indices.
+func (p *parser) postfix() (expr, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("Expected a name after '.' but got %v at offset %d", t, t.pos)
+			}
+			if p.isOp("(") {
+				args, err := p.arguments()
+				if err != nil {
+					return nil, err
+				}
+				x = callExpr{x: x, name: t.text, args: args}
+			} else {
+				x = fieldExpr{x: x, name: t.text}
+			}
+		case p.isOp("["):
+			p.next()
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = indexExpr{x: x, index: index}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// arguments parses the parenthesized arguments of a method call.
+func (p *parser) arguments() ([]expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := []expr{}
+	if p.isOp(")") {
+		p.next()
+		return args, nil
+	}
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.isOp(")") {
+			p.next()
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return literalExpr{t.text == "true"}, nil
+		case "null":
+			return literalExpr{nil}, nil
+		case "this":
+			return thisExpr{}, nil
+		case "instanceof":
+			return nil, fmt.Errorf("Unexpected %v at offset %d", t, t.pos)
+		}
+		if p.isOp("(") {
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			return callExpr{name: t.text, args: args}, nil
+		}
+		return nameExpr{t.text}, nil
+	case tokInt, tokLong, tokFloat, tokDouble:
+		return numberLiteral(t, false)
+	case tokString:
+		return literalExpr{t.val}, nil
+	case tokChar:
+		return literalExpr{jdwpclient.Char([]rune(t.val)[0])}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	return nil, fmt.Errorf("Unexpected %v at offset %d", t, t.pos)
+}
+
+// numberLiteral returns the literal of the numeric token. As in Java, the
+// decimal literals 2147483648 and 9223372036854775808L are only valid if
+// negated, while hexadecimal, octal and binary literals may use all 32 or 64
+// bits.
+func numberLiteral(t token, negated bool) (expr, error) {
+	text := strings.Replace(t.text, "_", "", -1)
+	switch t.kind {
+	case tokInt, tokLong:
+		text = strings.TrimRight(text, "lL")
+		bits := 32
+		if t.kind == tokLong {
+			bits = 64
+		}
+		var u uint64
+		var err error
+		if text == "0" || !strings.HasPrefix(text, "0") {
+			max := uint64(1)<<(bits-1) - 1
+			if negated {
+				max++
+			}
+			if u, err = strconv.ParseUint(text, 10, 64); err == nil && u > max {
+				err = strconv.ErrRange
+			}
+		} else {
+			u, err = strconv.ParseUint(text, 0, bits)
+		}
+		switch {
+		case errors.Is(err, strconv.ErrRange):
+			return nil, fmt.Errorf("Integer %v out of range at offset %d", t.text, t.pos)
+		case err != nil:
+			return nil, fmt.Errorf("Invalid number %v at offset %d", t.text, t.pos)
+		case t.kind == tokLong:
+			return literalExpr{int64(u)}, nil
+		}
+		return literalExpr{int(int32(u))}, nil
+	case tokFloat:
+		v, err := strconv.ParseFloat(strings.TrimRight(text, "fF"), 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %v at offset %d", t.text, t.pos)
+		}
+		return literalExpr{float32(v)}, nil
+	default:
+		v, err := strconv.ParseFloat(strings.TrimRight(text, "dD"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %v at offset %d", t.text, t.pos)
+		}
+		return literalExpr{v}, nil
+	}
+}
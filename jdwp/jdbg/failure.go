@@ -23,6 +23,9 @@ type failure struct {
 	error
 }
 
+// Unwrap returns the error that caused the failure.
+func (f failure) Unwrap() error { return f.error }
+
 // fail panics with a failure error formed from msg and args, immediately
 // terminating execution of Do().
 func (j *JDbg) fail(msg string, args ...interface{}) {
@@ -17,6 +17,7 @@
 package jdbg
 
 import (
+	"context"
 	"fmt"
 	"sapelkinav/javadap/jdwp/jdwpclient"
 	"strings"
@@ -53,6 +54,7 @@ type cache struct {
 // JDbg is a wrapper around a JDWP connection that provides an easier interface
 // for usage.
 type JDbg struct {
+	ctx     context.Context
 	conn    *jdwpclient.Connection
 	thread  jdwpclient.ThreadID
 	cache   cache
@@ -62,8 +64,10 @@ type JDbg struct {
 // Do calls f with a JDbg instance, returning the error returned by f.
 // If any JDWP errors are raised during the call to f, then execution of f is
 // immediately terminated, and the JDWP error is returned.
-func Do(conn *jdwpclient.Connection, thread jdwpclient.ThreadID, f func(jdbg *JDbg) error) error {
+// All the JDWP commands sent during the call are bound to ctx.
+func Do(ctx context.Context, conn *jdwpclient.Connection, thread jdwpclient.ThreadID, f func(jdbg *JDbg) error) error {
 	j := &JDbg{
+		ctx:    ctx,
 		conn:   conn,
 		thread: thread,
 		cache: cache{
@@ -73,9 +77,11 @@ func Do(conn *jdwpclient.Connection, thread jdwpclient.ThreadID, f func(jdbg *JD
 		},
 	}
 	defer func() {
-		// Reenable GC for all objects used during the call to f()
+		// Reenable GC for all objects used during the call to f(), even if
+		// ctx was cancelled.
+		ctx := context.WithoutCancel(ctx)
 		for _, o := range j.objects {
-			conn.EnableGC(o)
+			conn.EnableGC(ctx, o)
 		}
 	}()
 
@@ -110,6 +116,18 @@ func Do(conn *jdwpclient.Connection, thread jdwpclient.ThreadID, f func(jdbg *JD
 // Connection returns the JDWP connection.
 func (j *JDbg) Connection() *jdwpclient.Connection { return j.conn }
 
+// Context returns the context that the JDWP commands are bound to.
+func (j *JDbg) Context() context.Context { return j.ctx }
+
+// Require immediately terminates execution of Do() with a
+// jdwpclient.UnsupportedError if the VM does not have the capability required
+// by the feature.
+func (j *JDbg) Require(f jdwpclient.Feature) {
+	if err := j.conn.Capabilities().Require(f); err != nil {
+		j.err(err)
+	}
+}
+
 // ObjectType returns the Java java.lang.Object type.
 func (j *JDbg) ObjectType() *Class { return j.cache.objTy }
 
@@ -191,7 +209,7 @@ func (j *JDbg) Class(name string) *Class {
 
 // AllClasses returns all the loaded classes.
 func (j *JDbg) AllClasses() []*Class {
-	classes, err := j.conn.GetAllClasses()
+	classes, err := j.conn.GetAllClasses(j.ctx)
 	if err != nil {
 		j.fail("Couldn't get all classes: %v", err)
 	}
@@ -221,7 +239,7 @@ func (j *JDbg) classFromSig(sig string) (*Class, error) {
 	if class, ok := j.cache.classes[sig]; ok {
 		return class, nil
 	}
-	class, err := j.conn.GetClassBySignature(sig)
+	class, err := j.conn.GetClassBySignature(j.ctx, sig)
 	if err != nil {
 		return nil, err
 	}
@@ -240,7 +258,7 @@ func (j *JDbg) class(class jdwpclient.ClassInfo) (*Class, error) {
 	j.cache.classes[sig] = ty
 	j.cache.idToSig[class.TypeID] = sig
 
-	superid, err := j.conn.GetSuperClass(class.ClassID())
+	superid, err := j.conn.GetSuperClass(j.ctx, class.ClassID())
 	if err != nil {
 		return nil, err
 	}
@@ -249,7 +267,7 @@ func (j *JDbg) class(class jdwpclient.ClassInfo) (*Class, error) {
 		ty.super = j.typeFromID(jdwpclient.ReferenceTypeID(superid)).(*Class)
 	}
 
-	implementsids, err := j.conn.GetImplemented(class.TypeID)
+	implementsids, err := j.conn.GetImplemented(j.ctx, class.TypeID)
 	if err != nil {
 		return nil, err
 	}
@@ -259,7 +277,7 @@ func (j *JDbg) class(class jdwpclient.ClassInfo) (*Class, error) {
 		ty.implements[i] = j.typeFromID(jdwpclient.ReferenceTypeID(id)).(*Class)
 	}
 
-	ty.fields, err = j.conn.GetFields(class.TypeID)
+	ty.fields, err = j.conn.GetFields(j.ctx, class.TypeID)
 	if err != nil {
 		return nil, err
 	}
@@ -271,7 +289,7 @@ func (j *JDbg) typeFromID(id jdwpclient.ReferenceTypeID) Type {
 	sig, ok := j.cache.idToSig[id]
 	if !ok {
 		var err error
-		sig, err = j.conn.GetTypeSignature(id)
+		sig, err = j.conn.GetTypeSignature(j.ctx, id)
 		if err != nil {
 			j.fail("GetTypeSignature() returned: %v", err)
 		}
@@ -282,12 +300,12 @@ func (j *JDbg) typeFromID(id jdwpclient.ReferenceTypeID) Type {
 
 // This returns the this object for the current stack frame.
 func (j *JDbg) This() Value {
-	frames, err := j.conn.GetFrames(j.thread, 0, 1)
+	frames, err := j.conn.GetFrames(j.ctx, j.thread, 0, 1)
 	if err != nil {
 		j.fail("GetFrames() returned: %v", err)
 	}
 
-	this, err := j.conn.GetThisObject(j.thread, frames[0].Frame)
+	this, err := j.conn.GetThisObject(j.ctx, j.thread, frames[0].Frame)
 	if err != nil {
 		j.fail("GetThisObject() returned: %v", err)
 	}
@@ -296,7 +314,7 @@ func (j *JDbg) This() Value {
 }
 
 func (j *JDbg) String(val string) Value {
-	str, err := j.conn.CreateString(val)
+	str, err := j.conn.CreateString(j.ctx, val)
 	if err != nil {
 		j.fail("CreateString() returned: %v", err)
 	}
@@ -306,6 +324,7 @@ func (j *JDbg) String(val string) Value {
 // findArg finds the argument with the given name/index in the given frame
 func (j *JDbg) findArg(name string, index int, frame jdwpclient.FrameInfo) jdwpclient.VariableRequest {
 	table, err := j.conn.VariableTable(
+		j.ctx,
 		jdwpclient.ReferenceTypeID(frame.Location.Class),
 		frame.Location.Method)
 
@@ -313,7 +332,7 @@ func (j *JDbg) findArg(name string, index int, frame jdwpclient.FrameInfo) jdwpc
 		j.fail("VariableTable returned: %v", err)
 	}
 
-	variable := jdwpclient.VariableRequest{-1, 0}
+	variable := jdwpclient.VariableRequest{Index: -1}
 
 	for _, slot := range table.Slots {
 		if name == slot.Name {
@@ -355,13 +374,13 @@ func (j *JDbg) findArg(name string, index int, frame jdwpclient.FrameInfo) jdwpc
 // the argument by index (e.g. in the case the names have been stripped from the
 // debug info).
 func (j *JDbg) GetArgument(name string, index int) Variable {
-	frames, err := j.conn.GetFrames(j.thread, 0, 1)
+	frames, err := j.conn.GetFrames(j.ctx, j.thread, 0, 1)
 	if err != nil {
 		j.fail("GetFrames() returned: %v", err)
 	}
 	variable := j.findArg(name, index, frames[0])
 
-	values, err := j.conn.GetValues(j.thread, frames[0].Frame, []jdwpclient.VariableRequest{variable})
+	values, err := j.conn.GetValues(j.ctx, j.thread, frames[0].Frame, []jdwpclient.VariableRequest{variable})
 	if err != nil {
 		j.fail("GetValues() returned: %v", err)
 	}
@@ -370,21 +389,29 @@ func (j *JDbg) GetArgument(name string, index int) Variable {
 
 // SetVariable sets the value of the given variable.
 func (j *JDbg) SetVariable(variable Variable, val Value) {
-	frames, err := j.conn.GetFrames(j.thread, 0, 1)
+	frames, err := j.conn.GetFrames(j.ctx, j.thread, 0, 1)
 	if err != nil {
 		j.fail("GetFrames() returned: %v", err)
 	}
 
 	v := val.val.(jdwpclient.Value)
-	assign := jdwpclient.VariableAssignmentRequest{variable.variable.Index, v}
-	err = j.conn.SetValues(j.thread, frames[0].Frame, []jdwpclient.VariableAssignmentRequest{assign})
+	assign := jdwpclient.VariableAssignmentRequest{Index: variable.variable.Index, Value: v}
+	err = j.conn.SetValues(j.ctx, j.thread, frames[0].Frame, []jdwpclient.VariableAssignmentRequest{assign})
 	if err != nil {
 		j.fail("GetValues() returned: %v", err)
 	}
 }
 
+// Object returns the value of the object, typed by the object's type.
+func (j *JDbg) Object(id jdwpclient.Object) Value {
+	if id.ID() == 0 {
+		return Value{j.cache.objTy, jdwpclient.ObjectID(0)} // null pointer
+	}
+	return j.object(id)
+}
+
 func (j *JDbg) object(id jdwpclient.Object) Value {
-	tyID, err := j.conn.GetObjectType(id.ID())
+	tyID, err := j.conn.GetObjectType(j.ctx, id.ID())
 	if err != nil {
 		j.fail("GetObjectType() returned: %v", err)
 	}
@@ -396,7 +423,31 @@ func (j *JDbg) object(id jdwpclient.Object) Value {
 func (j *JDbg) value(o interface{}) Value {
 	switch v := o.(type) {
 	case jdwpclient.Object:
-		return j.object(v)
+		return j.Object(v)
+	default:
+		return j.primitive(v)
+	}
+}
+
+// primitive returns the value of a primitive type, typed by its Go type.
+func (j *JDbg) primitive(o interface{}) Value {
+	switch o.(type) {
+	case bool:
+		return Value{j.cache.boolTy, o}
+	case byte:
+		return Value{j.cache.byteTy, o}
+	case jdwpclient.Char:
+		return Value{j.cache.charTy, o}
+	case int16:
+		return Value{j.cache.shortTy, o}
+	case int:
+		return Value{j.cache.intTy, o}
+	case int64:
+		return Value{j.cache.longTy, o}
+	case float32:
+		return Value{j.cache.floatTy, o}
+	case float64:
+		return Value{j.cache.doubleTy, o}
 	default:
 		j.fail("Unhandled variable type %T", o)
 		return Value{}
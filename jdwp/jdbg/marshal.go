@@ -36,7 +36,7 @@ func (j *JDbg) marshal(o interface{}) jdwpclient.Value {
 		return j.marshal(o.val)
 
 	case string:
-		id, err := j.conn.CreateString(o)
+		id, err := j.conn.CreateString(j.ctx, o)
 		if err != nil {
 			j.fail("Failed to marshal string: %v", err)
 		}
@@ -114,7 +114,7 @@ func (j *JDbg) toObjects(l []interface{}) []interface{} {
 func (j *JDbg) unmarshal(v jdwpclient.Value) interface{} {
 	switch v := v.(type) {
 	case jdwpclient.StringID:
-		str, err := j.conn.GetString(v)
+		str, err := j.conn.GetString(j.ctx, v)
 		if err != nil {
 			j.fail("Failed to unmarshal string")
 		}
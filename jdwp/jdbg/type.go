@@ -132,7 +132,7 @@ func (t *Array) CastableTo(ty Type) bool {
 
 // New constructs a new array of the specified size.
 func (t *Array) New(size int) Value {
-	array, err := t.j.conn.NewArray(jdwpclient.ArrayTypeID(t.class.TypeID), size)
+	array, err := t.j.conn.NewArray(t.j.ctx, jdwpclient.ArrayTypeID(t.class.TypeID), size)
 	if err != nil {
 		t.j.fail("Failed to create array: %v", err)
 	}
@@ -175,7 +175,7 @@ func (t *Class) New(args ...interface{}) Value {
 	m := t.j.resolveMethod(false, t, constructor, args)
 	values := t.j.marshalN(args)
 	res, err := t.j.conn.NewInstance(
-		m.class.class.ClassID(), m.id, t.j.thread, jdwpclient.InvokeSingleThreaded, values...)
+		t.j.ctx, m.class.class.ClassID(), m.id, t.j.thread, jdwpclient.InvokeSingleThreaded, values...)
 	if err != nil {
 		t.j.fail("NewInstance() returned: %v", err)
 	}
@@ -207,7 +207,7 @@ func (t *Class) Call(method string, args ...interface{}) Value {
 // Field returns the value of the static field with the given name.
 func (t *Class) Field(name string) Value {
 	field := t.resolve().fields.FindByName(name)
-	values, err := t.j.conn.GetStaticFieldValues(t.class.TypeID, field.ID)
+	values, err := t.j.conn.GetStaticFieldValues(t.j.ctx, t.class.TypeID, field.ID)
 	if err != nil {
 		t.j.fail("GetValues() returned: %v", err)
 	}
@@ -221,13 +221,20 @@ func (t *Class) Super() *Class {
 
 func (t *Class) call(object Value, method string, args []interface{}) Value {
 	m := t.j.resolveMethod(object != nilValue, t, method, args)
+	return t.invoke(object, m, args)
+}
+
+// invoke invokes the resolved method m on the object, or on the class if m is
+// static.
+func (t *Class) invoke(object Value, m method, args []interface{}) Value {
+	method := m.name
 	values := t.j.marshalN(args)
 
 	var res jdwpclient.InvokeResult
 	var err error
 	if m.mod&jdwpclient.ModStatic != 0 {
 		res, err = t.j.conn.InvokeStaticMethod(
-			t.class.ClassID(), m.id, t.j.thread, jdwpclient.InvokeSingleThreaded, values...)
+			t.j.ctx, t.class.ClassID(), m.id, t.j.thread, jdwpclient.InvokeSingleThreaded, values...)
 	} else {
 		if object == nilValue {
 			t.j.fail("Cannot call non-static method '%v' without an object", method)
@@ -239,7 +246,7 @@ func (t *Class) call(object Value, method string, args []interface{}) Value {
 			t.j.fail("Cannot call methods on %T types", obj)
 		}
 		res, err = t.j.conn.InvokeMethod(
-			object.ID(), t.class.ClassID(), m.id, t.j.thread, jdwpclient.InvokeSingleThreaded, values...)
+			t.j.ctx, object.ID(), t.class.ClassID(), m.id, t.j.thread, jdwpclient.InvokeSingleThreaded, values...)
 	}
 	if err != nil {
 		t.j.err(err)
@@ -260,7 +267,7 @@ func (t *Class) call(object Value, method string, args []interface{}) Value {
 		return Value{m.sig.Return, result.ID()} // null pointer
 	}
 
-	tyID, err := t.j.conn.GetObjectType(result.ID())
+	tyID, err := t.j.conn.GetObjectType(t.j.ctx, result.ID())
 	if err != nil {
 		t.j.fail("GetObjectType() returned: %v", err)
 	}
@@ -278,7 +285,10 @@ func (t *Class) field(object Value, name string) Value {
 	if object == nilValue {
 		t.j.fail("Cannot get field '%v' on nill object", name)
 	}
-	f := t.fields.FindByName(name)
+	var f *jdwpclient.Field
+	for c := t; c != nil && f == nil; c = c.super {
+		f = c.fields.FindByName(name)
+	}
 	if f == nil {
 		t.j.fail("Class '%v' does not contain field '%v'", t.name, name)
 	}
@@ -286,12 +296,12 @@ func (t *Class) field(object Value, name string) Value {
 	if !ok {
 		t.j.fail("Class '%v' does not support fields", t.name)
 	}
-	vals, err := t.j.conn.GetFieldValues(obj.ID(), f.ID)
+	vals, err := t.j.conn.GetFieldValues(t.j.ctx, obj.ID(), f.ID)
 	if err != nil {
 		t.j.fail("GetFieldValues() returned: %v", err)
 	}
 	if len(vals) != 1 {
-		t.j.fail("GetFieldValues() returned %n values, expected 1", len(vals))
+		t.j.fail("GetFieldValues() returned %d values, expected 1", len(vals))
 	}
 	return t.j.value(vals[0])
 }
@@ -304,14 +314,14 @@ func (t *Class) resolve() *classResolvedInfo {
 	}
 	t.resolved = &classResolvedInfo{}
 
-	f, err := t.j.conn.GetFields(t.class.TypeID)
+	f, err := t.j.conn.GetFields(t.j.ctx, t.class.TypeID)
 	if err != nil {
 		t.resolved.error = err
 		return t.resolved
 	}
 	t.resolved.fields = f
 
-	m, err := t.j.conn.GetMethods(t.class.TypeID)
+	m, err := t.j.conn.GetMethods(t.j.ctx, t.class.TypeID)
 	if err != nil {
 		t.resolved.error = err
 		return t.resolved
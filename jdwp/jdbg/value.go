@@ -32,7 +32,7 @@ func newValue(ty Type, val interface{}) Value {
 	if obj, ok := val.(jdwpclient.Object); ok {
 		// Prevent GC of this object for the duration of the jdbg.Do call.
 		j, id := ty.jdbg(), obj.ID()
-		j.conn.DisableGC(id)
+		j.conn.DisableGC(j.ctx, id)
 		j.objects = append(j.objects, id)
 	}
 	return Value{ty, val}
@@ -43,7 +43,8 @@ func (v Value) Call(method string, args ...interface{}) Value {
 	return v.ty.call(v, method, args)
 }
 
-// Field returns the value of the specified field.
+// Field returns the value of the specified field, which may be declared by a
+// superclass of the value's class.
 func (v Value) Field(name string) Value {
 	return v.ty.field(v, name)
 }
@@ -53,6 +54,11 @@ func (v Value) Get() interface{} {
 	return v.ty.jdbg().unmarshal(v.val)
 }
 
+// Raw returns the value as a JDWP value, without unmarshalling.
+func (v Value) Raw() jdwpclient.Value {
+	return v.val
+}
+
 // Type returns the value's type.
 func (v Value) Type() Type {
 	return v.ty
@@ -63,7 +69,7 @@ func (v Value) AsType() Type {
 	j := v.ty.jdbg()
 	switch v := v.val.(type) {
 	case jdwpclient.ClassObjectID:
-		id, err := j.conn.ReflectedType(v)
+		id, err := j.conn.ReflectedType(j.ctx, v)
 		if err != nil {
 			j.fail("%v", err)
 		}
@@ -72,6 +78,48 @@ func (v Value) AsType() Type {
 	panic(fmt.Errorf("Unhandled value type: %T %+v", v.val, v.val))
 }
 
+// IsNull returns true if the value is a null object reference.
+func (v Value) IsNull() bool {
+	obj, ok := v.val.(jdwpclient.Object)
+	return ok && obj.ID() == 0
+}
+
+// ArrayLength returns the length of the array. This value must be an Array.
+func (v Value) ArrayLength() int {
+	j := v.ty.jdbg()
+	if _, ok := v.ty.(*Array); !ok {
+		j.fail("ArrayLength can only be used with Arrays, type is %v", v.ty)
+	}
+	n, err := j.conn.GetArrayLength(j.ctx, v.val.(jdwpclient.ArrayID))
+	if err != nil {
+		j.fail("GetArrayLength() returned: %v", err)
+	}
+	return n
+}
+
+// ArrayValues returns count values of the array, starting at the index first.
+// This value must be an Array.
+func (v Value) ArrayValues(first, count int) []Value {
+	j := v.ty.jdbg()
+	arrayTy, ok := v.ty.(*Array)
+	if !ok {
+		j.fail("ArrayValues can only be used with Arrays, type is %v", v.ty)
+	}
+	values, err := j.conn.GetArrayValues(j.ctx, v.val.(jdwpclient.ArrayID), first, count)
+	if err != nil {
+		j.fail("GetArrayValues() returned: %v", err)
+	}
+	out := make([]Value, len(values))
+	for i, val := range values {
+		if obj, ok := val.(jdwpclient.Object); ok && obj.ID() != 0 {
+			out[i] = j.object(obj)
+		} else {
+			out[i] = Value{arrayTy.el, val}
+		}
+	}
+	return out
+}
+
 // SetArrayValues sets the array values to values. This value must be an Array.
 func (v Value) SetArrayValues(values interface{}) {
 	j := v.ty.jdbg()
@@ -92,7 +140,7 @@ func (v Value) SetArrayValues(values interface{}) {
 		values = j.toObjects(values.([]interface{}))
 	}
 
-	if err := j.conn.SetArrayValues(v.val.(jdwpclient.ArrayID), 0, values); err != nil {
+	if err := j.conn.SetArrayValues(j.ctx, v.val.(jdwpclient.ArrayID), 0, values); err != nil {
 		j.fail("Failed to set array (type %s) values (type %T): %v", arrayTy, values, err)
 	}
 }
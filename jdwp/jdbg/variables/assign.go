@@ -0,0 +1,103 @@
+package variables
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strconv"
+	"strings"
+)
+
+// settable is a container whose children can be assigned new values.
+type settable interface {
+	container
+	// assignment returns the assignment of a value to the child with the
+	// name.
+	assignment(ctx context.Context, s *Store, name string) (assignment, error)
+}
+
+// assignment is the assignment of a value to a child of a container.
+type assignment struct {
+	thread jdwpclient.ThreadID
+	// frame is the frame in which the assigned expression is evaluated, or nil
+	// for the top frame of the thread.
+	frame  *jdwpclient.FrameInfo
+	target func(j *jdbg.JDbg) jdbg.Target
+}
+
+// SetVariable evaluates the Java expression and assigns its value to the
+// child with the name of the scope, object or array with the reference. It
+// returns the child with its new value. The expression is evaluated in the
+// frame of a scope, or in the top frame of the thread for the children of
+// objects and arrays. The logical children of formatted objects cannot be
+// assigned.
+func (s *Store) SetVariable(ctx context.Context, ref int, name, expression string) (Variable, error) {
+	s.mutex.Lock()
+	c, ok := s.refs[ref].(settable)
+	s.mutex.Unlock()
+	if !ok {
+		return Variable{}, fmt.Errorf("Cannot set the variables of reference %d", ref)
+	}
+	a, err := c.assignment(ctx, s, name)
+	if err != nil {
+		return Variable{}, err
+	}
+	var out []Variable
+	err = jdbg.Do(ctx, s.conn, a.thread, func(j *jdbg.JDbg) error {
+		target := a.target(j)
+		var v jdbg.Value
+		if a.frame != nil {
+			v = j.AssignInFrame(*a.frame, target, expression)
+		} else {
+			v = j.Assign(target, expression)
+		}
+		var err error
+		out, err = s.variables(ctx, a.thread, j, []child{{name, target.Type().Signature(), v.Raw()}})
+		return err
+	})
+	if err != nil {
+		return Variable{}, err
+	}
+	return out[0], nil
+}
+
+func (c *scope) assignment(ctx context.Context, s *Store, name string) (assignment, error) {
+	frame := jdwpclient.FrameInfo{Frame: c.frame.Frame, Location: c.frame.Location}
+	out := assignment{thread: c.frame.Thread, frame: &frame}
+	switch c.name {
+	case ScopeArguments, ScopeLocals:
+		out.target = func(j *jdbg.JDbg) jdbg.Target { return j.LocalTarget(frame, name) }
+	case ScopeThis:
+		out.target = func(j *jdbg.JDbg) jdbg.Target {
+			return j.FieldTarget(j.EvaluateInFrame(frame, "this"), name)
+		}
+	case ScopeStatic:
+		sig, err := s.types.signature(ctx, jdwpclient.ReferenceTypeID(c.frame.Location.Class))
+		if err != nil {
+			return assignment{}, err
+		}
+		out.target = func(j *jdbg.JDbg) jdbg.Target { return j.StaticTarget(j.Type(sig).(*jdbg.Class), name) }
+	default:
+		return assignment{}, fmt.Errorf("Unknown scope '%v'", c.name)
+	}
+	return out, nil
+}
+
+func (c *object) assignment(ctx context.Context, s *Store, name string) (assignment, error) {
+	return assignment{
+		thread: c.thread,
+		target: func(j *jdbg.JDbg) jdbg.Target { return j.FieldTarget(j.Object(c.object), name) },
+	}, nil
+}
+
+func (c *array) assignment(ctx context.Context, s *Store, name string) (assignment, error) {
+	index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "["), "]"))
+	if err != nil || index < c.first || index >= c.first+c.length {
+		return assignment{}, fmt.Errorf("Array has no element '%v'", name)
+	}
+	return assignment{
+		thread: c.thread,
+		target: func(j *jdbg.JDbg) jdbg.Target { return j.ElementTarget(j.Object(c.array), index) },
+	}, nil
+}
@@ -0,0 +1,263 @@
+package variables
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strconv"
+	"sync"
+)
+
+// Formatter presents the objects of a class as a summary and logical
+// children, such as the elements of a list, instead of as their fields.
+// Formatters may call methods of the objects on the thread of j.
+type Formatter interface {
+	// Format returns the summary of the object.
+	Format(j *jdbg.JDbg, object jdbg.Value) Summary
+	// Children returns count logical children of the object, starting at the
+	// child with the index start.
+	Children(j *jdbg.JDbg, object jdbg.Value, start, count int) []Child
+}
+
+// Summary is the presentation of an object by a Formatter.
+type Summary struct {
+	Value string // The text shown for the object.
+	// Children is the number of logical children of the object. An object
+	// without logical children shows its fields when expanded, unless Leaf is
+	// set.
+	Children int
+	Leaf     bool // The object cannot be expanded.
+}
+
+// Child is a logical child of an object.
+type Child struct {
+	Name  string
+	Value jdbg.Value
+}
+
+// Formatters is a registry of formatters keyed by class signature, such as
+// "Ljava/util/Map;". The formatter of an object is the formatter registered
+// for its class, for its nearest superclass, or for the first interface
+// implemented by them.
+type Formatters struct {
+	mutex       sync.RWMutex
+	bySignature map[string]Formatter
+}
+
+// NewFormatters returns a registry holding the built-in formatters for
+// collections, lists, sets, maps, Optional, boxed primitives, BigDecimal,
+// BigInteger, enums, records and the java.time types.
+func NewFormatters() *Formatters {
+	f := &Formatters{bySignature: map[string]Formatter{}}
+	f.Register("Ljava/util/Collection;", collection{})
+	f.Register("Ljava/util/Map;", mapFormatter{})
+	f.Register("Ljava/util/Optional;", optional{})
+	for _, sig := range []string{
+		"Ljava/lang/Boolean;", "Ljava/lang/Byte;", "Ljava/lang/Character;", "Ljava/lang/Short;",
+		"Ljava/lang/Integer;", "Ljava/lang/Long;", "Ljava/lang/Float;", "Ljava/lang/Double;",
+	} {
+		f.Register(sig, boxed{})
+	}
+	for _, sig := range []string{
+		"Ljava/math/BigDecimal;", "Ljava/math/BigInteger;",
+		"Ljava/time/Duration;", "Ljava/time/Instant;", "Ljava/time/LocalDate;",
+		"Ljava/time/LocalDateTime;", "Ljava/time/LocalTime;", "Ljava/time/MonthDay;",
+		"Ljava/time/OffsetDateTime;", "Ljava/time/OffsetTime;", "Ljava/time/Period;",
+		"Ljava/time/Year;", "Ljava/time/YearMonth;", "Ljava/time/ZoneId;",
+		"Ljava/time/ZonedDateTime;",
+	} {
+		f.Register(sig, ToString)
+	}
+	f.Register("Ljava/lang/Enum;", enum{})
+	f.Register("Ljava/lang/Record;", record{})
+	return f
+}
+
+// Register sets the formatter of the class or interface with the signature,
+// replacing any formatter already registered for it. A nil formatter
+// removes the registration.
+func (f *Formatters) Register(signature string, formatter Formatter) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if formatter == nil {
+		delete(f.bySignature, signature)
+		return
+	}
+	f.bySignature[signature] = formatter
+}
+
+// Lookup returns the formatter registered for the signature, or nil.
+func (f *Formatters) Lookup(signature string) Formatter {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.bySignature[signature]
+}
+
+// formatter returns the formatter for the objects of the class ty, or nil if
+// the objects show their fields. Superclasses take precedence over
+// interfaces.
+func (s *Store) formatter(ctx context.Context, ty jdwpclient.ReferenceTypeID) (Formatter, error) {
+	interfaces := []jdwpclient.ReferenceTypeID{}
+	var err error
+	for c := ty; c != 0; c, err = s.types.super(ctx, c) {
+		sig, err := s.types.signature(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if f := s.formatters.Lookup(sig); f != nil {
+			return f, nil
+		}
+		implemented, err := s.types.implemented(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		interfaces = append(interfaces, implemented...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := map[jdwpclient.ReferenceTypeID]bool{}
+	for len(interfaces) > 0 {
+		i := interfaces[0]
+		interfaces = interfaces[1:]
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		sig, err := s.types.signature(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		if f := s.formatters.Lookup(sig); f != nil {
+			return f, nil
+		}
+		super, err := s.types.implemented(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		interfaces = append(interfaces, super...)
+	}
+	return nil, nil
+}
+
+// ToString is a formatter that shows the result of the object's toString()
+// method, and cannot be expanded.
+var ToString Formatter = toString{}
+
+type toString struct{}
+
+func (toString) Format(j *jdbg.JDbg, object jdbg.Value) Summary {
+	return Summary{Value: j.ToString(object), Leaf: true}
+}
+
+func (toString) Children(*jdbg.JDbg, jdbg.Value, int, int) []Child { return nil }
+
+// collection shows the elements of a java.util.Collection, such as a List or
+// a Set.
+type collection struct{}
+
+func (collection) Format(j *jdbg.JDbg, object jdbg.Value) Summary {
+	size := object.Call("size").Get().(int)
+	return Summary{Value: fmt.Sprintf("size = %d", size), Children: size, Leaf: size == 0}
+}
+
+func (collection) Children(j *jdbg.JDbg, object jdbg.Value, start, count int) []Child {
+	elements := elements(object.Call("toArray"), start, count)
+	out := make([]Child, len(elements))
+	for i, e := range elements {
+		out[i] = Child{Name: fmt.Sprintf("[%d]", start+i), Value: e}
+	}
+	return out
+}
+
+// mapFormatter shows the entries of a java.util.Map, as children named by
+// their keys.
+type mapFormatter struct{}
+
+func (mapFormatter) Format(j *jdbg.JDbg, object jdbg.Value) Summary {
+	size := object.Call("size").Get().(int)
+	return Summary{Value: fmt.Sprintf("size = %d", size), Children: size, Leaf: size == 0}
+}
+
+func (mapFormatter) Children(j *jdbg.JDbg, object jdbg.Value, start, count int) []Child {
+	entries := elements(object.Call("entrySet").Call("toArray"), start, count)
+	out := make([]Child, len(entries))
+	for i, e := range entries {
+		out[i] = Child{Name: display(j, e.Call("getKey")), Value: e.Call("getValue")}
+	}
+	return out
+}
+
+// elements returns count elements of the array starting at start, or fewer
+// if the array is shorter.
+func elements(array jdbg.Value, start, count int) []jdbg.Value {
+	length := array.ArrayLength()
+	if start >= length {
+		return nil
+	}
+	if start+count > length {
+		count = length - start
+	}
+	return array.ArrayValues(start, count)
+}
+
+// optional shows the value of a java.util.Optional.
+type optional struct{}
+
+func (optional) Format(j *jdbg.JDbg, object jdbg.Value) Summary {
+	if !object.Call("isPresent").Get().(bool) {
+		return Summary{Value: "Optional.empty", Leaf: true}
+	}
+	return Summary{Value: "Optional[" + display(j, object.Call("get")) + "]", Children: 1}
+}
+
+func (optional) Children(j *jdbg.JDbg, object jdbg.Value, start, count int) []Child {
+	if start > 0 {
+		return nil
+	}
+	return []Child{{Name: "value", Value: object.Call("get")}}
+}
+
+// boxed shows the primitive value held by a boxed primitive.
+type boxed struct{}
+
+func (boxed) Format(j *jdbg.JDbg, object jdbg.Value) Summary {
+	return Summary{Value: display(j, object.Field("value")), Leaf: true}
+}
+
+func (boxed) Children(*jdbg.JDbg, jdbg.Value, int, int) []Child { return nil }
+
+// enum shows the name of an enum constant, and its fields when expanded.
+type enum struct{}
+
+func (enum) Format(j *jdbg.JDbg, object jdbg.Value) Summary {
+	return Summary{Value: j.ToString(object.Field("name"))}
+}
+
+func (enum) Children(*jdbg.JDbg, jdbg.Value, int, int) []Child { return nil }
+
+// record shows a record as its toString() does, such as "Point[x=1, y=2]",
+// and its components when expanded.
+type record struct{}
+
+func (record) Format(j *jdbg.JDbg, object jdbg.Value) Summary {
+	return Summary{Value: j.ToString(object)}
+}
+
+func (record) Children(*jdbg.JDbg, jdbg.Value, int, int) []Child { return nil }
+
+// display returns the value as shown in a summary: strings and characters
+// are quoted, and other objects are shown by their toString() method.
+func display(j *jdbg.JDbg, v jdbg.Value) string {
+	if v.IsNull() {
+		return "null"
+	}
+	switch val := v.Get().(type) {
+	case string:
+		return strconv.Quote(val)
+	case jdwpclient.Char:
+		return strconv.QuoteRune(rune(uint16(val)))
+	}
+	return j.ToString(v)
+}
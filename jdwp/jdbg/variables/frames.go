@@ -0,0 +1,232 @@
+package variables
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sort"
+)
+
+// StackFrame is a frame of the call stack of a suspended thread.
+type StackFrame struct {
+	Reference int // Identifies the frame in Scopes.
+	Thread    jdwpclient.ThreadID
+	Frame     jdwpclient.FrameID
+	Location  jdwpclient.Location
+	Class     string // Fully qualified name of the declaring class.
+	Method    string
+	Line      int // 1-based source line, or -1 if it is not known.
+}
+
+// Name returns the name of the frame, such as "Main.run".
+func (f StackFrame) Name() string {
+	return simpleName(f.Class) + "." + f.Method
+}
+
+// StackTrace returns count frames of the suspended thread, starting at the
+// frame start, and the total number of frames of the thread. If count is
+// zero, all the frames from start are returned.
+func (s *Store) StackTrace(ctx context.Context, thread jdwpclient.ThreadID, start, count int) ([]StackFrame, int, error) {
+	infos, err := s.conn.GetFrames(ctx, thread, 0, -1)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(infos)
+	infos = page(infos, start, count)
+
+	out := make([]StackFrame, len(infos))
+	for i, info := range infos {
+		f := StackFrame{
+			Thread:   thread,
+			Frame:    info.Frame,
+			Location: info.Location,
+			Method:   "<unknown>",
+			Line:     s.types.line(ctx, info.Location),
+		}
+		sig, err := s.types.signature(ctx, jdwpclient.ReferenceTypeID(info.Location.Class))
+		if err != nil {
+			return nil, 0, err
+		}
+		f.Class = typeName(sig)
+		if m, err := s.method(ctx, info.Location); err == nil {
+			f.Method = m.Name
+		}
+		f.Reference = s.reference(key{kind: "frame", a: uint64(thread), b: uint64(info.Frame)},
+			func() interface{} { return f })
+		out[i] = f
+	}
+	return out, total, nil
+}
+
+// Frame returns the stack frame with the reference.
+func (s *Store) Frame(ref int) (StackFrame, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f, ok := s.refs[ref].(StackFrame)
+	if !ok {
+		return StackFrame{}, fmt.Errorf("Invalid frame reference %d", ref)
+	}
+	return f, nil
+}
+
+// Scopes returns the non-empty scopes of the stack frame with the reference.
+func (s *Store) Scopes(ctx context.Context, ref int) ([]Scope, error) {
+	f, err := s.Frame(ref)
+	if err != nil {
+		return nil, err
+	}
+	out := []Scope{}
+	add := func(name string) {
+		out = append(out, Scope{
+			Name: name,
+			Reference: s.reference(key{kind: "scope", a: uint64(ref), name: name},
+				func() interface{} { return &scope{frame: f, name: name} }),
+		})
+	}
+
+	args, locals, err := s.frameVariables(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 {
+		add(ScopeArguments)
+	}
+	if len(locals) > 0 {
+		add(ScopeLocals)
+	}
+	if this, err := s.conn.GetThisObject(ctx, f.Thread, f.Frame); err == nil && this.Object != 0 {
+		add(ScopeThis)
+	}
+	fields, err := s.types.declaredFields(ctx, jdwpclient.ReferenceTypeID(f.Location.Class))
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		if field.ModBits.Static() {
+			add(ScopeStatic)
+			break
+		}
+	}
+	return out, nil
+}
+
+// method returns the method executing at the location.
+func (s *Store) method(ctx context.Context, l jdwpclient.Location) (jdwpclient.Method, error) {
+	methods, err := s.types.declaredMethods(ctx, jdwpclient.ReferenceTypeID(l.Class))
+	if err != nil {
+		return jdwpclient.Method{}, err
+	}
+	m := methods.FindByID(l.Method)
+	if m == nil {
+		return jdwpclient.Method{}, fmt.Errorf("Method %v not found", l.Method)
+	}
+	return *m, nil
+}
+
+// frameVariables returns the arguments of the frame's method and the local
+// variables that are live at the frame's location, sorted by slot. Frames of
+// methods without variable information have no variables.
+func (s *Store) frameVariables(ctx context.Context, f StackFrame) (args, locals []jdwpclient.FrameVariable, err error) {
+	table, err := s.types.variableTable(ctx, f.Location)
+	switch err {
+	case nil:
+	case jdwpclient.ErrAbsentInformation, jdwpclient.ErrNativeMethod:
+		return nil, nil, nil
+	default:
+		return nil, nil, err
+	}
+	for _, v := range table.Slots {
+		if v.Name == "this" {
+			continue
+		}
+		switch {
+		case v.Slot < table.ArgCount:
+			args = append(args, v)
+		case v.CodeIndex <= f.Location.Location && f.Location.Location < v.CodeIndex+uint64(v.Length):
+			locals = append(locals, v)
+		}
+	}
+	sort.Slice(args, func(i, j int) bool { return args[i].Slot < args[j].Slot })
+	sort.Slice(locals, func(i, j int) bool { return locals[i].Slot < locals[j].Slot })
+	return args, locals, nil
+}
+
+// scope is the container of the variables of a scope of a frame.
+type scope struct {
+	frame StackFrame
+	name  string
+}
+
+func (c *scope) variables(ctx context.Context, s *Store, start, count int) ([]Variable, error) {
+	switch c.name {
+	case ScopeArguments, ScopeLocals:
+		args, locals, err := s.frameVariables(ctx, c.frame)
+		if err != nil {
+			return nil, err
+		}
+		slots := locals
+		if c.name == ScopeArguments {
+			slots = args
+		}
+		slots = page(slots, start, count)
+		reqs := make([]jdwpclient.VariableRequest, len(slots))
+		for i, v := range slots {
+			reqs[i] = jdwpclient.VariableRequest{Index: v.Slot, Tag: v.Signature[0]}
+		}
+		values, err := s.conn.GetValues(ctx, c.frame.Thread, c.frame.Frame, reqs)
+		if err != nil {
+			return nil, err
+		}
+		children := make([]child, len(slots))
+		for i, v := range slots {
+			children[i] = child{v.Name, v.Signature, values[i]}
+		}
+		return s.variables(ctx, c.frame.Thread, nil, children)
+
+	case ScopeThis:
+		this, err := s.conn.GetThisObject(ctx, c.frame.Thread, c.frame.Frame)
+		if err != nil {
+			return nil, err
+		}
+		return s.fields(ctx, c.frame.Thread, this.Object, start, count)
+
+	case ScopeStatic:
+		ty := jdwpclient.ReferenceTypeID(c.frame.Location.Class)
+		fields, err := s.types.declaredFields(ctx, ty)
+		if err != nil {
+			return nil, err
+		}
+		statics := jdwpclient.Fields{}
+		for _, f := range fields {
+			if f.ModBits.Static() {
+				statics = append(statics, f)
+			}
+		}
+		statics = page(statics, start, count)
+		ids := make([]jdwpclient.FieldID, len(statics))
+		for i, f := range statics {
+			ids[i] = f.ID
+		}
+		values, err := s.conn.GetStaticFieldValues(ctx, ty, ids...)
+		if err != nil {
+			return nil, err
+		}
+		children := make([]child, len(statics))
+		for i, f := range statics {
+			children[i] = child{f.Name, f.Signature, values[i]}
+		}
+		return s.variables(ctx, c.frame.Thread, nil, children)
+	}
+	return nil, fmt.Errorf("Unknown scope '%v'", c.name)
+}
+
+// page returns count elements of l starting at start, or all the elements
+// from start if count is zero.
+func page[T any](l []T, start, count int) []T {
+	start = max(0, min(start, len(l)))
+	l = l[start:]
+	if count > 0 && count < len(l) {
+		l = l[:count]
+	}
+	return l
+}
@@ -0,0 +1,178 @@
+package variables
+
+import (
+	"context"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+	"sync"
+)
+
+// types caches the metadata of the classes and methods of the VM.
+type types struct {
+	conn *jdwpclient.Connection
+
+	mutex      sync.Mutex
+	signatures map[jdwpclient.ReferenceTypeID]string
+	supers     map[jdwpclient.ReferenceTypeID]jdwpclient.ReferenceTypeID
+	interfaces map[jdwpclient.ReferenceTypeID][]jdwpclient.ReferenceTypeID
+	fields     map[jdwpclient.ReferenceTypeID]jdwpclient.Fields
+	methods    map[jdwpclient.ReferenceTypeID]jdwpclient.Methods
+	variables  map[methodKey]jdwpclient.VariableTable
+	lines      map[methodKey]jdwpclient.LineTable
+}
+
+// methodKey identifies a method. Method IDs are only unique within their
+// class.
+type methodKey struct {
+	class  jdwpclient.ClassID
+	method jdwpclient.MethodID
+}
+
+func newTypes(conn *jdwpclient.Connection) *types {
+	t := &types{conn: conn}
+	t.reset()
+	return t
+}
+
+// reset clears the cache, as classes may be redefined while the VM runs.
+func (t *types) reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.signatures = map[jdwpclient.ReferenceTypeID]string{}
+	t.supers = map[jdwpclient.ReferenceTypeID]jdwpclient.ReferenceTypeID{}
+	t.interfaces = map[jdwpclient.ReferenceTypeID][]jdwpclient.ReferenceTypeID{}
+	t.fields = map[jdwpclient.ReferenceTypeID]jdwpclient.Fields{}
+	t.methods = map[jdwpclient.ReferenceTypeID]jdwpclient.Methods{}
+	t.variables = map[methodKey]jdwpclient.VariableTable{}
+	t.lines = map[methodKey]jdwpclient.LineTable{}
+}
+
+// cached returns the value of the key in the map m, calling get and caching
+// its result if the key is not in the map. Errors are not cached.
+func cached[K comparable, V any](t *types, m func() map[K]V, k K, get func() (V, error)) (V, error) {
+	t.mutex.Lock()
+	v, ok := m()[k]
+	t.mutex.Unlock()
+	if ok {
+		return v, nil
+	}
+	v, err := get()
+	if err != nil {
+		return v, err
+	}
+	t.mutex.Lock()
+	m()[k] = v
+	t.mutex.Unlock()
+	return v, nil
+}
+
+// signature returns the JNI signature of the type.
+func (t *types) signature(ctx context.Context, ty jdwpclient.ReferenceTypeID) (string, error) {
+	return cached(t, func() map[jdwpclient.ReferenceTypeID]string { return t.signatures }, ty,
+		func() (string, error) { return t.conn.GetTypeSignature(ctx, ty) })
+}
+
+// super returns the superclass of the class, or 0 for java.lang.Object and
+// interfaces.
+func (t *types) super(ctx context.Context, ty jdwpclient.ReferenceTypeID) (jdwpclient.ReferenceTypeID, error) {
+	return cached(t, func() map[jdwpclient.ReferenceTypeID]jdwpclient.ReferenceTypeID { return t.supers }, ty,
+		func() (jdwpclient.ReferenceTypeID, error) {
+			super, err := t.conn.GetSuperClass(ctx, jdwpclient.ClassID(ty))
+			return jdwpclient.ReferenceTypeID(super), err
+		})
+}
+
+// implemented returns the interfaces directly implemented by the class, or
+// the superinterfaces of the interface.
+func (t *types) implemented(ctx context.Context, ty jdwpclient.ReferenceTypeID) ([]jdwpclient.ReferenceTypeID, error) {
+	return cached(t, func() map[jdwpclient.ReferenceTypeID][]jdwpclient.ReferenceTypeID { return t.interfaces }, ty,
+		func() ([]jdwpclient.ReferenceTypeID, error) {
+			ids, err := t.conn.GetImplemented(ctx, ty)
+			out := make([]jdwpclient.ReferenceTypeID, len(ids))
+			for i, id := range ids {
+				out[i] = jdwpclient.ReferenceTypeID(id)
+			}
+			return out, err
+		})
+}
+
+// declaredFields returns the fields declared by the type.
+func (t *types) declaredFields(ctx context.Context, ty jdwpclient.ReferenceTypeID) (jdwpclient.Fields, error) {
+	return cached(t, func() map[jdwpclient.ReferenceTypeID]jdwpclient.Fields { return t.fields }, ty,
+		func() (jdwpclient.Fields, error) { return t.conn.GetFields(ctx, ty) })
+}
+
+// declaredMethods returns the methods declared by the type.
+func (t *types) declaredMethods(ctx context.Context, ty jdwpclient.ReferenceTypeID) (jdwpclient.Methods, error) {
+	return cached(t, func() map[jdwpclient.ReferenceTypeID]jdwpclient.Methods { return t.methods }, ty,
+		func() (jdwpclient.Methods, error) { return t.conn.GetMethods(ctx, ty) })
+}
+
+// variableTable returns the local variables of the method.
+func (t *types) variableTable(ctx context.Context, l jdwpclient.Location) (jdwpclient.VariableTable, error) {
+	return cached(t, func() map[methodKey]jdwpclient.VariableTable { return t.variables }, methodKey{l.Class, l.Method},
+		func() (jdwpclient.VariableTable, error) {
+			return t.conn.VariableTable(ctx, jdwpclient.ReferenceTypeID(l.Class), l.Method)
+		})
+}
+
+// line returns the source line of the location, or -1 if it is not known.
+func (t *types) line(ctx context.Context, l jdwpclient.Location) int {
+	table, err := cached(t, func() map[methodKey]jdwpclient.LineTable { return t.lines }, methodKey{l.Class, l.Method},
+		func() (jdwpclient.LineTable, error) {
+			return t.conn.LineTable(ctx, jdwpclient.ReferenceTypeID(l.Class), l.Method)
+		})
+	if err != nil {
+		return -1
+	}
+	return table.LineOf(l.Location)
+}
+
+// objectSignature returns the JNI signature of the object's type, and the
+// type.
+func (t *types) objectSignature(ctx context.Context, object jdwpclient.ObjectID) (string, jdwpclient.ReferenceTypeID, error) {
+	ty, err := t.conn.GetObjectType(ctx, object)
+	if err != nil {
+		return "", 0, err
+	}
+	sig, err := t.signature(ctx, ty.Type)
+	return sig, ty.Type, err
+}
+
+// typeName returns the Java name of the type with the JNI signature, such as
+// "int", "java.lang.String" or "int[][]".
+func typeName(sig string) string {
+	dims := 0
+	for dims < len(sig) && sig[dims] == '[' {
+		dims++
+	}
+	name := sig[dims:]
+	switch name {
+	case "Z":
+		name = "boolean"
+	case "B":
+		name = "byte"
+	case "C":
+		name = "char"
+	case "S":
+		name = "short"
+	case "I":
+		name = "int"
+	case "J":
+		name = "long"
+	case "F":
+		name = "float"
+	case "D":
+		name = "double"
+	case "V":
+		name = "void"
+	default:
+		name = strings.Replace(strings.TrimSuffix(strings.TrimPrefix(name, "L"), ";"), "/", ".", -1)
+	}
+	return name + strings.Repeat("[]", dims)
+}
+
+// simpleName returns the name of the class without its package.
+func simpleName(name string) string {
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
@@ -0,0 +1,377 @@
+package variables
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strconv"
+	"strings"
+)
+
+// child is a named value of a container, before it is presented as a
+// variable.
+type child struct {
+	name  string
+	sig   string // Signature of the declared type.
+	value jdwpclient.Value
+}
+
+// pending is a variable holding an object that is presented by a formatter.
+type pending struct {
+	index     int
+	object    jdwpclient.ObjectID
+	formatter Formatter
+}
+
+// variables presents the children as variables. Objects with a formatter
+// are formatted with j, or with a new JDbg on the thread if j is nil. Objects
+// that fail to format show their fields.
+func (s *Store) variables(ctx context.Context, thread jdwpclient.ThreadID, j *jdbg.JDbg, children []child) ([]Variable, error) {
+	out := make([]Variable, len(children))
+	formatted := []pending{}
+	for i, c := range children {
+		v, f, err := s.variable(ctx, thread, c)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+		if f != nil {
+			formatted = append(formatted, pending{i, v.object, f})
+		}
+	}
+	if len(formatted) == 0 {
+		return out, nil
+	}
+
+	format := func(j *jdbg.JDbg) error {
+		for _, p := range formatted {
+			s.format(j, thread, &out[p.index], p.object, p.formatter)
+		}
+		return nil
+	}
+	if j != nil {
+		format(j)
+		return out, nil
+	}
+	if err := jdbg.Do(ctx, s.conn, thread, format); err != nil {
+		log.Debug().Err(err).Msg("Failed to format variables")
+		for _, p := range formatted {
+			out[p.index].Reference = s.fieldsReference(thread, p.object)
+		}
+	}
+	return out, nil
+}
+
+// format presents the variable holding the object with the formatter.
+func (s *Store) format(j *jdbg.JDbg, thread jdwpclient.ThreadID, v *Variable, object jdwpclient.ObjectID, f Formatter) {
+	var summary Summary
+	err := jdbg.Try(func() error {
+		summary = f.Format(j, j.Object(object))
+		return nil
+	})
+	switch {
+	case err != nil:
+		log.Debug().Err(err).Str("type", v.Type).Msg("Failed to format object")
+		v.Reference = s.fieldsReference(thread, object)
+	case summary.Leaf:
+		v.Value = summary.Value
+	case summary.Children > 0:
+		v.Value = summary.Value
+		v.Indexed = summary.Children
+		v.Reference = s.reference(key{kind: "logical", a: uint64(object)},
+			func() interface{} {
+				return &logical{object: object, thread: thread, formatter: f, length: summary.Children}
+			})
+	default:
+		v.Value = summary.Value
+		v.Reference = s.fieldsReference(thread, object)
+	}
+}
+
+// variable returns the child as a variable, and the formatter of the child's
+// object, if any. Objects without a formatter and arrays get a reference to
+// their children.
+func (s *Store) variable(ctx context.Context, thread jdwpclient.ThreadID, c child) (Variable, Formatter, error) {
+	out := Variable{Name: c.name, Type: typeName(c.sig)}
+	if text, ok := primitive(c.value); ok {
+		out.Value = text
+		return out, nil, nil
+	}
+	o, ok := c.value.(jdwpclient.Object)
+	if !ok || o.ID() == 0 {
+		out.Value = "null"
+		return out, nil, nil
+	}
+
+	id := o.ID()
+	out.object = id
+	sig, ty, err := s.types.objectSignature(ctx, id)
+	if err != nil {
+		return out, nil, err
+	}
+	out.Type = typeName(sig)
+
+	switch {
+	case strings.HasPrefix(sig, "["):
+		length, err := s.conn.GetArrayLength(ctx, jdwpclient.ArrayID(id))
+		if err != nil {
+			return out, nil, err
+		}
+		elem := typeName(sig[1:])
+		i := strings.IndexByte(elem, '[')
+		if i < 0 {
+			i = len(elem)
+		}
+		out.Value = fmt.Sprintf("%v[%d]", elem[:i], length) + elem[i:]
+		out.Indexed = length
+		if length > 0 {
+			out.Reference = s.reference(key{kind: "array", a: uint64(id)},
+				func() interface{} {
+					return &array{array: jdwpclient.ArrayID(id), thread: thread, sig: sig, length: length}
+				})
+		}
+		return out, nil, nil
+
+	case sig == "Ljava/lang/String;":
+		str, err := s.conn.GetString(ctx, jdwpclient.StringID(id))
+		if err != nil {
+			return out, nil, err
+		}
+		out.Value = strconv.Quote(str)
+		out.Reference = s.fieldsReference(thread, id)
+		return out, nil, nil
+	}
+
+	out.Value = fmt.Sprintf("%v@%x", simpleName(out.Type), uint64(id))
+	f, err := s.formatter(ctx, ty)
+	if err != nil {
+		return out, nil, err
+	}
+	if f == nil {
+		out.Reference = s.fieldsReference(thread, id)
+	}
+	return out, f, nil
+}
+
+// primitive returns the value of a primitive type as text, with characters
+// quoted, or false if the value is not of a primitive type.
+func primitive(v jdwpclient.Value) (string, bool) {
+	if c, ok := v.(jdwpclient.Char); ok {
+		return strconv.QuoteRune(rune(uint16(c))), true
+	}
+	return jdbg.PrimitiveString(v)
+}
+
+// fieldsReference returns the reference to the fields of the object.
+func (s *Store) fieldsReference(thread jdwpclient.ThreadID, id jdwpclient.ObjectID) int {
+	return s.reference(key{kind: "object", a: uint64(id)},
+		func() interface{} { return &object{object: id, thread: thread} })
+}
+
+// fields returns the instance fields of the object, starting with the fields
+// declared by the object's class followed by the fields of its superclasses.
+func (s *Store) fields(ctx context.Context, thread jdwpclient.ThreadID, object jdwpclient.ObjectID, start, count int) ([]Variable, error) {
+	_, ty, err := s.types.objectSignature(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	fields := jdwpclient.Fields{}
+	for ; ty != 0; ty, err = s.types.super(ctx, ty) {
+		declared, err := s.types.declaredFields(ctx, ty)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range declared {
+			if !f.ModBits.Static() {
+				fields = append(fields, f)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields = page(fields, start, count)
+	ids := make([]jdwpclient.FieldID, len(fields))
+	for i, f := range fields {
+		ids[i] = f.ID
+	}
+	values, err := s.conn.GetFieldValues(ctx, object, ids...)
+	if err != nil {
+		return nil, err
+	}
+	children := make([]child, len(fields))
+	for i, f := range fields {
+		children[i] = child{f.Name, f.Signature, values[i]}
+	}
+	return s.variables(ctx, thread, nil, children)
+}
+
+// Field returns the field with the name among the children of the object, or
+// of the This or Static scope, with the reference. It returns the fully
+// qualified name of the class declaring the field, and the object holding the
+// field, or 0 for a static field.
+func (s *Store) Field(ctx context.Context, ref int, name string) (class string, instance jdwpclient.ObjectID, err error) {
+	s.mutex.Lock()
+	c := s.refs[ref]
+	s.mutex.Unlock()
+	var ty jdwpclient.ReferenceTypeID
+	static := false
+	switch c := c.(type) {
+	case *object:
+		instance = c.object
+	case *scope:
+		switch c.name {
+		case ScopeThis:
+			this, err := s.conn.GetThisObject(ctx, c.frame.Thread, c.frame.Frame)
+			if err != nil {
+				return "", 0, err
+			}
+			instance = this.Object
+		case ScopeStatic:
+			ty, static = jdwpclient.ReferenceTypeID(c.frame.Location.Class), true
+		}
+	}
+	if instance != 0 {
+		if _, ty, err = s.types.objectSignature(ctx, instance); err != nil {
+			return "", 0, err
+		}
+	}
+	if ty == 0 {
+		return "", 0, fmt.Errorf("'%v' of reference %d is not a field", name, ref)
+	}
+
+	// The Static scope only lists the fields declared by the class.
+	for ; ty != 0; ty, err = s.types.super(ctx, ty) {
+		declared, err := s.types.declaredFields(ctx, ty)
+		if err != nil {
+			return "", 0, err
+		}
+		if f := declared.FindByName(name); f != nil && f.ModBits.Static() == static {
+			sig, err := s.types.signature(ctx, ty)
+			if err != nil {
+				return "", 0, err
+			}
+			return typeName(sig), instance, nil
+		}
+		if static {
+			break
+		}
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return "", 0, fmt.Errorf("Reference %d has no field '%v'", ref, name)
+}
+
+// object is the container of the fields of an object.
+type object struct {
+	object jdwpclient.ObjectID
+	thread jdwpclient.ThreadID
+}
+
+func (c *object) variables(ctx context.Context, s *Store, start, count int) ([]Variable, error) {
+	return s.fields(ctx, c.thread, c.object, start, count)
+}
+
+// array is the container of the elements of an array, or of a range of
+// length elements of the array starting at first.
+type array struct {
+	array  jdwpclient.ArrayID
+	thread jdwpclient.ThreadID
+	sig    string // Signature of the array type.
+	first  int
+	length int
+}
+
+func (c *array) variables(ctx context.Context, s *Store, start, count int) ([]Variable, error) {
+	if count == 0 && start == 0 && c.length > PageSize {
+		return s.ranges("range", uint64(c.array), c.first, c.length, typeName(c.sig),
+			func(first, length int) container {
+				return &array{array: c.array, thread: c.thread, sig: c.sig, first: first, length: length}
+			}), nil
+	}
+	start, count = clamp(start, count, c.length)
+	if count == 0 {
+		return []Variable{}, nil
+	}
+	values, err := s.conn.GetArrayValues(ctx, c.array, c.first+start, count)
+	if err != nil {
+		return nil, err
+	}
+	children := make([]child, len(values))
+	for i, v := range values {
+		children[i] = child{fmt.Sprintf("[%d]", c.first+start+i), c.sig[1:], v}
+	}
+	return s.variables(ctx, c.thread, nil, children)
+}
+
+// logical is the container of the logical children of an object presented
+// by a formatter, or of a range of length children starting at first.
+type logical struct {
+	object    jdwpclient.ObjectID
+	thread    jdwpclient.ThreadID
+	formatter Formatter
+	first     int
+	length    int
+}
+
+func (c *logical) variables(ctx context.Context, s *Store, start, count int) ([]Variable, error) {
+	if count == 0 && start == 0 && c.length > PageSize {
+		return s.ranges("logical range", uint64(c.object), c.first, c.length, "",
+			func(first, length int) container {
+				return &logical{object: c.object, thread: c.thread, formatter: c.formatter, first: first, length: length}
+			}), nil
+	}
+	start, count = clamp(start, count, c.length)
+	var out []Variable
+	err := jdbg.Do(ctx, s.conn, c.thread, func(j *jdbg.JDbg) error {
+		logical := c.formatter.Children(j, j.Object(c.object), c.first+start, count)
+		children := make([]child, len(logical))
+		for i, l := range logical {
+			children[i] = child{l.Name, l.Value.Type().Signature(), l.Value.Raw()}
+		}
+		var err error
+		out, err = s.variables(ctx, c.thread, j, children)
+		return err
+	})
+	return out, err
+}
+
+// clamp limits the range of count elements starting at start to length
+// elements. A zero count selects all the elements from start.
+func clamp(start, count, length int) (int, int) {
+	start = max(0, min(start, length))
+	if count == 0 || start+count > length {
+		count = length - start
+	}
+	return start, count
+}
+
+// ranges splits the length children starting at first into ranges of
+// PageSize children, or of a power of PageSize children for large
+// containers, so that no range has more than PageSize children. sub returns
+// the container of a range.
+func (s *Store) ranges(kind string, id uint64, first, length int, ty string, sub func(first, length int) container) []Variable {
+	size := PageSize
+	for size*PageSize < length {
+		size *= PageSize
+	}
+	out := []Variable{}
+	for offset := 0; offset < length; offset += size {
+		n := size
+		if offset+n > length {
+			n = length - offset
+		}
+		start := first + offset
+		out = append(out, Variable{
+			Name:    fmt.Sprintf("[%d..%d]", start, start+n-1),
+			Type:    ty,
+			Indexed: n,
+			Reference: s.reference(key{kind: kind, a: id, b: uint64(start), name: strconv.Itoa(n)},
+				func() interface{} { return sub(start, n) }),
+		})
+	}
+	return out
+}
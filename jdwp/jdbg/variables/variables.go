@@ -0,0 +1,132 @@
+// Package variables presents the stack frames of suspended threads as a tree
+// of scopes and variables, as shown by a debugger UI.
+//
+// Frames, scopes and expandable values are identified by integer references
+// handed out by a Store. A reference is stable while the VM stays suspended:
+// the same frame, scope or object always gets the same reference. The
+// children of a reference are only fetched from the VM when they are
+// requested.
+package variables
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"sapelkinav/javadap/utils"
+	"sync"
+)
+
+var log, _ = utils.GetComponentLogger("jdwp", "variables")
+
+// PageSize is the maximum number of array elements returned for an array
+// that is expanded without a range. Larger arrays are split into ranges of
+// elements, which are expanded separately.
+const PageSize = 100
+
+// Variable is a named value of a scope, object or array.
+type Variable struct {
+	Name  string
+	Value string // The value as text.
+	Type  string // The name of the value's type, such as "int" or "java.lang.String".
+	// Reference identifies the children of the value, or is zero if the
+	// value has no children.
+	Reference int
+	// Indexed is the number of elements of an array, or of logical children
+	// of an object presented by a Formatter.
+	Indexed int
+
+	object jdwpclient.ObjectID // The object held by the variable, if any.
+}
+
+// Scope is a group of variables of a stack frame.
+type Scope struct {
+	Name      string // One of the Scope... constants.
+	Reference int
+}
+
+// The names of the scopes of a stack frame.
+const (
+	ScopeArguments = "Arguments"
+	ScopeLocals    = "Locals"
+	ScopeThis      = "This"
+	ScopeStatic    = "Static"
+)
+
+// key identifies a referenced frame, scope or value.
+type key struct {
+	kind string
+	a, b uint64
+	name string
+}
+
+// container is a referenced item with child variables.
+type container interface {
+	// variables returns count child variables starting at the index start,
+	// or all the children if count is zero.
+	variables(ctx context.Context, s *Store, start, count int) ([]Variable, error)
+}
+
+// Store hands out references to the frames, scopes and values of a suspended
+// VM, and fetches their children on demand.
+type Store struct {
+	conn       *jdwpclient.Connection
+	types      *types
+	formatters *Formatters
+
+	mutex sync.Mutex
+	next  int
+	keys  map[key]int
+	refs  map[int]interface{} // StackFrame or container, by reference.
+}
+
+// NewStore returns a store for the VM of conn, presenting objects with the
+// built-in formatters.
+func NewStore(conn *jdwpclient.Connection) *Store {
+	s := &Store{conn: conn, types: newTypes(conn), formatters: NewFormatters(), next: 1}
+	s.Reset()
+	return s
+}
+
+// Formatters returns the registry of the formatters used to present objects.
+// Formatters registered while the VM is suspended apply to the variables
+// listed after the next Reset.
+func (s *Store) Formatters() *Formatters { return s.formatters }
+
+// Reset invalidates all the references handed out by the store. Reset must be
+// called when the VM resumes.
+func (s *Store) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = map[key]int{}
+	s.refs = map[int]interface{}{}
+	s.types.reset()
+}
+
+// Variables returns the children of the scope or value with the reference.
+// If count is not zero, only count children starting at the index start are
+// returned. Arrays larger than PageSize that are expanded without a count
+// return ranges of elements as children.
+func (s *Store) Variables(ctx context.Context, ref int, start, count int) ([]Variable, error) {
+	s.mutex.Lock()
+	c, ok := s.refs[ref].(container)
+	s.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Invalid variables reference %d", ref)
+	}
+	return c.variables(ctx, s, start, count)
+}
+
+// reference returns the reference for the key, creating it for the value
+// returned by f if the key has no reference yet.
+func (s *Store) reference(k key, f func() interface{}) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if ref, ok := s.keys[k]; ok {
+		return ref
+	}
+	ref := s.next
+	s.next++
+	s.keys[k] = ref
+	s.refs[ref] = f()
+	return ref
+}
@@ -0,0 +1,132 @@
+package jdbg_tests_test
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdbg/variables"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestSetVariable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm := fakevm.New()
+	defer vm.Close()
+	integer := vm.Class("java.lang.Integer")
+	value := integer.AddField("value", "I", jdwpclient.ModPrivate|jdwpclient.ModFinal)
+	seven := vm.NewObject(integer)
+	seven.Fields[value.ID] = 7
+	integer.AddMethod("valueOf", "(I)Ljava/lang/Integer;", jdwpclient.ModPublic|jdwpclient.ModStatic).Invoke =
+		func(*fakevm.Thread, *fakevm.Object, []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+			return seven.ID, nil
+		}
+	order := vm.AddClass("com.example.Order", vm.Class("java.lang.Object"))
+	name := order.AddField("name", "Ljava/lang/String;", jdwpclient.ModPrivate)
+	retries := order.AddField("retries", "I", jdwpclient.ModPrivate)
+	limit := order.AddField("LIMIT", "I", jdwpclient.ModPublic|jdwpclient.ModStatic)
+	limit.Value = 10
+	order.AddField("MAX", "I", jdwpclient.ModPublic|jdwpclient.ModStatic|jdwpclient.ModFinal).Value = 99
+	run := order.AddMethod("run", "(ILjava/lang/Integer;)V", jdwpclient.ModPublic, 10, 11)
+	run.AddArgument("count", "I", 1)
+	run.AddArgument("boxed", "Ljava/lang/Integer;", 2)
+	run.AddVariable("items", "[I", 3)
+	run.AddVariable("next", "Lcom/example/Order;", 4)
+	run.AddVariable("small", "S", 5)
+
+	this := vm.NewObject(order)
+	this.Fields[name.ID] = vm.NewString("first").Value()
+	this.Fields[retries.ID] = 2
+	items := vm.NewArray(vm.ArrayClass("I"), 1, 2, 3)
+	thread := vm.AddThread("main")
+	frame := vm.Push(thread, run, 11)
+	frame.This = this
+	frame.Locals[1] = 5
+	frame.Locals[2] = jdwpclient.ObjectID(0)
+	frame.Locals[3] = items.Value()
+	frame.Locals[4] = jdwpclient.ObjectID(0)
+	frame.Locals[5] = int16(0)
+
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	store := variables.NewStore(conn)
+	frames, _, err := store.StackTrace(ctx, thread.ThreadID(), 0, 1)
+	if err != nil {
+		t.Fatalf("StackTrace failed: %v", err)
+	}
+	scopes, err := store.Scopes(ctx, frames[0].Reference)
+	if err != nil {
+		t.Fatalf("Scopes failed: %v", err)
+	}
+	refs := map[string]int{}
+	for _, s := range scopes {
+		refs[s.Name] = s.Reference
+	}
+	locals, err := store.Variables(ctx, refs[variables.ScopeLocals], 0, 0)
+	if err != nil {
+		t.Fatalf("Variables failed: %v", err)
+	}
+	refs["items"] = locals[0].Reference
+
+	for _, test := range []struct {
+		scope, name, expression string
+		want                    variables.Variable
+	}{
+		{variables.ScopeArguments, "count", "count * 2 + 1", variables.Variable{Name: "count", Value: "11", Type: "int"}},
+		{variables.ScopeArguments, "boxed", "7", variables.Variable{Name: "boxed", Value: "7", Type: "java.lang.Integer"}},
+		{variables.ScopeLocals, "next", "this", variables.Variable{Name: "next", Value: fmt.Sprintf("Order@%x", uint64(this.ID)), Type: "com.example.Order", Reference: 1}},
+		{variables.ScopeLocals, "next", "null", variables.Variable{Name: "next", Value: "null", Type: "com.example.Order"}},
+		{variables.ScopeLocals, "small", "-300", variables.Variable{Name: "small", Value: "-300", Type: "short"}},
+		{"items", "[1]", "'a'", variables.Variable{Name: "[1]", Value: "97", Type: "int"}},
+		{variables.ScopeThis, "name", `"second"`, variables.Variable{Name: "name", Value: `"second"`, Type: "java.lang.String", Reference: 1}},
+		{variables.ScopeThis, "retries", "retries + 1", variables.Variable{Name: "retries", Value: "3", Type: "int"}},
+		{variables.ScopeStatic, "LIMIT", "LIMIT * 2", variables.Variable{Name: "LIMIT", Value: "20", Type: "int"}},
+	} {
+		got, err := store.SetVariable(ctx, refs[test.scope], test.name, test.expression)
+		if err != nil {
+			t.Errorf("Setting %v to %v failed: %v", test.name, test.expression, err)
+			continue
+		}
+		w := test.want
+		if got.Name != w.Name || got.Value != w.Value || got.Type != w.Type || (w.Reference != 0) != (got.Reference != 0) {
+			t.Errorf("Setting %v to %v returned %+v, want %+v", test.name, test.expression, got, w)
+		}
+	}
+
+	checkVariables(ctx, t, store, "Arguments", refs[variables.ScopeArguments], 0, 0,
+		variables.Variable{Name: "count", Value: "11", Type: "int"},
+		variables.Variable{Name: "boxed", Value: "7", Type: "java.lang.Integer"})
+	checkVariables(ctx, t, store, "items", refs["items"], 0, 0,
+		variables.Variable{Name: "[0]", Value: "1", Type: "int"},
+		variables.Variable{Name: "[1]", Value: "97", Type: "int"},
+		variables.Variable{Name: "[2]", Value: "3", Type: "int"})
+	if got := this.Fields[retries.ID]; got != 3 {
+		t.Errorf("retries is %v, want 3", got)
+	}
+	if got := limit.Value; got != 20 {
+		t.Errorf("LIMIT is %v, want 20", got)
+	}
+
+	for _, test := range []struct{ scope, name, expression string }{
+		{variables.ScopeArguments, "count", "1L"},
+		{variables.ScopeArguments, "count", "true"},
+		{variables.ScopeArguments, "count", "null"},
+		{variables.ScopeLocals, "small", "count"},
+		{variables.ScopeLocals, "small", "40000"},
+		{variables.ScopeLocals, "next", `"x"`},
+		{variables.ScopeLocals, "missing", "1"},
+		{"items", "[3]", "1"},
+		{variables.ScopeStatic, "MAX", "1"},
+	} {
+		if got, err := store.SetVariable(ctx, refs[test.scope], test.name, test.expression); err == nil {
+			t.Errorf("Setting %v to %v succeeded with %+v, want an error", test.name, test.expression, got)
+		}
+	}
+}
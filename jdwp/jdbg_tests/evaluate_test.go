@@ -0,0 +1,170 @@
+package jdbg_tests_test
+
+import (
+	"context"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm := fakevm.New()
+	defer vm.Close()
+	base := vm.AddClass("com.example.Base", vm.Class("java.lang.Object"))
+	retries := base.AddField("retries", "I", jdwpclient.ModProtected)
+	order := vm.AddClass("com.example.Order", base)
+	total := order.AddField("total", "J", jdwpclient.ModPrivate)
+	next := order.AddField("next", "Lcom/example/Order;", jdwpclient.ModPrivate)
+	limit := base.AddField("LIMIT", "I", jdwpclient.ModPublic|jdwpclient.ModStatic)
+	limit.Value = 10
+	twice := base.AddMethod("twice", "(I)I", jdwpclient.ModPublic|jdwpclient.ModStatic)
+	twice.Invoke = func(_ *fakevm.Thread, _ *fakevm.Object, args []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+		return 2 * args[0].(int), nil
+	}
+	size := order.AddMethod("size", "()I", jdwpclient.ModPublic)
+	size.Invoke = func(*fakevm.Thread, *fakevm.Object, []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+		return 3, nil
+	}
+	intName, stringName := vm.NewString("int").Value(), vm.NewString("String").Value()
+	describeInt := order.AddMethod("describe", "(I)Ljava/lang/String;", jdwpclient.ModPublic)
+	describeInt.Invoke = func(*fakevm.Thread, *fakevm.Object, []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+		return intName, nil
+	}
+	describeString := order.AddMethod("describe", "(Ljava/lang/String;)Ljava/lang/String;", jdwpclient.ModPublic)
+	describeString.Invoke = func(*fakevm.Thread, *fakevm.Object, []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+		return stringName, nil
+	}
+	run := order.AddMethod("run", "(ID)V", jdwpclient.ModPublic, 10, 11)
+	run.AddVariable("count", "I", 1)
+	run.AddVariable("ratio", "D", 2)
+	run.AddVariable("items", "[I", 3)
+
+	this := vm.NewObject(order)
+	this.Fields[retries.ID] = 0
+	this.Fields[total.ID] = int64(250)
+	this.Fields[next.ID] = jdwpclient.ObjectID(0)
+	thread := vm.AddThread("main")
+	frame := vm.Push(thread, run, 11)
+	frame.This = this
+	frame.Locals[1] = 5
+	frame.Locals[2] = 0.5
+	frame.Locals[3] = vm.NewArray(vm.ArrayClass("I"), 1, 2, 3).Value()
+
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+
+	for _, test := range []struct {
+		expr string
+		want interface{}
+	}{
+		{"count", 5},
+		{"-count", -5},
+		{"ratio", 0.5},
+		{"total", int64(250)},
+		{"this.total", int64(250)},
+		{"retries", 0},
+		{"items.length", 3},
+		{"count > 3 && this.retries == 0", true},
+		{"count >= 5 || ratio < 0", true},
+		{"!(count == 5)", false},
+		{"ratio * 2", 1.0},
+		{"count / 2", 2},
+		{"count % 3", 2},
+		{"-count / 2", -2},
+		{"count / 0", "error"},
+		{"7L * count", int64(35)},
+		{"count + 0.5f", float32(5.5)},
+		{"ratio / 0 > 1e300", true},
+		{"'a' + 1", 98},
+		{"2147483647 + 1", -2147483648},
+		{"(int) ratio", 0},
+		{"(long) count", int64(5)},
+		{"(char) 97", jdwpclient.Char('a')},
+		{"(byte) 200 == -56", true},
+		{"(double) count / 2", 2.5},
+		{"(String) this", "error"},
+		{"(Base) this == this", true},
+		{"\"n=\" + count + ratio", "n=50.5"},
+		{"1 + 2 + \"!\" + 'c'", "3!c"},
+		{"\"\" + 1e10 + true + null", "1.0E10truenull"},
+		{"items[1]", 2},
+		{"items[count - 3] * 10", 30},
+		{"items[count]", "error"},
+		{"ratio[0]", "error"},
+		{"this instanceof Base", true},
+		{"this instanceof com.example.Order", true},
+		{"next instanceof Order", false},
+		{"count instanceof Order", "error"},
+		{"size()", 3},
+		{"this.size() > 2 && retries == 0", true},
+		{"twice(count)", 10},
+		{"Base.twice(3)", 6},
+		{"com.example.Base.twice(count) == 10", true},
+		{"LIMIT", 10},
+		{"Base.LIMIT > count ? 1 : 2", 1},
+		{"count > LIMIT ? \"big\" : \"small\"", "small"},
+		{"describe(count)", "int"},
+		{"describe(\"x\")", "String"},
+		{"next.size()", "error"},
+		{"Base", "error"},
+		{"com.example.Missing.twice(1)", "error"},
+		{"missing()", "error"},
+		{"count < 5.5", true},
+		{"count == 'a'", false},
+		{"0x10 == 16", true},
+		{"2147483647", 2147483647},
+		{"3000000000", "error"},
+		{"2147483648", "error"},
+		{"-2147483648", -2147483648},
+		{"-(2147483648)", "error"},
+		{"-2147483649", "error"},
+		{"0xFFFFFFFF", -1},
+		{"0x80000000", -2147483648},
+		{"037777777777", -1},
+		{"0b11111111111111111111111111111111", -1},
+		{"0x100000000", "error"},
+		{"-9223372036854775808L", int64(-9223372036854775808)},
+		{"9223372036854775808L", "error"},
+		{"0xFFFFFFFFFFFFFFFFL", int64(-1)},
+		{"1_000L > 999", true},
+		{"next == null", true},
+		{"this != null && this == this", true},
+		{"missing", "error"},
+		{"count && true", "error"},
+		{"(count > 1", "error"},
+	} {
+		var got interface{}
+		err := jdbg.Do(ctx, conn, thread.ThreadID(), func(j *jdbg.JDbg) error {
+			got = j.Evaluate(test.expr).Get()
+			return nil
+		})
+		switch {
+		case test.want == "error":
+			if err == nil {
+				t.Errorf("Evaluate(%q) returned %v, expected an error", test.expr, got)
+			}
+		case err != nil:
+			t.Errorf("Evaluate(%q) failed: %v", test.expr, err)
+		case got != test.want:
+			t.Errorf("Evaluate(%q) returned %v (%T), want %v (%T)", test.expr, got, got, test.want, test.want)
+		}
+	}
+
+	err = jdbg.Do(ctx, conn, thread.ThreadID(), func(j *jdbg.JDbg) error {
+		j.Evaluate("count >")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "end of expression") {
+		t.Errorf("Expected parse error at end of expression, got: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package jdbg_tests_test
+
+import (
+	"context"
+	"errors"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestJDbgOnFakeVM(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm := fakevm.New()
+	defer vm.Close()
+	calc := vm.AddClass("com.example.Calc", vm.Class("java.lang.Object"))
+	add := calc.AddMethod("add", "(II)I", jdwpclient.ModPublic|jdwpclient.ModStatic)
+	add.Invoke = func(_ *fakevm.Thread, _ *fakevm.Object, args []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+		return args[0].(int) + args[1].(int), nil
+	}
+	greeting := calc.AddField("greeting", "Ljava/lang/String;", jdwpclient.ModPublic|jdwpclient.ModStatic)
+	greeting.Value = vm.NewString("hello").Value()
+	thread := vm.AddThread("main")
+
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+
+	err = jdbg.Do(ctx, conn, thread.ThreadID(), func(j *jdbg.JDbg) error {
+		class := j.Class("com.example.Calc")
+		if got := class.Call("add", 2, 3).Get(); got != 5 {
+			t.Errorf("add(2, 3) returned %v, want 5", got)
+		}
+		if got := class.Field("greeting").Get(); got != "hello" {
+			t.Errorf("greeting is %v, want hello", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("JDbg.Do failed: %v", err)
+	}
+}
+
+func TestJDbgRequire(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm := fakevm.New()
+	defer vm.Close()
+	vm.Capabilities.CanPopFrames = false
+	thread := vm.AddThread("main")
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+
+	err = jdbg.Do(ctx, conn, thread.ThreadID(), func(j *jdbg.JDbg) error {
+		j.Require(jdwpclient.RedefineClasses)
+		j.Require(jdwpclient.PopFrames)
+		t.Error("Require did not terminate Do")
+		return nil
+	})
+	if !errors.Is(err, jdwpclient.ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported, got: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package jdbg_tests_test
+
+import (
+	"context"
+	"fmt"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdbg"
+	"sapelkinav/javadap/jdwp/jdbg/variables"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+// money formats com.example.Money objects from their cents field.
+type money struct{}
+
+func (money) Format(j *jdbg.JDbg, object jdbg.Value) variables.Summary {
+	cents := object.Field("cents").Get().(int64)
+	return variables.Summary{Value: fmt.Sprintf("$%d", cents/100), Leaf: true}
+}
+
+func (money) Children(*jdbg.JDbg, jdbg.Value, int, int) []variables.Child { return nil }
+
+// broken fails to format any object.
+type broken struct{}
+
+func (broken) Format(j *jdbg.JDbg, object jdbg.Value) variables.Summary {
+	object.Call("missing")
+	return variables.Summary{}
+}
+
+func (broken) Children(*jdbg.JDbg, jdbg.Value, int, int) []variables.Child { return nil }
+
+func TestFormatters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm := fakevm.New()
+	defer vm.Close()
+	object := vm.Class("java.lang.Object")
+	integer := vm.Class("java.lang.Integer")
+	value := integer.AddField("value", "I", jdwpclient.ModPrivate|jdwpclient.ModFinal)
+	box := func(i int) jdwpclient.Value {
+		o := vm.NewObject(integer)
+		o.Fields[value.ID] = i
+		return o.ID
+	}
+	returns := func(c *fakevm.Class, name, sig string, result jdwpclient.Value) {
+		c.AddMethod(name, sig, jdwpclient.ModPublic).Invoke =
+			func(*fakevm.Thread, *fakevm.Object, []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+				return result, nil
+			}
+	}
+	objects := vm.ArrayClass("Ljava/lang/Object;")
+
+	collection := vm.AddInterface("java.util.Collection")
+	list := vm.AddInterface("java.util.List")
+	list.Interfaces = []*fakevm.Class{collection}
+	set := vm.AddInterface("java.util.Set")
+	set.Interfaces = []*fakevm.Class{collection}
+	arrayList := vm.AddClass("java.util.ArrayList", object)
+	arrayList.Interfaces = []*fakevm.Class{list}
+	returns(arrayList, "size", "()I", 3)
+	returns(arrayList, "toArray", "()[Ljava/lang/Object;", vm.NewArray(objects, box(1), box(2), box(3)).Value())
+
+	mapInterface := vm.AddInterface("java.util.Map")
+	hashMap := vm.AddClass("java.util.HashMap", object)
+	hashMap.Interfaces = []*fakevm.Class{mapInterface}
+	node := vm.AddClass("java.util.HashMap$Node", object)
+	entrySet := vm.AddClass("java.util.HashMap$EntrySet", object)
+	entrySet.Interfaces = []*fakevm.Class{set}
+	entries := []jdwpclient.Value{}
+	keys, values := map[*fakevm.Object]jdwpclient.Value{}, map[*fakevm.Object]jdwpclient.Value{}
+	for i, k := range []string{"one", "two"} {
+		e := vm.NewObject(node)
+		keys[e], values[e] = vm.NewString(k).Value(), box(i+1)
+		entries = append(entries, e.ID)
+	}
+	node.AddMethod("getKey", "()Ljava/lang/Object;", jdwpclient.ModPublic).Invoke =
+		func(_ *fakevm.Thread, this *fakevm.Object, _ []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+			return keys[this], nil
+		}
+	node.AddMethod("getValue", "()Ljava/lang/Object;", jdwpclient.ModPublic).Invoke =
+		func(_ *fakevm.Thread, this *fakevm.Object, _ []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+			return values[this], nil
+		}
+	returns(hashMap, "size", "()I", 2)
+	returns(entrySet, "toArray", "()[Ljava/lang/Object;", vm.NewArray(objects, entries...).Value())
+	returns(hashMap, "entrySet", "()Ljava/util/Set;", vm.NewObject(entrySet).ID)
+
+	optional := vm.AddClass("java.util.Optional", object)
+	returns(optional, "isPresent", "()Z", true)
+	returns(optional, "get", "()Ljava/lang/Object;", vm.NewString("x").Value())
+
+	enum := vm.AddClass("java.lang.Enum", object)
+	name := enum.AddField("name", "Ljava/lang/String;", jdwpclient.ModPrivate|jdwpclient.ModFinal)
+	color := vm.AddClass("com.example.Color", enum)
+	red := vm.NewObject(color)
+	red.Fields[name.ID] = vm.NewString("RED").Value()
+
+	decimal := vm.AddClass("java.math.BigDecimal", vm.Class("java.lang.Number"))
+	returns(decimal, "toString", "()Ljava/lang/String;", vm.NewString("3.14").Value())
+
+	moneyClass := vm.AddClass("com.example.Money", object)
+	cents := moneyClass.AddField("cents", "J", jdwpclient.ModPrivate)
+	five := vm.NewObject(moneyClass)
+	five.Fields[cents.ID] = int64(500)
+	brokenClass := vm.AddClass("com.example.Broken", object)
+	brokenClass.AddField("state", "I", jdwpclient.ModPrivate)
+	brokenObject := vm.NewObject(brokenClass)
+	brokenObject.Fields[brokenClass.Fields[0].ID] = 7
+
+	main := vm.AddClass("com.example.Main", object)
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic|jdwpclient.ModStatic, 1)
+	locals := []jdwpclient.Value{
+		vm.NewObject(arrayList).ID, vm.NewObject(hashMap).ID, vm.NewObject(optional).ID,
+		red.ID, vm.NewObject(decimal).ID, five.ID, brokenObject.ID,
+	}
+	for i, l := range []struct{ name, sig string }{
+		{"list", "Ljava/util/List;"}, {"map", "Ljava/util/Map;"}, {"optional", "Ljava/util/Optional;"},
+		{"color", "Lcom/example/Color;"}, {"decimal", "Ljava/math/BigDecimal;"},
+		{"money", "Lcom/example/Money;"}, {"broken", "Lcom/example/Broken;"},
+	} {
+		run.AddVariable(l.name, l.sig, i)
+	}
+	thread := vm.AddThread("main")
+	frame := vm.Push(thread, run, 1)
+	for i, l := range locals {
+		frame.Locals[i] = l
+	}
+
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	store := variables.NewStore(conn)
+	store.Formatters().Register("Lcom/example/Money;", money{})
+	store.Formatters().Register("Lcom/example/Broken;", broken{})
+
+	frames, _, err := store.StackTrace(ctx, thread.ThreadID(), 0, 1)
+	if err != nil {
+		t.Fatalf("StackTrace failed: %v", err)
+	}
+	scopes, err := store.Scopes(ctx, frames[0].Reference)
+	if err != nil {
+		t.Fatalf("Scopes failed: %v", err)
+	}
+	got := checkVariables(ctx, t, store, "Locals", scopes[0].Reference, 0, 0,
+		variables.Variable{Name: "list", Value: "size = 3", Type: "java.util.ArrayList", Reference: 1, Indexed: 3},
+		variables.Variable{Name: "map", Value: "size = 2", Type: "java.util.HashMap", Reference: 1, Indexed: 2},
+		variables.Variable{Name: "optional", Value: `Optional["x"]`, Type: "java.util.Optional", Reference: 1, Indexed: 1},
+		variables.Variable{Name: "color", Value: "RED", Type: "com.example.Color", Reference: 1},
+		variables.Variable{Name: "decimal", Value: "3.14", Type: "java.math.BigDecimal"},
+		variables.Variable{Name: "money", Value: "$5", Type: "com.example.Money"},
+		variables.Variable{Name: "broken", Value: fmt.Sprintf("Broken@%x", uint64(brokenObject.ID)), Type: "com.example.Broken", Reference: 1})
+
+	checkVariables(ctx, t, store, "list", got[0].Reference, 0, 0,
+		variables.Variable{Name: "[0]", Value: "1", Type: "java.lang.Integer"},
+		variables.Variable{Name: "[1]", Value: "2", Type: "java.lang.Integer"},
+		variables.Variable{Name: "[2]", Value: "3", Type: "java.lang.Integer"})
+	checkVariables(ctx, t, store, "list page", got[0].Reference, 1, 1,
+		variables.Variable{Name: "[1]", Value: "2", Type: "java.lang.Integer"})
+	checkVariables(ctx, t, store, "map", got[1].Reference, 0, 0,
+		variables.Variable{Name: `"one"`, Value: "1", Type: "java.lang.Integer"},
+		variables.Variable{Name: `"two"`, Value: "2", Type: "java.lang.Integer"})
+	checkVariables(ctx, t, store, "optional", got[2].Reference, 0, 0,
+		variables.Variable{Name: "value", Value: `"x"`, Type: "java.lang.String", Reference: 1})
+	checkVariables(ctx, t, store, "color", got[3].Reference, 0, 0,
+		variables.Variable{Name: "name", Value: `"RED"`, Type: "java.lang.String", Reference: 1})
+	checkVariables(ctx, t, store, "broken", got[6].Reference, 0, 0,
+		variables.Variable{Name: "state", Value: "7", Type: "int"})
+
+	// Removing a registration shows the fields of the objects again.
+	store.Formatters().Register("Lcom/example/Money;", nil)
+	store.Reset()
+	frames, _, _ = store.StackTrace(ctx, thread.ThreadID(), 0, 1)
+	scopes, _ = store.Scopes(ctx, frames[0].Reference)
+	got, err = store.Variables(ctx, scopes[0].Reference, 5, 1)
+	if err != nil {
+		t.Fatalf("Variables failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Value != fmt.Sprintf("Money@%x", uint64(five.ID)) || got[0].Reference == 0 {
+		t.Errorf("money is %+v without its formatter, want its fields", got)
+	}
+}
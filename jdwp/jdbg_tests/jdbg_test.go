@@ -16,9 +16,7 @@ package jdbg_tests_test
 
 import (
 	"context"
-	"fmt"
 	"io"
-	"net"
 	"os"
 	"path/filepath"
 	"sapelkinav/javadap/jdwp/jdbg"
@@ -26,12 +24,10 @@ import (
 	"sapelkinav/javadap/launcher"
 	"sapelkinav/javadap/utils"
 	"testing"
-	"time"
 )
 
 const (
 	TEST_LOG_DIR = "./.test_logs"
-	JDWP_PORT    = 5007 // Different port from other tests
 	JAR_PATH     = "../../daphelloworld/build/libs/daphelloworld-0.0.1-SNAPSHOT.jar"
 )
 
@@ -58,25 +54,19 @@ func setupJDbgTest(t *testing.T) *TestSetup {
 		t.Skipf("JAR file not found at %s, skipping test", jarPath)
 	}
 
-	javaLauncher := launcher.NewJavaLauncher(jarPath, JDWP_PORT)
+	// The agent picks a free port, so that test packages can run in parallel.
+	javaLauncher := launcher.New(launcher.Config{Jar: jarPath, Suspend: true})
 	if err := javaLauncher.Start(); err != nil {
 		t.Fatalf("Failed to launch Java process: %v", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	var socket io.ReadWriteCloser
-	for i := 0; i < 10; i++ {
-		if socket, err = net.Dial("tcp", fmt.Sprintf("localhost:%d", JDWP_PORT)); err == nil {
-			break
-		}
-		time.Sleep(time.Second)
-	}
-
-	if socket == nil {
+	socket, err := javaLauncher.Connect(ctx)
+	if err != nil {
 		javaLauncher.Stop()
 		cancel()
-		t.Fatalf("Failed to connect to JDWP socket after 10 attempts: %v", err)
+		t.Fatalf("Failed to connect to JDWP: %v", err)
 	}
 
 	connection, err := jdwpclient.Open(ctx, socket)
@@ -88,7 +78,7 @@ func setupJDbgTest(t *testing.T) *TestSetup {
 	}
 
 	// Get a thread for testing
-	threads, err := connection.GetAllThreads()
+	threads, err := connection.GetAllThreads(ctx)
 	if err != nil {
 		socket.Close()
 		javaLauncher.Stop()
@@ -129,7 +119,7 @@ func TestJDbgDo(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		// Basic test - just verify we can create a JDbg instance
 		if j.Connection() != setup.connection {
 			t.Error("Connection() should return the provided connection")
@@ -146,7 +136,7 @@ func TestJDbgBasicTypes(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		// Test basic object types
 		objType := j.ObjectType()
 		if objType == nil {
@@ -213,7 +203,7 @@ func TestJDbgTypeBySignature(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		testCases := []struct {
 			name      string
 			signature string
@@ -251,7 +241,7 @@ func TestJDbgClassByName(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		testCases := []string{
 			"java.lang.Object",
 			"java.lang.String",
@@ -282,7 +272,7 @@ func TestJDbgAllClasses(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		classes := j.AllClasses()
 		if len(classes) == 0 {
 			t.Error("AllClasses() should return at least one class")
@@ -323,7 +313,7 @@ func TestJDbgArrayOf(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		// Test array of different types
 		intType := j.IntType()
 		intArrayType := j.ArrayOf(intType)
@@ -351,7 +341,7 @@ func TestJDbgString(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		testStrings := []string{
 			"Hello, World!",
 			"",
@@ -382,13 +372,13 @@ func TestJDbgThis(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := setup.connection.Suspend(setup.thread)
+	err := setup.connection.Suspend(setup.ctx, setup.thread)
 	if err != nil {
 		t.Fatalf("Failed to suspend thread: %v", err)
 	}
-	defer setup.connection.Resume(setup.thread)
+	defer setup.connection.Resume(setup.ctx, setup.thread)
 
-	err = jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err = jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		// This test may fail if we're in a static context
 		thisVal := j.This()
 		// We don't fail if This() returns nil since it might be a static method
@@ -405,13 +395,13 @@ func TestJDbgGetArgument(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := setup.connection.Suspend(setup.thread)
+	err := setup.connection.Suspend(setup.ctx, setup.thread)
 	if err != nil {
 		t.Fatalf("Failed to suspend thread: %v", err)
 	}
-	defer setup.connection.Resume(setup.thread)
+	defer setup.connection.Resume(setup.ctx, setup.thread)
 
-	err = jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err = jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		// Try to get the first argument (index 0)
 		// This may fail if there are no arguments or if the method is static
 		arg := j.GetArgument("arg0", 0)
@@ -429,7 +419,7 @@ func TestJDbgErrorHandling(t *testing.T) {
 	defer setup.teardown()
 
 	// Test with invalid type signature
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		// This should cause a failure within the Do block
 		jtype := j.Type("InvalidSignure")
 		print(jtype.Signature())
@@ -447,7 +437,7 @@ func TestJDbgTypeIntegration(t *testing.T) {
 	setup := setupJDbgTest(t)
 	defer setup.teardown()
 
-	err := jdbg.Do(setup.connection, setup.thread, func(j *jdbg.JDbg) error {
+	err := jdbg.Do(setup.ctx, setup.connection, setup.thread, func(j *jdbg.JDbg) error {
 		// Get String type through different methods
 		stringBySignature := j.Type("Ljava/lang/String;")
 		stringByName := j.Class("java.lang.String")
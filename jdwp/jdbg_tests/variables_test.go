@@ -0,0 +1,180 @@
+package jdbg_tests_test
+
+import (
+	"context"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdbg/variables"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm := fakevm.New()
+	defer vm.Close()
+	integer := vm.Class("java.lang.Integer")
+	value := integer.AddField("value", "I", jdwpclient.ModPrivate|jdwpclient.ModFinal)
+	base := vm.AddClass("com.example.Base", vm.Class("java.lang.Object"))
+	retries := base.AddField("retries", "I", jdwpclient.ModProtected)
+	order := vm.AddClass("com.example.Order", base)
+	name := order.AddField("name", "Ljava/lang/String;", jdwpclient.ModPrivate)
+	limit := order.AddField("LIMIT", "I", jdwpclient.ModPublic|jdwpclient.ModStatic)
+	limit.Value = 10
+	run := order.AddMethod("run", "(ILjava/lang/Integer;)V", jdwpclient.ModPublic, 10, 11, 12)
+	run.AddArgument("count", "I", 1)
+	run.AddArgument("boxed", "Ljava/lang/Integer;", 2)
+	run.AddVariable("items", "[I", 3)
+	run.AddVariable("next", "Lcom/example/Order;", 4)
+	main := order.AddMethod("main", "([Ljava/lang/String;)V", jdwpclient.ModPublic|jdwpclient.ModStatic, 3)
+
+	this := vm.NewObject(order)
+	this.Fields[retries.ID] = 2
+	this.Fields[name.ID] = vm.NewString("first").Value()
+	boxed := vm.NewObject(integer)
+	boxed.Fields[value.ID] = 42
+	elements := make([]jdwpclient.Value, 250)
+	for i := range elements {
+		elements[i] = i * i
+	}
+	thread := vm.AddThread("main")
+	vm.Push(thread, main, 3)
+	frame := vm.Push(thread, run, 11)
+	frame.This = this
+	frame.Locals[1] = 5
+	frame.Locals[2] = boxed.ID
+	frame.Locals[3] = vm.NewArray(vm.ArrayClass("I"), elements...).Value()
+	frame.Locals[4] = jdwpclient.ObjectID(0)
+
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	store := variables.NewStore(conn)
+
+	frames, total, err := store.StackTrace(ctx, thread.ThreadID(), 0, 1)
+	if err != nil {
+		t.Fatalf("StackTrace failed: %v", err)
+	}
+	if total != 2 || len(frames) != 1 {
+		t.Fatalf("StackTrace returned %d of %d frames, want 1 of 2", len(frames), total)
+	}
+	if got := frames[0]; got.Name() != "Order.run" || got.Class != "com.example.Order" || got.Line != 11 {
+		t.Errorf("Top frame is %v (%v) at line %d, want Order.run (com.example.Order) at line 11",
+			got.Name(), got.Class, got.Line)
+	}
+	again, _, err := store.StackTrace(ctx, thread.ThreadID(), 0, 0)
+	if err != nil {
+		t.Fatalf("StackTrace failed: %v", err)
+	}
+	if len(again) != 2 || again[0].Reference != frames[0].Reference || again[1].Name() != "Order.main" {
+		t.Errorf("Second StackTrace returned %+v, want the same top frame reference and Order.main", again)
+	}
+
+	scopes, err := store.Scopes(ctx, frames[0].Reference)
+	if err != nil {
+		t.Fatalf("Scopes failed: %v", err)
+	}
+	refs := map[string]int{}
+	names := []string{}
+	for _, s := range scopes {
+		refs[s.Name] = s.Reference
+		names = append(names, s.Name)
+	}
+	if len(names) != 4 {
+		t.Fatalf("Scopes are %v, want Arguments, Locals, This and Static", names)
+	}
+
+	check := func(name string, ref, start, count int, want ...variables.Variable) []variables.Variable {
+		t.Helper()
+		return checkVariables(ctx, t, store, name, ref, start, count, want...)
+	}
+
+	check("Arguments", refs[variables.ScopeArguments], 0, 0,
+		variables.Variable{Name: "count", Value: "5", Type: "int"},
+		variables.Variable{Name: "boxed", Value: "42", Type: "java.lang.Integer"})
+
+	locals := check("Locals", refs[variables.ScopeLocals], 0, 0,
+		variables.Variable{Name: "items", Value: "int[250]", Type: "int[]", Reference: 1, Indexed: 250},
+		variables.Variable{Name: "next", Value: "null", Type: "com.example.Order"})
+	ranges := check("items", locals[0].Reference, 0, 0,
+		variables.Variable{Name: "[0..99]", Type: "int[]", Reference: 1, Indexed: 100},
+		variables.Variable{Name: "[100..199]", Type: "int[]", Reference: 1, Indexed: 100},
+		variables.Variable{Name: "[200..249]", Type: "int[]", Reference: 1, Indexed: 50})
+	last, err := store.Variables(ctx, ranges[2].Reference, 0, 0)
+	if err != nil {
+		t.Fatalf("Variables of [200..249] failed: %v", err)
+	}
+	if len(last) != 50 || last[0].Name != "[200]" || last[49].Value != "62001" {
+		t.Errorf("[200..249] has %d variables, first %+v, last %+v", len(last), last[0], last[len(last)-1])
+	}
+	check("[100..199] page", ranges[1].Reference, 10, 2,
+		variables.Variable{Name: "[110]", Value: "12100", Type: "int"},
+		variables.Variable{Name: "[111]", Value: "12321", Type: "int"})
+	check("items page", locals[0].Reference, 248, 5,
+		variables.Variable{Name: "[248]", Value: "61504", Type: "int"},
+		variables.Variable{Name: "[249]", Value: "62001", Type: "int"})
+	check("[100..199] negative start", ranges[1].Reference, -5, 1,
+		variables.Variable{Name: "[100]", Value: "10000", Type: "int"})
+	check("Arguments negative start", refs[variables.ScopeArguments], -1, 1,
+		variables.Variable{Name: "count", Value: "5", Type: "int"})
+
+	check("This", refs[variables.ScopeThis], 0, 0,
+		variables.Variable{Name: "name", Value: `"first"`, Type: "java.lang.String", Reference: 1},
+		variables.Variable{Name: "retries", Value: "2", Type: "int"})
+	check("Static", refs[variables.ScopeStatic], 0, 0,
+		variables.Variable{Name: "LIMIT", Value: "10", Type: "int"})
+
+	if class, instance, err := store.Field(ctx, refs[variables.ScopeThis], "retries"); err != nil ||
+		class != "com.example.Base" || instance != this.ID {
+		t.Errorf("Field retries of This returned %v, %v, %v, want com.example.Base, %v", class, instance, err, this.ID)
+	}
+	if class, instance, err := store.Field(ctx, refs[variables.ScopeStatic], "LIMIT"); err != nil ||
+		class != "com.example.Order" || instance != 0 {
+		t.Errorf("Field LIMIT of Static returned %v, %v, %v, want com.example.Order, 0", class, instance, err)
+	}
+	if _, _, err := store.Field(ctx, refs[variables.ScopeLocals], "items"); err == nil {
+		t.Errorf("Field succeeded for a local variable")
+	}
+
+	// References are stable until the store is reset.
+	locals2, err := store.Variables(ctx, refs[variables.ScopeLocals], 0, 0)
+	if err != nil {
+		t.Fatalf("Variables failed: %v", err)
+	}
+	if locals2[0].Reference != locals[0].Reference {
+		t.Errorf("Reference of items changed from %d to %d", locals[0].Reference, locals2[0].Reference)
+	}
+	store.Reset()
+	if _, err := store.Variables(ctx, locals[0].Reference, 0, 0); err == nil {
+		t.Errorf("Variables succeeded for a reference invalidated by Reset")
+	}
+	if _, err := store.Scopes(ctx, frames[0].Reference); err == nil {
+		t.Errorf("Scopes succeeded for a frame invalidated by Reset")
+	}
+}
+
+// checkVariables checks that the variables of the reference are want,
+// ignoring the values of non-zero references.
+func checkVariables(ctx context.Context, t *testing.T, store *variables.Store, name string, ref, start, count int, want ...variables.Variable) []variables.Variable {
+	t.Helper()
+	got, err := store.Variables(ctx, ref, start, count)
+	if err != nil {
+		t.Fatalf("Variables of %v failed: %v", name, err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%v has %d variables (%+v), want %d", name, len(got), got, len(want))
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if g.Name != w.Name || g.Value != w.Value || g.Type != w.Type || g.Indexed != w.Indexed ||
+			(w.Reference != 0) != (g.Reference != 0) {
+			t.Errorf("%v variable %d is %+v, want %+v", name, i, g, w)
+		}
+	}
+	return got
+}
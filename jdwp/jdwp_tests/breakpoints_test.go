@@ -0,0 +1,64 @@
+package jdwp_tests_test
+
+import (
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestDeferredBreakpointsWithoutReader(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	// More deferred breakpoints than the Changed channel holds.
+	reqs := []debugger.SourceBreakpoint{}
+	lines := []int{}
+	for line := 10; line < 40; line++ {
+		reqs = append(reqs, debugger.SourceBreakpoint{Line: line})
+		lines = append(lines, line)
+	}
+	b := debugger.NewBreakpoints(debugger.NewDispatcher(ctx, conn), debugger.NewIDs())
+	if _, err := b.Set(ctx, "Lib.java", reqs); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	lib := vm.AddClass("Lib", vm.Class("java.lang.Object"))
+	lib.AddMethod("run", "()V", jdwpclient.ModPublic, lines...)
+	thread := vm.AddThread("main")
+	if n, err := vm.PrepareClass(lib, thread); err != nil || n != 1 {
+		t.Fatalf("PrepareClass raised %d events: %v", n, err)
+	}
+	// The dispatcher resumes the thread once the breakpoints are set, even
+	// though nothing reads the changed breakpoints.
+	waitResumed(t, vm, thread)
+	if n := len(vm.Requests(jdwpclient.Breakpoint)); n != len(reqs) {
+		t.Errorf("%d breakpoint requests on the VM, want %d", n, len(reqs))
+	}
+}
+
+func TestBreakpointIDsAreShared(t *testing.T) {
+	ctx, conn, _ := openFakeVM(t)
+
+	events, ids := debugger.NewDispatcher(ctx, conn), debugger.NewIDs()
+	b := debugger.NewBreakpoints(events, ids)
+	e := debugger.NewExceptions(events, ids)
+	w := debugger.NewWatchpoints(events, ids)
+	bps, err := b.Set(ctx, "Main.java", []debugger.SourceBreakpoint{{Line: 10}, {Line: 11}})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	exceptions, err := e.Set(ctx, []debugger.ExceptionBreakpoint{{Uncaught: true}})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	wps, err := w.Set(ctx, []debugger.Watchpoint{{Class: "Main", Field: "count", Modification: true}})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	seen := map[int]bool{}
+	for _, id := range []int{bps[0].ID, bps[1].ID, exceptions[0].ID, wps[0].ID} {
+		if seen[id] {
+			t.Errorf("Breakpoint ID %d is used twice", id)
+		}
+		seen[id] = true
+	}
+}
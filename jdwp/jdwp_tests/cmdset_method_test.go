@@ -0,0 +1,53 @@
+package jdwp_tests_test
+
+import (
+	"testing"
+)
+
+func TestLineTable(t *testing.T) {
+	setup := setupJDWPTest(t)
+	defer setup.teardown()
+
+	class, err := setup.connection.GetClassBySignature(setup.ctx, "Ljava/lang/Thread;")
+	if err != nil {
+		t.Fatalf("GetClassBySignature failed: %v", err)
+	}
+
+	methods, err := setup.connection.GetMethods(setup.ctx, class.TypeID)
+	if err != nil {
+		t.Fatalf("GetMethods failed: %v", err)
+	}
+
+	method := methods.FindBySignature("getName", "()Ljava/lang/String;")
+	if method == nil {
+		t.Fatal("Thread.getName() not found")
+	}
+
+	table, err := setup.connection.LineTable(setup.ctx, class.TypeID, method.ID)
+	if err != nil {
+		t.Fatalf("LineTable failed: %v", err)
+	}
+
+	if len(table.Lines) == 0 {
+		t.Fatal("Line table should not be empty")
+	}
+
+	if table.End < table.Start {
+		t.Errorf("Line table end %d is before start %d", table.End, table.Start)
+	}
+
+	first := table.Lines[0]
+	index, ok := table.Lookup(first.LineNumber)
+	if !ok {
+		t.Fatalf("Lookup of line %d failed", first.LineNumber)
+	}
+	if index > first.CodeIndex {
+		t.Errorf("Lookup of line %d returned %d, expected at most %d", first.LineNumber, index, first.CodeIndex)
+	}
+
+	if line := table.LineOf(first.CodeIndex); line != first.LineNumber {
+		t.Errorf("LineOf(%d) returned %d, expected %d", first.CodeIndex, line, first.LineNumber)
+	}
+
+	t.Logf("Thread.getName() spans code %d-%d over %d lines", table.Start, table.End, len(table.Lines))
+}
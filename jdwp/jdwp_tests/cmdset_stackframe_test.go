@@ -39,7 +39,7 @@ const (
 )
 
 func getThreadAndFrame(t *testing.T, setup *TestSetup) (ThreadID, FrameID) {
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -50,19 +50,19 @@ func getThreadAndFrame(t *testing.T, setup *TestSetup) (ThreadID, FrameID) {
 
 	testThread := threads[0]
 
-	err = setup.connection.Suspend(testThread)
+	err = setup.connection.Suspend(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("Suspend failed: %v", err)
 	}
 
-	frames, err := setup.connection.GetFrames(testThread, 0, 1)
+	frames, err := setup.connection.GetFrames(setup.ctx, testThread, 0, 1)
 	if err != nil {
-		setup.connection.Resume(testThread)
+		setup.connection.Resume(setup.ctx, testThread)
 		t.Fatalf("GetFrames failed: %v", err)
 	}
 
 	if len(frames) == 0 {
-		setup.connection.Resume(testThread)
+		setup.connection.Resume(setup.ctx, testThread)
 		t.Skip("No frames available for stack frame test")
 	}
 
@@ -74,9 +74,9 @@ func TestGetThisObject(t *testing.T) {
 	defer setup.teardown()
 
 	testThread, testFrame := getThreadAndFrame(t, setup)
-	defer setup.connection.Resume(testThread)
+	defer setup.connection.Resume(setup.ctx, testThread)
 
-	thisObject, err := setup.connection.GetThisObject(testThread, testFrame)
+	thisObject, err := setup.connection.GetThisObject(setup.ctx, testThread, testFrame)
 	if err != nil {
 		t.Logf("GetThisObject failed (may be expected for static methods): %v", err)
 		return
@@ -96,7 +96,7 @@ func TestGetValues(t *testing.T) {
 	defer setup.teardown()
 
 	testThread, testFrame := getThreadAndFrame(t, setup)
-	defer setup.connection.Resume(testThread)
+	defer setup.connection.Resume(setup.ctx, testThread)
 
 	testCases := []struct {
 		name  string
@@ -121,7 +121,7 @@ func TestGetValues(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			values, err := setup.connection.GetValues(testThread, testFrame, tc.slots)
+			values, err := setup.connection.GetValues(setup.ctx, testThread, testFrame, tc.slots)
 			if err != nil {
 				t.Logf("GetValues failed for %s (may be expected): %v", tc.name, err)
 				return
@@ -144,7 +144,7 @@ func TestGetValuesWithDifferentTags(t *testing.T) {
 	defer setup.teardown()
 
 	testThread, testFrame := getThreadAndFrame(t, setup)
-	defer setup.connection.Resume(testThread)
+	defer setup.connection.Resume(setup.ctx, testThread)
 
 	tagTests := []struct {
 		name string
@@ -165,7 +165,7 @@ func TestGetValuesWithDifferentTags(t *testing.T) {
 	for _, tagTest := range tagTests {
 		t.Run(tagTest.name, func(t *testing.T) {
 			slots := []VariableRequest{{Index: 0, Tag: tagTest.tag}}
-			values, err := setup.connection.GetValues(testThread, testFrame, slots)
+			values, err := setup.connection.GetValues(setup.ctx, testThread, testFrame, slots)
 			if err != nil {
 				t.Logf("GetValues failed for %s (%s): %v", tagTest.name, tagTest.desc, err)
 				return
@@ -183,10 +183,10 @@ func TestSetValues(t *testing.T) {
 	defer setup.teardown()
 
 	testThread, testFrame := getThreadAndFrame(t, setup)
-	defer setup.connection.Resume(testThread)
+	defer setup.connection.Resume(setup.ctx, testThread)
 
 	getSlots := []VariableRequest{{Index: 0, Tag: uint8(TagInt)}} // Try to get an integer
-	originalValues, err := setup.connection.GetValues(testThread, testFrame, getSlots)
+	originalValues, err := setup.connection.GetValues(setup.ctx, testThread, testFrame, getSlots)
 	if err != nil {
 		t.Logf("GetValues failed, skipping SetValues test: %v", err)
 		return
@@ -200,13 +200,13 @@ func TestSetValues(t *testing.T) {
 		{Index: 0, Value: int32(42)}, // Set integer value
 	}
 
-	err = setup.connection.SetValues(testThread, testFrame, setSlots)
+	err = setup.connection.SetValues(setup.ctx, testThread, testFrame, setSlots)
 	if err != nil {
 		t.Logf("SetValues failed (may be expected for non-writable variables): %v", err)
 		return
 	}
 
-	newValues, err := setup.connection.GetValues(testThread, testFrame, getSlots)
+	newValues, err := setup.connection.GetValues(setup.ctx, testThread, testFrame, getSlots)
 	if err != nil {
 		t.Fatalf("GetValues after SetValues failed: %v", err)
 	}
@@ -223,7 +223,7 @@ func TestSetValuesWithDifferentTypes(t *testing.T) {
 	defer setup.teardown()
 
 	testThread, testFrame := getThreadAndFrame(t, setup)
-	defer setup.connection.Resume(testThread)
+	defer setup.connection.Resume(setup.ctx, testThread)
 
 	testCases := []struct {
 		name  string
@@ -252,7 +252,7 @@ func TestSetValuesWithDifferentTypes(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := setup.connection.SetValues(testThread, testFrame, tc.slots)
+			err := setup.connection.SetValues(setup.ctx, testThread, testFrame, tc.slots)
 			if err != nil {
 				t.Logf("SetValues failed for %s (may be expected): %v", tc.name, err)
 				return
@@ -268,9 +268,9 @@ func TestStackFrameIntegration(t *testing.T) {
 	defer setup.teardown()
 
 	testThread, testFrame := getThreadAndFrame(t, setup)
-	defer setup.connection.Resume(testThread)
+	defer setup.connection.Resume(setup.ctx, testThread)
 
-	thisObject, err := setup.connection.GetThisObject(testThread, testFrame)
+	thisObject, err := setup.connection.GetThisObject(setup.ctx, testThread, testFrame)
 	if err != nil {
 		t.Logf("GetThisObject failed (may be static method): %v", err)
 	} else {
@@ -282,7 +282,7 @@ func TestStackFrameIntegration(t *testing.T) {
 		{Index: 1, Tag: uint8(TagInt)},    // Integer
 	}
 
-	values, err := setup.connection.GetValues(testThread, testFrame, getSlots)
+	values, err := setup.connection.GetValues(setup.ctx, testThread, testFrame, getSlots)
 	if err != nil {
 		t.Logf("GetValues failed: %v", err)
 	} else {
@@ -297,7 +297,7 @@ func TestStackFrameIntegration(t *testing.T) {
 			{Index: 0, Value: values[0]}, // Set back the same value
 		}
 
-		err = setup.connection.SetValues(testThread, testFrame, setSlots)
+		err = setup.connection.SetValues(setup.ctx, testThread, testFrame, setSlots)
 		if err != nil {
 			t.Logf("SetValues failed: %v", err)
 		} else {
@@ -312,7 +312,7 @@ func TestStackFrameErrorHandling(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -325,7 +325,7 @@ func TestStackFrameErrorHandling(t *testing.T) {
 	invalidFrame := FrameID(999999) // Use invalid frame ID
 
 	t.Run("Invalid frame ID", func(t *testing.T) {
-		_, err := setup.connection.GetThisObject(testThread, invalidFrame)
+		_, err := setup.connection.GetThisObject(setup.ctx, testThread, invalidFrame)
 		if err == nil {
 			t.Error("Expected error for invalid frame ID, but got none")
 		} else {
@@ -334,19 +334,19 @@ func TestStackFrameErrorHandling(t *testing.T) {
 	})
 
 	t.Run("Invalid variable slots", func(t *testing.T) {
-		err := setup.connection.Suspend(testThread)
+		err := setup.connection.Suspend(setup.ctx, testThread)
 		if err != nil {
 			t.Fatalf("Suspend failed: %v", err)
 		}
-		defer setup.connection.Resume(testThread)
+		defer setup.connection.Resume(setup.ctx, testThread)
 
-		frames, err := setup.connection.GetFrames(testThread, 0, 1)
+		frames, err := setup.connection.GetFrames(setup.ctx, testThread, 0, 1)
 		if err != nil || len(frames) == 0 {
 			t.Skip("No valid frames for invalid slot test")
 		}
 
 		invalidSlots := []VariableRequest{{Index: 999, Tag: uint8(TagInt)}}
-		_, err = setup.connection.GetValues(testThread, frames[0].Frame, invalidSlots)
+		_, err = setup.connection.GetValues(setup.ctx, testThread, frames[0].Frame, invalidSlots)
 		if err == nil {
 			t.Log("No error for invalid variable slot (may be valid)")
 		} else {
@@ -40,7 +40,7 @@ func TestGetString(t *testing.T) {
 
 	for _, testStr := range testStrings {
 		t.Run("String_"+testStr[:min(len(testStr), 20)], func(t *testing.T) {
-			stringID, err := setup.connection.CreateString(testStr)
+			stringID, err := setup.connection.CreateString(setup.ctx, testStr)
 			if err != nil {
 				t.Fatalf("CreateString failed for '%s': %v", testStr, err)
 			}
@@ -49,7 +49,7 @@ func TestGetString(t *testing.T) {
 				t.Errorf("Expected non-zero StringID for '%s'", testStr)
 			}
 
-			retrievedStr, err := setup.connection.GetString(stringID)
+			retrievedStr, err := setup.connection.GetString(setup.ctx, stringID)
 			if err != nil {
 				t.Fatalf("GetString failed for StringID %d: %v", stringID, err)
 			}
@@ -77,7 +77,7 @@ func TestGetStringWithMultipleStrings(t *testing.T) {
 	}
 
 	for _, testStr := range testStrings {
-		stringID, err := setup.connection.CreateString(testStr)
+		stringID, err := setup.connection.CreateString(setup.ctx, testStr)
 		if err != nil {
 			t.Fatalf("CreateString failed for '%s': %v", testStr, err)
 		}
@@ -86,7 +86,7 @@ func TestGetStringWithMultipleStrings(t *testing.T) {
 	}
 
 	for testStr, stringID := range stringMap {
-		retrievedStr, err := setup.connection.GetString(StringID(stringID))
+		retrievedStr, err := setup.connection.GetString(setup.ctx, StringID(stringID))
 		if err != nil {
 			t.Fatalf("GetString failed for StringID %d: %v", stringID, err)
 		}
@@ -117,12 +117,12 @@ func TestGetStringEdgeCases(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			stringID, err := setup.connection.CreateString(tc.test)
+			stringID, err := setup.connection.CreateString(setup.ctx, tc.test)
 			if err != nil {
 				t.Fatalf("CreateString failed for %s: %v", tc.name, err)
 			}
 
-			retrievedStr, err := setup.connection.GetString(stringID)
+			retrievedStr, err := setup.connection.GetString(setup.ctx, stringID)
 			if err != nil {
 				t.Fatalf("GetString failed for %s (ID %d): %v", tc.name, stringID, err)
 			}
@@ -153,12 +153,12 @@ func TestGetStringUnicodeSupport(t *testing.T) {
 
 	for _, testStr := range unicodeStrings {
 		t.Run("Unicode_"+testStr[:min(len(testStr), 15)], func(t *testing.T) {
-			stringID, err := setup.connection.CreateString(testStr)
+			stringID, err := setup.connection.CreateString(setup.ctx, testStr)
 			if err != nil {
 				t.Fatalf("CreateString failed for unicode string '%s': %v", testStr, err)
 			}
 
-			retrievedStr, err := setup.connection.GetString(stringID)
+			retrievedStr, err := setup.connection.GetString(setup.ctx, stringID)
 			if err != nil {
 				t.Fatalf("GetString failed for unicode StringID %d: %v", stringID, err)
 			}
@@ -182,7 +182,7 @@ func TestStringReferenceIntegration(t *testing.T) {
 	for i := 0; i < numStrings; i++ {
 		testStr := fmt.Sprintf("Integration test string #%d", i)
 
-		stringID, err := setup.connection.CreateString(testStr)
+		stringID, err := setup.connection.CreateString(setup.ctx, testStr)
 		if err != nil {
 			t.Fatalf("CreateString failed for integration test string %d: %v", i, err)
 		}
@@ -192,7 +192,7 @@ func TestStringReferenceIntegration(t *testing.T) {
 	}
 
 	for stringID, expectedStr := range createdStrings {
-		retrievedStr, err := setup.connection.GetString(StringID(stringID))
+		retrievedStr, err := setup.connection.GetString(setup.ctx, StringID(stringID))
 		if err != nil {
 			t.Fatalf("GetString failed for integration test StringID %d: %v", stringID, err)
 		}
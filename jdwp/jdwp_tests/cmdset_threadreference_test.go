@@ -22,7 +22,7 @@ func TestGetThreadName(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -32,7 +32,7 @@ func TestGetThreadName(t *testing.T) {
 	}
 
 	testThread := threads[0]
-	name, err := setup.connection.GetThreadName(testThread)
+	name, err := setup.connection.GetThreadName(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("GetThreadName failed: %v", err)
 	}
@@ -48,7 +48,7 @@ func TestSuspendAndResumeThread(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -59,14 +59,14 @@ func TestSuspendAndResumeThread(t *testing.T) {
 
 	testThread := threads[0]
 
-	err = setup.connection.Suspend(testThread)
+	err = setup.connection.Suspend(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("Suspend failed: %v", err)
 	}
 
 	t.Logf("Successfully suspended thread %d", testThread)
 
-	err = setup.connection.Resume(testThread)
+	err = setup.connection.Resume(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("Resume failed: %v", err)
 	}
@@ -78,7 +78,7 @@ func TestGetThreadStatus(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -88,7 +88,7 @@ func TestGetThreadStatus(t *testing.T) {
 	}
 
 	testThread := threads[0]
-	threadStatus, suspendStatus, err := setup.connection.GetThreadStatus(testThread)
+	threadStatus, suspendStatus, err := setup.connection.GetThreadStatus(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("GetThreadStatus failed: %v", err)
 	}
@@ -100,7 +100,7 @@ func TestGetSuspendCount(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -111,7 +111,7 @@ func TestGetSuspendCount(t *testing.T) {
 
 	testThread := threads[0]
 
-	initialCount, err := setup.connection.GetSuspendCount(testThread)
+	initialCount, err := setup.connection.GetSuspendCount(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("GetSuspendCount failed: %v", err)
 	}
@@ -120,14 +120,14 @@ func TestGetSuspendCount(t *testing.T) {
 		t.Errorf("Suspend count should be non-negative, got %d", initialCount)
 	}
 
-	err = setup.connection.Suspend(testThread)
+	err = setup.connection.Suspend(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("Suspend failed: %v", err)
 	}
 
-	countAfterSuspend, err := setup.connection.GetSuspendCount(testThread)
+	countAfterSuspend, err := setup.connection.GetSuspendCount(setup.ctx, testThread)
 	if err != nil {
-		setup.connection.Resume(testThread)
+		setup.connection.Resume(setup.ctx, testThread)
 		t.Fatalf("GetSuspendCount after suspend failed: %v", err)
 	}
 
@@ -135,12 +135,12 @@ func TestGetSuspendCount(t *testing.T) {
 		t.Errorf("Expected suspend count to increase by 1, got %d -> %d", initialCount, countAfterSuspend)
 	}
 
-	err = setup.connection.Resume(testThread)
+	err = setup.connection.Resume(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("Resume failed: %v", err)
 	}
 
-	countAfterResume, err := setup.connection.GetSuspendCount(testThread)
+	countAfterResume, err := setup.connection.GetSuspendCount(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("GetSuspendCount after resume failed: %v", err)
 	}
@@ -156,7 +156,7 @@ func TestGetFrames(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -167,16 +167,16 @@ func TestGetFrames(t *testing.T) {
 
 	testThread := threads[0]
 
-	err = setup.connection.Suspend(testThread)
+	err = setup.connection.Suspend(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("Suspend failed: %v", err)
 	}
-	defer setup.connection.Resume(testThread)
+	defer setup.connection.Resume(setup.ctx, testThread)
 
-	frames, err := setup.connection.GetFrames(testThread, 0, -1)
+	frames, err := setup.connection.GetFrames(setup.ctx, testThread, 0, -1)
 	if err != nil {
 		t.Logf("GetFrames with count=-1 failed: %v, trying with count=1", err)
-		frames, err = setup.connection.GetFrames(testThread, 0, 1)
+		frames, err = setup.connection.GetFrames(setup.ctx, testThread, 0, 1)
 		if err != nil {
 			t.Fatalf("GetFrames failed: %v", err)
 		}
@@ -193,7 +193,7 @@ func TestGetFramesWithDifferentParameters(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -204,11 +204,11 @@ func TestGetFramesWithDifferentParameters(t *testing.T) {
 
 	testThread := threads[0]
 
-	err = setup.connection.Suspend(testThread)
+	err = setup.connection.Suspend(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("Suspend failed: %v", err)
 	}
-	defer setup.connection.Resume(testThread)
+	defer setup.connection.Resume(setup.ctx, testThread)
 
 	testCases := []struct {
 		name  string
@@ -221,7 +221,7 @@ func TestGetFramesWithDifferentParameters(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			frames, err := setup.connection.GetFrames(testThread, tc.start, tc.count)
+			frames, err := setup.connection.GetFrames(setup.ctx, testThread, tc.start, tc.count)
 			if err != nil {
 				t.Logf("GetFrames failed for %s: %v", tc.name, err)
 				return
@@ -236,7 +236,7 @@ func TestGetFramesWithDifferentParameters(t *testing.T) {
 //	setup := setupJDWPTest(t)
 //	defer setup.teardown()
 //
-//	threads, err := setup.connection.GetAllThreads()
+//	threads, err := setup.connection.GetAllThreads(setup.ctx)
 //	if err != nil {
 //		t.Fatalf("GetAllThreads failed: %v", err)
 //	}
@@ -247,45 +247,45 @@ func TestGetFramesWithDifferentParameters(t *testing.T) {
 //
 //	testThread := threads[0]
 //
-//	name, err := setup.connection.GetThreadName(testThread)
+//	name, err := setup.connection.GetThreadName(setup.ctx, testThread)
 //	if err != nil {
 //		t.Fatalf("GetThreadName failed: %v", err)
 //	}
 //
-//	threadStatus, suspendStatus, err := setup.connection.GetThreadStatus(testThread)
+//	threadStatus, suspendStatus, err := setup.connection.GetThreadStatus(setup.ctx, testThread)
 //	if err != nil {
 //		t.Fatalf("GetThreadStatus failed: %v", err)
 //	}
 //
-//	initialSuspendCount, err := setup.connection.GetSuspendCount(testThread)
+//	initialSuspendCount, err := setup.connection.GetSuspendCount(setup.ctx, testThread)
 //	if err != nil {
 //		t.Fatalf("GetSuspendCount failed: %v", err)
 //	}
 //
-//	err = setup.connection.Suspend(testThread)
+//	err = setup.connection.Suspend(setup.ctx, testThread)
 //	if err != nil {
 //		t.Fatalf("Suspend failed: %v", err)
 //	}
 //
-//	frames, err := setup.connection.GetFrames(testThread, 0, 1)
+//	frames, err := setup.connection.GetFrames(setup.ctx, testThread, 0, 1)
 //	if err != nil {
-//		setup.connection.Resume(testThread)
+//		setup.connection.Resume(setup.ctx, testThread)
 //		t.Logf("GetFrames failed: %v", err)
 //		frames = []jdwpclient.FrameInfo{}
 //	}
 //
-//	newSuspendCount, err := setup.connection.GetSuspendCount(testThread)
+//	newSuspendCount, err := setup.connection.GetSuspendCount(setup.ctx, testThread)
 //	if err != nil {
-//		setup.connection.Resume(testThread)
+//		setup.connection.Resume(setup.ctx, testThread)
 //		t.Fatalf("GetSuspendCount after suspend failed: %v", err)
 //	}
 //
-//	err = setup.connection.Resume(testThread)
+//	err = setup.connection.Resume(setup.ctx, testThread)
 //	if err != nil {
 //		t.Fatalf("Resume failed: %v", err)
 //	}
 //
-//	finalSuspendCount, err := setup.connection.GetSuspendCount(testThread)
+//	finalSuspendCount, err := setup.connection.GetSuspendCount(setup.ctx, testThread)
 //	if err != nil {
 //		t.Fatalf("GetSuspendCount after resume failed: %v", err)
 //	}
@@ -18,19 +18,16 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"path/filepath"
 	"sapelkinav/javadap/jdwp/jdwpclient"
 	"sapelkinav/javadap/launcher"
 	"sapelkinav/javadap/utils"
 	"testing"
-	"time"
 )
 
 const (
 	TEST_LOG_DIR = "./.test_logs"
-	JDWP_PORT    = 5006
 	JAR_PATH     = "../../daphelloworld/build/libs/daphelloworld-0.0.1-SNAPSHOT.jar"
 )
 
@@ -56,25 +53,19 @@ func setupJDWPTest(t *testing.T) *TestSetup {
 		t.Skipf("JAR file not found at %s, skipping test", jarPath)
 	}
 
-	javaLauncher := launcher.NewJavaLauncher(jarPath, JDWP_PORT)
+	// The agent picks a free port, so that test packages can run in parallel.
+	javaLauncher := launcher.New(launcher.Config{Jar: jarPath, Suspend: true})
 	if err := javaLauncher.Start(); err != nil {
 		t.Fatalf("Failed to launch Java process: %v", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	var socket io.ReadWriteCloser
-	for i := 0; i < 10; i++ {
-		if socket, err = net.Dial("tcp", fmt.Sprintf("localhost:%d", JDWP_PORT)); err == nil {
-			break
-		}
-		time.Sleep(time.Second)
-	}
-
-	if socket == nil {
+	socket, err := javaLauncher.Connect(ctx)
+	if err != nil {
 		javaLauncher.Stop()
 		cancel()
-		t.Fatalf("Failed to connect to JDWP socket after 10 attempts: %v", err)
+		t.Fatalf("Failed to connect to JDWP: %v", err)
 	}
 
 	connection, err := jdwpclient.Open(ctx, socket)
@@ -110,7 +101,7 @@ func TestGetVersion(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	version, err := setup.connection.GetVersion()
+	version, err := setup.connection.GetVersion(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetVersion failed: %v", err)
 	}
@@ -143,7 +134,7 @@ func TestGetIDSizes(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	idSizes, err := setup.connection.GetIDSizes()
+	idSizes, err := setup.connection.GetIDSizes(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetIDSizes failed: %v", err)
 	}
@@ -173,11 +164,29 @@ func TestGetIDSizes(t *testing.T) {
 		idSizes.ReferenceTypeIDSize, idSizes.FrameIDSize)
 }
 
+func TestGetCapabilities(t *testing.T) {
+	setup := setupJDWPTest(t)
+	defer setup.teardown()
+
+	caps, err := setup.connection.GetCapabilities(setup.ctx)
+	if err != nil {
+		t.Fatalf("GetCapabilities failed: %v", err)
+	}
+	if caps != setup.connection.Capabilities() {
+		t.Errorf("Capabilities() = %+v, want %+v", setup.connection.Capabilities(), caps)
+	}
+	// HotSpot has supported these capabilities since Java 6.
+	if !caps.CanRedefineClasses || !caps.CanPopFrames || !caps.CanWatchFieldModification {
+		t.Errorf("Missing expected capabilities: %+v", caps)
+	}
+	t.Logf("Capabilities: %+v", caps)
+}
+
 func TestGetAllClasses(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	classes, err := setup.connection.GetAllClasses()
+	classes, err := setup.connection.GetAllClasses(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllClasses failed: %v", err)
 	}
@@ -217,7 +226,7 @@ func TestGetClassesBySignature(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			classes, err := setup.connection.GetClassesBySignature(tc.signature)
+			classes, err := setup.connection.GetClassesBySignature(setup.ctx, tc.signature)
 			if err != nil {
 				t.Fatalf("GetClassesBySignature failed for %s: %v", tc.signature, err)
 			}
@@ -242,7 +251,7 @@ func TestGetAllThreads(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -267,7 +276,7 @@ func TestCreateString(t *testing.T) {
 
 	for _, testStr := range testStrings {
 		t.Run(fmt.Sprintf("String_%s", testStr), func(t *testing.T) {
-			stringID, err := setup.connection.CreateString(testStr)
+			stringID, err := setup.connection.CreateString(setup.ctx, testStr)
 			if err != nil {
 				t.Fatalf("CreateString failed for '%s': %v", testStr, err)
 			}
@@ -285,14 +294,14 @@ func TestSuspendAndResumeAll(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	err := setup.connection.SuspendAll()
+	err := setup.connection.SuspendAll(setup.ctx)
 	if err != nil {
 		t.Fatalf("SuspendAll failed: %v", err)
 	}
 
 	t.Log("Successfully suspended all threads")
 
-	err = setup.connection.ResumeAll()
+	err = setup.connection.ResumeAll(setup.ctx)
 	if err != nil {
 		t.Fatalf("ResumeAll failed: %v", err)
 	}
@@ -304,7 +313,7 @@ func TestResumeAllExcept(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
@@ -313,20 +322,20 @@ func TestResumeAllExcept(t *testing.T) {
 		t.Skip("No threads available for ResumeAllExcept test")
 	}
 
-	err = setup.connection.SuspendAll()
+	err = setup.connection.SuspendAll(setup.ctx)
 	if err != nil {
 		t.Fatalf("SuspendAll failed: %v", err)
 	}
 
 	testThread := threads[0]
-	err = setup.connection.ResumeAllExcept(testThread)
+	err = setup.connection.ResumeAllExcept(setup.ctx, testThread)
 	if err != nil {
 		t.Fatalf("ResumeAllExcept failed: %v", err)
 	}
 
 	t.Logf("Successfully resumed all threads except thread %d", testThread)
 
-	err = setup.connection.ResumeAll()
+	err = setup.connection.ResumeAll(setup.ctx)
 	if err != nil {
 		t.Fatalf("Final ResumeAll failed: %v", err)
 	}
@@ -336,27 +345,27 @@ func TestVMCommandsIntegration(t *testing.T) {
 	setup := setupJDWPTest(t)
 	defer setup.teardown()
 
-	version, err := setup.connection.GetVersion()
+	version, err := setup.connection.GetVersion(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetVersion failed: %v", err)
 	}
 
-	idSizes, err := setup.connection.GetIDSizes()
+	idSizes, err := setup.connection.GetIDSizes(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetIDSizes failed: %v", err)
 	}
 
-	classes, err := setup.connection.GetAllClasses()
+	classes, err := setup.connection.GetAllClasses(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllClasses failed: %v", err)
 	}
 
-	threads, err := setup.connection.GetAllThreads()
+	threads, err := setup.connection.GetAllThreads(setup.ctx)
 	if err != nil {
 		t.Fatalf("GetAllThreads failed: %v", err)
 	}
 
-	stringID, err := setup.connection.CreateString("Integration test string")
+	stringID, err := setup.connection.CreateString(setup.ctx, "Integration test string")
 	if err != nil {
 		t.Fatalf("CreateString failed: %v", err)
 	}
@@ -0,0 +1,265 @@
+package jdwp_tests_test
+
+import (
+	"context"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+	"time"
+)
+
+func TestParseHitCondition(t *testing.T) {
+	for _, test := range []struct {
+		cond string
+		hits []int // The hits from 1 to 10 that stop.
+	}{
+		{"3", []int{3}},
+		{"== 3", []int{3}},
+		{">= 8", []int{8, 9, 10}},
+		{">8", []int{9, 10}},
+		{"< 3", []int{1, 2}},
+		{"<= 2", []int{1, 2}},
+		{"% 4", []int{4, 8}},
+		{"% 4 == 1", []int{1, 5, 9}},
+	} {
+		c, err := debugger.ParseHitCondition(test.cond)
+		if err != nil {
+			t.Errorf("ParseHitCondition(%q) failed: %v", test.cond, err)
+			continue
+		}
+		got := []int{}
+		for n := 1; n <= 10; n++ {
+			if c(n) {
+				got = append(got, n)
+			}
+		}
+		if len(got) != len(test.hits) {
+			t.Errorf("Hit condition %q stops on %v, want %v", test.cond, got, test.hits)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.hits[i] {
+				t.Errorf("Hit condition %q stops on %v, want %v", test.cond, got, test.hits)
+				break
+			}
+		}
+	}
+	for _, bad := range []string{"abc", ">= x", "% 0", "% 3 == y"} {
+		if _, err := debugger.ParseHitCondition(bad); err == nil {
+			t.Errorf("ParseHitCondition(%q) succeeded", bad)
+		}
+	}
+}
+
+// waitResumed waits for the thread to be resumed by a breakpoint that does not
+// stop.
+func waitResumed(t *testing.T, vm *fakevm.VM, thread *fakevm.Thread) {
+	deadline := time.Now().Add(5 * time.Second)
+	for vm.Suspended(thread) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the thread to resume")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConditionalBreakpoints(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("Main", vm.Class("java.lang.Object"))
+	limit := main.AddField("limit", "I", jdwpclient.ModPrivate)
+	run := main.AddMethod("run", "(I)V", jdwpclient.ModPublic, 10, 11)
+	run.AddVariable("count", "I", 1)
+	this := vm.NewObject(main)
+	this.Fields[limit.ID] = 3
+	thread := vm.AddThread("main")
+	frame := vm.Push(thread, run, 11)
+	frame.This = this
+
+	b := debugger.NewBreakpoints(debugger.NewDispatcher(ctx, conn), debugger.NewIDs())
+	bps, err := b.Set(ctx, "Main.java", []debugger.SourceBreakpoint{
+		{Line: 11, Condition: "count > limit && this.limit == 3", HitCondition: ">= 2"},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !bps[0].Verified {
+		t.Fatalf("Breakpoint not verified: %+v", bps[0])
+	}
+
+	// The condition holds from count 4, and the hit condition from the second
+	// time the condition holds.
+	for count := 1; count <= 5; count++ {
+		frame.Locals[1] = count
+		if n, err := vm.Breakpoint(thread); err != nil || n != 1 {
+			t.Fatalf("Breakpoint raised %d events: %v", n, err)
+		}
+		if count < 5 {
+			waitResumed(t, vm, thread)
+			continue
+		}
+		select {
+		case hit := <-b.Hits():
+			if hit.Breakpoint.HitCount != 2 || hit.ConditionError != nil {
+				t.Errorf("Unexpected hit: %+v", hit)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for conditional breakpoint")
+		}
+	}
+	if err := conn.ResumeAll(ctx); err != nil {
+		t.Fatalf("ResumeAll failed: %v", err)
+	}
+
+	// Conditions that fail to evaluate stop at the breakpoint.
+	if _, err := b.Set(ctx, "Main.java", []debugger.SourceBreakpoint{{Line: 11, Condition: "missing > 1"}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := vm.Breakpoint(thread); err != nil {
+		t.Fatalf("Breakpoint failed: %v", err)
+	}
+	select {
+	case hit := <-b.Hits():
+		if hit.ConditionError == nil {
+			t.Errorf("Expected a condition error, got hit: %+v", hit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for breakpoint with failing condition")
+	}
+	if err := conn.ResumeAll(ctx); err != nil {
+		t.Fatalf("ResumeAll failed: %v", err)
+	}
+
+	// Breakpoints with invalid hit conditions are not set, but the other
+	// breakpoints in the source are.
+	bps, err = b.Set(ctx, "Main.java", []debugger.SourceBreakpoint{{Line: 11, HitCondition: "> x"}, {Line: 10}})
+	if err != nil {
+		t.Fatalf("Set with invalid hit condition failed: %v", err)
+	}
+	if bps[0].Verified || bps[0].Message == "" || !bps[1].Verified {
+		t.Errorf("Set with invalid hit condition returned %+v", bps)
+	}
+	if n := len(vm.Requests(jdwpclient.Breakpoint)); n != 1 {
+		t.Errorf("Set with invalid hit condition left %d breakpoint requests, want 1", n)
+	}
+
+	// A failing Set keeps the previous breakpoints.
+	vm.Handle(fakevm.Command{Set: 6, ID: 1}, func(*fakevm.Args) (interface{}, jdwpclient.Error) {
+		return nil, jdwpclient.ErrInternal
+	})
+	if _, err := b.Set(ctx, "Main.java", []debugger.SourceBreakpoint{{Line: 11}}); err == nil {
+		t.Error("Set succeeded without line tables")
+	}
+	if n := len(vm.Requests(jdwpclient.Breakpoint)); n != 1 {
+		t.Errorf("Failing Set left %d breakpoint requests, want 1", n)
+	}
+}
+
+func TestConditionWithoutEvaluator(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic|jdwpclient.ModStatic, 10, 11)
+	thread := vm.AddThread("main")
+	vm.Push(thread, run, 11)
+
+	b := debugger.NewBreakpoints(debugger.NewDispatcher(ctx, conn), debugger.NewIDs())
+	b.SetEvaluator(nil)
+	if _, err := b.Set(ctx, "Main.java", []debugger.SourceBreakpoint{{Line: 11, Condition: "true"}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := vm.Breakpoint(thread); err != nil {
+		t.Fatalf("Breakpoint failed: %v", err)
+	}
+	select {
+	case hit := <-b.Hits():
+		if hit.ConditionError == nil {
+			t.Errorf("Expected a condition error, got hit: %+v", hit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for breakpoint with a condition")
+	}
+}
+
+func TestLogpoints(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "(I)V", jdwpclient.ModPublic|jdwpclient.ModStatic, 10, 11)
+	run.AddVariable("count", "I", 1)
+	thread := vm.AddThread("main")
+	vm.Push(thread, run, 11).Locals[1] = 7
+
+	b := debugger.NewBreakpoints(debugger.NewDispatcher(ctx, conn), debugger.NewIDs())
+	_, err := b.Set(ctx, "Main.java", []debugger.SourceBreakpoint{
+		{Line: 11, LogMessage: "count={count}, big={count > 5}, bad={nope}"},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := vm.Breakpoint(thread); err != nil {
+		t.Fatalf("Breakpoint failed: %v", err)
+	}
+	select {
+	case l := <-b.Logs():
+		want := "count=7, big=true, bad=<Cannot find variable 'nope'> (Cannot find variable 'nope')"
+		if l.Message != want {
+			t.Errorf("Logpoint logged %q, want %q", l.Message, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for logpoint")
+	}
+	waitResumed(t, vm, thread)
+	select {
+	case hit := <-b.Hits():
+		t.Errorf("Logpoint stopped: %+v", hit)
+	default:
+	}
+}
+
+func TestLogpointWithStoppingEvent(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic, 10, 11)
+	thread := vm.AddThread("main")
+	vm.Push(thread, run, 11)
+
+	events := debugger.NewDispatcher(ctx, conn)
+	b := debugger.NewBreakpoints(events, debugger.NewIDs())
+	if _, err := b.Set(ctx, "Main.java", []debugger.SourceBreakpoint{{Line: 11, LogMessage: "logged"}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	// Method entries stop, as their handler does not resume.
+	entry, err := events.Set(ctx, jdwpclient.MethodEntry, jdwpclient.SuspendAll, func(context.Context, jdwpclient.Event) {})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	logpoint := vm.Requests(jdwpclient.Breakpoint)[0]
+
+	location := run.Location(11)
+	for _, stopping := range []bool{false, true} {
+		raised := []jdwpclient.Event{&jdwpclient.EventBreakpoint{Request: logpoint.ID, Thread: thread.ThreadID(), Location: location}}
+		if stopping {
+			raised = append(raised, &jdwpclient.EventMethodEntry{Request: entry.ID, Thread: thread.ThreadID(), Location: location})
+		}
+		if err := vm.Emit(jdwpclient.SuspendAll, thread, raised...); err != nil {
+			t.Fatalf("Emit failed: %v", err)
+		}
+		select {
+		case <-b.Logs():
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for logpoint")
+		}
+		if !stopping {
+			waitResumed(t, vm, thread)
+			continue
+		}
+		// The logpoint must not resume the thread stopped by the method entry.
+		time.Sleep(50 * time.Millisecond)
+		if !vm.Suspended(thread) {
+			t.Error("Logpoint resumed the thread stopped by another event")
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package jdwp_tests_test
+
+import (
+	"context"
+	"reflect"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+	"time"
+)
+
+// addThrowable adds java.lang.Throwable to the VM, with getMessage and
+// getStackTrace returning message and a stack trace of the elements.
+func addThrowable(vm *fakevm.VM, message string, elements ...string) *fakevm.Class {
+	object := vm.Class("java.lang.Object")
+	element := vm.AddClass("java.lang.StackTraceElement", object)
+	strings := map[jdwpclient.ObjectID]jdwpclient.Value{}
+	values := []jdwpclient.Value{}
+	for _, e := range elements {
+		o := vm.NewObject(element)
+		strings[o.ID] = vm.NewString(e).Value()
+		values = append(values, o.Value())
+	}
+	element.AddMethod("toString", "()Ljava/lang/String;", jdwpclient.ModPublic).Invoke =
+		func(_ *fakevm.Thread, this *fakevm.Object, _ []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+			return strings[this.ID], nil
+		}
+	trace := vm.NewArray(vm.ArrayClass("Ljava/lang/StackTraceElement;"), values...)
+
+	throwable := vm.AddClass("java.lang.Throwable", object)
+	msg := vm.NewString(message).Value()
+	throwable.AddMethod("getMessage", "()Ljava/lang/String;", jdwpclient.ModPublic).Invoke =
+		func(*fakevm.Thread, *fakevm.Object, []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+			return msg, nil
+		}
+	throwable.AddMethod("getStackTrace", "()[Ljava/lang/StackTraceElement;", jdwpclient.ModPublic).Invoke =
+		func(*fakevm.Thread, *fakevm.Object, []jdwpclient.Value) (jdwpclient.Value, *fakevm.Object) {
+			return trace.Value(), nil
+		}
+	return throwable
+}
+
+func waitExceptionHit(ctx context.Context, t *testing.T, e *debugger.Exceptions) debugger.ExceptionHit {
+	select {
+	case hit := <-e.Hits():
+		return hit
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for exception hit")
+	case <-ctx.Done():
+		t.Fatal("Context cancelled waiting for exception hit")
+	}
+	return debugger.ExceptionHit{}
+}
+
+func TestExceptionBreakpoints(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	throwable := addThrowable(vm, "Bad state", "com.example.Main.run(Main.java:11)", "com.example.Main.main(Main.java:3)")
+	runtime := vm.AddClass("java.lang.RuntimeException", throwable)
+	illegalState := vm.AddClass("java.lang.IllegalStateException", runtime)
+	io := vm.AddClass("java.io.IOException", throwable)
+	main := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic, 10, 11, 12)
+	thread := vm.AddThread("main")
+	vm.Push(thread, run, 11)
+
+	e := debugger.NewExceptions(debugger.NewDispatcher(ctx, conn), debugger.NewIDs())
+	bps, err := e.Set(ctx, []debugger.ExceptionBreakpoint{
+		{Class: "java.lang.RuntimeException", Caught: true, Uncaught: true},
+		{Uncaught: true},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !bps[0].Verified || !bps[1].Verified {
+		t.Fatalf("Exception breakpoints not verified: %+v", bps)
+	}
+
+	// Subclasses of the breakpoint's class are caught by it.
+	catch := run.Location(12)
+	if n, err := vm.Throw(thread, vm.NewObject(illegalState), &catch); err != nil || n != 1 {
+		t.Fatalf("Throw raised %d events: %v", n, err)
+	}
+	hit := waitExceptionHit(ctx, t, e)
+	want := debugger.ExceptionDetails{
+		Type:          "java.lang.IllegalStateException",
+		Message:       "Bad state",
+		StackTrace:    []string{"com.example.Main.run(Main.java:11)", "com.example.Main.main(Main.java:3)"},
+		Location:      run.Location(11),
+		CatchLocation: &catch,
+	}
+	want.Exception = hit.Details.Exception
+	if hit.Breakpoint.ID != bps[0].ID || hit.Thread != thread.ThreadID() {
+		t.Errorf("Unexpected hit: %+v", hit)
+	}
+	if !reflect.DeepEqual(hit.Details, want) {
+		t.Errorf("Unexpected exception details:\n got %+v\nwant %+v", hit.Details, want)
+	}
+	if err := conn.ResumeAll(ctx); err != nil {
+		t.Fatalf("ResumeAll failed: %v", err)
+	}
+
+	// Caught exceptions of other classes do not stop.
+	if n, err := vm.Throw(thread, vm.NewObject(io), &catch); err != nil || n != 0 {
+		t.Fatalf("Caught IOException raised %d events: %v", n, err)
+	}
+	if _, err := vm.Throw(thread, vm.NewObject(io), nil); err != nil {
+		t.Fatalf("Throw failed: %v", err)
+	}
+	hit = waitExceptionHit(ctx, t, e)
+	if hit.Breakpoint.ID != bps[1].ID || hit.Details.Type != "java.io.IOException" || hit.Details.CatchLocation != nil {
+		t.Errorf("Unexpected uncaught hit: %+v", hit)
+	}
+}
+
+func TestDeferredExceptionBreakpoint(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	throwable := addThrowable(vm, "")
+	thread := vm.AddThread("main")
+	e := debugger.NewExceptions(debugger.NewDispatcher(ctx, conn), debugger.NewIDs())
+	bps, err := e.Set(ctx, []debugger.ExceptionBreakpoint{{Class: "com.example.AppException", Caught: true}})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if bps[0].Verified || bps[0].Message == "" {
+		t.Fatalf("Breakpoint on unloaded class should be unverified with a message: %+v", bps[0])
+	}
+
+	app := vm.AddClass("com.example.AppException", throwable)
+	if _, err := vm.PrepareClass(app, thread); err != nil {
+		t.Fatalf("PrepareClass failed: %v", err)
+	}
+	select {
+	case bp := <-e.Changed():
+		if bp.ID != bps[0].ID || !bp.Verified {
+			t.Errorf("Unexpected changed breakpoint: %+v", bp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for deferred exception breakpoint")
+	}
+	if n := len(vm.Requests(jdwpclient.Exception)); n != 1 {
+		t.Errorf("%d exception requests on the VM, want 1", n)
+	}
+
+	// Replacing the breakpoints clears the requests of the old ones.
+	if _, err := e.Set(ctx, nil); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for _, kind := range []jdwpclient.EventKind{jdwpclient.Exception, jdwpclient.ClassPrepare} {
+		if n := len(vm.Requests(kind)); n != 0 {
+			t.Errorf("%d %v requests left on the VM", n, kind)
+		}
+	}
+}
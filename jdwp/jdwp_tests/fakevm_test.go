@@ -0,0 +1,158 @@
+package jdwp_tests_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+	"time"
+)
+
+func TestFakeVMModel(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	class := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	method := class.AddMethod("run", "(I)V", jdwpclient.ModPublic, 10, 11, 12)
+	method.AddVariable("count", "I", 1)
+	thread := vm.AddThread("main")
+	frame := vm.Push(thread, method, 11)
+	frame.Locals[1] = 42
+
+	info, err := conn.GetClassBySignature(ctx, "Lcom/example/Main;")
+	if err != nil {
+		t.Fatalf("GetClassBySignature failed: %v", err)
+	}
+	if info.TypeID != class.ID {
+		t.Errorf("Unexpected class ID: got %v, want %v", info.TypeID, class.ID)
+	}
+	methods, err := conn.GetMethods(ctx, info.TypeID)
+	if err != nil {
+		t.Fatalf("GetMethods failed: %v", err)
+	}
+	run := methods.FindBySignature("run", "(I)V")
+	if run == nil {
+		t.Fatalf("Method run not found in %v", methods)
+	}
+	table, err := conn.LineTable(ctx, info.TypeID, run.ID)
+	if err != nil {
+		t.Fatalf("LineTable failed: %v", err)
+	}
+	if index, ok := table.Lookup(12); !ok || index != 2 {
+		t.Errorf("Lookup(12) returned %v, %v", index, ok)
+	}
+
+	name, err := conn.GetThreadName(ctx, thread.ThreadID())
+	if err != nil || name != "main" {
+		t.Fatalf("GetThreadName returned %q, %v", name, err)
+	}
+	if _, err := conn.GetFrames(ctx, thread.ThreadID(), 0, -1); err != jdwpclient.ErrThreadNotSuspended {
+		t.Errorf("GetFrames on running thread returned: %v", err)
+	}
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	frames, err := conn.GetFrames(ctx, thread.ThreadID(), 0, -1)
+	if err != nil {
+		t.Fatalf("GetFrames failed: %v", err)
+	}
+	if len(frames) != 1 || frames[0].Location != method.Location(11) {
+		t.Fatalf("Unexpected frames: %+v", frames)
+	}
+	values, err := conn.GetValues(ctx, thread.ThreadID(), frames[0].Frame,
+		[]jdwpclient.VariableRequest{{Index: 1, Tag: uint8(jdwpclient.TagInt)}})
+	if err != nil {
+		t.Fatalf("GetValues failed: %v", err)
+	}
+	if !reflect.DeepEqual(values, []jdwpclient.Value{42}) {
+		t.Errorf("Unexpected values: %v", values)
+	}
+
+	str, err := conn.CreateString(ctx, "hello")
+	if err != nil {
+		t.Fatalf("CreateString failed: %v", err)
+	}
+	if got, err := conn.GetString(ctx, str); err != nil || got != "hello" {
+		t.Errorf("GetString returned %q, %v", got, err)
+	}
+}
+
+func TestFakeVMEvents(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	class := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	method := class.AddMethod("run", "()V", jdwpclient.ModPublic, 10, 11)
+	thread := vm.AddThread("main")
+	vm.Push(thread, method, 11)
+
+	req, err := conn.SetEventRequest(ctx, jdwpclient.Breakpoint, jdwpclient.SuspendAll,
+		jdwpclient.LocationOnlyEventModifier(method.Location(11)))
+	if err != nil {
+		t.Fatalf("SetEventRequest failed: %v", err)
+	}
+	set := vm.Requests(jdwpclient.Breakpoint)
+	if len(set) != 1 || !reflect.DeepEqual(set[0], req) {
+		t.Fatalf("Unexpected requests on the VM: %v, want %v", set, req)
+	}
+
+	if n, err := vm.Breakpoint(thread); n != 1 || err != nil {
+		t.Fatalf("Breakpoint raised %v events: %v", n, err)
+	}
+	select {
+	case set := <-conn.Events():
+		if len(set.Events) != 1 || set.Policy != jdwpclient.SuspendAll {
+			t.Fatalf("Unexpected events: %+v", set)
+		}
+		bp, ok := set.Events[0].(*jdwpclient.EventBreakpoint)
+		if !ok || bp.Request != req.ID || bp.Thread != thread.ThreadID() {
+			t.Fatalf("Unexpected event: %+v", set.Events[0])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for breakpoint event")
+	}
+	if !vm.Suspended(thread) {
+		t.Error("Thread not suspended by SuspendAll breakpoint")
+	}
+
+	if err := conn.ClearEventRequest(ctx, req); err != nil {
+		t.Fatalf("ClearEventRequest failed: %v", err)
+	}
+	if n, _ := vm.Breakpoint(thread); n != 0 {
+		t.Errorf("Cleared breakpoint raised %v events", n)
+	}
+}
+
+func TestFakeVMCapabilities(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm := fakevm.New()
+	defer vm.Close()
+	vm.Capabilities = jdwpclient.Capabilities{CanWatchFieldModification: true}
+	// Older VMs only implement the legacy Capabilities command.
+	vm.Handle(fakevm.Command{Set: 1, ID: 17}, func(*fakevm.Args) (interface{}, jdwpclient.Error) {
+		return nil, jdwpclient.ErrNotImplemented
+	})
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+
+	if caps := conn.Capabilities(); caps != vm.Capabilities {
+		t.Errorf("Capabilities() = %+v, want %+v", caps, vm.Capabilities)
+	}
+	if _, err := conn.SetEventRequest(ctx, jdwpclient.FieldModification, jdwpclient.SuspendAll); err != nil {
+		t.Errorf("Supported watchpoint request failed: %v", err)
+	}
+	_, err = conn.SetEventRequest(ctx, jdwpclient.FieldAccess, jdwpclient.SuspendAll)
+	if !errors.Is(err, jdwpclient.ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported, got: %v", err)
+	}
+	if want := "Field access watchpoints unsupported by target VM"; err.Error() != want {
+		t.Errorf("Unexpected error message: %q, want %q", err.Error(), want)
+	}
+	if len(vm.Requests(jdwpclient.FieldAccess)) != 0 {
+		t.Error("Unsupported request was sent to the VM")
+	}
+}
@@ -0,0 +1,113 @@
+package jdwp_tests_test
+
+import (
+	"errors"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestPopFramesAndForceEarlyReturn(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic, 10, 11)
+	compute := main.AddMethod("compute", "()I", jdwpclient.ModPublic, 20, 21)
+	helper := main.AddMethod("helper", "()V", jdwpclient.ModPublic, 30)
+	thread := vm.AddThread("main")
+	vm.Push(thread, run, 11)
+	computeFrame := vm.Push(thread, compute, 21)
+	vm.Push(thread, helper, 30)
+
+	if err := conn.PopFrames(ctx, thread.ThreadID(), computeFrame.ID); err != jdwpclient.ErrThreadNotSuspended {
+		t.Errorf("PopFrames on running thread returned: %v", err)
+	}
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	if err := conn.PopFrames(ctx, thread.ThreadID(), computeFrame.ID); err != nil {
+		t.Fatalf("PopFrames failed: %v", err)
+	}
+	frames, err := conn.GetFrames(ctx, thread.ThreadID(), 0, -1)
+	if err != nil {
+		t.Fatalf("GetFrames failed: %v", err)
+	}
+	if len(frames) != 1 || frames[0].Location != run.Location(11) {
+		t.Fatalf("Unexpected frames after PopFrames: %+v", frames)
+	}
+
+	vm.Push(thread, compute, 20)
+	if err := conn.ForceEarlyReturn(ctx, thread.ThreadID(), 42); err != nil {
+		t.Fatalf("ForceEarlyReturn failed: %v", err)
+	}
+	if thread.Returned != 42 || len(thread.Frames) != 1 {
+		t.Errorf("Thread returned %v with %d frames", thread.Returned, len(thread.Frames))
+	}
+
+	// Void methods return a nil value.
+	vm.Push(thread, helper, 30)
+	if err := conn.ForceEarlyReturn(ctx, thread.ThreadID(), nil); err != nil {
+		t.Fatalf("ForceEarlyReturn from void method failed: %v", err)
+	}
+	if thread.Returned != nil || len(thread.Frames) != 1 {
+		t.Errorf("Void method returned %v with %d frames", thread.Returned, len(thread.Frames))
+	}
+}
+
+func TestRestartFrame(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic, 10, 11)
+	compute := main.AddMethod("compute", "()I", jdwpclient.ModPublic, 20, 21, 22)
+	thread := vm.AddThread("main")
+	vm.Push(thread, run, 11)
+	vm.Push(thread, compute, 22)
+	// Stepping into from the call site re-enters compute.
+	vm.Step = func(t *fakevm.Thread, step jdwpclient.StepEventModifier) {
+		if step.Depth == jdwpclient.StepInto && t.Frames[0].Location.Method == run.ID {
+			entry := &fakevm.Frame{ID: 1000, Location: compute.Location(20)}
+			t.Frames = append([]*fakevm.Frame{entry}, t.Frames...)
+		}
+	}
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	frames, err := conn.GetFrames(ctx, thread.ThreadID(), 0, -1)
+	if err != nil {
+		t.Fatalf("GetFrames failed: %v", err)
+	}
+
+	events := debugger.NewDispatcher(ctx, conn)
+	location, err := debugger.RestartFrame(ctx, events, thread.ThreadID(), frames[0])
+	if err != nil {
+		t.Fatalf("RestartFrame failed: %v", err)
+	}
+	if location != compute.Location(20) {
+		t.Errorf("Restarted frame stopped at %v, want %v", location, compute.Location(20))
+	}
+	if !vm.Suspended(thread) {
+		t.Error("Thread not suspended after restarting frame")
+	}
+	if n := len(vm.Requests(jdwpclient.SingleStep)); n != 0 {
+		t.Errorf("%d step requests left on the VM", n)
+	}
+}
+
+func TestRestartBottomFrame(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	thread := vm.AddThread("main")
+
+	// The last frame of a thread cannot be popped.
+	main := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	frame := vm.Push(thread, main.AddMethod("main", "()V", jdwpclient.ModPublic, 1), 1)
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	events := debugger.NewDispatcher(ctx, conn)
+	info := jdwpclient.FrameInfo{Frame: frame.ID, Location: frame.Location}
+	if _, err := debugger.RestartFrame(ctx, events, thread.ThreadID(), info); !errors.Is(err, jdwpclient.ErrNoMoreFrames) {
+		t.Errorf("Expected ErrNoMoreFrames, got: %v", err)
+	}
+}
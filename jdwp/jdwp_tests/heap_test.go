@@ -0,0 +1,138 @@
+package jdwp_tests_test
+
+import (
+	"reflect"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestInstanceCommands(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	node := vm.AddClass("com.example.Node", vm.Class("java.lang.Object"))
+	next := node.AddField("next", "Lcom/example/Node;", jdwpclient.ModPrivate)
+	head := node.AddField("head", "Lcom/example/Node;", jdwpclient.ModPrivate|jdwpclient.ModStatic)
+	a, b, c := vm.NewObject(node), vm.NewObject(node), vm.NewObject(node)
+	a.Fields[next.ID] = c.ID
+	b.Fields[next.ID] = c.ID
+	head.Value = c.ID
+
+	counts, err := conn.GetInstanceCounts(ctx, node.ID, vm.Class("java.lang.Thread").ID)
+	if err != nil || !reflect.DeepEqual(counts, []int64{3, 0}) {
+		t.Errorf("GetInstanceCounts returned %v, %v, want [3 0]", counts, err)
+	}
+	instances, err := conn.GetInstances(ctx, node.ID, 2)
+	want := []jdwpclient.TaggedObjectID{{Type: jdwpclient.TagObject, Object: a.ID}, {Type: jdwpclient.TagObject, Object: b.ID}}
+	if err != nil || !reflect.DeepEqual(instances, want) {
+		t.Errorf("GetInstances returned %v, %v, want %v", instances, err, want)
+	}
+
+	referrers, err := conn.GetReferringObjects(ctx, c.ID, 0)
+	if err != nil {
+		t.Fatalf("GetReferringObjects failed: %v", err)
+	}
+	class := vm.ClassObject(node)
+	want = []jdwpclient.TaggedObjectID{
+		{Type: jdwpclient.TagObject, Object: a.ID},
+		{Type: jdwpclient.TagObject, Object: b.ID},
+		{Type: jdwpclient.TagClassObject, Object: class.ID},
+	}
+	if !reflect.DeepEqual(referrers, want) {
+		t.Errorf("GetReferringObjects returned %v, want %v", referrers, want)
+	}
+	if ty, err := conn.ReflectedType(ctx, jdwpclient.ClassObjectID(class.ID)); err != nil || ty != node.ID {
+		t.Errorf("ReflectedType returned %v, %v, want %v", ty, err, node.ID)
+	}
+	if referrers, err := conn.GetReferringObjects(ctx, c.ID, 1); err != nil || len(referrers) != 1 {
+		t.Errorf("GetReferringObjects with max 1 returned %v, %v, want 1 object", referrers, err)
+	}
+}
+
+func TestClassHistogram(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	node := vm.AddClass("com.example.Node", vm.Class("java.lang.Object"))
+	for i := 0; i < 3; i++ {
+		vm.NewObject(node)
+	}
+	vm.NewString("a")
+	vm.NewString("b")
+	vm.NewArray(vm.ArrayClass("I"), 1, 2)
+
+	histogram, err := debugger.ClassHistogram(ctx, conn)
+	if err != nil {
+		t.Fatalf("ClassHistogram failed: %v", err)
+	}
+	// Every VM holds the two thread groups of the JVM.
+	want := []debugger.ClassCount{
+		{Type: node.ID, Name: "com.example.Node", Instances: 3},
+		{Type: vm.Class("java.lang.String").ID, Name: "java.lang.String", Instances: 2},
+		{Type: vm.Class("java.lang.ThreadGroup").ID, Name: "java.lang.ThreadGroup", Instances: 2},
+		{Type: vm.Class("int[]").ID, Name: "[I", Instances: 1},
+	}
+	if !reflect.DeepEqual(histogram, want) {
+		t.Errorf("ClassHistogram returned:\n%+v\nwant:\n%+v", histogram, want)
+	}
+}
+
+func TestWhyAlive(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	object := vm.Class("java.lang.Object")
+	cache := vm.AddClass("com.example.Cache", object)
+	entries := cache.AddField("entries", "[Ljava/lang/Object;", jdwpclient.ModPrivate|jdwpclient.ModStatic)
+	entry := vm.AddClass("com.example.Entry", object)
+	value := entry.AddField("value", "Ljava/lang/Object;", jdwpclient.ModPrivate)
+	target := vm.Class("java.lang.Thread").AddField("target", "Ljava/lang/Runnable;", jdwpclient.ModPrivate)
+
+	leaked := vm.NewObject(object)
+	e := vm.NewObject(entry)
+	e.Fields[value.ID] = leaked.ID
+	array := vm.NewArray(vm.ArrayClass("Ljava/lang/Object;"), e.ID)
+	entries.Value = jdwpclient.ArrayID(array.ID)
+	task := vm.NewObject(object)
+	worker := vm.AddThread("worker")
+	worker.Fields[target.ID] = task.ID
+	orphan := vm.NewObject(object)
+
+	path, err := debugger.WhyAlive(ctx, conn, leaked.ID, 0)
+	if err != nil {
+		t.Fatalf("WhyAlive failed: %v", err)
+	}
+	want := debugger.RetentionPath{
+		Root: debugger.StaticRoot,
+		Name: "com.example.Cache",
+		Objects: []jdwpclient.TaggedObjectID{
+			{Type: jdwpclient.TagClassObject, Object: vm.ClassObject(cache).ID},
+			{Type: jdwpclient.TagArray, Object: array.ID},
+			{Type: jdwpclient.TagObject, Object: e.ID},
+			{Type: jdwpclient.TagObject, Object: leaked.ID},
+		},
+	}
+	if !reflect.DeepEqual(path, want) {
+		t.Errorf("WhyAlive of a cached object returned:\n%+v\nwant:\n%+v", path, want)
+	}
+
+	path, err = debugger.WhyAlive(ctx, conn, task.ID, 0)
+	want = debugger.RetentionPath{
+		Root: debugger.ThreadRoot,
+		Name: "worker",
+		Objects: []jdwpclient.TaggedObjectID{
+			{Type: jdwpclient.TagThread, Object: worker.ID},
+			{Type: jdwpclient.TagObject, Object: task.ID},
+		},
+	}
+	if err != nil || !reflect.DeepEqual(path, want) {
+		t.Errorf("WhyAlive of a task returned %+v, %v, want %+v", path, err, want)
+	}
+
+	path, err = debugger.WhyAlive(ctx, conn, leaked.ID, 2)
+	if err != nil || path.Root != debugger.NoRoot {
+		t.Errorf("WhyAlive beyond its limit returned %+v, %v, want no root", path, err)
+	}
+	path, err = debugger.WhyAlive(ctx, conn, orphan.ID, 0)
+	if err != nil || path.Root != debugger.NoRoot || len(path.Objects) != 1 {
+		t.Errorf("WhyAlive of an unreferenced object returned %+v, %v, want no root", path, err)
+	}
+	if vm.Suspended(worker) {
+		t.Errorf("WhyAlive left the VM suspended")
+	}
+}
@@ -0,0 +1,113 @@
+package jdwp_tests_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+	"time"
+)
+
+func TestClassWatcher(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic, 10)
+	stop := main.AddMethod("stop", "()V", jdwpclient.ModPublic, 20)
+	main.Redefine = func(bytes []byte) ([]*fakevm.Method, jdwpclient.Error) {
+		if string(bytes) == "bad" {
+			return nil, jdwpclient.ErrInvalidClassFormat
+		}
+		return []*fakevm.Method{run, stop}, jdwpclient.ErrNone
+	}
+	// Only run has a frame, so stop has no obsolete code.
+	thread := vm.AddThread("worker")
+	frame := vm.Push(thread, run, 10)
+	if err := conn.Suspend(ctx, thread.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Make sure the change is visible with coarse file timestamps.
+		later := time.Now().Add(time.Duration(len(content)) * time.Second)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("com/example/Main.class", "v1")
+
+	w, err := debugger.NewClassWatcher(conn, dir)
+	if err != nil {
+		t.Fatalf("NewClassWatcher failed: %v", err)
+	}
+	if res, err := w.Poll(ctx); err != nil || len(res.Classes) != 0 {
+		t.Fatalf("Unchanged classes were redefined: %+v, %v", res, err)
+	}
+
+	write("com/example/Main.class", "v2-new")
+	write("com/example/Other.class", "other")
+	res, err := w.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	if len(res.Classes) != 1 || res.Classes[0].TypeID != main.ID {
+		t.Errorf("Unexpected redefined classes: %+v", res.Classes)
+	}
+	if !reflect.DeepEqual(res.Skipped, []string{"Lcom/example/Other;"}) {
+		t.Errorf("Unexpected skipped classes: %v", res.Skipped)
+	}
+	if len(res.Obsolete) != 1 || res.Obsolete[0].String() != "Lcom/example/Main;.run()V" {
+		t.Fatalf("Unexpected obsolete methods: %v", res.Obsolete)
+	}
+	obsolete := res.Obsolete[0]
+	if obsolete.Method.ID != run.ID || obsolete.Obsolete == run.ID || obsolete.Obsolete != frame.Location.Method {
+		t.Errorf("Obsolete method %+v, want the frame's method %v replacing %v", obsolete, frame.Location.Method, run.ID)
+	}
+	if !reflect.DeepEqual(obsolete.Threads, []jdwpclient.ThreadID{thread.ThreadID()}) {
+		t.Errorf("Obsolete method run by %v, want %v", obsolete.Threads, thread.ThreadID())
+	}
+	// The old method ID now identifies the new code.
+	if isObsolete, err := conn.IsObsolete(ctx, main.ID, run.ID); err != nil || isObsolete {
+		t.Errorf("IsObsolete of the redefined method returned %v, %v, want false", isObsolete, err)
+	}
+	if string(main.Bytes) != "v2-new" {
+		t.Errorf("VM has class file %q", main.Bytes)
+	}
+
+	write("com/example/Main.class", "bad")
+	if _, err := w.Poll(ctx); !errors.Is(err, jdwpclient.ErrInvalidClassFormat) {
+		t.Errorf("Expected ErrInvalidClassFormat, got: %v", err)
+	}
+}
+
+func TestRedefineClassesUnsupported(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm := fakevm.New()
+	defer vm.Close()
+	vm.Capabilities.CanRedefineClasses = false
+	vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+
+	classes := map[string][]byte{"Lcom/example/Main;": {0xca, 0xfe}}
+	if _, err := debugger.RedefineClasses(ctx, conn, classes); !errors.Is(err, jdwpclient.ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported, got: %v", err)
+	}
+}
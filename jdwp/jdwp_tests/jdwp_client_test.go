@@ -0,0 +1,320 @@
+package jdwp_tests_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var cmdResumeAll = fakevm.Command{Set: 1, ID: 9}
+
+// openFakeVM returns a connection to a new fake VM.
+func openFakeVM(t *testing.T) (context.Context, *jdwpclient.Connection, *fakevm.VM) {
+	ctx, cancel := context.WithCancel(context.Background())
+	vm := fakevm.New()
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		cancel()
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+	t.Cleanup(func() {
+		vm.Close()
+		cancel()
+	})
+	return ctx, conn, vm
+}
+
+func TestDisconnectFailsPendingCalls(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	vm.Handle(cmdResumeAll, func(*fakevm.Args) (interface{}, jdwpclient.Error) {
+		vm.Close()
+		return nil, jdwpclient.ErrNone
+	})
+
+	if err := conn.ResumeAll(ctx); !errors.Is(err, jdwpclient.ErrDisconnected) {
+		t.Fatalf("Expected ErrDisconnected for pending call, got: %v", err)
+	}
+	if err := conn.SuspendAll(ctx); !errors.Is(err, jdwpclient.ErrDisconnected) {
+		t.Fatalf("Expected ErrDisconnected after disconnect, got: %v", err)
+	}
+	select {
+	case <-conn.Closed():
+	default:
+		t.Fatal("Closed() not closed after disconnect")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	conn.SetTimeout(50 * time.Millisecond)
+
+	release := make(chan struct{})
+	vm.Handle(cmdResumeAll, func(*fakevm.Args) (interface{}, jdwpclient.Error) {
+		<-release
+		return nil, jdwpclient.ErrNone
+	})
+	if err := conn.ResumeAll(ctx); err == nil || errors.Is(err, jdwpclient.ErrDisconnected) {
+		t.Fatalf("Expected timeout error, got: %v", err)
+	}
+
+	// The late reply must be dropped without affecting later calls.
+	close(release)
+	if err := conn.ResumeAll(ctx); err != nil {
+		t.Fatalf("ResumeAll after timeout failed: %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	vm.Handle(cmdResumeAll, func(*fakevm.Args) (interface{}, jdwpclient.Error) {
+		<-release
+		return nil, jdwpclient.ErrNone
+	})
+
+	callCtx, cancelCall := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancelCall()
+	}()
+	if err := conn.ResumeAll(callCtx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestEventAfterOpenContextStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	vm := fakevm.New()
+	defer vm.Close()
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+	cancel()
+	// The event stream is closed once the events stop being pumped.
+	for range conn.Events() {
+	}
+
+	if err := vm.Emit(jdwpclient.SuspendNone, nil, &jdwpclient.EventVMDeath{}); err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+	select {
+	case <-conn.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("Connection not closed after an event arrived with the context stopped")
+	}
+	if err := conn.SuspendAll(context.Background()); !errors.Is(err, jdwpclient.ErrDisconnected) {
+		t.Errorf("SuspendAll after the context stopped returned %v, want ErrDisconnected", err)
+	}
+}
+
+// serveFakeVM serves the fake VM to each debugger that connects to the
+// listener, one at a time.
+func serveFakeVM(vm *fakevm.VM, listener net.Listener) {
+	go func() {
+		for {
+			socket, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			vm.Serve(socket)
+		}
+	}()
+}
+
+func TestAttachAfterDispose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+	vm := fakevm.New()
+	defer vm.Close()
+	serveFakeVM(vm, listener)
+
+	conn, err := jdwpclient.Attach(ctx, listener.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+	if conn.Addr() != listener.Addr().String() {
+		t.Errorf("Addr is %v, want %v", conn.Addr(), listener.Addr())
+	}
+	if err := conn.SuspendAll(ctx); err != nil {
+		t.Fatalf("SuspendAll failed: %v", err)
+	}
+
+	again, err := conn.Reattach(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("Reattach failed: %v", err)
+	}
+	defer again.Close()
+	if err := conn.SuspendAll(ctx); !errors.Is(err, jdwpclient.ErrDisconnected) {
+		t.Errorf("SuspendAll on the disposed connection returned %v, want ErrDisconnected", err)
+	}
+	if err := again.ResumeAll(ctx); err != nil {
+		t.Errorf("ResumeAll after Reattach failed: %v", err)
+	}
+}
+
+func TestListenerAccept(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, err := jdwpclient.Listen("localhost:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	// The fake VM connects to the debugger, as an agent with server=n does.
+	vm := fakevm.New()
+	defer vm.Close()
+	go func() {
+		if socket, err := net.Dial("tcp", listener.Addr()); err == nil {
+			vm.Serve(socket)
+		}
+	}()
+	conn, err := listener.Accept(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.ResumeAll(ctx); err != nil {
+		t.Errorf("ResumeAll failed: %v", err)
+	}
+
+	// Accept stops waiting once the context is done.
+	waitCtx, stop := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer stop()
+	if _, err := listener.Accept(waitCtx, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Accept without a VM returned %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	// The listener accepts connections but never answers the handshake.
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			socket, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer socket.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = jdwpclient.Attach(context.Background(), listener.Addr().String(), 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Attach returned %v, want a handshake timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Attach took %v to time out", elapsed)
+	}
+}
+
+func TestOpenFailureClosesConnection(t *testing.T) {
+	idSizes := fakevm.Command{Set: 1, ID: 7}
+	capabilities := fakevm.Command{Set: 1, ID: 12}
+	capabilitiesNew := fakevm.Command{Set: 1, ID: 17}
+	for _, failing := range [][]fakevm.Command{{idSizes}, {capabilities, capabilitiesNew}} {
+		vm := fakevm.New()
+		defer vm.Close()
+		for _, cmd := range failing {
+			vm.Handle(cmd, func(*fakevm.Args) (interface{}, jdwpclient.Error) {
+				return nil, jdwpclient.ErrInternal
+			})
+		}
+		client, server := net.Pipe()
+		served := make(chan error, 1)
+		go func() { served <- vm.Serve(server) }()
+
+		if _, err := jdwpclient.Open(context.Background(), client); err == nil {
+			t.Fatalf("Open succeeded with failing commands %+v", failing)
+		}
+		// The VM stops serving once the client closes the connection.
+		select {
+		case <-served:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Connection not closed after failing commands %+v", failing)
+		}
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	class := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	method := class.AddMethod("run", "()V", jdwpclient.ModPublic, 10, 11)
+	thread := vm.AddThread("main")
+	vm.Push(thread, method, 11)
+	resumes := int32(0)
+	vm.Handle(cmdResumeAll, func(*fakevm.Args) (interface{}, jdwpclient.Error) {
+		atomic.AddInt32(&resumes, 1)
+		return nil, jdwpclient.ErrNone
+	})
+
+	// Raise more events than are buffered while the handler is busy with the
+	// first one, after which it stops watching.
+	raised := make(chan struct{})
+	go func() {
+		defer close(raised)
+		for len(vm.Requests(jdwpclient.Breakpoint)) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		for i := 0; i < 32; i++ {
+			if _, err := vm.Breakpoint(thread); err != nil {
+				t.Errorf("Breakpoint failed: %v", err)
+				return
+			}
+		}
+	}()
+	handled := 0
+	onEvent := func(jdwpclient.Event) bool {
+		if handled++; handled == 1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return false
+	}
+	done := make(chan error)
+	go func() {
+		done <- conn.WatchEvents(ctx, jdwpclient.Breakpoint, jdwpclient.SuspendNone, onEvent,
+			jdwpclient.LocationOnlyEventModifier(method.Location(11)))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WatchEvents failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for WatchEvents to return")
+	}
+	<-raised
+
+	if n := atomic.LoadInt32(&resumes); n != 0 {
+		t.Errorf("WatchEvents resumed the VM %d times", n)
+	}
+	if n := len(vm.Requests(jdwpclient.Breakpoint)); n != 0 {
+		t.Errorf("WatchEvents left %d breakpoint requests", n)
+	}
+	// None of the watched events leak onto the event stream.
+	select {
+	case set := <-conn.Events():
+		t.Errorf("Watched events on the event stream: %+v", set)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,210 @@
+package jdwp_tests_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sapelkinav/javadap/launcher"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLauncherCommand(t *testing.T) {
+	t.Setenv("JAVA_HOME", "")
+	sep := string(os.PathListSeparator)
+	for _, test := range []struct {
+		name   string
+		config launcher.Config
+		want   []string
+	}{
+		{
+			"jar",
+			launcher.Config{Jar: "app.jar", Port: 5005, Suspend: true},
+			[]string{"java", "-agentlib:jdwp=transport=dt_socket,server=y,suspend=y,address=5005", "-jar", "app.jar"},
+		},
+		{
+			"main class",
+			launcher.Config{
+				Java:      "/opt/jdk/bin/java",
+				MainClass: "com.example.Main",
+				ClassPath: []string{"build/classes", "lib/dep.jar"},
+				VMArgs:    []string{"-Xmx1g", "-Dmode=test"},
+				Args:      []string{"--verbose", "input.txt"},
+				Port:      6000,
+			},
+			[]string{"/opt/jdk/bin/java", "-agentlib:jdwp=transport=dt_socket,server=y,suspend=n,address=6000",
+				"-Xmx1g", "-Dmode=test", "-cp", "build/classes" + sep + "lib/dep.jar", "com.example.Main",
+				"--verbose", "input.txt"},
+		},
+		{
+			"module",
+			launcher.Config{
+				Module:     "com.example/com.example.Main",
+				ModulePath: []string{"mods"},
+				Env:        map[string]string{"JAVA_HOME": "/opt/jdk17"},
+				Port:       5005,
+			},
+			[]string{filepath.Join("/opt/jdk17", "bin", "java"), "-agentlib:jdwp=transport=dt_socket,server=y,suspend=n,address=5005",
+				"--module-path", "mods", "-m", "com.example/com.example.Main"},
+		},
+		{
+			"debugger address",
+			launcher.Config{Jar: "app.jar", DebuggerAddress: "localhost:7000", Suspend: true},
+			[]string{"java", "-agentlib:jdwp=transport=dt_socket,server=n,suspend=y,address=localhost:7000", "-jar", "app.jar"},
+		},
+	} {
+		cmd, err := test.config.Command()
+		if err != nil {
+			t.Errorf("Command of %v failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd.Args, test.want) {
+			t.Errorf("Command of %v is %q, want %q", test.name, cmd.Args, test.want)
+		}
+	}
+
+	cmd, err := launcher.Config{
+		MainClass: "Main",
+		Port:      5005,
+		Cwd:       "/tmp/work",
+		Env:       map[string]string{"B": "2", "A": "1"},
+	}.Command()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if cmd.Dir != "/tmp/work" {
+		t.Errorf("Working directory is %q, want /tmp/work", cmd.Dir)
+	}
+	if n := len(cmd.Env); n < 2 || cmd.Env[n-2] != "A=1" || cmd.Env[n-1] != "B=2" {
+		t.Errorf("Environment ends with %q, want A=1 and B=2", cmd.Env[len(cmd.Env)-2:])
+	}
+
+	for _, config := range []launcher.Config{
+		{Port: 5005},
+		{Jar: "app.jar", MainClass: "Main", Port: 5005},
+		{Jar: "app.jar", Port: -1},
+		{Jar: "app.jar", Port: 5005, DebuggerAddress: "localhost:7000"},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("Validate(%+v) returned %v, want an error", config, err)
+		}
+	}
+}
+
+// fakeJava writes a script that stands in for the java executable, running
+// the shell commands.
+func fakeJava(t *testing.T, commands string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "java")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+commands+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake java: %v", err)
+	}
+	return path
+}
+
+func TestLauncherConnect(t *testing.T) {
+	ctx := context.Background()
+
+	// The fake agent announces the port of a listener of the test.
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+	stderr := &bytes.Buffer{}
+	l := launcher.New(launcher.Config{
+		Java:   fakeJava(t, fmt.Sprintf("echo starting >&2; sleep 0.2; echo 'Listening for transport dt_socket at address: %d' >&2; exec sleep 10", port)),
+		Jar:    "app.jar",
+		Stdout: &bytes.Buffer{},
+		Stderr: stderr,
+	})
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer l.Stop()
+	conn, err := l.Connect(ctx)
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	conn.Close()
+	if l.Port() != port {
+		t.Errorf("Port is %d, want %d", l.Port(), port)
+	}
+	if err := l.Stop(); err != nil {
+		t.Errorf("Stop failed: %v", err)
+	}
+	if !strings.HasPrefix(stderr.String(), "starting\nListening") {
+		t.Errorf("Stderr is %q, want the output of the program", stderr.String())
+	}
+
+	// A program that exits before its agent listens fails Connect at once.
+	l = launcher.New(launcher.Config{
+		Java:   fakeJava(t, "echo 'Error: Could not find or load main class Main' >&2; exit 1"),
+		Jar:    "app.jar",
+		Stdout: &bytes.Buffer{},
+		Stderr: &bytes.Buffer{},
+	})
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	start := time.Now()
+	if _, err := l.Connect(ctx); err == nil || !strings.Contains(err.Error(), "exited") {
+		t.Errorf("Connect returned %v, want an error as the process exited", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Connect took %v to fail", d)
+	}
+}
+
+func TestLauncherOutput(t *testing.T) {
+	logs := t.TempDir()
+	l := launcher.New(launcher.Config{
+		Java:   fakeJava(t, `echo one; echo oops >&2; read name; echo "hello $name"; printf partial`),
+		Jar:    "app.jar",
+		LogDir: logs,
+	})
+	output := l.Output()
+	if err := l.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer l.Stop()
+	if _, err := l.Stdin().Write([]byte("world\n")); err != nil {
+		t.Fatalf("Writing to stdin failed: %v", err)
+	}
+
+	got := map[launcher.Stream][]string{}
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case line, ok := <-output:
+			if !ok {
+				done = true
+				break
+			}
+			got[line.Stream] = append(got[line.Stream], line.Text)
+		case <-timeout:
+			t.Fatalf("Output was not closed, got %q", got)
+		}
+	}
+	want := map[launcher.Stream][]string{
+		launcher.Stdout: {"one", "hello world", "partial"},
+		launcher.Stderr: {"oops"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Output is %q, want %q", got, want)
+	}
+
+	stdout, err := os.ReadFile(filepath.Join(logs, "java_stdout.log"))
+	if err != nil {
+		t.Fatalf("Failed to read the stdout log: %v", err)
+	}
+	if string(stdout) != "one\nhello world\npartial" {
+		t.Errorf("Stdout log is %q", stdout)
+	}
+}
@@ -0,0 +1,132 @@
+package jdwp_tests_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestMonitorCommands(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	lock := vm.NewObject(vm.Class("java.lang.Object"))
+	owner := vm.AddThread("owner")
+	owner.Owned = []fakevm.Monitor{{Object: lock, Depth: 0}, {Object: lock, Depth: 2}}
+	blocked := vm.AddThread("blocked")
+	blocked.Status = jdwpclient.ThreadMonitor
+	blocked.Contended = lock
+
+	if _, err := conn.GetMonitorInfo(ctx, lock.ID); err != jdwpclient.ErrThreadNotSuspended {
+		t.Errorf("GetMonitorInfo on a running VM returned %v, want ErrThreadNotSuspended", err)
+	}
+	if err := conn.SuspendAll(ctx); err != nil {
+		t.Fatalf("SuspendAll failed: %v", err)
+	}
+	usage, err := conn.GetMonitorInfo(ctx, lock.ID)
+	want := jdwpclient.MonitorUsage{Owner: owner.ThreadID(), EntryCount: 2, Waiters: []jdwpclient.ThreadID{blocked.ThreadID()}}
+	if err != nil || !reflect.DeepEqual(usage, want) {
+		t.Errorf("GetMonitorInfo returned %+v, %v, want %+v", usage, err, want)
+	}
+	monitors, err := conn.GetOwnedMonitors(ctx, owner.ThreadID())
+	if err != nil || len(monitors) != 1 || monitors[0].Object != lock.ID {
+		t.Errorf("GetOwnedMonitors returned %+v, %v, want [%v]", monitors, err, lock.ID)
+	}
+	depths, err := conn.GetOwnedMonitorsStackDepth(ctx, owner.ThreadID())
+	if err != nil || len(depths) != 2 || depths[1].StackDepth != 2 {
+		t.Errorf("GetOwnedMonitorsStackDepth returned %+v, %v, want depths 0 and 2", depths, err)
+	}
+	contended, err := conn.GetCurrentContendedMonitor(ctx, blocked.ThreadID())
+	if err != nil || contended.Object != lock.ID {
+		t.Errorf("GetCurrentContendedMonitor returned %+v, %v, want %v", contended, err, lock.ID)
+	}
+	if contended, err := conn.GetCurrentContendedMonitor(ctx, owner.ThreadID()); err != nil || contended.Object != 0 {
+		t.Errorf("GetCurrentContendedMonitor of a running thread returned %+v, %v, want null", contended, err)
+	}
+}
+
+func TestMonitorCommandsUnsupported(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	vm := fakevm.New()
+	defer vm.Close()
+	vm.Capabilities = jdwpclient.Capabilities{}
+	conn, err := vm.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open fake VM: %v", err)
+	}
+	thread := vm.AddThread("main")
+	if _, err := conn.GetOwnedMonitors(ctx, thread.ThreadID()); !errors.Is(err, jdwpclient.ErrUnsupported) {
+		t.Errorf("GetOwnedMonitors returned %v, want ErrUnsupported", err)
+	}
+	if _, err := debugger.AnalyzeLocks(ctx, conn); !errors.Is(err, jdwpclient.ErrUnsupported) {
+		t.Errorf("AnalyzeLocks returned %v, want ErrUnsupported", err)
+	}
+}
+
+func TestAnalyzeLocks(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	class := vm.AddClass("com.example.Bank", vm.Class("java.lang.Object"))
+	transfer := class.AddMethod("transfer", "()V", jdwpclient.ModPublic, 10, 11, 12)
+	withdraw := class.AddMethod("withdraw", "()V", jdwpclient.ModPublic, 20, 21)
+	object := vm.Class("java.lang.Object")
+	account1, account2, queue := vm.NewObject(object), vm.NewObject(object), vm.NewObject(object)
+
+	// first holds account1, entered by transfer, and waits for account2.
+	first := vm.AddThread("first")
+	vm.Push(first, transfer, 11)
+	vm.Push(first, withdraw, 21)
+	first.Owned = []fakevm.Monitor{{Object: account1, Depth: 1}}
+	first.Status, first.Contended = jdwpclient.ThreadMonitor, account2
+	// second holds account2, entered by withdraw, and waits for account1.
+	second := vm.AddThread("second")
+	vm.Push(second, transfer, 12)
+	vm.Push(second, withdraw, 20)
+	second.Owned = []fakevm.Monitor{{Object: account2, Depth: 0}}
+	second.Status, second.Contended = jdwpclient.ThreadMonitor, account1
+	// third is blocked by the deadlock without being part of it.
+	third := vm.AddThread("third")
+	third.Status, third.Contended = jdwpclient.ThreadMonitor, account1
+	// consumer waits on the queue it released, which is not a contention.
+	consumer := vm.AddThread("consumer")
+	consumer.Status, consumer.Contended = jdwpclient.ThreadWait, queue
+
+	got, err := debugger.AnalyzeLocks(ctx, conn)
+	if err != nil {
+		t.Fatalf("AnalyzeLocks failed: %v", err)
+	}
+	want := debugger.LockAnalysis{
+		Contended: []debugger.ContendedMonitor{
+			{Monitor: account1.ID, Owner: first.ThreadID(), EntryCount: 1,
+				Blocked: []jdwpclient.ThreadID{second.ThreadID(), third.ThreadID()}},
+			{Monitor: account2.ID, Owner: second.ThreadID(), EntryCount: 1,
+				Blocked: []jdwpclient.ThreadID{first.ThreadID()}},
+		},
+		Deadlocks: []debugger.Deadlock{{
+			{Thread: first.ThreadID(), Name: "first", Monitor: account2.ID, Owner: second.ThreadID(),
+				Depth: 0, Acquired: withdraw.Location(20)},
+			{Thread: second.ThreadID(), Name: "second", Monitor: account1.ID, Owner: first.ThreadID(),
+				Depth: 1, Acquired: transfer.Location(11)},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AnalyzeLocks returned:\n%+v\nwant:\n%+v", got, want)
+	}
+	for _, thread := range []*fakevm.Thread{first, second, third, consumer} {
+		if vm.Suspended(thread) {
+			t.Errorf("Thread %v is still suspended after AnalyzeLocks", thread.Name)
+		}
+	}
+
+	// Without deadlock, the contention is still reported.
+	second.Status, second.Contended = jdwpclient.ThreadRunning, nil
+	got, err = debugger.AnalyzeLocks(ctx, conn)
+	if err != nil {
+		t.Fatalf("AnalyzeLocks failed: %v", err)
+	}
+	if len(got.Deadlocks) != 0 || len(got.Contended) != 2 {
+		t.Errorf("AnalyzeLocks without a deadlock returned %+v", got)
+	}
+}
@@ -0,0 +1,143 @@
+package jdwp_tests_test
+
+import (
+	"reflect"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+	"time"
+)
+
+func TestReferenceTypeCommands(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	object := vm.Class("java.lang.Object")
+	outer := vm.AddClass("com.example.Outer", object)
+	inner := vm.AddClass("com.example.Outer$Inner", object)
+	vm.AddClass("com.example.Outer$Inner$Deep", object)
+	vm.AddClass("com.example.Outer$1", object)
+	listener := vm.AddInterface("com.example.Outer$Listener")
+	loader := vm.NewObject(vm.AddClass("com.example.Loader", object))
+	outer.Loader = loader
+	outer.ModBits = jdwpclient.ModPublic | jdwpclient.ModFinal
+	outer.Status = jdwpclient.StatusVerified | jdwpclient.StatusPrepared
+	outer.SourceDebugExtension = "SMAP\nOuter.kt\nKotlin\n*E\n"
+
+	if status, err := conn.GetClassStatus(ctx, outer.ID); err != nil || status != outer.Status {
+		t.Errorf("GetClassStatus returned %v, %v, want %v", status, err, outer.Status)
+	}
+	if mods, err := conn.GetModifiers(ctx, outer.ID); err != nil || mods != outer.ModBits {
+		t.Errorf("GetModifiers returned %v, %v, want %v", mods, err, outer.ModBits)
+	}
+	if mods, err := conn.GetModifiers(ctx, listener.ID); err != nil || mods&jdwpclient.ModInterface == 0 {
+		t.Errorf("GetModifiers of an interface returned %v, %v, want interface", mods, err)
+	}
+	nested, err := conn.GetNestedTypes(ctx, outer.ID)
+	want := []jdwpclient.ObjectType{{Kind: jdwpclient.Class, Type: inner.ID}, {Kind: jdwpclient.Interface, Type: listener.ID}}
+	if err != nil || !reflect.DeepEqual(nested, want) {
+		t.Errorf("GetNestedTypes returned %+v, %v, want %+v", nested, err, want)
+	}
+	if id, err := conn.GetClassLoader(ctx, outer.ID); err != nil || id != jdwpclient.ClassLoaderID(loader.ID) {
+		t.Errorf("GetClassLoader returned %v, %v, want %v", id, err, loader.ID)
+	}
+	if id, err := conn.GetClassLoader(ctx, object.ID); err != nil || id != 0 {
+		t.Errorf("GetClassLoader of a bootstrap class returned %v, %v, want 0", id, err)
+	}
+	class, err := conn.GetClassObject(ctx, outer.ID)
+	if err != nil {
+		t.Fatalf("GetClassObject failed: %v", err)
+	}
+	if ty, err := conn.ReflectedType(ctx, class); err != nil || ty != outer.ID {
+		t.Errorf("ReflectedType of the class object returned %v, %v, want %v", ty, err, outer.ID)
+	}
+	if sde, err := conn.GetSourceDebugExtension(ctx, outer.ID); err != nil || sde != outer.SourceDebugExtension {
+		t.Errorf("GetSourceDebugExtension returned %q, %v, want %q", sde, err, outer.SourceDebugExtension)
+	}
+	if _, err := conn.GetSourceDebugExtension(ctx, inner.ID); err != jdwpclient.ErrAbsentInformation {
+		t.Errorf("GetSourceDebugExtension without attribute returned %v, want ErrAbsentInformation", err)
+	}
+}
+
+func TestTypeMetadataCache(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	class := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	class.SourceFile = "Main.java"
+
+	got, err := conn.GetTypeMetadata(ctx, class.ID)
+	if err != nil {
+		t.Fatalf("GetTypeMetadata failed: %v", err)
+	}
+	want := jdwpclient.TypeMetadata{
+		Signature:   "Lcom/example/Main;",
+		Modifiers:   jdwpclient.ModPublic,
+		ClassObject: jdwpclient.ClassObjectID(vm.ClassObject(class).ID),
+		SourceFile:  "Main.java",
+	}
+	if got != want {
+		t.Errorf("GetTypeMetadata returned %+v, want %+v", got, want)
+	}
+	if n := len(vm.Requests(jdwpclient.ClassUnload)); n != 1 {
+		t.Errorf("GetTypeMetadata set %d ClassUnload requests, want 1", n)
+	}
+	if requests := conn.EventRequests(); len(requests) != 0 {
+		t.Errorf("EventRequests returned %v, want none", requests)
+	}
+
+	vm.Lock()
+	class.SourceFile = "Renamed.java"
+	vm.Unlock()
+	if got, err := conn.GetTypeMetadata(ctx, class.ID); err != nil || got.SourceFile != "Main.java" {
+		t.Errorf("GetTypeMetadata of a cached type returned %+v, %v, want source file Main.java", got, err)
+	}
+	err = conn.RedefineClasses(ctx, []jdwpclient.ClassDefinition{{Type: class.ID, Bytes: []byte{0xca, 0xfe}}})
+	if err != nil {
+		t.Fatalf("RedefineClasses failed: %v", err)
+	}
+	if got, err := conn.GetTypeMetadata(ctx, class.ID); err != nil || got.SourceFile != "Renamed.java" {
+		t.Errorf("GetTypeMetadata of a redefined type returned %+v, %v, want source file Renamed.java", got, err)
+	}
+
+	// The events of the debugger's request are dispatched after the cache is
+	// invalidated.
+	if _, err := conn.SetEventRequest(ctx, jdwpclient.ClassUnload, jdwpclient.SuspendNone); err != nil {
+		t.Fatalf("SetEventRequest failed: %v", err)
+	}
+	if n, err := vm.UnloadClass(class); err != nil || n != 2 {
+		t.Fatalf("UnloadClass raised %d events, %v, want 2", n, err)
+	}
+	select {
+	case set := <-conn.Events():
+		if len(set.Events) != 1 {
+			t.Fatalf("Got events %+v, want ClassUnload of %v", set.Events, want.Signature)
+		}
+		if unload, ok := set.Events[0].(*jdwpclient.EventClassUnload); !ok || unload.Signature != want.Signature {
+			t.Fatalf("Got event %+v, want ClassUnload of %v", set.Events[0], want.Signature)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for the ClassUnload event")
+	}
+	if _, err := conn.GetTypeMetadata(ctx, class.ID); err != jdwpclient.ErrInvalidClass {
+		t.Errorf("GetTypeMetadata of an unloaded type returned %v, want ErrInvalidClass", err)
+	}
+}
+
+func TestTypeMetadataUnloadedWhileRead(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	class := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+
+	// The class is unloaded before the VM replies to the last command read
+	// by GetTypeMetadata.
+	vm.Handle(fakevm.Command{Set: 2, ID: 12}, func(*fakevm.Args) (interface{}, jdwpclient.Error) {
+		vm.Unlock()
+		defer vm.Lock()
+		if n, err := vm.UnloadClass(class); err != nil || n != 1 {
+			t.Errorf("UnloadClass raised %d events, %v, want 1", n, err)
+		}
+		return nil, jdwpclient.ErrAbsentInformation
+	})
+	if _, err := conn.GetTypeMetadata(ctx, class.ID); err != nil {
+		t.Fatalf("GetTypeMetadata failed: %v", err)
+	}
+	if _, err := conn.GetTypeMetadata(ctx, class.ID); err != jdwpclient.ErrInvalidClass {
+		t.Errorf("GetTypeMetadata of a type unloaded while read returned %v, want ErrInvalidClass", err)
+	}
+}
@@ -0,0 +1,85 @@
+package jdwp_tests_test
+
+import (
+	"errors"
+	"reflect"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestStepper(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic, 10, 11, 12)
+	thread := vm.AddThread("main")
+	vm.Push(thread, run, 10)
+
+	var modifiers []jdwpclient.EventModifier
+	vm.Step = func(t *fakevm.Thread, step jdwpclient.StepEventModifier) {
+		if step.Size == jdwpclient.StepLine && step.Depth == jdwpclient.StepOver {
+			t.Frames[0].Location.Location++
+		}
+		for _, r := range conn.EventRequests() {
+			if r.Kind == jdwpclient.SingleStep {
+				modifiers = r.Modifiers
+			}
+		}
+	}
+	if err := conn.SuspendAll(ctx); err != nil {
+		t.Fatalf("SuspendAll failed: %v", err)
+	}
+
+	stepper := debugger.NewStepper(debugger.NewDispatcher(ctx, conn), "java.*", "jdk.internal.*")
+	location, err := stepper.StepOver(ctx, thread.ThreadID())
+	if err != nil {
+		t.Fatalf("StepOver failed: %v", err)
+	}
+	if location != run.Location(11) {
+		t.Errorf("Stepped to %v, want %v", location, run.Location(11))
+	}
+	if !vm.Suspended(thread) {
+		t.Error("Thread not suspended after step")
+	}
+	want := []jdwpclient.EventModifier{
+		jdwpclient.StepEventModifier{Thread: thread.ThreadID(), Size: jdwpclient.StepLine, Depth: jdwpclient.StepOver},
+		jdwpclient.CountEventModifier(1),
+		jdwpclient.ClassExcludeEventModifier("java.*"),
+		jdwpclient.ClassExcludeEventModifier("jdk.internal.*"),
+	}
+	if !reflect.DeepEqual(modifiers, want) {
+		t.Errorf("Unexpected step modifiers: %v, want %v", modifiers, want)
+	}
+	for _, kind := range []jdwpclient.EventKind{jdwpclient.SingleStep, jdwpclient.ThreadDeath} {
+		if n := len(vm.Requests(kind)); n != 0 {
+			t.Errorf("%d %v requests left on the VM", n, kind)
+		}
+	}
+}
+
+func TestStepThreadDies(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	main := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic, 10)
+	thread := vm.AddThread("main")
+	vm.Push(thread, run, 10)
+	// Stepping out of the thread's last frame terminates the thread.
+	vm.Step = func(t *fakevm.Thread, step jdwpclient.StepEventModifier) {
+		t.Frames = nil
+	}
+	if err := conn.SuspendAll(ctx); err != nil {
+		t.Fatalf("SuspendAll failed: %v", err)
+	}
+
+	stepper := debugger.NewStepper(debugger.NewDispatcher(ctx, conn))
+	if _, err := stepper.StepOut(ctx, thread.ThreadID()); !errors.Is(err, debugger.ErrThreadDied) {
+		t.Fatalf("Expected ErrThreadDied, got: %v", err)
+	}
+	// Stepping the dead thread fails without waiting for a step.
+	if _, err := stepper.StepInto(ctx, thread.ThreadID()); !errors.Is(err, debugger.ErrThreadDied) {
+		t.Fatalf("Expected ErrThreadDied for dead thread, got: %v", err)
+	}
+}
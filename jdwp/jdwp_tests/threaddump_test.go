@@ -0,0 +1,122 @@
+package jdwp_tests_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/fakevm"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"strings"
+	"testing"
+)
+
+func TestDumpThreads(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	object := vm.Class("java.lang.Object")
+	main := vm.AddClass("com.example.Main", object)
+	main.SourceFile = "Main.java"
+	run := main.AddMethod("run", "()V", jdwpclient.ModPublic, 10, 11)
+	work := main.AddMethod("work", "()V", jdwpclient.ModPublic|jdwpclient.ModSynchronized, 20, 21)
+	sleep := vm.Class("java.lang.Thread").AddMethod("sleep", "(J)V", jdwpclient.ModPublic|jdwpclient.ModStatic|jdwpclient.ModNative)
+	generated := vm.AddClass("com.example.Generated", object)
+	call := generated.AddMethod("call", "()V", jdwpclient.ModPublic)
+	lock := vm.NewObject(object)
+
+	worker := vm.AddThread("worker")
+	vm.Push(worker, run, 11)
+	vm.Push(worker, work, 21)
+	worker.Owned = []fakevm.Monitor{{Object: lock, Depth: 0}}
+	sleeper := vm.AddThread("sleeper")
+	sleeper.Status = jdwpclient.ThreadSleeping
+	vm.Push(sleeper, call, 0)
+	vm.Push(sleeper, sleep, 0)
+	blocked := vm.AddThread("blocked")
+	blocked.Status, blocked.Contended = jdwpclient.ThreadMonitor, lock
+	vm.Push(blocked, work, 20)
+
+	// The debugger already suspended the sleeper, which stays suspended.
+	if err := conn.Suspend(ctx, sleeper.ThreadID()); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+
+	dump, err := debugger.DumpThreads(ctx, conn)
+	if err != nil {
+		t.Fatalf("DumpThreads failed: %v", err)
+	}
+	monitor := &debugger.DumpedMonitor{Object: lock.ID, Class: "java.lang.Object"}
+	want := []debugger.DumpedThread{
+		{ID: worker.ThreadID(), Name: "worker", Group: "system/main", Status: jdwpclient.ThreadRunning, State: "RUNNABLE",
+			Frames: []debugger.DumpedFrame{
+				{Class: "com.example.Main", Method: "work", Source: "Main.java", Line: 21, Locked: []debugger.DumpedMonitor{*monitor}},
+				{Class: "com.example.Main", Method: "run", Source: "Main.java", Line: 11},
+			}},
+		{ID: sleeper.ThreadID(), Name: "sleeper", Group: "system/main", Status: jdwpclient.ThreadSleeping,
+			State: "TIMED_WAITING (sleeping)", SuspendCount: 1,
+			Frames: []debugger.DumpedFrame{
+				{Class: "java.lang.Thread", Method: "sleep", Line: -1, Native: true},
+				{Class: "com.example.Generated", Method: "call", Line: -1},
+			}},
+		{ID: blocked.ThreadID(), Name: "blocked", Group: "system/main", Status: jdwpclient.ThreadMonitor,
+			State: "BLOCKED (on object monitor)", WaitingFor: monitor,
+			Frames: []debugger.DumpedFrame{
+				{Class: "com.example.Main", Method: "work", Source: "Main.java", Line: 20},
+			}},
+	}
+	if !reflect.DeepEqual(dump.Threads, want) {
+		t.Errorf("DumpThreads returned:\n%+v\nwant:\n%+v", dump.Threads, want)
+	}
+	if dump.VM != "fakevm (1.8.0)" {
+		t.Errorf("VM is %q, want fakevm (1.8.0)", dump.VM)
+	}
+	for _, thread := range []*fakevm.Thread{worker, blocked} {
+		if vm.Suspended(thread) {
+			t.Errorf("Thread %v is still suspended after the dump", thread.Name)
+		}
+	}
+	if count, err := conn.GetSuspendCount(ctx, sleeper.ThreadID()); err != nil || count != 1 {
+		t.Errorf("Suspend count of sleeper is %v, %v after the dump, want 1", count, err)
+	}
+
+	text := &bytes.Buffer{}
+	if err := dump.WriteText(text); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	lockText := fmt.Sprintf("<0x%016x> (a java.lang.Object)", uint64(lock.ID))
+	for _, line := range []string{
+		"Full thread dump fakevm (1.8.0):",
+		fmt.Sprintf(`"worker" #%d group="system/main" runnable`, uint64(worker.ID)),
+		"   java.lang.Thread.State: RUNNABLE",
+		"\tat com.example.Main.work(Main.java:21)\n\t- locked " + lockText + "\n\tat com.example.Main.run(Main.java:11)",
+		"\tat java.lang.Thread.sleep(Native Method)\n\tat com.example.Generated.call(Unknown Source)",
+		"   java.lang.Thread.State: BLOCKED (on object monitor)",
+		"\tat com.example.Main.work(Main.java:20)\n\t- waiting to lock " + lockText,
+	} {
+		if !strings.Contains(text.String(), line) {
+			t.Errorf("Text dump does not contain %q:\n%v", line, text)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := dump.WriteJSON(out); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded struct {
+		Threads []struct {
+			Name   string
+			State  string
+			Frames []struct {
+				Method string
+				Line   int
+			}
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode the JSON dump: %v\n%v", err, out)
+	}
+	if len(decoded.Threads) != 3 || decoded.Threads[2].State != "BLOCKED (on object monitor)" ||
+		decoded.Threads[0].Frames[1].Method != "run" || decoded.Threads[0].Frames[1].Line != 11 {
+		t.Errorf("Unexpected JSON dump:\n%v", out)
+	}
+}
@@ -0,0 +1,101 @@
+package jdwp_tests_test
+
+import (
+	"reflect"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+)
+
+func TestThreadGroups(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	system, main := vm.ThreadGroup("system"), vm.ThreadGroup("main")
+	pool := vm.AddThreadGroup("pool", main)
+	thread := vm.AddThread("main")
+
+	groups, err := conn.GetTopLevelThreadGroups(ctx)
+	if err != nil {
+		t.Fatalf("GetTopLevelThreadGroups failed: %v", err)
+	}
+	if len(groups) != 1 || groups[0] != system.ThreadGroupID() {
+		t.Errorf("Top level thread groups are %v, want [%v]", groups, system.ThreadGroupID())
+	}
+	if name, err := conn.GetThreadGroupName(ctx, pool.ThreadGroupID()); err != nil || name != "pool" {
+		t.Errorf("GetThreadGroupName returned %q, %v, want pool", name, err)
+	}
+	if parent, err := conn.GetThreadGroupParent(ctx, main.ThreadGroupID()); err != nil || parent != system.ThreadGroupID() {
+		t.Errorf("GetThreadGroupParent returned %v, %v, want %v", parent, err, system.ThreadGroupID())
+	}
+	if parent, err := conn.GetThreadGroupParent(ctx, system.ThreadGroupID()); err != nil || parent != 0 {
+		t.Errorf("GetThreadGroupParent of the top level group returned %v, %v, want 0", parent, err)
+	}
+	children, err := conn.GetThreadGroupChildren(ctx, main.ThreadGroupID())
+	if err != nil {
+		t.Fatalf("GetThreadGroupChildren failed: %v", err)
+	}
+	want := jdwpclient.ThreadGroupChildren{
+		Threads: []jdwpclient.ThreadID{thread.ThreadID()},
+		Groups:  []jdwpclient.ThreadGroupID{pool.ThreadGroupID()},
+	}
+	if !reflect.DeepEqual(children, want) {
+		t.Errorf("GetThreadGroupChildren returned %+v, want %+v", children, want)
+	}
+	if group, err := conn.GetThreadGroup(ctx, thread.ThreadID()); err != nil || group != main.ThreadGroupID() {
+		t.Errorf("GetThreadGroup returned %v, %v, want %v", group, err, main.ThreadGroupID())
+	}
+	if _, err := conn.GetThreadGroupName(ctx, jdwpclient.ThreadGroupID(thread.ID)); err != jdwpclient.ErrInvalidThreadGroup {
+		t.Errorf("GetThreadGroupName of a thread returned %v, want ErrInvalidThreadGroup", err)
+	}
+}
+
+func TestThreadSnapshot(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	system, main := vm.ThreadGroup("system"), vm.ThreadGroup("main")
+	innocuous := vm.AddThreadGroup("InnocuousThreadGroup", system)
+	pool := vm.AddThreadGroup("pool", main)
+
+	class := vm.AddClass("com.example.Main", vm.Class("java.lang.Object"))
+	run := class.AddMethod("run", "()V", jdwpclient.ModPublic, 10)
+	work := class.AddMethod("work", "()V", jdwpclient.ModPublic, 20)
+	mainThread := vm.AddThread("main")
+	vm.Push(mainThread, run, 10)
+	vm.Push(mainThread, work, 20)
+	worker := vm.AddThread("worker-1")
+	worker.Group = pool
+	worker.Status = jdwpclient.ThreadWait
+	handler := vm.AddThread("Reference Handler")
+	handler.Group = system
+	cleaner := vm.AddThread("Common-Cleaner")
+	cleaner.Group = innocuous
+	vm.AddThread("done").Status = jdwpclient.ThreadZombie
+
+	for i := 0; i < 2; i++ {
+		if err := conn.Suspend(ctx, mainThread.ThreadID()); err != nil {
+			t.Fatalf("Suspend failed: %v", err)
+		}
+	}
+
+	got, err := debugger.ThreadSnapshot(ctx, conn)
+	if err != nil {
+		t.Fatalf("ThreadSnapshot failed: %v", err)
+	}
+	want := []debugger.ThreadInfo{
+		{ID: handler.ThreadID(), Name: "Reference Handler", Status: jdwpclient.ThreadRunning, Groups: []string{"system"}, FrameCount: -1},
+		{ID: mainThread.ThreadID(), Name: "main", Status: jdwpclient.ThreadRunning, SuspendCount: 2, Groups: []string{"system", "main"}, FrameCount: 2},
+		{ID: worker.ThreadID(), Name: "worker-1", Status: jdwpclient.ThreadWait, Groups: []string{"system", "main", "pool"}, FrameCount: -1},
+		{ID: cleaner.ThreadID(), Name: "Common-Cleaner", Status: jdwpclient.ThreadRunning, Groups: []string{"system", "InnocuousThreadGroup"}, FrameCount: -1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ThreadSnapshot returned:\n%+v\nwant:\n%+v", got, want)
+	}
+
+	isSystem := []bool{true, false, false, true}
+	for i, info := range got {
+		if info.IsSystem() != isSystem[i] {
+			t.Errorf("IsSystem of %v (%v) is %v, want %v", info.Name, info.GroupPath(), info.IsSystem(), isSystem[i])
+		}
+	}
+	if path := got[2].GroupPath(); path != "system/main/pool" {
+		t.Errorf("GroupPath of worker-1 is %q, want system/main/pool", path)
+	}
+}
@@ -0,0 +1,81 @@
+package jdwp_tests_test
+
+import (
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+	"testing"
+	"time"
+)
+
+func waitWatchpointHit(t *testing.T, w *debugger.Watchpoints) debugger.WatchpointHit {
+	select {
+	case hit := <-w.Hits():
+		return hit
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for watchpoint hit")
+	}
+	return debugger.WatchpointHit{}
+}
+
+func TestWatchpoints(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+
+	order := vm.AddClass("com.example.Order", vm.Class("java.lang.Object"))
+	status := order.AddField("status", "I", jdwpclient.ModPrivate)
+	count := order.AddField("count", "I", jdwpclient.ModPrivate|jdwpclient.ModStatic)
+	count.Value = 7
+	special := vm.AddClass("com.example.SpecialOrder", order)
+	update := order.AddMethod("update", "()V", jdwpclient.ModPublic, 20)
+	thread := vm.AddThread("main")
+	vm.Push(thread, update, 20)
+
+	watched, other := vm.NewObject(special), vm.NewObject(special)
+	watched.Fields[status.ID], other.Fields[status.ID] = 1, 1
+
+	w := debugger.NewWatchpoints(debugger.NewDispatcher(ctx, conn), debugger.NewIDs())
+	wps, err := w.Set(ctx, []debugger.Watchpoint{
+		// The field is inherited from Order.
+		{Class: "com.example.SpecialOrder", Field: "status", Instance: watched.ID, Modification: true},
+		{Class: "com.example.Order", Field: "count", Access: true},
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !wps[0].Verified || !wps[1].Verified {
+		t.Fatalf("Watchpoints not verified: %+v", wps)
+	}
+
+	if n, err := vm.ModifyField(thread, other, status, 2); err != nil || n != 0 {
+		t.Fatalf("Modifying another instance raised %d events: %v", n, err)
+	}
+	if n, err := vm.ModifyField(thread, watched, status, 2); err != nil || n != 1 {
+		t.Fatalf("ModifyField raised %d events: %v", n, err)
+	}
+	hit := waitWatchpointHit(t, w)
+	if hit.Watchpoint.ID != wps[0].ID || !hit.Modification || hit.Object != watched.ID ||
+		hit.OldValue != 1 || hit.NewValue != 2 || hit.Location != update.Location(20) {
+		t.Errorf("Unexpected modification hit: %+v", hit)
+	}
+	if err := conn.ResumeAll(ctx); err != nil {
+		t.Fatalf("ResumeAll failed: %v", err)
+	}
+
+	if n, err := vm.AccessField(thread, nil, count); err != nil || n != 1 {
+		t.Fatalf("AccessField raised %d events: %v", n, err)
+	}
+	hit = waitWatchpointHit(t, w)
+	if hit.Watchpoint.ID != wps[1].ID || hit.Modification || hit.Object != 0 || hit.OldValue != 7 {
+		t.Errorf("Unexpected access hit: %+v", hit)
+	}
+}
+
+func TestWatchpointUnknownField(t *testing.T) {
+	ctx, conn, vm := openFakeVM(t)
+	vm.AddClass("com.example.Order", vm.Class("java.lang.Object"))
+
+	w := debugger.NewWatchpoints(debugger.NewDispatcher(ctx, conn), debugger.NewIDs())
+	_, err := w.Set(ctx, []debugger.Watchpoint{{Class: "com.example.Order", Field: "missing", Modification: true}})
+	if err == nil {
+		t.Fatal("Set on missing field succeeded")
+	}
+}
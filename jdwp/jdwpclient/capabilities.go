@@ -0,0 +1,208 @@
+package jdwpclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// Capabilities describes the optional features supported by the VM, as
+// returned by the VirtualMachine.CapabilitiesNew command.
+type Capabilities struct {
+	CanWatchFieldModification        bool // Can watch field modifications
+	CanWatchFieldAccess              bool // Can watch field accesses
+	CanGetBytecodes                  bool // Can get the bytecodes of a method
+	CanGetSyntheticAttribute         bool // Can test whether a field or method is synthetic
+	CanGetOwnedMonitorInfo           bool // Can get the monitors owned by a thread
+	CanGetCurrentContendedMonitor    bool // Can get the monitor a thread is waiting on
+	CanGetMonitorInfo                bool // Can get the monitor information of an object
+	CanRedefineClasses               bool // Can redefine classes
+	CanAddMethod                     bool // Can add methods when redefining classes
+	CanUnrestrictedlyRedefineClasses bool // Can redefine classes in arbitrary ways
+	CanPopFrames                     bool // Can pop stack frames
+	CanUseInstanceFilters            bool // Can filter events by their 'this' object
+	CanGetSourceDebugExtension       bool // Can get the source debug extension of a class
+	CanRequestVMDeathEvent           bool // Can request VMDeath events
+	CanSetDefaultStratum             bool // Can set the default stratum
+	CanGetInstanceInfo               bool // Can get the instances and referrers of objects
+	CanRequestMonitorEvents          bool // Can request monitor events
+	CanGetMonitorFrameInfo           bool // Can get the stack depths of owned monitors
+	CanUseSourceNameFilters          bool // Can filter class prepare events by source name
+	CanGetConstantPool               bool // Can get the constant pool of a class
+	CanForceEarlyReturn              bool // Can force a method to return early
+	Reserved22                       bool
+	Reserved23                       bool
+	Reserved24                       bool
+	Reserved25                       bool
+	Reserved26                       bool
+	Reserved27                       bool
+	Reserved28                       bool
+	Reserved29                       bool
+	Reserved30                       bool
+	Reserved31                       bool
+	Reserved32                       bool
+}
+
+// legacyCapabilities is the reply of the VirtualMachine.Capabilities command,
+// which holds the first 7 flags of Capabilities.
+type legacyCapabilities struct {
+	CanWatchFieldModification     bool
+	CanWatchFieldAccess           bool
+	CanGetBytecodes               bool
+	CanGetSyntheticAttribute      bool
+	CanGetOwnedMonitorInfo        bool
+	CanGetCurrentContendedMonitor bool
+	CanGetMonitorInfo             bool
+}
+
+// GetCapabilities queries the capabilities of the VM. VMs that do not
+// implement CapabilitiesNew report the capabilities of the older
+// Capabilities command, with all the newer capabilities unset.
+func (c *Connection) GetCapabilities(ctx context.Context) (Capabilities, error) {
+	res := Capabilities{}
+	err := c.get(ctx, cmdVirtualMachineCapabilitiesNew, struct{}{}, &res)
+	if err != ErrNotImplemented {
+		return res, err
+	}
+	legacy := legacyCapabilities{}
+	if err := c.get(ctx, cmdVirtualMachineCapabilities, struct{}{}, &legacy); err != nil {
+		return Capabilities{}, err
+	}
+	return Capabilities{
+		CanWatchFieldModification:     legacy.CanWatchFieldModification,
+		CanWatchFieldAccess:           legacy.CanWatchFieldAccess,
+		CanGetBytecodes:               legacy.CanGetBytecodes,
+		CanGetSyntheticAttribute:      legacy.CanGetSyntheticAttribute,
+		CanGetOwnedMonitorInfo:        legacy.CanGetOwnedMonitorInfo,
+		CanGetCurrentContendedMonitor: legacy.CanGetCurrentContendedMonitor,
+		CanGetMonitorInfo:             legacy.CanGetMonitorInfo,
+	}, nil
+}
+
+// Capabilities returns the capabilities of the VM, as queried when the
+// connection was opened.
+func (c *Connection) Capabilities() Capabilities { return c.capabilities }
+
+// Feature is an optional VM feature that is only available if the VM has
+// the matching capability.
+type Feature int
+
+const (
+	// FieldModificationWatchpoints is the feature of FieldModification events.
+	FieldModificationWatchpoints Feature = iota
+	// FieldAccessWatchpoints is the feature of FieldAccess events.
+	FieldAccessWatchpoints
+	// InstanceFilters is the feature of the InstanceOnlyEventModifier.
+	InstanceFilters
+	// RedefineClasses is the feature of the VirtualMachine.RedefineClasses
+	// command.
+	RedefineClasses
+	// PopFrames is the feature of the StackFrame.PopFrames command.
+	PopFrames
+	// ForceEarlyReturn is the feature of the ThreadReference.ForceEarlyReturn
+	// command.
+	ForceEarlyReturn
+	// InstanceInfo is the feature of the instance and referrer queries.
+	InstanceInfo
+	// MonitorInfo is the feature of the object monitor queries.
+	MonitorInfo
+	// OwnedMonitorInfo is the feature of the thread owned monitor queries.
+	OwnedMonitorInfo
+	// CurrentContendedMonitor is the feature of the thread contended monitor
+	// queries.
+	CurrentContendedMonitor
+	// SourceDebugExtension is the feature of the
+	// ReferenceType.SourceDebugExtension command.
+	SourceDebugExtension
+	// MonitorFrameInfo is the feature of the stack depths of owned monitors.
+	MonitorFrameInfo
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FieldModificationWatchpoints:
+		return "Field modification watchpoints"
+	case FieldAccessWatchpoints:
+		return "Field access watchpoints"
+	case InstanceFilters:
+		return "Instance filters"
+	case RedefineClasses:
+		return "Redefining classes"
+	case PopFrames:
+		return "Popping frames"
+	case ForceEarlyReturn:
+		return "Forcing early return"
+	case InstanceInfo:
+		return "Instance info"
+	case MonitorInfo:
+		return "Monitor info"
+	case OwnedMonitorInfo:
+		return "Owned monitor info"
+	case CurrentContendedMonitor:
+		return "Current contended monitor"
+	case SourceDebugExtension:
+		return "Source debug extension"
+	case MonitorFrameInfo:
+		return "Monitor frame info"
+	}
+	return fmt.Sprintf("Feature<%d>", int(f))
+}
+
+// Supports returns true if the VM has the capability required by the feature.
+func (c Capabilities) Supports(f Feature) bool {
+	switch f {
+	case FieldModificationWatchpoints:
+		return c.CanWatchFieldModification
+	case FieldAccessWatchpoints:
+		return c.CanWatchFieldAccess
+	case InstanceFilters:
+		return c.CanUseInstanceFilters
+	case RedefineClasses:
+		return c.CanRedefineClasses
+	case PopFrames:
+		return c.CanPopFrames
+	case ForceEarlyReturn:
+		return c.CanForceEarlyReturn
+	case InstanceInfo:
+		return c.CanGetInstanceInfo
+	case MonitorInfo:
+		return c.CanGetMonitorInfo
+	case OwnedMonitorInfo:
+		return c.CanGetOwnedMonitorInfo
+	case CurrentContendedMonitor:
+		return c.CanGetCurrentContendedMonitor
+	case SourceDebugExtension:
+		return c.CanGetSourceDebugExtension
+	case MonitorFrameInfo:
+		return c.CanGetMonitorFrameInfo
+	}
+	return false
+}
+
+// Require returns an UnsupportedError if the VM does not have the capability
+// required by the feature, otherwise nil.
+func (c Capabilities) Require(f Feature) error {
+	if !c.Supports(f) {
+		return UnsupportedError{Feature: f}
+	}
+	return nil
+}
+
+// UnsupportedError is the error returned when using a feature that the VM
+// does not have the capability for.
+type UnsupportedError struct {
+	Feature Feature
+}
+
+// ErrUnsupported can be used with errors.Is to test whether an error is an
+// UnsupportedError.
+var ErrUnsupported = UnsupportedError{Feature: -1}
+
+func (e UnsupportedError) Error() string {
+	return fmt.Sprintf("%v unsupported by target VM", e.Feature)
+}
+
+// Is returns true if target is an UnsupportedError.
+func (e UnsupportedError) Is(target error) bool {
+	_, ok := target.(UnsupportedError)
+	return ok
+}
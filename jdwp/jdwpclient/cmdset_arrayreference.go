@@ -14,31 +14,41 @@
 
 package jdwpclient
 
+import "context"
+
 // GetArrayLength returns the length of the specified array.
-func (c *Connection) GetArrayLength(id ArrayID) (int, error) {
+func (c *Connection) GetArrayLength(ctx context.Context, id ArrayID) (int, error) {
 	var res int
-	err := c.get(cmdArrayReferenceLength, id, &res)
+	err := c.get(ctx, cmdArrayReferenceLength, id, &res)
 	return res, err
 }
 
-// GetArrayValues the values of the specified array.
-func (c *Connection) GetArrayValues(id ArrayID, first, length int) ([]Value, error) {
+// ArrayRegion is a range of values of an array, which all have the type of the
+// array's elements.
+type ArrayRegion struct {
+	Tag    Tag // The tag of the array's element type
+	Values []Value
+}
+
+// GetArrayValues returns length values of the specified array, starting at
+// the index first.
+func (c *Connection) GetArrayValues(ctx context.Context, id ArrayID, first, length int) ([]Value, error) {
 	req := struct {
 		ID     ArrayID
 		First  int
 		Length int
 	}{id, first, length}
-	var res []Value
-	err := c.get(cmdArrayReferenceGetValues, req, &res)
-	return res, err
+	var res ArrayRegion
+	err := c.get(ctx, cmdArrayReferenceGetValues, req, &res)
+	return res.Values, err
 }
 
 // SetArrayValues the values of the specified array.
-func (c *Connection) SetArrayValues(id ArrayID, first int, values interface{}) error {
+func (c *Connection) SetArrayValues(ctx context.Context, id ArrayID, first int, values interface{}) error {
 	req := struct {
 		ID     ArrayID
 		First  int
 		Values interface{}
 	}{id, first, values}
-	return c.get(cmdArrayReferenceSetValues, req, nil)
+	return c.get(ctx, cmdArrayReferenceSetValues, req, nil)
 }
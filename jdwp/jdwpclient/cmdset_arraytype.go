@@ -14,13 +14,15 @@
 
 package jdwpclient
 
+import "context"
+
 // NewArray constructs a new array of the specified type and length.
-func (c *Connection) NewArray(ty ArrayTypeID, length int) (TaggedObjectID, error) {
+func (c *Connection) NewArray(ctx context.Context, ty ArrayTypeID, length int) (TaggedObjectID, error) {
 	req := struct {
 		Ty     ArrayTypeID
 		Length int
 	}{ty, length}
 	var res TaggedObjectID
-	err := c.get(cmdArrayTypeNewInstance, req, &res)
+	err := c.get(ctx, cmdArrayTypeNewInstance, req, &res)
 	return res, err
 }
@@ -14,8 +14,10 @@
 
 package jdwpclient
 
+import "context"
+
 // ReflectedType returns the reference type reflected by the class object.
-func (c *Connection) ReflectedType(id ClassObjectID) (ReferenceTypeID, error) {
+func (c *Connection) ReflectedType(ctx context.Context, id ClassObjectID) (ReferenceTypeID, error) {
 	req := struct {
 		ID ClassObjectID
 	}{id}
@@ -23,6 +25,6 @@ func (c *Connection) ReflectedType(id ClassObjectID) (ReferenceTypeID, error) {
 		Kind byte
 		ID   ReferenceTypeID
 	}
-	err := c.get(cmdClassObjectReferenceReflectedType, req, &res)
+	err := c.get(ctx, cmdClassObjectReferenceReflectedType, req, &res)
 	return res.ID, err
 }
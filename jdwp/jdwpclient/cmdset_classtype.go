@@ -14,6 +14,8 @@
 
 package jdwpclient
 
+import "context"
+
 // InvokeResult holds the return values for a method invokation.
 type InvokeResult struct {
 	Result    Value
@@ -21,14 +23,23 @@ type InvokeResult struct {
 }
 
 // GetSuperClass returns the immediate super class of the specified class.
-func (c *Connection) GetSuperClass(class ClassID) (ClassID, error) {
+func (c *Connection) GetSuperClass(ctx context.Context, class ClassID) (ClassID, error) {
 	var res ClassID
-	err := c.get(cmdClassTypeSuperclass, class, &res)
+	err := c.get(ctx, cmdClassTypeSuperclass, class, &res)
 	return res, err
 }
 
+// SetStaticFieldValues sets the values of static fields declared by the
+// class. The values must be of the Go types used for the fields' types.
+func (c *Connection) SetStaticFieldValues(ctx context.Context, class ClassID, values ...FieldValue) error {
+	return c.get(ctx, cmdClassTypeSetValues, struct {
+		Class  ClassID
+		Values []untaggedFieldValue
+	}{class, untagged(values)}, nil)
+}
+
 // InvokeStaticMethod invokes the specified static method.
-func (c *Connection) InvokeStaticMethod(class ClassID, method MethodID, thread ThreadID, options InvokeOptions, args ...Value) (InvokeResult, error) {
+func (c *Connection) InvokeStaticMethod(ctx context.Context, class ClassID, method MethodID, thread ThreadID, options InvokeOptions, args ...Value) (InvokeResult, error) {
 	req := struct {
 		Class   ClassID
 		Thread  ThreadID
@@ -37,7 +48,7 @@ func (c *Connection) InvokeStaticMethod(class ClassID, method MethodID, thread T
 		Options InvokeOptions
 	}{class, thread, method, args, options}
 	var res InvokeResult
-	err := c.get(cmdClassTypeInvokeMethod, req, &res)
+	err := c.get(ctx, cmdClassTypeInvokeMethod, req, &res)
 	return res, err
 }
 
@@ -48,7 +59,7 @@ type NewInstanceResult struct {
 }
 
 // NewInstance invokes the specified constructor.
-func (c *Connection) NewInstance(class ClassID, constructor MethodID, thread ThreadID, options InvokeOptions, args ...Value) (NewInstanceResult, error) {
+func (c *Connection) NewInstance(ctx context.Context, class ClassID, constructor MethodID, thread ThreadID, options InvokeOptions, args ...Value) (NewInstanceResult, error) {
 	req := struct {
 		Class       ClassID
 		Thread      ThreadID
@@ -57,6 +68,6 @@ func (c *Connection) NewInstance(class ClassID, constructor MethodID, thread Thr
 		Options     InvokeOptions
 	}{class, thread, constructor, args, options}
 	var res NewInstanceResult
-	err := c.get(cmdClassTypeNewInstance, req, &res)
+	err := c.get(ctx, cmdClassTypeNewInstance, req, &res)
 	return res, err
 }
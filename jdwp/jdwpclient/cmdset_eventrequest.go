@@ -15,9 +15,13 @@
 package jdwpclient
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"reflect"
+	"sapelkinav/javadap/jdwp/data/endian"
 	"sapelkinav/javadap/jdwp/event/task"
+	"sort"
 )
 
 // EventRequestID is an identifier of an event request.
@@ -25,15 +29,55 @@ type EventRequestID int
 
 const cmdCompositeEvent = cmdID(100)
 
-// WatchEvents sets an event watcher, calling handler for each received event.
-// WatchEvents will continue to watch for events until handler returns false or
-// the context is cancelled.
-func (c *Connection) WatchEvents(
+// EventRequest is a handle to an event request set on the VM. The request
+// stays active until it is cleared with ClearEventRequest, and its events are
+// delivered on the stream returned by Events.
+type EventRequest struct {
+	ID            EventRequestID
+	Kind          EventKind
+	SuspendPolicy SuspendPolicy
+	Modifiers     []EventModifier
+}
+
+func (r *EventRequest) String() string {
+	return fmt.Sprintf("EventRequest<%d: %v, %v, %v>", int(r.ID), r.Kind, r.SuspendPolicy, r.Modifiers)
+}
+
+// SetEventRequest sets a new event request on the VM.
+// No threads are resumed by setting the request. If the request needs a
+// capability that the VM does not have, SetEventRequest returns an
+// UnsupportedError.
+func (c *Connection) SetEventRequest(
 	ctx context.Context,
 	kind EventKind,
-	suspendPolity SuspendPolicy,
-	handler func(Event) bool,
-	modifiers ...EventModifier) error {
+	suspendPolicy SuspendPolicy,
+	modifiers ...EventModifier) (*EventRequest, error) {
+	return c.setEventRequest(ctx, kind, suspendPolicy, nil, modifiers)
+}
+
+// watcher receives the events raised by a request instead of the event
+// stream.
+type watcher struct {
+	events chan Event
+	done   chan struct{} // Closed once events is no longer read.
+}
+
+func newWatcher() *watcher {
+	return &watcher{events: make(chan Event, 8), done: make(chan struct{})}
+}
+
+// setEventRequest sets a new event request on the VM. If w is not nil then the
+// events raised by the request are sent to w instead of the event stream.
+func (c *Connection) setEventRequest(
+	ctx context.Context,
+	kind EventKind,
+	suspendPolicy SuspendPolicy,
+	w *watcher,
+	modifiers []EventModifier) (*EventRequest, error) {
+
+	if err := c.checkEventRequest(kind, modifiers); err != nil {
+		return nil, err
+	}
 
 	req := struct {
 		Kind          EventKind
@@ -41,35 +85,162 @@ func (c *Connection) WatchEvents(
 		Modifiers     []EventModifier
 	}{
 		Kind:          kind,
-		SuspendPolicy: suspendPolity,
+		SuspendPolicy: suspendPolicy,
 		Modifiers:     modifiers,
 	}
 
-	var id EventRequestID
-	err := c.get(cmdEventRequestSet, req, &id)
-	if err != nil {
-		return err
+	out := &EventRequest{
+		Kind:          kind,
+		SuspendPolicy: suspendPolicy,
+		Modifiers:     modifiers,
 	}
 
-	events := make(chan Event, 8)
+	// Register the request as the reply is received, before recv can process
+	// any event raised by the new request.
+	onReply := func(reply replyPacket) {
+		if reply.err != ErrNone {
+			return
+		}
+		var id EventRequestID
+		d := endian.Reader(bytes.NewReader(reply.data), endian.BigEndian)
+		if err := c.decode(d, reflect.ValueOf(&id)); err != nil {
+			return
+		}
+		c.Lock()
+		out.ID = id
+		c.requests[id] = out
+		if w != nil {
+			c.events[id] = w
+		}
+		c.Unlock()
+	}
+
+	if err := c.getWithHook(ctx, cmdEventRequestSet, req, &out.ID, onReply); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// checkEventRequest returns an UnsupportedError if the VM does not have the
+// capabilities required by the event kind or modifiers.
+func (c *Connection) checkEventRequest(kind EventKind, modifiers []EventModifier) error {
+	switch kind {
+	case FieldAccess:
+		if err := c.capabilities.Require(FieldAccessWatchpoints); err != nil {
+			return err
+		}
+	case FieldModification:
+		if err := c.capabilities.Require(FieldModificationWatchpoints); err != nil {
+			return err
+		}
+	}
+	for _, m := range modifiers {
+		if _, ok := m.(InstanceOnlyEventModifier); ok {
+			return c.capabilities.Require(InstanceFilters)
+		}
+	}
+	return nil
+}
+
+// ClearEventRequest clears the event request. No further events are
+// delivered for the request.
+func (c *Connection) ClearEventRequest(ctx context.Context, req *EventRequest) error {
 	c.Lock()
-	c.events[id] = events
+	delete(c.requests, req.ID)
 	c.Unlock()
 
-	defer func() {
+	clear := struct {
+		Kind EventKind
+		ID   EventRequestID
+	}{
+		Kind: req.Kind,
+		ID:   req.ID,
+	}
+	// Events raised before the VM clears the request still go to its
+	// watcher, so they do not leak onto the event stream.
+	onReply := func(replyPacket) {
 		c.Lock()
-		delete(c.events, id)
+		delete(c.events, req.ID)
 		c.Unlock()
-	}()
+	}
+	return c.getWithHook(ctx, cmdEventRequestClear, clear, nil, onReply)
+}
 
-	if err := c.ResumeAll(); err != nil {
+// ClearAllBreakpoints clears all the breakpoint event requests.
+func (c *Connection) ClearAllBreakpoints(ctx context.Context) error {
+	if err := c.get(ctx, cmdEventRequestClearAllBreakpoints, struct{}{}, nil); err != nil {
 		return err
 	}
+	c.Lock()
+	for id, req := range c.requests {
+		if req.Kind == Breakpoint {
+			delete(c.requests, id)
+			delete(c.events, id)
+		}
+	}
+	c.Unlock()
+	return nil
+}
+
+// EventRequests returns all the active event requests, ordered by identifier.
+func (c *Connection) EventRequests() []*EventRequest {
+	c.Lock()
+	out := make([]*EventRequest, 0, len(c.requests))
+	for _, req := range c.requests {
+		out = append(out, req)
+	}
+	c.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Events returns the stream of events raised by the VM, with the events of
+// each composite event in one EventSet. This includes the events of all the
+// requests set with SetEventRequest, as well as the automatically generated
+// VMStart and VMDeath events.
+// The stream is closed when the connection is closed.
+func (c *Connection) Events() <-chan EventSet {
+	return c.stream
+}
+
+// WatchEvents sets an event watcher, calling handler for each received event.
+// WatchEvents watches for events until handler returns false or the context is
+// cancelled. No threads are resumed by setting the request.
+// The watched events are not delivered on the Events stream.
+func (c *Connection) WatchEvents(
+	ctx context.Context,
+	kind EventKind,
+	suspendPolicy SuspendPolicy,
+	handler func(Event) bool,
+	modifiers ...EventModifier) error {
+
+	return c.watchEvents(ctx, kind, suspendPolicy, nil, handler, modifiers)
+}
+
+// watchEvents is WatchEvents calling started, if not nil, once the request is
+// set.
+func (c *Connection) watchEvents(
+	ctx context.Context,
+	kind EventKind,
+	suspendPolicy SuspendPolicy,
+	started func() error,
+	handler func(Event) bool,
+	modifiers []EventModifier) error {
+
+	w := newWatcher()
+	req, err := c.setEventRequest(ctx, kind, suspendPolicy, w, modifiers)
+	if err != nil {
+		return err
+	}
+
+	if started != nil {
+		err = started()
+	}
 
 run: // Consume events until the handler returns false or the context is cancelled.
-	for {
+	for err == nil {
 		select {
-		case event := <-events:
+		case event := <-w.events:
 			if !handler(event) {
 				break run
 			}
@@ -77,24 +248,22 @@ run: // Consume events until the handler returns false or the context is cancell
 			break run
 		}
 	}
+	// recv drops the events that don't fit in the buffer from now on, as it
+	// must not block while the request is cleared.
+	close(w.done)
 
-	//  Clear the event.
-	clear := struct {
-		Kind EventKind
-		ID   EventRequestID
-	}{
-		Kind: kind,
-		ID:   id,
+	// The request must be cleared even if ctx has been cancelled.
+	if clearErr := c.ClearEventRequest(context.WithoutCancel(ctx), req); err == nil {
+		err = clearErr
 	}
-
-	if err := c.get(cmdEventRequestClear, clear, nil); err != nil {
+	if err != nil {
 		return err
 	}
 
 flush: // Consume any remaining events in the pipe.
 	for {
 		select {
-		case event := <-events:
+		case event := <-w.events:
 			handler(event)
 		default:
 			break flush
@@ -164,8 +333,8 @@ type FieldOnlyEventModifier struct {
 // Can only be used with step events.
 type StepEventModifier struct {
 	Thread ThreadID
-	Size   int
-	Depth  int
+	Size   StepSize
+	Depth  StepDepth
 }
 
 // InstanceOnlyEventModifier is an EventModifier that filters events to those
@@ -183,6 +352,34 @@ func (FieldOnlyEventModifier) modKind() uint8     { return 9 }
 func (StepEventModifier) modKind() uint8          { return 10 }
 func (InstanceOnlyEventModifier) modKind() uint8  { return 11 }
 
+// modifierOfKind returns a zero EventModifier of the given modKind, or nil if
+// the kind is not known.
+func modifierOfKind(kind uint8) EventModifier {
+	switch kind {
+	case 1:
+		return CountEventModifier(0)
+	case 3:
+		return ThreadOnlyEventModifier(0)
+	case 4:
+		return ClassOnlyEventModifier(0)
+	case 5:
+		return ClassMatchEventModifier("")
+	case 6:
+		return ClassExcludeEventModifier("")
+	case 7:
+		return LocationOnlyEventModifier{}
+	case 8:
+		return ExceptionOnlyEventModifier{}
+	case 9:
+		return FieldOnlyEventModifier{}
+	case 10:
+		return StepEventModifier{}
+	case 11:
+		return InstanceOnlyEventModifier(0)
+	}
+	return nil
+}
+
 func (m CountEventModifier) String() string {
 	return fmt.Sprintf("CountEventModifier<%v>", int(m))
 }
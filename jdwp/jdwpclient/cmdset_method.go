@@ -14,14 +14,78 @@
 
 package jdwpclient
 
+import "context"
+
 // VariableTable returns all of the variables that are present in the given
 // Method.
-func (c *Connection) VariableTable(classTy ReferenceTypeID, method MethodID) (VariableTable, error) {
+func (c *Connection) VariableTable(ctx context.Context, classTy ReferenceTypeID, method MethodID) (VariableTable, error) {
 	req := struct {
 		Class  ReferenceTypeID
 		Method MethodID
 	}{classTy, method}
 	var res VariableTable
-	err := c.get(cmdMethodTypeVariableTable, req, &res)
+	err := c.get(ctx, cmdMethodTypeVariableTable, req, &res)
+	return res, err
+}
+
+// LineTableEntry maps a code index to a source line number.
+type LineTableEntry struct {
+	CodeIndex  uint64
+	LineNumber int
+}
+
+// LineTable describes the source lines of a method.
+type LineTable struct {
+	Start uint64 // Lowest valid code index for the method.
+	End   uint64 // Highest valid code index for the method.
+	Lines []LineTableEntry
+}
+
+// LineTable returns the line number table for the given method.
+// If the method is native or abstract, LineTable returns ErrNativeMethod or
+// ErrAbsentInformation.
+func (c *Connection) LineTable(ctx context.Context, classTy ReferenceTypeID, method MethodID) (LineTable, error) {
+	req := struct {
+		Class  ReferenceTypeID
+		Method MethodID
+	}{classTy, method}
+	var res LineTable
+	err := c.get(ctx, cmdMethodTypeLineTable, req, &res)
+	return res, err
+}
+
+// Lookup returns the lowest code index that maps to the given source line, and
+// true. If the line has no code in the method, Lookup returns false.
+func (t LineTable) Lookup(line int) (uint64, bool) {
+	found, best := false, uint64(0)
+	for _, e := range t.Lines {
+		if e.LineNumber == line && (!found || e.CodeIndex < best) {
+			found, best = true, e.CodeIndex
+		}
+	}
+	return best, found
+}
+
+// LineOf returns the source line for the code index, or -1 if the line is not
+// known.
+func (t LineTable) LineOf(codeIndex uint64) int {
+	line, best := -1, uint64(0)
+	for _, e := range t.Lines {
+		if e.CodeIndex <= codeIndex && (line < 0 || e.CodeIndex >= best) {
+			line, best = e.LineNumber, e.CodeIndex
+		}
+	}
+	return line
+}
+
+// IsObsolete returns true if the method has been replaced by a non-equivalent
+// method by a RedefineClasses call.
+func (c *Connection) IsObsolete(ctx context.Context, classTy ReferenceTypeID, method MethodID) (bool, error) {
+	req := struct {
+		Class  ReferenceTypeID
+		Method MethodID
+	}{classTy, method}
+	var res bool
+	err := c.get(ctx, cmdMethodTypeIsObsolete, req, &res)
 	return res, err
 }
@@ -14,6 +14,8 @@
 
 package jdwpclient
 
+import "context"
+
 // ObjectType describes a Java type.
 type ObjectType struct {
 	Kind TypeTag
@@ -21,24 +23,87 @@ type ObjectType struct {
 }
 
 // GetObjectType returns the type of the specified object.
-func (c *Connection) GetObjectType(object ObjectID) (ObjectType, error) {
+func (c *Connection) GetObjectType(ctx context.Context, object ObjectID) (ObjectType, error) {
 	var res ObjectType
-	err := c.get(cmdObjectReferenceReferenceType, object, &res)
+	err := c.get(ctx, cmdObjectReferenceReferenceType, object, &res)
 	return res, err
 }
 
 // GetFieldValues returns the values of all the instance fields.
-func (c *Connection) GetFieldValues(obj ObjectID, fields ...FieldID) ([]Value, error) {
+func (c *Connection) GetFieldValues(ctx context.Context, obj ObjectID, fields ...FieldID) ([]Value, error) {
 	var res []Value
-	err := c.get(cmdObjectReferenceGetValues, struct {
+	err := c.get(ctx, cmdObjectReferenceGetValues, struct {
 		Obj    ObjectID
 		Fields []FieldID
 	}{obj, fields}, &res)
 	return res, err
 }
 
+// FieldValue is a value to assign to a field.
+type FieldValue struct {
+	Field FieldID
+	Value Value
+}
+
+// untagged returns the field values as they are encoded in a SetValues
+// command, where the values are not prefixed with their tags.
+func untagged(values []FieldValue) []untaggedFieldValue {
+	out := make([]untaggedFieldValue, len(values))
+	for i, v := range values {
+		out[i] = untaggedFieldValue{v.Field, v.Value}
+	}
+	return out
+}
+
+type untaggedFieldValue struct {
+	Field FieldID
+	Value untaggedValue
+}
+
+// SetFieldValues sets the values of instance fields of the object. The
+// values must be of the Go types used for the fields' types.
+func (c *Connection) SetFieldValues(ctx context.Context, obj ObjectID, values ...FieldValue) error {
+	return c.get(ctx, cmdObjectReferenceSetValues, struct {
+		Obj    ObjectID
+		Values []untaggedFieldValue
+	}{obj, untagged(values)}, nil)
+}
+
+// MonitorUsage describes the monitor of an object.
+type MonitorUsage struct {
+	Owner      ThreadID   // The thread owning the monitor, or zero.
+	EntryCount int        // The number of times the owner entered the monitor.
+	Waiters    []ThreadID // The threads waiting to enter or re-enter the monitor.
+}
+
+// GetMonitorInfo returns the usage of the object's monitor. All the threads of
+// the VM must be suspended.
+func (c *Connection) GetMonitorInfo(ctx context.Context, obj ObjectID) (MonitorUsage, error) {
+	if err := c.capabilities.Require(MonitorInfo); err != nil {
+		return MonitorUsage{}, err
+	}
+	var res MonitorUsage
+	err := c.get(ctx, cmdObjectReferenceMonitorInfo, obj, &res)
+	return res, err
+}
+
+// GetReferringObjects returns up to max objects that directly reference the
+// object, or all of them if max is zero. Only reachable objects are returned.
+func (c *Connection) GetReferringObjects(ctx context.Context, obj ObjectID, max int) ([]TaggedObjectID, error) {
+	if err := c.capabilities.Require(InstanceInfo); err != nil {
+		return nil, err
+	}
+	req := struct {
+		Obj ObjectID
+		Max int
+	}{obj, max}
+	res := []TaggedObjectID{}
+	err := c.get(ctx, cmdObjectReferenceReferringObjects, req, &res)
+	return res, err
+}
+
 // InvokeMethod invokes the specified static method.
-func (c *Connection) InvokeMethod(object ObjectID, class ClassID, method MethodID, thread ThreadID, options InvokeOptions, args ...Value) (InvokeResult, error) {
+func (c *Connection) InvokeMethod(ctx context.Context, object ObjectID, class ClassID, method MethodID, thread ThreadID, options InvokeOptions, args ...Value) (InvokeResult, error) {
 	req := struct {
 		Object  ObjectID
 		Thread  ThreadID
@@ -48,16 +113,16 @@ func (c *Connection) InvokeMethod(object ObjectID, class ClassID, method MethodI
 		Options InvokeOptions
 	}{object, thread, class, method, args, options}
 	var res InvokeResult
-	err := c.get(cmdObjectReferenceInvokeMethod, req, &res)
+	err := c.get(ctx, cmdObjectReferenceInvokeMethod, req, &res)
 	return res, err
 }
 
 // DisableGC disables garbage collection for the specified object.
-func (c *Connection) DisableGC(object ObjectID) error {
-	return c.get(cmdObjectReferenceDisableCollection, object, nil)
+func (c *Connection) DisableGC(ctx context.Context, object ObjectID) error {
+	return c.get(ctx, cmdObjectReferenceDisableCollection, object, nil)
 }
 
 // EnableGC enables garbage collection for the specified object.
-func (c *Connection) EnableGC(object ObjectID) error {
-	return c.get(cmdObjectReferenceEnableCollection, object, nil)
+func (c *Connection) EnableGC(ctx context.Context, object ObjectID) error {
+	return c.get(ctx, cmdObjectReferenceEnableCollection, object, nil)
 }
@@ -14,31 +14,107 @@
 
 package jdwpclient
 
+import "context"
+
 // GetTypeSignature returns the Java type signature for the specified type.
-func (c *Connection) GetTypeSignature(ty ReferenceTypeID) (string, error) {
+func (c *Connection) GetTypeSignature(ctx context.Context, ty ReferenceTypeID) (string, error) {
 	var res string
-	err := c.get(cmdReferenceTypeSignature, ty, &res)
+	err := c.get(ctx, cmdReferenceTypeSignature, ty, &res)
+	return res, err
+}
+
+// GetSourceFile returns the name of the source file that declares the type,
+// without its path, such as "Main.java". It returns ErrAbsentInformation if
+// the class file has no source file attribute.
+func (c *Connection) GetSourceFile(ctx context.Context, ty ReferenceTypeID) (string, error) {
+	var res string
+	err := c.get(ctx, cmdReferenceTypeSourceFile, ty, &res)
+	return res, err
+}
+
+// GetClassLoader returns the class loader that loaded the type, or 0 if the
+// type was loaded by the bootstrap class loader.
+func (c *Connection) GetClassLoader(ctx context.Context, ty ReferenceTypeID) (ClassLoaderID, error) {
+	var res ClassLoaderID
+	err := c.get(ctx, cmdReferenceTypeClassLoader, ty, &res)
+	return res, err
+}
+
+// GetModifiers returns the modifiers of the type, as declared in its class
+// file.
+func (c *Connection) GetModifiers(ctx context.Context, ty ReferenceTypeID) (ModBits, error) {
+	var res ModBits
+	err := c.get(ctx, cmdReferenceTypeModifiers, ty, &res)
+	return res, err
+}
+
+// GetNestedTypes returns the loaded classes and interfaces declared as
+// members of the type. Local and anonymous classes are not included.
+func (c *Connection) GetNestedTypes(ctx context.Context, ty ReferenceTypeID) ([]ObjectType, error) {
+	res := []ObjectType{}
+	err := c.get(ctx, cmdReferenceTypeNestedTypes, ty, &res)
+	return res, err
+}
+
+// GetClassStatus returns the current loading state of the type.
+func (c *Connection) GetClassStatus(ctx context.Context, ty ReferenceTypeID) (ClassStatus, error) {
+	var res ClassStatus
+	err := c.get(ctx, cmdReferenceTypeStatus, ty, &res)
+	return res, err
+}
+
+// GetClassObject returns the java.lang.Class instance of the type.
+func (c *Connection) GetClassObject(ctx context.Context, ty ReferenceTypeID) (ClassObjectID, error) {
+	var res ClassObjectID
+	err := c.get(ctx, cmdReferenceTypeClassObject, ty, &res)
+	return res, err
+}
+
+// GetSourceDebugExtension returns the SourceDebugExtension attribute of the
+// type, such as the SMAP of a class compiled from a JSP or a Kotlin inline
+// function. It returns ErrAbsentInformation if the class file has none.
+func (c *Connection) GetSourceDebugExtension(ctx context.Context, ty ReferenceTypeID) (string, error) {
+	if err := c.capabilities.Require(SourceDebugExtension); err != nil {
+		return "", err
+	}
+	var res string
+	err := c.get(ctx, cmdReferenceTypeSourceDebugExtension, ty, &res)
+	return res, err
+}
+
+// GetInstances returns up to max reachable instances of the type, or all of
+// them if max is zero.
+func (c *Connection) GetInstances(ctx context.Context, ty ReferenceTypeID, max int) ([]TaggedObjectID, error) {
+	if err := c.capabilities.Require(InstanceInfo); err != nil {
+		return nil, err
+	}
+	req := struct {
+		Type ReferenceTypeID
+		Max  int
+	}{ty, max}
+	res := []TaggedObjectID{}
+	err := c.get(ctx, cmdReferenceTypeInstances, req, &res)
 	return res, err
 }
 
 // GetFields returns all the fields for the specified type.
-func (c *Connection) GetFields(ty ReferenceTypeID) (Fields, error) {
+func (c *Connection) GetFields(ctx context.Context, ty ReferenceTypeID) (Fields, error) {
 	var res Fields
-	err := c.get(cmdReferenceTypeFields, ty, &res)
+	err := c.get(ctx, cmdReferenceTypeFields, ty, &res)
 	return res, err
 }
 
 // GetMethods returns all the methods for the specified type.
-func (c *Connection) GetMethods(ty ReferenceTypeID) (Methods, error) {
+func (c *Connection) GetMethods(ctx context.Context, ty ReferenceTypeID) (Methods, error) {
 	var res Methods
-	err := c.get(cmdReferenceTypeMethods, ty, &res)
+	err := c.get(ctx, cmdReferenceTypeMethods, ty, &res)
 	return res, err
 }
 
 // GetStaticFieldValues returns the values of all the requests static fields.
-func (c *Connection) GetStaticFieldValues(ty ReferenceTypeID, fields ...FieldID) ([]Value, error) {
+func (c *Connection) GetStaticFieldValues(ctx context.Context, ty ReferenceTypeID, fields ...FieldID) ([]Value, error) {
 	var res []Value
-	err := c.get(cmdReferenceTypeGetValues, struct {
+	err := c.get(ctx, cmdReferenceTypeGetValues, struct {
 		Ty     ReferenceTypeID
 		Fields []FieldID
 	}{ty, fields}, &res)
@@ -47,8 +123,8 @@ func (c *Connection) GetStaticFieldValues(ty ReferenceTypeID, fields ...FieldID)
 
 // GetImplemented returns all the direct interfaces implemented by the specified
 // type.
-func (c *Connection) GetImplemented(ty ReferenceTypeID) ([]InterfaceID, error) {
+func (c *Connection) GetImplemented(ctx context.Context, ty ReferenceTypeID) ([]InterfaceID, error) {
 	var res []InterfaceID
-	err := c.get(cmdReferenceTypeInterfaces, ty, &res)
+	err := c.get(ctx, cmdReferenceTypeInterfaces, ty, &res)
 	return res, err
 }
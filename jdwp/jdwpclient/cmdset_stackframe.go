@@ -14,15 +14,17 @@
 
 package jdwpclient
 
+import "context"
+
 // GetThisObject returns the this object for the specified thread and stack
 // frame.
-func (c *Connection) GetThisObject(thread ThreadID, frame FrameID) (TaggedObjectID, error) {
+func (c *Connection) GetThisObject(ctx context.Context, thread ThreadID, frame FrameID) (TaggedObjectID, error) {
 	req := struct {
 		Thread ThreadID
 		Frame  FrameID
 	}{thread, frame}
 	res := TaggedObjectID{}
-	err := c.get(cmdStackFrameThisObject, req, &res)
+	err := c.get(ctx, cmdStackFrameThisObject, req, &res)
 	return res, err
 }
 
@@ -33,14 +35,14 @@ type VariableRequest struct {
 
 // GetValues returns the set of objects for the specified thread and frame,
 // based on their slots.
-func (c *Connection) GetValues(thread ThreadID, frame FrameID, slots []VariableRequest) ([]Value, error) {
+func (c *Connection) GetValues(ctx context.Context, thread ThreadID, frame FrameID, slots []VariableRequest) ([]Value, error) {
 	req := struct {
 		Thread ThreadID
 		Frame  FrameID
 		Slots  []VariableRequest
 	}{thread, frame, slots}
 	res := ValueSlice{}
-	err := c.get(cmdStackFrameGetValues, req, &res)
+	err := c.get(ctx, cmdStackFrameGetValues, req, &res)
 	return res, err
 }
 
@@ -50,13 +52,28 @@ type VariableAssignmentRequest struct {
 }
 
 // SetValues sets the values for the local variables given thread and frame
-func (c *Connection) SetValues(thread ThreadID, frame FrameID, slots []VariableAssignmentRequest) error {
+func (c *Connection) SetValues(ctx context.Context, thread ThreadID, frame FrameID, slots []VariableAssignmentRequest) error {
 	req := struct {
 		Thread ThreadID
 		Frame  FrameID
 		Slots  []VariableAssignmentRequest
 	}{thread, frame, slots}
 
-	err := c.get(cmdStackFrameSetValues, req, nil)
+	err := c.get(ctx, cmdStackFrameSetValues, req, nil)
 	return err
 }
+
+// PopFrames pops the stack frames of the suspended thread up to and including
+// frame. The thread resumes at the instruction that invoked the method of
+// frame, so resuming the thread invokes the method again. The values of the
+// popped frames are lost, and locks held by them are released.
+func (c *Connection) PopFrames(ctx context.Context, thread ThreadID, frame FrameID) error {
+	if err := c.capabilities.Require(PopFrames); err != nil {
+		return err
+	}
+	req := struct {
+		Thread ThreadID
+		Frame  FrameID
+	}{thread, frame}
+	return c.get(ctx, cmdStackFramePopFrames, req, nil)
+}
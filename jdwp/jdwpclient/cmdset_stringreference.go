@@ -14,9 +14,11 @@
 
 package jdwpclient
 
+import "context"
+
 // GetString returns the string text for the given StringID.
-func (c *Connection) GetString(id StringID) (string, error) {
+func (c *Connection) GetString(ctx context.Context, id StringID) (string, error) {
 	var res string
-	err := c.get(cmdStringReferenceValue, id, &res)
+	err := c.get(ctx, cmdStringReferenceValue, id, &res)
 	return res, err
 }
@@ -0,0 +1,33 @@
+package jdwpclient
+
+import "context"
+
+// GetThreadGroupName returns the name of the thread group.
+func (c *Connection) GetThreadGroupName(ctx context.Context, id ThreadGroupID) (string, error) {
+	var res string
+	err := c.get(ctx, cmdThreadGroupReferenceName, id, &res)
+	return res, err
+}
+
+// GetThreadGroupParent returns the parent of the thread group, or zero for a
+// top level thread group.
+func (c *Connection) GetThreadGroupParent(ctx context.Context, id ThreadGroupID) (ThreadGroupID, error) {
+	var res ThreadGroupID
+	err := c.get(ctx, cmdThreadGroupReferenceParent, id, &res)
+	return res, err
+}
+
+// ThreadGroupChildren holds the live threads and the active thread groups
+// directly contained in a thread group.
+type ThreadGroupChildren struct {
+	Threads []ThreadID
+	Groups  []ThreadGroupID
+}
+
+// GetThreadGroupChildren returns the threads and thread groups directly
+// contained in the thread group.
+func (c *Connection) GetThreadGroupChildren(ctx context.Context, id ThreadGroupID) (ThreadGroupChildren, error) {
+	var res ThreadGroupChildren
+	err := c.get(ctx, cmdThreadGroupReferenceChildren, id, &res)
+	return res, err
+}
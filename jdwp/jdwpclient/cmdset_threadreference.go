@@ -14,32 +14,34 @@
 
 package jdwpclient
 
+import "context"
+
 // GetThreadName returns a thread's name.
-func (c *Connection) GetThreadName(id ThreadID) (string, error) {
+func (c *Connection) GetThreadName(ctx context.Context, id ThreadID) (string, error) {
 	var res string
-	err := c.get(cmdThreadReferenceName, id, &res)
+	err := c.get(ctx, cmdThreadReferenceName, id, &res)
 	return res, err
 }
 
 // Suspend suspends the specified thread.
-func (c *Connection) Suspend(id ThreadID) error {
+func (c *Connection) Suspend(ctx context.Context, id ThreadID) error {
 	var res struct{}
-	return c.get(cmdThreadReferenceSuspend, id, &res)
+	return c.get(ctx, cmdThreadReferenceSuspend, id, &res)
 }
 
 // Resume resumes the specified thread.
-func (c *Connection) Resume(id ThreadID) error {
+func (c *Connection) Resume(ctx context.Context, id ThreadID) error {
 	var res struct{}
-	return c.get(cmdThreadReferenceResume, id, &res)
+	return c.get(ctx, cmdThreadReferenceResume, id, &res)
 }
 
 // GetThreadStatus returns the status of the thread.
-func (c *Connection) GetThreadStatus(id ThreadID) (ThreadStatus, SuspendStatus, error) {
+func (c *Connection) GetThreadStatus(ctx context.Context, id ThreadID) (ThreadStatus, SuspendStatus, error) {
 	var res struct {
 		T ThreadStatus
 		S SuspendStatus
 	}
-	err := c.get(cmdThreadReferenceStatus, id, &res)
+	err := c.get(ctx, cmdThreadReferenceStatus, id, &res)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -48,15 +50,73 @@ func (c *Connection) GetThreadStatus(id ThreadID) (ThreadStatus, SuspendStatus,
 
 // GetSuspendCount returns the number of times the thread has been suspended
 // without a corresponding resume.
-func (c *Connection) GetSuspendCount(id ThreadID) (int, error) {
+func (c *Connection) GetSuspendCount(ctx context.Context, id ThreadID) (int, error) {
 	var count int
-	err := c.get(cmdThreadReferenceSuspendCount, id, &count)
+	err := c.get(ctx, cmdThreadReferenceSuspendCount, id, &count)
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
+// GetThreadGroup returns the thread group that the thread belongs to.
+func (c *Connection) GetThreadGroup(ctx context.Context, id ThreadID) (ThreadGroupID, error) {
+	var res ThreadGroupID
+	err := c.get(ctx, cmdThreadReferenceThreadGroup, id, &res)
+	return res, err
+}
+
+// GetFrameCount returns the number of frames on the suspended thread's stack.
+func (c *Connection) GetFrameCount(ctx context.Context, id ThreadID) (int, error) {
+	var count int
+	err := c.get(ctx, cmdThreadReferenceFrameCount, id, &count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetOwnedMonitors returns the objects whose monitors are owned by the
+// suspended thread.
+func (c *Connection) GetOwnedMonitors(ctx context.Context, id ThreadID) ([]TaggedObjectID, error) {
+	if err := c.capabilities.Require(OwnedMonitorInfo); err != nil {
+		return nil, err
+	}
+	var res []TaggedObjectID
+	err := c.get(ctx, cmdThreadReferenceOwnedMonitors, id, &res)
+	return res, err
+}
+
+// GetCurrentContendedMonitor returns the object whose monitor the suspended
+// thread waits to enter, or waits on with Object.wait. The object is null if
+// the thread does not wait for a monitor.
+func (c *Connection) GetCurrentContendedMonitor(ctx context.Context, id ThreadID) (TaggedObjectID, error) {
+	if err := c.capabilities.Require(CurrentContendedMonitor); err != nil {
+		return TaggedObjectID{}, err
+	}
+	var res TaggedObjectID
+	err := c.get(ctx, cmdThreadReferenceCurrentContendedMonitor, id, &res)
+	return res, err
+}
+
+// OwnedMonitor is a monitor owned by a thread, with the depth of the stack
+// frame that entered it.
+type OwnedMonitor struct {
+	Monitor    TaggedObjectID
+	StackDepth int // The index of the frame from the top of the stack, or -1 if unknown.
+}
+
+// GetOwnedMonitorsStackDepth returns the monitors owned by the suspended
+// thread, with the stack depths at which they were entered.
+func (c *Connection) GetOwnedMonitorsStackDepth(ctx context.Context, id ThreadID) ([]OwnedMonitor, error) {
+	if err := c.capabilities.Require(MonitorFrameInfo); err != nil {
+		return nil, err
+	}
+	var res []OwnedMonitor
+	err := c.get(ctx, cmdThreadReferenceOwnedMonitorsStackDepth, id, &res)
+	return res, err
+}
+
 // FrameInfo describes a single stack frame.
 type FrameInfo struct {
 	Frame    FrameID
@@ -64,13 +124,27 @@ type FrameInfo struct {
 }
 
 // GetFrames returns a number of stack frames.
-func (c *Connection) GetFrames(thread ThreadID, start, count int) ([]FrameInfo, error) {
+func (c *Connection) GetFrames(ctx context.Context, thread ThreadID, start, count int) ([]FrameInfo, error) {
 
 	req := struct {
 		Thread       ThreadID
 		Start, Count int
 	}{thread, start, count}
 	var res []FrameInfo
-	err := c.get(cmdThreadReferenceFrames, req, &res)
+	err := c.get(ctx, cmdThreadReferenceFrames, req, &res)
 	return res, err
 }
+
+// ForceEarlyReturn makes the top frame of the suspended thread return value
+// without executing the remainder of its method once the thread is resumed.
+// Methods returning void must be given a nil value.
+func (c *Connection) ForceEarlyReturn(ctx context.Context, thread ThreadID, value Value) error {
+	if err := c.capabilities.Require(ForceEarlyReturn); err != nil {
+		return err
+	}
+	req := struct {
+		Thread ThreadID
+		Value  Value
+	}{thread, value}
+	return c.get(ctx, cmdThreadReferenceForceEarlyReturn, req, nil)
+}
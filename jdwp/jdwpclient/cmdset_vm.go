@@ -14,6 +14,8 @@
 
 package jdwpclient
 
+import "context"
+
 // Version describes the JDWP version
 type Version struct {
 	Description string //		Text information on the VM version
@@ -24,9 +26,9 @@ type Version struct {
 }
 
 // GetVersion returns the JDWP version from the server.
-func (c *Connection) GetVersion() (Version, error) {
+func (c *Connection) GetVersion(ctx context.Context) (Version, error) {
 	res := Version{}
-	err := c.get(cmdVirtualMachineVersion, struct{}{}, &res)
+	err := c.get(ctx, cmdVirtualMachineVersion, struct{}{}, &res)
 	return res, err
 }
 
@@ -45,13 +47,13 @@ func (c ClassInfo) ClassID() ClassID {
 
 // GetClassesBySignature returns all the loaded classes matching the requested
 // signature from the server.
-func (c *Connection) GetClassesBySignature(signature string) ([]ClassInfo, error) {
+func (c *Connection) GetClassesBySignature(ctx context.Context, signature string) ([]ClassInfo, error) {
 	res := []struct {
 		Kind   TypeTag
 		TypeID ReferenceTypeID
 		Status ClassStatus
 	}{}
-	err := c.get(cmdVirtualMachineClassesBySignature, &signature, &res)
+	err := c.get(ctx, cmdVirtualMachineClassesBySignature, &signature, &res)
 	out := make([]ClassInfo, len(res))
 	for i, c := range res {
 		out[i] = ClassInfo{c.Kind, c.TypeID, signature, c.Status}
@@ -60,16 +62,34 @@ func (c *Connection) GetClassesBySignature(signature string) ([]ClassInfo, error
 }
 
 // GetAllClasses returns all the active threads by ID.
-func (c *Connection) GetAllClasses() ([]ClassInfo, error) {
+func (c *Connection) GetAllClasses(ctx context.Context) ([]ClassInfo, error) {
 	res := []ClassInfo{}
-	err := c.get(cmdVirtualMachineAllClasses, struct{}{}, &res)
+	err := c.get(ctx, cmdVirtualMachineAllClasses, struct{}{}, &res)
+	return res, err
+}
+
+// GetInstanceCounts returns the number of reachable instances of each of the
+// reference types, in the same order.
+func (c *Connection) GetInstanceCounts(ctx context.Context, types ...ReferenceTypeID) ([]int64, error) {
+	if err := c.capabilities.Require(InstanceInfo); err != nil {
+		return nil, err
+	}
+	res := []int64{}
+	err := c.get(ctx, cmdVirtualMachineInstanceCounts, types, &res)
 	return res, err
 }
 
 // GetAllThreads returns all the active threads by ID.
-func (c *Connection) GetAllThreads() ([]ThreadID, error) {
+func (c *Connection) GetAllThreads(ctx context.Context) ([]ThreadID, error) {
 	res := []ThreadID{}
-	err := c.get(cmdVirtualMachineAllThreads, struct{}{}, &res)
+	err := c.get(ctx, cmdVirtualMachineAllThreads, struct{}{}, &res)
+	return res, err
+}
+
+// GetTopLevelThreadGroups returns the thread groups that have no parent.
+func (c *Connection) GetTopLevelThreadGroups(ctx context.Context) ([]ThreadGroupID, error) {
+	res := []ThreadGroupID{}
+	err := c.get(ctx, cmdVirtualMachineTopLevelThreadGroups, struct{}{}, &res)
 	return res, err
 }
 
@@ -83,33 +103,66 @@ type IDSizes struct {
 }
 
 // GetIDSizes returns the sizes of all the variably sized data types.
-func (c *Connection) GetIDSizes() (IDSizes, error) {
+func (c *Connection) GetIDSizes(ctx context.Context) (IDSizes, error) {
 	res := IDSizes{}
-	err := c.get(cmdVirtualMachineIDSizes, struct{}{}, &res)
+	err := c.get(ctx, cmdVirtualMachineIDSizes, struct{}{}, &res)
 	return res, err
 }
 
 // SuspendAll suspends all threads.
-func (c *Connection) SuspendAll() error {
-	return c.get(cmdVirtualMachineSuspend, struct{}{}, nil)
+func (c *Connection) SuspendAll(ctx context.Context) error {
+	return c.get(ctx, cmdVirtualMachineSuspend, struct{}{}, nil)
 }
 
 // ResumeAll resumes all threads.
-func (c *Connection) ResumeAll() error {
-	return c.get(cmdVirtualMachineResume, struct{}{}, nil)
+func (c *Connection) ResumeAll(ctx context.Context) error {
+	return c.get(ctx, cmdVirtualMachineResume, struct{}{}, nil)
 }
 
 // ResumeAllExcept resumes all threads except for the specified thread.
-func (c *Connection) ResumeAllExcept(thread ThreadID) error {
-	if err := c.Suspend(thread); err != nil {
+func (c *Connection) ResumeAllExcept(ctx context.Context, thread ThreadID) error {
+	if err := c.Suspend(ctx, thread); err != nil {
 		return err
 	}
-	return c.ResumeAll()
+	return c.ResumeAll(ctx)
 }
 
 // CreateString returns the StringID for the given string.
-func (c *Connection) CreateString(str string) (StringID, error) {
+func (c *Connection) CreateString(ctx context.Context, str string) (StringID, error) {
 	res := StringID(0)
-	err := c.get(cmdVirtualMachineCreateString, str, &res)
+	err := c.get(ctx, cmdVirtualMachineCreateString, str, &res)
 	return res, err
 }
+
+// Dispose invalidates the connection to the VM. All event requests are
+// cancelled and all threads suspended by the debugger are resumed.
+func (c *Connection) Dispose(ctx context.Context) error {
+	return c.get(ctx, cmdVirtualMachineDispose, struct{}{}, nil)
+}
+
+// Exit terminates the target VM with the given exit code.
+func (c *Connection) Exit(ctx context.Context, code int) error {
+	return c.get(ctx, cmdVirtualMachineExit, code, nil)
+}
+
+// ClassDefinition is a new class file for a loaded reference type.
+type ClassDefinition struct {
+	Type  ReferenceTypeID // The reference type to redefine
+	Bytes []byte          // The new class file, in the JVM class file format
+}
+
+// RedefineClasses replaces the definitions of the loaded reference types with
+// the new class files. Threads keep executing the old code of active frames,
+// whose methods become obsolete if they were changed by the redefinition.
+func (c *Connection) RedefineClasses(ctx context.Context, classes []ClassDefinition) error {
+	if err := c.capabilities.Require(RedefineClasses); err != nil {
+		return err
+	}
+	if err := c.get(ctx, cmdVirtualMachineRedefineClasses, classes, nil); err != nil {
+		return err
+	}
+	for _, def := range classes {
+		c.forgetTypes(def.Type)
+	}
+	return nil
+}
@@ -31,6 +31,21 @@ func unbox(v reflect.Value) reflect.Value {
 	return v
 }
 
+// Encode writes the value v to w, using the JDWP encoding scheme with IDs of
+// the given sizes. Encode and Decode are exposed for implementing the VM side
+// of the protocol, such as in tests.
+func Encode(w binary.Writer, sizes IDSizes, v interface{}) error {
+	c := Connection{idSizes: sizes}
+	return c.encode(w, reflect.ValueOf(v))
+}
+
+// Decode reads the value pointed to by v from r, using the JDWP encoding
+// scheme with IDs of the given sizes.
+func Decode(r binary.Reader, sizes IDSizes, v interface{}) error {
+	c := Connection{idSizes: sizes}
+	return c.decode(r, reflect.ValueOf(v))
+}
+
 // encode writes the value v to w, using the JDWP encoding scheme.
 func (c *Connection) encode(w binary.Writer, v reflect.Value) error {
 	if debug {
@@ -49,6 +64,26 @@ func (c *Connection) encode(w binary.Writer, v reflect.Value) error {
 		// EventModifier's are prefixed with their 1-byte modKind.
 		w.Uint8(o.(EventModifier).modKind())
 
+	case reflect.TypeOf((*Event)(nil)).Elem():
+		// Events are prefixed with their 1-byte kind.
+		w.Uint8(uint8(o.(Event).Kind()))
+
+	case reflect.TypeOf(ArrayRegion{}):
+		// Array regions are prefixed with the tag of their values, which are
+		// only tagged if they are objects.
+		region := o.(ArrayRegion)
+		w.Uint8(uint8(region.Tag))
+		w.Uint32(uint32(len(region.Values)))
+		values := reflect.ValueOf(region.Values)
+		for i := range region.Values {
+			value := values.Index(i)
+			if region.Tag.IsPrimitive() {
+				value = value.Elem()
+			}
+			c.encode(w, value)
+		}
+		return w.Error()
+
 	case reflect.TypeOf((*Value)(nil)).Elem():
 		// values are prefixed with their 1-tag type.
 		switch o.(type) {
@@ -71,7 +106,9 @@ func (c *Connection) encode(w binary.Writer, v reflect.Value) error {
 		case int64:
 			w.Uint8(uint8(TagLong))
 		case nil:
+			// Void values have no data after the tag.
 			w.Uint8(uint8(TagVoid))
+			return w.Error()
 		case bool:
 			w.Uint8(uint8(TagBoolean))
 		case StringID:
@@ -169,50 +206,49 @@ func (c *Connection) decode(r binary.Reader, v reflect.Value) error {
 		v = v.Elem()
 		// Continue to decode event body below.
 
+	case reflect.TypeOf((*EventModifier)(nil)).Elem():
+		modifier := modifierOfKind(r.Uint8())
+		if modifier == nil {
+			return fmt.Errorf("Unknown event modifier kind")
+		}
+		data := reflect.New(reflect.TypeOf(modifier)).Elem()
+		if err := c.decode(r, data); err != nil {
+			return err
+		}
+		v.Set(data)
+		return r.Error()
+
 	case reflect.TypeOf((*Value)(nil)).Elem():
 		tag := Tag(r.Uint8())
-		var ty reflect.Type
-		switch tag {
-		case TagArray:
-			ty = reflect.TypeOf(ArrayID(0))
-		case TagByte:
-			ty = reflect.TypeOf(byte(0))
-		case TagChar:
-			ty = reflect.TypeOf(Char(0))
-		case TagObject:
-			ty = reflect.TypeOf(ObjectID(0))
-		case TagFloat:
-			ty = reflect.TypeOf(float32(0))
-		case TagDouble:
-			ty = reflect.TypeOf(float64(0))
-		case TagInt:
-			ty = reflect.TypeOf(int(0))
-		case TagShort:
-			ty = reflect.TypeOf(int16(0))
-		case TagLong:
-			ty = reflect.TypeOf(int64(0))
-		case TagBoolean:
-			ty = reflect.TypeOf(false)
-		case TagString:
-			ty = reflect.TypeOf(StringID(0))
-		case TagThread:
-			ty = reflect.TypeOf(ThreadID(0))
-		case TagThreadGroup:
-			ty = reflect.TypeOf(ThreadGroupID(0))
-		case TagClassLoader:
-			ty = reflect.TypeOf(ClassLoaderID(0))
-		case TagClassObject:
-			ty = reflect.TypeOf(ClassObjectID(0))
-		case TagVoid:
+		if tag == TagVoid {
 			v.Set(reflect.New(v.Type()).Elem())
 			return r.Error()
-		default:
+		}
+		ty := tag.valueType()
+		if ty == nil {
 			panic(fmt.Errorf("Unhandled value type %v", tag))
 		}
 		data := reflect.New(ty).Elem()
 		c.decode(r, data)
 		v.Set(data)
 		return r.Error()
+
+	case reflect.TypeOf(ArrayRegion{}):
+		// Array regions are prefixed with the tag of their values, which are
+		// only tagged if they are objects.
+		region := ArrayRegion{Tag: Tag(r.Uint8())}
+		region.Values = make([]Value, r.Uint32())
+		for i := range region.Values {
+			if !region.Tag.IsPrimitive() {
+				c.decode(r, reflect.ValueOf(&region.Values[i]).Elem())
+				continue
+			}
+			data := reflect.New(region.Tag.valueType()).Elem()
+			c.decode(r, data)
+			region.Values[i] = data.Interface()
+		}
+		v.Set(reflect.ValueOf(region))
+		return r.Error()
 	}
 
 	t := v.Type()
@@ -230,9 +266,6 @@ func (c *Connection) decode(r binary.Reader, v reflect.Value) error {
 	case ObjectID, ThreadID, ThreadGroupID, StringID, ClassLoaderID, ClassObjectID, ArrayID:
 		v.Set(reflect.ValueOf(binary.ReadUint(r, c.idSizes.ObjectIDSize*8)).Convert(t))
 
-	case EventModifier:
-		panic("Cannot decode EventModifiers")
-
 	default:
 		switch t.Kind() {
 		case reflect.Ptr, reflect.Interface:
@@ -255,6 +288,10 @@ func (c *Connection) decode(r binary.Reader, v reflect.Value) error {
 			v.Set(reflect.ValueOf(r.Int32()).Convert(t))
 		case reflect.Int64:
 			v.Set(reflect.ValueOf(r.Int64()).Convert(t))
+		case reflect.Float32:
+			v.Set(reflect.ValueOf(r.Float32()).Convert(t))
+		case reflect.Float64:
+			v.Set(reflect.ValueOf(r.Float64()).Convert(t))
 		case reflect.Struct:
 			for i, count := 0, v.NumField(); i < count; i++ {
 				c.decode(r, v.Field(i))
@@ -272,3 +309,41 @@ func (c *Connection) decode(r binary.Reader, v reflect.Value) error {
 	}
 	return r.Error()
 }
+
+// valueType returns the type of the Values with the tag, or nil if the tag
+// has no values.
+func (t Tag) valueType() reflect.Type {
+	switch t {
+	case TagArray:
+		return reflect.TypeOf(ArrayID(0))
+	case TagByte:
+		return reflect.TypeOf(byte(0))
+	case TagChar:
+		return reflect.TypeOf(Char(0))
+	case TagObject:
+		return reflect.TypeOf(ObjectID(0))
+	case TagFloat:
+		return reflect.TypeOf(float32(0))
+	case TagDouble:
+		return reflect.TypeOf(float64(0))
+	case TagInt:
+		return reflect.TypeOf(int(0))
+	case TagShort:
+		return reflect.TypeOf(int16(0))
+	case TagLong:
+		return reflect.TypeOf(int64(0))
+	case TagBoolean:
+		return reflect.TypeOf(false)
+	case TagString:
+		return reflect.TypeOf(StringID(0))
+	case TagThread:
+		return reflect.TypeOf(ThreadID(0))
+	case TagThreadGroup:
+		return reflect.TypeOf(ThreadGroupID(0))
+	case TagClassLoader:
+		return reflect.TypeOf(ClassLoaderID(0))
+	case TagClassObject:
+		return reflect.TypeOf(ClassObjectID(0))
+	}
+	return nil
+}
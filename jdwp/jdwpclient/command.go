@@ -98,6 +98,7 @@ var (
 	cmdVirtualMachineRedefineClasses       = cmd{cmdSetVirtualMachine, 18}
 	cmdVirtualMachineSetDefaultStratum     = cmd{cmdSetVirtualMachine, 19}
 	cmdVirtualMachineAllClassesWithGeneric = cmd{cmdSetVirtualMachine, 20}
+	cmdVirtualMachineInstanceCounts        = cmd{cmdSetVirtualMachine, 21}
 
 	cmdReferenceTypeSignature            = cmd{cmdSetReferenceType, 1}
 	cmdReferenceTypeClassLoader          = cmd{cmdSetReferenceType, 2}
@@ -114,6 +115,7 @@ var (
 	cmdReferenceTypeSignatureWithGeneric = cmd{cmdSetReferenceType, 13}
 	cmdReferenceTypeFieldsWithGeneric    = cmd{cmdSetReferenceType, 14}
 	cmdReferenceTypeMethodsWithGeneric   = cmd{cmdSetReferenceType, 15}
+	cmdReferenceTypeInstances            = cmd{cmdSetReferenceType, 16}
 
 	cmdClassTypeSuperclass   = cmd{cmdSetClassType, 1}
 	cmdClassTypeSetValues    = cmd{cmdSetClassType, 2}
@@ -136,6 +138,7 @@ var (
 	cmdObjectReferenceDisableCollection = cmd{cmdSetObjectReference, 7}
 	cmdObjectReferenceEnableCollection  = cmd{cmdSetObjectReference, 8}
 	cmdObjectReferenceIsCollected       = cmd{cmdSetObjectReference, 9}
+	cmdObjectReferenceReferringObjects  = cmd{cmdSetObjectReference, 10}
 
 	cmdStringReferenceValue = cmd{cmdSetStringReference, 1}
 
@@ -151,6 +154,8 @@ var (
 	cmdThreadReferenceStop                    = cmd{cmdSetThreadReference, 10}
 	cmdThreadReferenceInterrupt               = cmd{cmdSetThreadReference, 11}
 	cmdThreadReferenceSuspendCount            = cmd{cmdSetThreadReference, 12}
+	cmdThreadReferenceOwnedMonitorsStackDepth = cmd{cmdSetThreadReference, 13}
+	cmdThreadReferenceForceEarlyReturn        = cmd{cmdSetThreadReference, 14}
 
 	cmdThreadGroupReferenceName     = cmd{cmdSetThreadGroupReference, 1}
 	cmdThreadGroupReferenceParent   = cmd{cmdSetThreadGroupReference, 2}
@@ -205,6 +210,7 @@ func init() {
 	register(cmdVirtualMachineRedefineClasses, "RedefineClasses")
 	register(cmdVirtualMachineSetDefaultStratum, "SetDefaultStratum")
 	register(cmdVirtualMachineAllClassesWithGeneric, "AllClassesWithGeneric")
+	register(cmdVirtualMachineInstanceCounts, "InstanceCounts")
 
 	register(cmdReferenceTypeSignature, "Signature")
 	register(cmdReferenceTypeClassLoader, "ClassLoader")
@@ -221,6 +227,7 @@ func init() {
 	register(cmdReferenceTypeSignatureWithGeneric, "SignatureWithGeneric")
 	register(cmdReferenceTypeFieldsWithGeneric, "FieldsWithGeneric")
 	register(cmdReferenceTypeMethodsWithGeneric, "MethodsWithGeneric")
+	register(cmdReferenceTypeInstances, "Instances")
 
 	register(cmdClassTypeSuperclass, "Superclass")
 	register(cmdClassTypeSetValues, "SetValues")
@@ -243,6 +250,7 @@ func init() {
 	register(cmdObjectReferenceDisableCollection, "DisableCollection")
 	register(cmdObjectReferenceEnableCollection, "EnableCollection")
 	register(cmdObjectReferenceIsCollected, "IsCollected")
+	register(cmdObjectReferenceReferringObjects, "ReferringObjects")
 
 	register(cmdStringReferenceValue, "Value")
 
@@ -258,6 +266,8 @@ func init() {
 	register(cmdThreadReferenceStop, "Stop")
 	register(cmdThreadReferenceInterrupt, "Interrupt")
 	register(cmdThreadReferenceSuspendCount, "SuspendCount")
+	register(cmdThreadReferenceOwnedMonitorsStackDepth, "OwnedMonitorsStackDepthInfo")
+	register(cmdThreadReferenceForceEarlyReturn, "ForceEarlyReturn")
 
 	register(cmdThreadGroupReferenceName, "Name")
 	register(cmdThreadGroupReferenceParent, "Parent")
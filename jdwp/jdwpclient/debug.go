@@ -14,11 +14,11 @@
 
 package jdwpclient
 
-import "fmt"
-
+// dbg logs the packet traffic at debug level. It goes through the component
+// logger rather than stdout, as stdout may be carrying a DAP stream.
 func dbg(msg string, args ...interface{}) {
 	const enabled = true
 	if enabled {
-		fmt.Println(fmt.Sprintf(msg, args...))
+		log.Debug().Msgf(msg, args...)
 	}
 }
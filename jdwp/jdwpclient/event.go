@@ -14,15 +14,19 @@
 
 package jdwpclient
 
-// events is a collection of events.
-type events struct {
+// EventSet is the set of events of a composite event, which the VM raises
+// together, such as a breakpoint and a step completing at the same location.
+// The threads suspended by the events are suspended once for the whole set.
+type EventSet struct {
 	Policy SuspendPolicy
 	Events []Event
 }
 
 // Event is the interface implemented by all events raised by the VM.
 type Event interface {
-	request() EventRequestID
+	// RequestID returns the identifier of the request that raised the event,
+	// or 0 for automatically generated events.
+	RequestID() EventRequestID
 	Kind() EventKind
 }
 
@@ -125,19 +129,19 @@ type EventFieldModification struct {
 	NewValue  Value
 }
 
-func (e EventVMStart) request() EventRequestID           { return e.Request }
-func (e EventVMDeath) request() EventRequestID           { return e.Request }
-func (e EventSingleStep) request() EventRequestID        { return e.Request }
-func (e EventBreakpoint) request() EventRequestID        { return e.Request }
-func (e EventMethodEntry) request() EventRequestID       { return e.Request }
-func (e EventMethodExit) request() EventRequestID        { return e.Request }
-func (e EventException) request() EventRequestID         { return e.Request }
-func (e EventThreadStart) request() EventRequestID       { return e.Request }
-func (e EventThreadDeath) request() EventRequestID       { return e.Request }
-func (e EventClassPrepare) request() EventRequestID      { return e.Request }
-func (e EventClassUnload) request() EventRequestID       { return e.Request }
-func (e EventFieldAccess) request() EventRequestID       { return e.Request }
-func (e EventFieldModification) request() EventRequestID { return e.Request }
+func (e EventVMStart) RequestID() EventRequestID           { return e.Request }
+func (e EventVMDeath) RequestID() EventRequestID           { return e.Request }
+func (e EventSingleStep) RequestID() EventRequestID        { return e.Request }
+func (e EventBreakpoint) RequestID() EventRequestID        { return e.Request }
+func (e EventMethodEntry) RequestID() EventRequestID       { return e.Request }
+func (e EventMethodExit) RequestID() EventRequestID        { return e.Request }
+func (e EventException) RequestID() EventRequestID         { return e.Request }
+func (e EventThreadStart) RequestID() EventRequestID       { return e.Request }
+func (e EventThreadDeath) RequestID() EventRequestID       { return e.Request }
+func (e EventClassPrepare) RequestID() EventRequestID      { return e.Request }
+func (e EventClassUnload) RequestID() EventRequestID       { return e.Request }
+func (e EventFieldAccess) RequestID() EventRequestID       { return e.Request }
+func (e EventFieldModification) RequestID() EventRequestID { return e.Request }
 
 // Kind returns VMStart
 func (EventVMStart) Kind() EventKind { return VMStart }
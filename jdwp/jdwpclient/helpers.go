@@ -22,8 +22,8 @@ import (
 // GetClassBySignature returns the single loaded class matching the requested
 // signature from the server. If there are no, or more than one class found,
 // then an error is returned.
-func (c *Connection) GetClassBySignature(signature string) (ClassInfo, error) {
-	classes, err := c.GetClassesBySignature(signature)
+func (c *Connection) GetClassBySignature(ctx context.Context, signature string) (ClassInfo, error) {
+	classes, err := c.GetClassesBySignature(ctx, signature)
 	if err != nil {
 		return ClassInfo{}, err
 	}
@@ -35,8 +35,8 @@ func (c *Connection) GetClassBySignature(signature string) (ClassInfo, error) {
 }
 
 // GetLocationMethodName returns the name of the method from the location.
-func (c *Connection) GetLocationMethodName(l Location) (string, error) {
-	methods, err := c.GetMethods(ReferenceTypeID(l.Class))
+func (c *Connection) GetLocationMethodName(ctx context.Context, l Location) (string, error) {
+	methods, err := c.GetMethods(ctx, ReferenceTypeID(l.Class))
 	if err != nil {
 		return "", err
 	}
@@ -48,8 +48,8 @@ func (c *Connection) GetLocationMethodName(l Location) (string, error) {
 }
 
 // GetClassMethod looks up the method with the specified signature on class.
-func (c *Connection) GetClassMethod(class ClassID, name, signature string) (Method, error) {
-	methods, err := c.GetMethods(ReferenceTypeID(class))
+func (c *Connection) GetClassMethod(ctx context.Context, class ClassID, name, signature string) (Method, error) {
+	methods, err := c.GetMethods(ctx, ReferenceTypeID(class))
 	if err != nil {
 		return Method{}, err
 	}
@@ -60,9 +60,9 @@ func (c *Connection) GetClassMethod(class ClassID, name, signature string) (Meth
 	return *method, nil
 }
 
-// WaitForClassPrepare blocks until a class with a name that matches the pattern
-// is prepared, and then returns the thread that prepared the class.
-// All threads are suspended when the method returns.
+// WaitForClassPrepare resumes all threads and blocks until a class with a name
+// that matches the pattern is prepared, and then returns the thread that
+// prepared the class. All threads are suspended when the method returns.
 func (c *Connection) WaitForClassPrepare(ctx context.Context, pattern string) (ThreadID, error) {
 	var out ThreadID
 
@@ -71,7 +71,9 @@ func (c *Connection) WaitForClassPrepare(ctx context.Context, pattern string) (T
 		return false
 	}
 
-	err := c.WatchEvents(ctx, ClassPrepare, SuspendAll, onEvent, ClassMatchEventModifier(pattern))
+	resume := func() error { return c.ResumeAll(ctx) }
+	err := c.watchEvents(ctx, ClassPrepare, SuspendAll, resume, onEvent,
+		[]EventModifier{ClassMatchEventModifier(pattern)})
 	if err != nil {
 		return 0, err
 	}
@@ -79,8 +81,8 @@ func (c *Connection) WaitForClassPrepare(ctx context.Context, pattern string) (T
 	return out, nil
 }
 
-// WaitForMethodEntry blocks until the method on class is entered, and then
-// returns the method entry event.
+// WaitForMethodEntry resumes all threads and blocks until the method on class
+// is entered, and then returns the method entry event.
 // All threads are suspended when the method returns.
 func (c *Connection) WaitForMethodEntry(ctx context.Context, class ClassID, method MethodID) (*EventMethodEntry, error) {
 	var out *EventMethodEntry
@@ -91,11 +93,13 @@ func (c *Connection) WaitForMethodEntry(ctx context.Context, class ClassID, meth
 			out = e
 			return false
 		}
-		c.ResumeAll()
+		c.ResumeAll(ctx)
 		return true
 	}
 
-	err := c.WatchEvents(ctx, MethodEntry, SuspendAll, onEvent, ClassOnlyEventModifier(class))
+	resume := func() error { return c.ResumeAll(ctx) }
+	err := c.watchEvents(ctx, MethodEntry, SuspendAll, resume, onEvent,
+		[]EventModifier{ClassOnlyEventModifier(class)})
 	if err != nil {
 		return nil, err
 	}
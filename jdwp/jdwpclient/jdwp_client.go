@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"reflect"
 	"sapelkinav/javadap/jdwp/data/binary"
 	"sapelkinav/javadap/jdwp/data/endian"
@@ -28,21 +30,81 @@ var (
 	}
 )
 
+// Connection is a JDWP connection to a VM.
+//
+// The first call to GetTypeMetadata sets a ClassUnload request to keep the
+// type cache up to date. The request stays set until the connection is
+// closed, does not appear in EventRequests and its events are not delivered
+// on the Events stream.
 type Connection struct {
 	in           io.Reader
+	conn         io.Closer
+	addr         string // The address the connection was attached to, if any.
 	r            binary.Reader
 	w            binary.Writer
 	flush        func() error
 	idSizes      IDSizes
+	capabilities Capabilities
 	nextPacketID packetID
-	events       map[EventRequestID]chan<- Event
+	requests     map[EventRequestID]*EventRequest
+	events       map[EventRequestID]*watcher // Events not sent to stream
+	queue        chan EventSet               // Input to the event stream
+	stream       chan EventSet               // Output of the event stream
 	replies      map[packetID]chan<- replyPacket
+	onReply      map[packetID]func(replyPacket)
+	types        map[ReferenceTypeID]*TypeMetadata // Cache of GetTypeMetadata
+	unloadsSet   bool                              // Set once types is invalidated on ClassUnload
+	unloads      uint64                            // Incremented whenever types is invalidated
+	timeout      time.Duration
+	closed       chan struct{} // Closed once the connection is lost
+	closeErr     error
 	sync.Mutex
 }
 
-// Open creates a Connection using conn for I/O.
+// DefaultTimeout is the default duration a Connection waits for the reply to
+// a command.
+const DefaultTimeout = time.Second * 120
+
+// DefaultHandshakeTimeout is the default duration a Connection waits for the
+// VM to answer the JDWP handshake.
+const DefaultHandshakeTimeout = time.Second * 10
+
+// DisconnectedError is the error returned by the commands that could not
+// complete because the connection to the VM was lost.
+type DisconnectedError struct {
+	Cause error // The reason the connection was lost, or nil on EOF.
+}
+
+// ErrDisconnected can be used with errors.Is to test whether an error is a
+// DisconnectedError.
+var ErrDisconnected = DisconnectedError{}
+
+func (e DisconnectedError) Error() string {
+	if e.Cause == nil {
+		return "JDWP connection closed"
+	}
+	return fmt.Sprintf("JDWP connection closed: %v", e.Cause)
+}
+
+// Unwrap returns the reason the connection was lost.
+func (e DisconnectedError) Unwrap() error { return e.Cause }
+
+// Is returns true if target is a DisconnectedError.
+func (e DisconnectedError) Is(target error) bool {
+	_, ok := target.(DisconnectedError)
+	return ok
+}
+
+// Open creates a Connection using conn for I/O. The VM must complete the
+// handshake within DefaultHandshakeTimeout.
 func Open(ctx context.Context, conn io.ReadWriteCloser) (*Connection, error) {
-	if err := exchangeHandshakes(conn); err != nil {
+	return open(ctx, conn, DefaultHandshakeTimeout)
+}
+
+// open creates a Connection using conn for I/O, once the VM has completed the
+// handshake within timeout.
+func open(ctx context.Context, conn io.ReadWriteCloser, timeout time.Duration) (*Connection, error) {
+	if err := exchangeHandshakes(conn, timeout); err != nil {
 		return nil, err
 	}
 
@@ -50,24 +112,67 @@ func Open(ctx context.Context, conn io.ReadWriteCloser) (*Connection, error) {
 	r := endian.Reader(conn, endian.BigEndian)
 	w := endian.Writer(buf, endian.BigEndian)
 	c := &Connection{
-		in:      conn,
-		r:       r,
-		w:       w,
-		flush:   buf.Flush,
-		idSizes: defaultIDSizes,
-		events:  map[EventRequestID]chan<- Event{},
-		replies: map[packetID]chan<- replyPacket{},
-	}
-	go func() { c.recv(ctx) }()
+		in:       conn,
+		conn:     conn,
+		r:        r,
+		w:        w,
+		flush:    buf.Flush,
+		idSizes:  defaultIDSizes,
+		requests: map[EventRequestID]*EventRequest{},
+		events:   map[EventRequestID]*watcher{},
+		queue:    make(chan EventSet),
+		stream:   make(chan EventSet),
+		replies:  map[packetID]chan<- replyPacket{},
+		onReply:  map[packetID]func(replyPacket){},
+		types:    map[ReferenceTypeID]*TypeMetadata{},
+		timeout:  DefaultTimeout,
+		closed:   make(chan struct{}),
+	}
+	go c.pumpEvents(ctx)
+	go func() {
+		defer close(c.queue)
+		c.disconnect(c.recv(ctx))
+	}()
+	fail := func(err error) (*Connection, error) {
+		// Closing conn stops recv, which stops pumpEvents once the events
+		// received so far are drained.
+		conn.Close()
+		for range c.stream {
+		}
+		return nil, err
+	}
 	var err error
-	c.idSizes, err = c.GetIDSizes()
+	c.idSizes, err = c.GetIDSizes(ctx)
 	if err != nil {
-		return nil, err
+		return fail(err)
+	}
+	c.capabilities, err = c.GetCapabilities(ctx)
+	if err != nil {
+		return fail(err)
 	}
 	return c, nil
 }
 
-func exchangeHandshakes(conn io.ReadWriter) error {
+// exchangeHandshakes sends the handshake and expects the VM to echo it within
+// timeout, if it is positive. Connections without deadlines are closed once
+// the timeout expires.
+func exchangeHandshakes(conn io.ReadWriteCloser, timeout time.Duration) (err error) {
+	if timeout > 0 {
+		expired := func() bool { return errors.Is(err, os.ErrDeadlineExceeded) }
+		if d, ok := conn.(deadliner); ok {
+			d.SetDeadline(time.Now().Add(timeout))
+			defer d.SetDeadline(time.Time{})
+		} else {
+			t := time.AfterFunc(timeout, func() { conn.Close() })
+			defer t.Stop()
+			expired = func() bool { return !t.Stop() }
+		}
+		defer func() {
+			if err != nil && expired() {
+				err = fmt.Errorf("JDWP handshake timed out after %v", timeout)
+			}
+		}()
+	}
 	if _, err := conn.Write(handshake); err != nil {
 		return err
 	}
@@ -81,6 +186,12 @@ func exchangeHandshakes(conn io.ReadWriter) error {
 	return nil
 }
 
+// deadliner is implemented by the connections that support deadlines, such as
+// net.Conn.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
 // expect reads c.in, expecting the specfified sequence of bytes. If the read
 // data doesn't match, then the function returns immediately with false.
 func expect(conn io.Reader, expected []byte) (bool, error) {
@@ -100,17 +211,47 @@ func expect(conn io.Reader, expected []byte) (bool, error) {
 	return true, nil
 }
 
+// SetTimeout sets the duration to wait for the reply to each command. A
+// timeout of zero or less disables the timeout, leaving the caller's context
+// as the only limit.
+func (c *Connection) SetTimeout(timeout time.Duration) {
+	c.Lock()
+	c.timeout = timeout
+	c.Unlock()
+}
+
+// Closed returns a channel that is closed once the connection to the VM is
+// lost.
+func (c *Connection) Closed() <-chan struct{} { return c.closed }
+
+// disconnect marks the connection as lost with the error err returned by recv,
+// failing all the outstanding and future commands with a DisconnectedError.
+func (c *Connection) disconnect(err error) {
+	c.Lock()
+	defer c.Unlock()
+	c.closeErr = DisconnectedError{Cause: err}
+	c.replies = map[packetID]chan<- replyPacket{}
+	c.onReply = map[packetID]func(replyPacket){}
+	close(c.closed)
+}
+
 // get sends the specified command and waits for a reply.
-func (c *Connection) get(cmd cmd, req interface{}, out interface{}) error {
-	p, err := c.req(cmd, req)
+func (c *Connection) get(ctx context.Context, cmd cmd, req interface{}, out interface{}) error {
+	return c.getWithHook(ctx, cmd, req, out, nil)
+}
+
+// getWithHook is like get, but also calls onReply from the receive goroutine
+// as soon as the reply is read, before any later packet is processed.
+func (c *Connection) getWithHook(ctx context.Context, cmd cmd, req interface{}, out interface{}, onReply func(replyPacket)) error {
+	p, err := c.req(cmd, req, onReply)
 	if err != nil {
 		return err
 	}
-	return p.wait(out)
+	return p.wait(ctx, out)
 }
 
 // req sends the specified command and returns a pending.
-func (c *Connection) req(cmd cmd, req interface{}) (*pending, error) {
+func (c *Connection) req(cmd cmd, req interface{}, onReply func(replyPacket)) (*pending, error) {
 	data := bytes.Buffer{}
 	if req != nil {
 		e := endian.Writer(&data, endian.BigEndian)
@@ -119,34 +260,48 @@ func (c *Connection) req(cmd cmd, req interface{}) (*pending, error) {
 		}
 	}
 
-	id, replyChan := c.newReplyHandler()
-
-	p := cmdPacket{id: id, cmdSet: cmd.set, cmdID: cmd.id, data: data.Bytes()}
-
 	c.Lock()
 	defer c.Unlock()
 
+	if c.closeErr != nil {
+		return nil, c.closeErr
+	}
+
+	id, replyChan := c.newReplyHandler(onReply)
+
+	p := cmdPacket{id: id, cmdSet: cmd.set, cmdID: cmd.id, data: data.Bytes()}
+
 	if err := p.write(c.w); err != nil {
+		c.forget(id)
 		return nil, err
 	}
 	if err := c.flush(); err != nil {
+		c.forget(id)
 		return nil, err
 	}
 
 	dbg("<%v> send: %v, %+v", id, cmd, req)
 
-	return &pending{c, replyChan, id}, nil
+	return &pending{c, replyChan, id, c.timeout}, nil
 }
 
 type pending struct {
-	c  *Connection
-	p  <-chan replyPacket
-	id packetID
+	c       *Connection
+	p       <-chan replyPacket
+	id      packetID
+	timeout time.Duration
 }
 
 // wait blocks until the penging response is received, filling out with the
-// response data.
-func (p *pending) wait(out interface{}) error {
+// response data. wait fails if ctx is cancelled, the connection's timeout
+// elapses or the connection is lost before the reply is received.
+func (p *pending) wait(ctx context.Context, out interface{}) error {
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 	select {
 	case reply := <-p.p:
 		if reply.err != ErrNone {
@@ -166,17 +321,39 @@ func (p *pending) wait(out interface{}) error {
 			panic(fmt.Errorf("Only %d/%d bytes read from reply packet", offset, len(reply.data)))
 		}
 		return nil
-	case <-time.After(time.Second * 120):
-		return fmt.Errorf("timeout")
+	case <-p.c.closed:
+		p.c.Lock()
+		defer p.c.Unlock()
+		return p.c.closeErr
+	case <-ctx.Done():
+		p.c.Lock()
+		p.c.forget(p.id)
+		p.c.Unlock()
+		return ctx.Err()
+	case <-timeout:
+		p.c.Lock()
+		p.c.forget(p.id)
+		p.c.Unlock()
+		return fmt.Errorf("Timeout after %v waiting for reply to packet %v", p.timeout, p.id)
 	}
 }
 
-func (c *Connection) newReplyHandler() (packetID, <-chan replyPacket) {
+// forget removes the reply handler for the packet id. A reply received later
+// is logged and dropped. c must be locked.
+func (c *Connection) forget(id packetID) {
+	delete(c.replies, id)
+	delete(c.onReply, id)
+}
+
+// newReplyHandler allocates a new packet identifier and registers the
+// channel that receives its reply. c must be locked.
+func (c *Connection) newReplyHandler(onReply func(replyPacket)) (packetID, <-chan replyPacket) {
 	reply := make(chan replyPacket, 1)
-	c.Lock()
 	id := c.nextPacketID
 	c.nextPacketID++
 	c.replies[id] = reply
-	c.Unlock()
+	if onReply != nil {
+		c.onReply[id] = onReply
+	}
 	return id, reply
 }
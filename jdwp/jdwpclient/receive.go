@@ -15,56 +15,82 @@ const REPLY_FLAG = 0x80
 // recv decodes all the incoming reply or command packets, forwarding them on
 // to the corresponding chans. recv is blocking and should be run on a new
 // go routine.
-// recv returns when ctx is stopped or there's an IO error.
-func (c *Connection) recv(ctx context.Context) {
+// recv returns when ctx is stopped or there's an IO error, returning the
+// error or nil on EOF.
+func (c *Connection) recv(ctx context.Context) error {
 	for !task.Stopped(ctx) {
 		packet, err := c.readPacket()
 		switch err {
 		case nil:
 		case io.EOF:
-			return
+			return nil
 		default:
 			if !task.Stopped(ctx) {
 				log.Warn().Err(err).Msg("Failed to read packet")
 			}
-			return
+			return err
 		}
 
 		switch packet := packet.(type) {
 		case replyPacket:
 			c.Lock()
 			out, ok := c.replies[packet.id]
+			onReply := c.onReply[packet.id]
 			delete(c.replies, packet.id)
+			delete(c.onReply, packet.id)
 			c.Unlock()
 			if !ok {
-				log.Warn().Err(err).Uint32("Unexpected reply for packet", uint32(packet.id))
+				log.Warn().Uint32("packet", uint32(packet.id)).Msg("Dropping unexpected reply")
 				continue
 			}
+			if onReply != nil {
+				onReply(packet)
+			}
 			out <- packet
 
 		case cmdPacket:
 			switch {
 			case packet.cmdSet == cmdSetEvent && packet.cmdID == cmdCompositeEvent:
 				d := endian.Reader(bytes.NewReader(packet.data), endian.BigEndian)
-				l := events{}
+				l := EventSet{}
 				if err := c.decode(d, reflect.ValueOf(&l)); err != nil {
 					log.Warn().Err(err).Msg("Couldn't decode composite event data. Error: ")
 					continue
 				}
 
+				// The events of watched requests are sent to their watchers,
+				// and the others to the event stream as one set.
+				set := EventSet{Policy: l.Policy}
 				for _, ev := range l.Events {
-					dbg("<%v> event: %T %+v", ev.request(), ev, ev)
+					dbg("<%v> event: %T %+v", ev.RequestID(), ev, ev)
+					if unload, ok := ev.(*EventClassUnload); ok {
+						c.unloaded(unload.Signature)
+					}
 
 					c.Lock()
-					handler, ok := c.events[ev.request()]
+					w, ok := c.events[ev.RequestID()]
 					c.Unlock()
 
-					if ok {
-						handler <- ev
-					} else {
-						dbg("No event handler registered for %+v", ev)
+					if !ok {
+						set.Events = append(set.Events, ev)
+						continue
+					}
+					select {
+					case w.events <- ev:
+					case <-w.done:
+						dbg("<%v> dropping event of stopped watcher", ev.RequestID())
+					case <-task.ShouldStop(ctx):
 					}
 				}
+				if len(set.Events) == 0 {
+					continue
+				}
+				// pumpEvents stops reading c.queue once ctx is stopped, and
+				// recv returns before reading the next packet.
+				select {
+				case c.queue <- set:
+				case <-task.ShouldStop(ctx):
+				}
 
 			default:
 				dbg("received unknown packet %+v", packet)
@@ -72,4 +98,34 @@ func (c *Connection) recv(ctx context.Context) {
 			}
 		}
 	}
+	return ctx.Err()
+}
+
+// pumpEvents forwards the events from c.queue to c.stream, buffering as many
+// events as needed so that recv is never blocked by a slow consumer.
+// pumpEvents closes c.stream once c.queue is closed and drained, or when ctx
+// is stopped.
+func (c *Connection) pumpEvents(ctx context.Context) {
+	defer close(c.stream)
+	pending := []EventSet{}
+	queue := c.queue
+	for queue != nil || len(pending) > 0 {
+		var out chan<- EventSet
+		var next EventSet
+		if len(pending) > 0 {
+			out, next = c.stream, pending[0]
+		}
+		select {
+		case set, ok := <-queue:
+			if !ok {
+				queue = nil
+				continue
+			}
+			pending = append(pending, set)
+		case out <- next:
+			pending = pending[1:]
+		case <-task.ShouldStop(ctx):
+			return
+		}
+	}
 }
@@ -0,0 +1,49 @@
+package jdwpclient
+
+import "fmt"
+
+// StepSize is the granularity of a single step.
+type StepSize int
+
+const (
+	// StepMin steps by the minimum possible amount, usually a bytecode
+	// instruction.
+	StepMin = StepSize(0)
+	// StepLine steps to the next source line. If there is no line number
+	// information, StepLine steps like StepMin.
+	StepLine = StepSize(1)
+)
+
+func (s StepSize) String() string {
+	switch s {
+	case StepMin:
+		return "StepMin"
+	case StepLine:
+		return "StepLine"
+	}
+	return fmt.Sprint(int(s))
+}
+
+// StepDepth describes which frames a single step may stop in.
+type StepDepth int
+
+const (
+	// StepInto steps into any method calls.
+	StepInto = StepDepth(0)
+	// StepOver steps over any method calls.
+	StepOver = StepDepth(1)
+	// StepOut steps out of the current method.
+	StepOut = StepDepth(2)
+)
+
+func (s StepDepth) String() string {
+	switch s {
+	case StepInto:
+		return "StepInto"
+	case StepOver:
+		return "StepOver"
+	case StepOut:
+		return "StepOut"
+	}
+	return fmt.Sprint(int(s))
+}
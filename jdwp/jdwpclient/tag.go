@@ -75,3 +75,13 @@ func (t Tag) String() string {
 		return fmt.Sprintf("Tag<%v>", int(t))
 	}
 }
+
+// IsPrimitive returns true if the tag is of a primitive type, or false if the
+// tag is of an object type.
+func (t Tag) IsPrimitive() bool {
+	switch t {
+	case TagByte, TagChar, TagFloat, TagDouble, TagInt, TagLong, TagShort, TagBoolean:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package jdwpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Attach dials the JDWP agent listening at addr, as "host:port", and opens a
+// Connection to it. The VM must answer the handshake within timeout, or
+// DefaultHandshakeTimeout if timeout is zero.
+//
+// The agent of a VM started with server=y accepts a new debugger once the
+// previous one has disposed its connection, which Reattach relies on.
+func Attach(ctx context.Context, addr string, timeout time.Duration) (*Connection, error) {
+	if timeout == 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	socket, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to JDWP at %v: %w", addr, err)
+	}
+	c, err := open(ctx, socket, timeout)
+	if err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("Failed to open JDWP connection to %v: %w", addr, err)
+	}
+	c.addr = addr
+	return c, nil
+}
+
+// Addr returns the address the connection was attached to, or an empty string
+// if it was not opened by Attach.
+func (c *Connection) Addr() string { return c.addr }
+
+// Reattach disposes the connection, unless it is already lost, and attaches
+// again to the VM at the same address. The returned connection replaces c,
+// which is closed.
+func (c *Connection) Reattach(ctx context.Context, timeout time.Duration) (*Connection, error) {
+	if c.addr == "" {
+		return nil, fmt.Errorf("Connection was not attached to an address")
+	}
+	select {
+	case <-c.closed:
+	default:
+		if err := c.Dispose(ctx); err != nil && !errors.Is(err, ErrDisconnected) {
+			return nil, err
+		}
+	}
+	c.Close()
+	return Attach(ctx, c.addr, timeout)
+}
+
+// Close closes the connection to the VM without disposing it. The agent
+// treats this as the debugger going away.
+func (c *Connection) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Listener accepts the connections of VMs whose JDWP agent connects to the
+// debugger, as started with
+// -agentlib:jdwp=transport=dt_socket,server=n,address=host:port.
+type Listener struct {
+	l net.Listener
+}
+
+// Listen binds addr, as "host:port", for VMs to connect to. A zero port picks
+// a free port, returned by Addr.
+func Listen(addr string) (*Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen for JDWP at %v: %w", addr, err)
+	}
+	return &Listener{l}, nil
+}
+
+// Addr returns the address the listener is bound to, as "host:port".
+func (l *Listener) Addr() string { return l.l.Addr().String() }
+
+// Accept waits for a VM to connect, until ctx is done, and opens a Connection
+// to it. The VM must answer the handshake within timeout, or
+// DefaultHandshakeTimeout if timeout is zero.
+func (l *Listener) Accept(ctx context.Context, timeout time.Duration) (*Connection, error) {
+	if timeout == 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	if d, ok := l.l.(deadliner); ok {
+		d.SetDeadline(time.Time{})
+		stop := context.AfterFunc(ctx, func() { d.SetDeadline(time.Now()) })
+		defer stop()
+	}
+	socket, err := l.l.Accept()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("No VM connected to %v: %w", l.Addr(), err)
+	}
+	c, err := open(ctx, socket, timeout)
+	if err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("Failed to open JDWP connection from %v: %w", socket.RemoteAddr(), err)
+	}
+	return c, nil
+}
+
+// Close stops listening. Connections already accepted stay open.
+func (l *Listener) Close() error { return l.l.Close() }
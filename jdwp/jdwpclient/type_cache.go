@@ -0,0 +1,128 @@
+package jdwpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// TypeMetadata holds the properties of a loaded reference type that do not
+// change until the type is unloaded, as cached by GetTypeMetadata.
+type TypeMetadata struct {
+	Signature   string
+	Modifiers   ModBits
+	ClassLoader ClassLoaderID // 0 for the bootstrap class loader.
+	ClassObject ClassObjectID
+	// SourceFile is the name of the source file declaring the type, or empty
+	// if the class file does not record it.
+	SourceFile string
+	// SourceDebugExtension is the SourceDebugExtension attribute of the type,
+	// or empty if the class file has none or the VM cannot report it.
+	SourceDebugExtension string
+}
+
+// GetTypeMetadata returns the metadata of the type, which the connection
+// caches until the type is unloaded or redefined. The status and the nested
+// types change while the type is loaded, and are not cached.
+//
+// The cache is invalidated by the ClassUnload events of every request. The
+// first call sets a ClassUnload request of its own, which does not appear in
+// EventRequests and whose events are not delivered on the Events stream.
+func (c *Connection) GetTypeMetadata(ctx context.Context, ty ReferenceTypeID) (TypeMetadata, error) {
+	c.Lock()
+	m, ok := c.types[ty]
+	unloads := c.unloads
+	c.Unlock()
+	if ok {
+		return *m, nil
+	}
+	c.watchUnloads(ctx)
+
+	m = &TypeMetadata{}
+	var err error
+	if m.Signature, err = c.GetTypeSignature(ctx, ty); err != nil {
+		return TypeMetadata{}, err
+	}
+	if m.Modifiers, err = c.GetModifiers(ctx, ty); err != nil {
+		return TypeMetadata{}, fmt.Errorf("Failed to get the modifiers of %v: %w", m.Signature, err)
+	}
+	if m.ClassLoader, err = c.GetClassLoader(ctx, ty); err != nil {
+		return TypeMetadata{}, fmt.Errorf("Failed to get the class loader of %v: %w", m.Signature, err)
+	}
+	if m.ClassObject, err = c.GetClassObject(ctx, ty); err != nil {
+		return TypeMetadata{}, fmt.Errorf("Failed to get the class object of %v: %w", m.Signature, err)
+	}
+	if m.SourceFile, err = c.GetSourceFile(ctx, ty); err != nil && err != ErrAbsentInformation {
+		return TypeMetadata{}, fmt.Errorf("Failed to get the source file of %v: %w", m.Signature, err)
+	}
+	m.SourceDebugExtension, err = c.GetSourceDebugExtension(ctx, ty)
+	if err != nil && err != ErrAbsentInformation && !errors.Is(err, ErrUnsupported) {
+		return TypeMetadata{}, fmt.Errorf("Failed to get the source debug extension of %v: %w", m.Signature, err)
+	}
+
+	c.Lock()
+	// The metadata is not cached if types were unloaded or redefined while
+	// it was read, as the type may be one of them.
+	if c.unloads == unloads {
+		c.types[ty] = m
+	}
+	c.Unlock()
+	return *m, nil
+}
+
+// watchUnloads sets the ClassUnload request that invalidates the type cache,
+// unless it is already set. Failing to set the request only leaves the cache
+// to the ClassUnload requests of the debugger.
+func (c *Connection) watchUnloads(ctx context.Context) {
+	c.Lock()
+	set := c.unloadsSet
+	c.unloadsSet = true
+	c.Unlock()
+	if set {
+		return
+	}
+
+	// recv invalidates the cache before dispatching the events, which are
+	// then dropped as the watcher is done.
+	w := &watcher{done: dropped}
+	req, err := c.setEventRequest(ctx, ClassUnload, SuspendNone, w, nil)
+	c.Lock()
+	defer c.Unlock()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to watch class unloads, cached type metadata may be stale")
+		c.unloadsSet = false
+		return
+	}
+	delete(c.requests, req.ID)
+}
+
+// dropped is the closed done channel of watchers whose events are dropped.
+var dropped = func() chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
+
+// forgetTypes removes the types from the type cache.
+func (c *Connection) forgetTypes(types ...ReferenceTypeID) {
+	c.Lock()
+	defer c.Unlock()
+	c.unloads++
+	for _, ty := range types {
+		delete(c.types, ty)
+	}
+}
+
+// unloaded removes the types with the signature from the type cache. Classes
+// with the same name may be loaded by several class loaders, and the
+// ClassUnload event does not tell which was unloaded, so all are removed.
+func (c *Connection) unloaded(signature string) {
+	c.Lock()
+	defer c.Unlock()
+	c.unloads++
+	for ty, m := range c.types {
+		if m.Signature == signature {
+			delete(c.types, ty)
+		}
+	}
+}
@@ -1,23 +1,162 @@
 package launcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sapelkinav/javadap/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
+// Config describes how to launch a Java program with the JDWP agent.
+// Exactly one of Jar, MainClass and Module selects the program to run.
+type Config struct {
+	Java string // Path to the java executable. Defaults to $JAVA_HOME/bin/java, or java on the PATH.
+
+	Jar        string   // Jar to run with -jar.
+	MainClass  string   // Main class to run from the ClassPath.
+	ClassPath  []string // Entries of -cp.
+	Module     string   // Module to run with -m, as "module" or "module/class".
+	ModulePath []string // Entries of --module-path.
+
+	VMArgs []string          // JVM options, such as "-Xmx1g" or "-Dkey=value".
+	Args   []string          // Arguments of the program.
+	Env    map[string]string // Variables added to the environment of the program.
+	Cwd    string            // Working directory, defaults to the debugger's.
+
+	Port    int  // JDWP port, or zero for a port chosen by the agent.
+	Suspend bool // Suspend the VM until the debugger attaches.
+
+	// DebuggerAddress, if set, is the "host:port" of a debugger listening for
+	// the VM. The agent then connects to it (server=n) instead of listening
+	// on Port.
+	DebuggerAddress string
+
+	// Stdout and Stderr, if set, receive a copy of the output of the program.
+	Stdout, Stderr io.Writer
+	// LogDir, if set, is the directory where the output of the program is
+	// appended to java_stdout.log and java_stderr.log.
+	LogDir string
+}
+
+// Validate checks that the configuration selects a single program to run.
+func (c Config) Validate() error {
+	n := 0
+	for _, s := range []string{c.Jar, c.MainClass, c.Module} {
+		if s != "" {
+			n++
+		}
+	}
+	switch {
+	case n == 0:
+		return fmt.Errorf("Launch requires a jar, a main class or a module")
+	case n > 1:
+		return fmt.Errorf("Launch requires only one of a jar, a main class or a module")
+	case c.Port < 0:
+		return fmt.Errorf("Invalid JDWP port %d", c.Port)
+	case c.DebuggerAddress != "" && c.Port != 0:
+		return fmt.Errorf("Launch requires only one of a JDWP port or a debugger address")
+	}
+	return nil
+}
+
+// Command returns the command that runs the program of the configuration.
+func (c Config) Command() (*exec.Cmd, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	suspend := "n"
+	if c.Suspend {
+		suspend = "y"
+	}
+	server, address := "y", strconv.Itoa(c.Port)
+	if c.DebuggerAddress != "" {
+		server, address = "n", c.DebuggerAddress
+	}
+	args := []string{fmt.Sprintf("-agentlib:jdwp=transport=dt_socket,server=%s,suspend=%s,address=%s", server, suspend, address)}
+	args = append(args, c.VMArgs...)
+	if len(c.ClassPath) > 0 {
+		args = append(args, "-cp", strings.Join(c.ClassPath, string(os.PathListSeparator)))
+	}
+	if len(c.ModulePath) > 0 {
+		args = append(args, "--module-path", strings.Join(c.ModulePath, string(os.PathListSeparator)))
+	}
+	switch {
+	case c.Jar != "":
+		args = append(args, "-jar", c.Jar)
+	case c.MainClass != "":
+		args = append(args, c.MainClass)
+	default:
+		args = append(args, "-m", c.Module)
+	}
+	args = append(args, c.Args...)
+
+	cmd := exec.Command(c.java(), args...)
+	cmd.Dir = c.Cwd
+	if len(c.Env) > 0 {
+		names := make([]string, 0, len(c.Env))
+		for name := range c.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		cmd.Env = os.Environ()
+		for _, name := range names {
+			cmd.Env = append(cmd.Env, name+"="+c.Env[name])
+		}
+	}
+	return cmd, nil
+}
+
+// java returns the java executable of the configuration.
+func (c Config) java() string {
+	if c.Java != "" {
+		return c.Java
+	}
+	home, ok := c.Env["JAVA_HOME"]
+	if !ok {
+		home = os.Getenv("JAVA_HOME")
+	}
+	if home != "" {
+		return filepath.Join(home, "bin", "java")
+	}
+	return "java"
+}
+
 type JavaLauncher struct {
-	jarPath  string
-	jdwpPort int
-	cmd      *exec.Cmd
-	logger   zerolog.Logger
+	config Config
+	cmd    *exec.Cmd
+	logs   []io.Closer
+	logger zerolog.Logger
+
+	listening sync.Once
+	ready     chan struct{} // Closed once the agent listens on port.
+	port      int
+	exited    chan struct{} // Closed once the process exits with waitErr.
+	waitErr   error
+
+	stdin io.WriteCloser
+	lines chan Line // Receives the output lines, if requested.
 }
 
+// NewJavaLauncher returns a launcher that runs the jar with the VM suspended
+// until a debugger attaches to the JDWP port.
 func NewJavaLauncher(jarPath string, jdwpPort int) *JavaLauncher {
+	return New(Config{Jar: jarPath, Port: jdwpPort, Suspend: true})
+}
+
+// New returns a launcher for the configuration.
+func New(config Config) *JavaLauncher {
 	logger, err := utils.GetComponentLogger("launcher", "java")
 	if err != nil {
 		// Fallback to global logger if component logger can't be created
@@ -25,68 +164,167 @@ func NewJavaLauncher(jarPath string, jdwpPort int) *JavaLauncher {
 	}
 
 	return &JavaLauncher{
-		jarPath:  jarPath,
-		jdwpPort: jdwpPort,
-		logger:   logger,
+		config: config,
+		logger: logger,
+		ready:  make(chan struct{}),
+		exited: make(chan struct{}),
 	}
 }
 
-func (l *JavaLauncher) Start() error {
-	// Create logs directory for Java process output
-	javaLogDir := "./.logs"
-	if err := os.MkdirAll(javaLogDir, 0755); err != nil {
-		return fmt.Errorf("failed to create Java log directory: %w", err)
+// Output returns the channel that receives the lines written by the program
+// to stdout and stderr, in the order that they are read from each stream.
+// The channel is closed once the process exits. Output must be called before
+// Start, and the channel must then be drained for the program to make
+// progress.
+func (l *JavaLauncher) Output() <-chan Line {
+	if l.lines == nil {
+		l.lines = make(chan Line, 256)
 	}
+	return l.lines
+}
 
-	// Create Java stdout and stderr log files
-	stdoutLog, err := os.OpenFile(fmt.Sprintf("%s/java_stdout.log", javaLogDir), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		return fmt.Errorf("failed to create Java stdout log file: %w", err)
-	}
+// Stdin returns the writer to the standard input of the started program.
+func (l *JavaLauncher) Stdin() io.WriteCloser { return l.stdin }
 
-	stderrLog, err := os.OpenFile(fmt.Sprintf("%s/java_stderr.log", javaLogDir), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+// Start starts the program. Use Connect to wait for its JDWP agent, unless
+// the agent connects to the DebuggerAddress.
+func (l *JavaLauncher) Start() error {
+	cmd, err := l.config.Command()
 	if err != nil {
-		stdoutLog.Close()
-		return fmt.Errorf("failed to create Java stderr log file: %w", err)
+		return err
+	}
+	// The agent announces its address on stdout or stderr, depending on the
+	// JVM.
+	stdout := &output{stream: Stdout, lines: l.lines, found: l.listen}
+	stderr := &output{stream: Stderr, lines: l.lines, found: l.listen}
+	if l.config.Stdout != nil {
+		stdout.writers = append(stdout.writers, l.config.Stdout)
+	}
+	if l.config.Stderr != nil {
+		stderr.writers = append(stderr.writers, l.config.Stderr)
+	}
+	if l.config.LogDir != "" {
+		if err := l.openLogs(stdout, stderr); err != nil {
+			return err
+		}
+	}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if l.stdin, err = cmd.StdinPipe(); err != nil {
+		l.closeLogs()
+		return err
 	}
 
 	l.logger.Info().
-		Str("jar", l.jarPath).
-		Int("jdwpPort", l.jdwpPort).
+		Strs("args", cmd.Args).
+		Str("dir", cmd.Dir).
+		Int("jdwpPort", l.config.Port).
 		Msg("Starting Java application with JDWP enabled")
 
-	// Create command with JDWP options
-	l.cmd = exec.Command(
-		"java",
-		fmt.Sprintf("-agentlib:jdwp=transport=dt_socket,server=y,suspend=y,address=%d", l.jdwpPort),
-		"-jar", l.jarPath,
-	)
-
-	// Redirect stdout and stderr to log files
-	l.cmd.Stdout = stdoutLog
-	l.cmd.Stderr = stderrLog
-
-	// Start the process
+	l.cmd = cmd
 	if err := l.cmd.Start(); err != nil {
-		stdoutLog.Close()
-		stderrLog.Close()
+		l.closeLogs()
 		return utils.LogError(l.logger, err, "Failed to start Java process")
 	}
 
 	l.logger.Info().Int("pid", l.cmd.Process.Pid).Msg("Java process started successfully")
 
-	// Allow time for JDWP to initialize
-	time.Sleep(500 * time.Millisecond)
+	go func() {
+		// Wait for the process to exit, and for its output to be copied
+		l.waitErr = l.cmd.Wait()
+		stdout.flush()
+		stderr.flush()
+		if l.lines != nil {
+			close(l.lines)
+		}
+		l.closeLogs()
+		close(l.exited)
+	}()
+	return nil
+}
+
+// listen records that the agent listens on the port.
+func (l *JavaLauncher) listen(port int) {
+	l.listening.Do(func() {
+		l.port = port
+		close(l.ready)
+	})
+}
 
+// Port returns the port of the JDWP agent, or zero if the agent is not
+// listening yet.
+func (l *JavaLauncher) Port() int {
+	select {
+	case <-l.ready:
+		return l.port
+	default:
+		return 0
+	}
+}
+
+// Connect waits for the JDWP agent of the started program to listen, and
+// returns a connection to it. It fails if the program exits first, or if the
+// agent does not listen within readyTimeout or before ctx is done.
+func (l *JavaLauncher) Connect(ctx context.Context) (net.Conn, error) {
+	if l.cmd == nil {
+		return nil, fmt.Errorf("Java process is not started")
+	}
+	if l.config.DebuggerAddress != "" {
+		return nil, fmt.Errorf("JDWP agent connects to the debugger at %v", l.config.DebuggerAddress)
+	}
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	select {
+	case <-l.ready:
+	case <-l.exited:
+		return nil, fmt.Errorf("Java process exited before the JDWP agent listened: %v", l.cmd.ProcessState)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("JDWP agent did not listen: %w", ctx.Err())
+	}
+	addr := net.JoinHostPort("localhost", strconv.Itoa(l.port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to JDWP at %v: %w", addr, err)
+	}
+	l.logger.Info().Str("address", addr).Msg("Connected to JDWP agent")
+	return conn, nil
+}
+
+// openLogs tees the outputs of the program to log files in LogDir.
+func (l *JavaLauncher) openLogs(stdout, stderr *output) error {
+	dir := l.config.LogDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create Java log directory: %w", err)
+	}
+	for _, o := range []*output{stdout, stderr} {
+		name := fmt.Sprintf("java_%v.log", o.stream)
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			l.closeLogs()
+			return fmt.Errorf("failed to create Java log file %v: %w", name, err)
+		}
+		l.logs = append(l.logs, f)
+		o.writers = append(o.writers, f)
+	}
 	return nil
 }
 
+func (l *JavaLauncher) closeLogs() {
+	for _, f := range l.logs {
+		f.Close()
+	}
+	l.logs = nil
+}
+
 func (l *JavaLauncher) Stop() error {
 	if l.cmd == nil || l.cmd.Process == nil {
 		l.logger.Info().Msg("No Java process to stop")
 		return nil
 	}
 
+	if !l.IsRunning() {
+		return nil
+	}
+
 	l.logger.Info().Int("pid", l.cmd.Process.Pid).Msg("Stopping Java process")
 
 	// Attempt graceful termination first
@@ -96,24 +334,42 @@ func (l *JavaLauncher) Stop() error {
 		err = l.cmd.Process.Kill()
 	}
 
-	// Wait for the process to exit
-	_, waitErr := l.cmd.Process.Wait()
-	if waitErr != nil {
-		l.logger.Error().Err(waitErr).Msg("Error waiting for Java process to exit")
+	select {
+	case <-l.exited:
+	case <-time.After(stopTimeout):
+		l.logger.Warn().Msg("Java process did not exit after interrupt, killing it")
+		err = l.cmd.Process.Kill()
+		<-l.exited
+	}
+	var exitErr *exec.ExitError
+	if l.waitErr != nil && !errors.As(l.waitErr, &exitErr) {
+		l.logger.Error().Err(l.waitErr).Msg("Error waiting for Java process to exit")
 	}
 
 	l.logger.Info().Msg("Java process terminated")
 	return err
 }
 
+// Exited returns a channel that is closed once the started process exits.
+func (l *JavaLauncher) Exited() <-chan struct{} { return l.exited }
+
 // IsRunning checks if the Java process is still running
 func (l *JavaLauncher) IsRunning() bool {
 	if l.cmd == nil || l.cmd.Process == nil {
 		return false
 	}
-
-	// Try to signal the process with signal 0, which doesn't actually send a signal
-	// but checks if the process exists and we have permission to signal it
-	err := l.cmd.Process.Signal(os.Signal(nil))
-	return err == nil
+	select {
+	case <-l.exited:
+		return false
+	default:
+		return true
+	}
 }
+
+const (
+	// readyTimeout is how long Connect waits for the JDWP agent to listen.
+	readyTimeout = 30 * time.Second
+	// stopTimeout is how long Stop waits for the process to exit after an
+	// interrupt before killing it.
+	stopTimeout = 5 * time.Second
+)
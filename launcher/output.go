@@ -0,0 +1,95 @@
+package launcher
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Stream identifies an output stream of the program.
+type Stream int
+
+const (
+	Stdout Stream = iota
+	Stderr
+)
+
+// String returns "stdout" or "stderr".
+func (s Stream) String() string {
+	if s == Stderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// Line is a line of output of the program, without its line terminator.
+type Line struct {
+	Stream Stream
+	Text   string
+}
+
+// agentListening matches the line printed by the JDWP agent once it listens
+// for a debugger, such as "Listening for transport dt_socket at address: 5005".
+var agentListening = regexp.MustCompile(`Listening for transport dt_socket at address: (?:\S*:)?(\d+)`)
+
+// maxLine is the length at which lines without a terminator are split.
+const maxLine = 64 * 1024
+
+// output copies an output stream of the program to the writers, and splits it
+// into lines. Lines are sent to lines, if it is not nil, and the first line
+// announcing the JDWP agent's port is reported to found.
+type output struct {
+	stream  Stream
+	writers []io.Writer
+	lines   chan<- Line
+	found   func(port int)
+	line    []byte // The incomplete last line.
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	for _, w := range o.writers {
+		if _, err := w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	for rest := p; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			o.line = append(o.line, rest...)
+			if len(o.line) >= maxLine {
+				o.emit() // Split overlong lines.
+			}
+			break
+		}
+		o.line = append(o.line, rest[:i]...)
+		rest = rest[i+1:]
+		o.emit()
+	}
+	return len(p), nil
+}
+
+// emit handles the buffered line.
+func (o *output) emit() {
+	text := strings.TrimSuffix(string(o.line), "\r")
+	o.line = o.line[:0]
+	if o.found != nil {
+		if m := agentListening.FindStringSubmatch(text); m != nil {
+			if port, err := strconv.Atoi(m[1]); err == nil {
+				o.found(port)
+				o.found = nil
+			}
+		}
+	}
+	if o.lines != nil {
+		o.lines <- Line{o.stream, text}
+	}
+}
+
+// flush handles the incomplete last line, once the stream is closed.
+func (o *output) flush() {
+	if len(o.line) > 0 {
+		o.emit()
+	}
+}
@@ -2,87 +2,69 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"github.com/rs/zerolog/log"
-	"io"
-	"net"
 	"os"
 	"os/signal"
-	"sapelkinav/javadap/jdwp/jdwpclient"
-	"sapelkinav/javadap/launcher"
+	"sapelkinav/javadap/dap"
 	"sapelkinav/javadap/utils"
 	"syscall"
-	"time"
 )
 
 const LOG_DIR = "./.logs"
 
 func main() {
-
-	if err := utils.InitializeLogger(LOG_DIR, "debug"); err != nil {
-		fmt.Printf("Failed to set up logger: %v\n", err)
-		os.Exit(1)
+	if len(os.Args) > 1 && os.Args[1] == "threaddump" {
+		// stdout carries the dump.
+		utils.ConsoleOutput = os.Stderr
+		if err := threadDump(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Thread dump failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	jarPath := "daphelloworld/build/libs/daphelloworld-0.0.1-SNAPSHOT.jar"
-	jdwpPort := 5005
+	listen := flag.String("listen", "", "Serve DAP on this TCP address instead of stdio")
+	flag.Parse()
 
-	// Launch the Java application with JDWP enabled in server mode
-	fmt.Println("Launching Java application with JDWP enabled...")
-	javaLauncher := launcher.NewJavaLauncher(jarPath, jdwpPort)
-	if err := javaLauncher.Start(); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to launch Java process: %v\n", err)
+	// stdout may carry the DAP stream, so keep the console logs off it.
+	utils.ConsoleOutput = os.Stderr
+	if err := utils.InitializeLogger(LOG_DIR, "debug"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logger: %v\n", err)
 		os.Exit(1)
 	}
-	defer javaLauncher.Stop()
-
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
-	var socket io.ReadWriteCloser
-	var err error
-	for i := 0; i < 5; i++ {
-		if socket, err = net.Dial("tcp", fmt.Sprintf("localhost:%v", jdwpPort)); err == nil {
-			break
-		}
-		time.Sleep(time.Second)
-	}
 
-	if socket == nil {
-		log.Warn().Err(err).Msg("Failed to connect to the socket. Error")
-		return
-	}
+	ctx, cancel := context.WithCancel(context.Background())
 
-	con, err := jdwpclient.Open(ctx, socket)
-	defer socket.Close()
+	done := make(chan error, 1)
+	go func() {
+		if *listen != "" {
+			done <- dap.ListenAndServe(ctx, *listen)
+		} else {
+			done <- dap.Serve(ctx, os.Stdin, os.Stdout)
+		}
+	}()
 
-	version, err := con.GetVersion()
-	if err != nil {
-		fmt.Println(version)
+	if err := gracefulShutdown(cancel, done); err != nil {
+		fmt.Fprintf(os.Stderr, "Debug adapter failed: %v\n", err)
+		os.Exit(1)
 	}
-
-	gracefulShutdown(cancel)
-
 }
 
+// gracefulShutdown blocks until either a termination signal is received or
+// the server finishes, returning the server's error.
 func gracefulShutdown(
-	cancel context.CancelFunc) {
+	cancel context.CancelFunc,
+	done <-chan error) error {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
-	running := true
-	for running {
-		select {
-		case sig := <-signalChan:
-			fmt.Printf("Received signal: %v. Shutting down gracefully...\n", sig)
-			cancel()        // Cancel context to notify all goroutines
-			running = false // Exit the loop
-		default:
-			// Do periodic work here if needed
-			// For example, check status, perform periodic tasks, etc.
-
-			// Sleep a bit to prevent CPU spinning
-			time.Sleep(100 * time.Millisecond)
-		}
+	select {
+	case sig := <-signalChan:
+		fmt.Fprintf(os.Stderr, "Received signal: %v. Shutting down gracefully...\n", sig)
+		cancel() // Cancel context to notify all goroutines
+		return nil
+	case err := <-done:
+		cancel()
+		return err
 	}
-
-	fmt.Println("Application shutdown complete")
 }
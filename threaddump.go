@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sapelkinav/javadap/jdwp/debugger"
+	"sapelkinav/javadap/jdwp/jdwpclient"
+)
+
+// threadDump runs the threaddump subcommand: it attaches to the JDWP agent at
+// the address given in args, prints the threads of the VM in the jstack
+// format or as JSON, and detaches.
+func threadDump(args []string) error {
+	flags := flag.NewFlagSet("threaddump", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print the dump as JSON")
+	timeout := flags.Duration("timeout", jdwpclient.DefaultHandshakeTimeout, "Time to wait for the JDWP handshake")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %v threaddump [flags] host:port\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("threaddump requires the address of the JDWP agent")
+	}
+
+	ctx := context.Background()
+	conn, err := jdwpclient.Attach(ctx, flags.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Detach, so that the agent accepts other debuggers.
+		conn.Dispose(ctx)
+		conn.Close()
+	}()
+	dump, err := debugger.DumpThreads(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return dump.WriteJSON(os.Stdout)
+	}
+	return dump.WriteText(os.Stdout)
+}
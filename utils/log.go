@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -26,8 +27,18 @@ var (
 	// Global configuration
 	logDir      string
 	globalLevel zerolog.Level
+
+	// ConsoleOutput is where the console writers print to. It defaults to
+	// stdout, but must be redirected when stdout carries a protocol stream.
+	ConsoleOutput io.Writer = os.Stdout
 )
 
+// consoleOutput forwards to ConsoleOutput at write time, so that loggers
+// created before the output is redirected also follow it.
+type consoleOutput struct{}
+
+func (consoleOutput) Write(p []byte) (int, error) { return ConsoleOutput.Write(p) }
+
 // InitializeLogger sets up the global logger with appropriate configuration
 func InitializeLogger(baseLogDir string, logLevel string) error {
 	// Store global configuration
@@ -68,7 +79,7 @@ func InitializeLogger(baseLogDir string, logLevel string) error {
 
 	// Create console writer for stdout with colors
 	consoleWriter := zerolog.ConsoleWriter{
-		Out:        os.Stdout,
+		Out:        consoleOutput{},
 		TimeFormat: time.RFC3339,
 		PartsOrder: []string{
 			zerolog.TimestampFieldName,
@@ -157,7 +168,7 @@ func GetModuleLogger(moduleName string) (zerolog.Logger, error) {
 
 	// Create console writer
 	consoleWriter := zerolog.ConsoleWriter{
-		Out:        os.Stdout,
+		Out:        consoleOutput{},
 		TimeFormat: time.RFC3339,
 		PartsOrder: []string{
 			zerolog.TimestampFieldName,